@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Handler only serves the requests of HTTP callers presenting a bearer
+// token granted a scope, and fails the others with 401 or 403.
+func (t *Tokens) Handler(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := t.Authorize(r.Header.Get(AuthorizationHeader), scope)
+		if err != nil {
+			fields := logrus.Fields{
+				"path":   r.URL.Path,
+				"remote": r.RemoteAddr,
+			}
+			if token != nil {
+				fields["token"] = token.ID
+			}
+			log.WithFields(fields).WithError(err).Warn("Denied HTTP request")
+			if errors.Is(err, ErrForbidden) {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), token)))
+	})
+}
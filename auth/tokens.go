@@ -0,0 +1,298 @@
+/*
+Package auth authenticates the callers of the remote signer APIs with bearer
+tokens, for deployments which cannot issue TLS client certificates. Only the
+SHA-256 hashes of the tokens are stored, in a JSON file:
+
+	{
+	  "tokens": [
+	    {"id": "validator-a", "sha256": "9f86...", "scopes": ["sign", "list"], "public_keys": ["0x..."]},
+	    {"id": "operator", "sha256": "60303...", "scopes": ["admin", "metrics"]}
+	  ]
+	}
+
+Each token is granted scopes, and may be restricted to the public keys of an
+allowlist. The file is reloaded when it changes, or on demand such as on
+SIGHUP, so that tokens are rotated without restarting the server.
+*/
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.WithField("prefix", "auth")
+
+// DefaultPollInterval is how often the token file is checked for changes.
+const DefaultPollInterval = 10 * time.Second
+
+// Scopes granted to tokens.
+const (
+	// ScopeSign allows signing with the remote signer API.
+	ScopeSign = "sign"
+	// ScopeList allows listing the public keys of the remote signer API.
+	ScopeList = "list"
+	// ScopeAdmin allows calling the admin API.
+	ScopeAdmin = "admin"
+	// ScopeMetrics allows scraping the metrics over HTTP.
+	ScopeMetrics = "metrics"
+)
+
+var knownScopes = map[string]bool{
+	ScopeSign:    true,
+	ScopeList:    true,
+	ScopeAdmin:   true,
+	ScopeMetrics: true,
+}
+
+// AuthorizationHeader is the header, or gRPC metadata key, carrying the token.
+const AuthorizationHeader = "authorization"
+
+const bearerPrefix = "Bearer "
+
+var (
+	// ErrUnauthenticated is returned for missing, unknown or malformed tokens.
+	ErrUnauthenticated = errors.New("invalid bearer token")
+	// ErrForbidden is returned when a token lacks a scope, or is not allowed a key.
+	ErrForbidden = errors.New("token is not allowed")
+)
+
+// File is the token file, as read from disk.
+type File struct {
+	Tokens []*TokenEntry `json:"tokens"`
+}
+
+// TokenEntry describes a token of the token file.
+type TokenEntry struct {
+	// ID identifies the token in logs, it is not secret.
+	ID string `json:"id"`
+	// SHA256 is the hex encoded SHA-256 hash of the token.
+	SHA256 string   `json:"sha256"`
+	Scopes []string `json:"scopes"`
+	// PublicKeys, if set, are the only keys the token may sign with or list.
+	PublicKeys []string `json:"public_keys,omitempty"`
+}
+
+// Token is an authenticated token.
+type Token struct {
+	ID     string
+	scopes map[string]bool
+	// keys is nil if the token may use every key.
+	keys map[[48]byte]bool
+}
+
+// HasScope tells whether the token was granted a scope.
+func (t *Token) HasScope(scope string) bool {
+	return t.scopes[scope]
+}
+
+// AllowsKey tells whether the token may sign with or list a public key.
+func (t *Token) AllowsKey(pubKey []byte) bool {
+	if t.keys == nil {
+		return true
+	}
+	var key [48]byte
+	if len(pubKey) != len(key) {
+		return false
+	}
+	copy(key[:], pubKey)
+	return t.keys[key]
+}
+
+// Tokens authenticates bearer tokens against the hashes of a token file.
+type Tokens struct {
+	path         string
+	pollInterval time.Duration
+	lock         sync.RWMutex
+	byHash       map[[sha256.Size]byte]*Token
+	modTime      time.Time
+}
+
+// Load reads a token file, failing if it is invalid.
+func Load(path string) (*Tokens, error) {
+	t := &Tokens{
+		path:         path,
+		pollInterval: DefaultPollInterval,
+	}
+	if err := t.Reload(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Reload reads the token file again, and swaps in its tokens at once.
+// On error, the previous tokens are kept.
+func (t *Tokens) Reload() error {
+	info, err := os.Stat(t.path)
+	if err != nil {
+		return errors.Wrapf(err, "could not stat token file %s", t.path)
+	}
+	enc, err := ioutil.ReadFile(t.path)
+	if err != nil {
+		return errors.Wrapf(err, "could not read token file %s", t.path)
+	}
+	f := &File{}
+	if err := json.Unmarshal(enc, f); err != nil {
+		return errors.Wrapf(err, "could not parse token file %s", t.path)
+	}
+	byHash, err := parseTokens(f.Tokens)
+	if err != nil {
+		return errors.Wrapf(err, "invalid token file %s", t.path)
+	}
+	t.lock.Lock()
+	t.byHash = byHash
+	t.modTime = info.ModTime()
+	t.lock.Unlock()
+	log.WithFields(logrus.Fields{
+		"path":      t.path,
+		"numTokens": len(byHash),
+	}).Info("Loaded bearer tokens")
+	return nil
+}
+
+func parseTokens(entries []*TokenEntry) (map[[sha256.Size]byte]*Token, error) {
+	byHash := make(map[[sha256.Size]byte]*Token, len(entries))
+	ids := make(map[string]bool, len(entries))
+	for i, e := range entries {
+		if e.ID == "" {
+			return nil, errors.Errorf("token %d has no id", i)
+		}
+		if ids[e.ID] {
+			return nil, errors.Errorf("duplicate token %s", e.ID)
+		}
+		ids[e.ID] = true
+		raw, err := hex.DecodeString(strings.TrimPrefix(e.SHA256, "0x"))
+		if err != nil || len(raw) != sha256.Size {
+			return nil, errors.Errorf("invalid sha256 hash of token %s", e.ID)
+		}
+		var hash [sha256.Size]byte
+		copy(hash[:], raw)
+		if _, ok := byHash[hash]; ok {
+			return nil, errors.Errorf("token %s has the same hash as another token", e.ID)
+		}
+		token := &Token{ID: e.ID, scopes: make(map[string]bool, len(e.Scopes))}
+		for _, scope := range e.Scopes {
+			if !knownScopes[scope] {
+				return nil, errors.Errorf("unknown scope %s of token %s", scope, e.ID)
+			}
+			token.scopes[scope] = true
+		}
+		if len(e.PublicKeys) > 0 {
+			token.keys = make(map[[48]byte]bool, len(e.PublicKeys))
+			for _, hexKey := range e.PublicKeys {
+				raw, err := hex.DecodeString(strings.TrimPrefix(hexKey, "0x"))
+				if err != nil || len(raw) != 48 {
+					return nil, errors.Errorf("invalid public key %s of token %s", hexKey, e.ID)
+				}
+				var key [48]byte
+				copy(key[:], raw)
+				token.keys[key] = true
+			}
+		}
+		byHash[hash] = token
+	}
+	return byHash, nil
+}
+
+// Run polls the token file for changes, reloading it when it changes,
+// until the context is done.
+func (t *Tokens) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(t.path)
+			if err != nil {
+				log.WithError(err).Debug("Could not check token file for changes")
+				continue
+			}
+			t.lock.RLock()
+			changed := !info.ModTime().Equal(t.modTime)
+			t.lock.RUnlock()
+			if !changed {
+				continue
+			}
+			if err := t.Reload(); err != nil {
+				log.WithError(err).Error("Could not reload bearer tokens, keeping the previous ones")
+			}
+		}
+	}
+}
+
+// Authenticate returns the token of an authorization header value of the
+// form "Bearer <token>", or an error wrapping ErrUnauthenticated.
+func (t *Tokens) Authenticate(authorization string) (*Token, error) {
+	if !strings.HasPrefix(authorization, bearerPrefix) {
+		return nil, errors.Wrap(ErrUnauthenticated, "expected a bearer token")
+	}
+	hash := sha256.Sum256([]byte(strings.TrimPrefix(authorization, bearerPrefix)))
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	// Hashes are compared in constant time, so that the time taken
+	// does not reveal how close a guess is to a known hash.
+	var found *Token
+	for h, token := range t.byHash {
+		if subtle.ConstantTimeCompare(h[:], hash[:]) == 1 {
+			found = token
+		}
+	}
+	if found == nil {
+		return nil, ErrUnauthenticated
+	}
+	return found, nil
+}
+
+// Authorize authenticates an authorization header value, and checks that
+// its token was granted a scope. It returns an error wrapping
+// ErrUnauthenticated or ErrForbidden otherwise.
+func (t *Tokens) Authorize(authorization, scope string) (*Token, error) {
+	token, err := t.Authenticate(authorization)
+	if err != nil {
+		return nil, err
+	}
+	if !token.HasScope(scope) {
+		return token, errors.Wrapf(ErrForbidden, "token %s lacks scope %s", token.ID, scope)
+	}
+	return token, nil
+}
+
+// Generate returns a new random token and the hex encoded SHA-256 hash to
+// store in the token file.
+func Generate() (token, hash string, err error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", errors.Wrap(err, "could not generate token")
+	}
+	token = hex.EncodeToString(raw)
+	sum := sha256.Sum256([]byte(token))
+	return token, hex.EncodeToString(sum[:]), nil
+}
+
+// tokenKey is the context key of the authenticated token of a request.
+type tokenKey struct{}
+
+// NewContext returns a context carrying the authenticated token of a request.
+func NewContext(ctx context.Context, token *Token) context.Context {
+	return context.WithValue(ctx, tokenKey{}, token)
+}
+
+// FromContext returns the authenticated token of a request, if any.
+func FromContext(ctx context.Context) (*Token, bool) {
+	token, ok := ctx.Value(tokenKey{}).(*Token)
+	return token, ok
+}
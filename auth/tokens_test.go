@@ -0,0 +1,204 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func writeTokenFile(t *testing.T, path string, entries ...*TokenEntry) {
+	enc, err := json.Marshal(&File{Tokens: entries})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, enc, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func tokenFile(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	})
+	return filepath.Join(dir, "tokens.json")
+}
+
+func TestTokens_Authorize(t *testing.T) {
+	signer, signerHash, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	operator, operatorHash, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	allowed := [48]byte{1}
+	path := tokenFile(t)
+	writeTokenFile(t, path,
+		&TokenEntry{
+			ID:         "validator-a",
+			SHA256:     signerHash,
+			Scopes:     []string{ScopeSign, ScopeList},
+			PublicKeys: []string{fmt.Sprintf("%#x", allowed)},
+		},
+		&TokenEntry{ID: "operator", SHA256: operatorHash, Scopes: []string{ScopeAdmin}},
+	)
+	tokens, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := tokens.Authorize("Bearer "+signer, ScopeSign)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.ID != "validator-a" {
+		t.Errorf("Wanted token validator-a, received %s", token.ID)
+	}
+	if !token.AllowsKey(allowed[:]) {
+		t.Error("Wanted allowed key")
+	}
+	other := [48]byte{2}
+	if token.AllowsKey(other[:]) {
+		t.Error("Wanted other key not allowed")
+	}
+	if _, err := tokens.Authorize("Bearer "+signer, ScopeAdmin); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Wanted %v, received %v", ErrForbidden, err)
+	}
+	token, err = tokens.Authorize("Bearer "+operator, ScopeAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !token.AllowsKey(other[:]) {
+		t.Error("Wanted every key allowed without an allowlist")
+	}
+	for _, authorization := range []string{"", signer, "Bearer wrong", "Basic " + signer} {
+		if _, err := tokens.Authorize(authorization, ScopeSign); !errors.Is(err, ErrUnauthenticated) {
+			t.Errorf("Wanted %v for %q, received %v", ErrUnauthenticated, authorization, err)
+		}
+	}
+}
+
+func TestTokens_Reload(t *testing.T) {
+	first, firstHash, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, secondHash, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := tokenFile(t)
+	writeTokenFile(t, path, &TokenEntry{ID: "first", SHA256: firstHash, Scopes: []string{ScopeSign}})
+	tokens, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeTokenFile(t, path, &TokenEntry{ID: "second", SHA256: secondHash, Scopes: []string{ScopeSign}})
+	if err := tokens.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tokens.Authenticate("Bearer " + first); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("Wanted rotated token revoked, received %v", err)
+	}
+	if _, err := tokens.Authenticate("Bearer " + second); err != nil {
+		t.Errorf("Wanted new token accepted, received %v", err)
+	}
+
+	writeTokenFile(t, path, &TokenEntry{ID: "bad", SHA256: secondHash, Scopes: []string{"everything"}})
+	if err := tokens.Reload(); err == nil {
+		t.Error("Wanted error reloading an unknown scope, received nil")
+	}
+	if _, err := tokens.Authenticate("Bearer " + second); err != nil {
+		t.Errorf("Wanted previous tokens kept, received %v", err)
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	_, hash, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		entries []*TokenEntry
+	}{
+		{name: "no id", entries: []*TokenEntry{{SHA256: hash}}},
+		{name: "duplicate id", entries: []*TokenEntry{{ID: "a", SHA256: hash}, {ID: "a", SHA256: hash}}},
+		{name: "duplicate hash", entries: []*TokenEntry{{ID: "a", SHA256: hash}, {ID: "b", SHA256: hash}}},
+		{name: "invalid hash", entries: []*TokenEntry{{ID: "a", SHA256: "0x01"}}},
+		{name: "invalid key", entries: []*TokenEntry{{ID: "a", SHA256: hash, PublicKeys: []string{"0x01"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := tokenFile(t)
+			writeTokenFile(t, path, tt.entries...)
+			if _, err := Load(path); err == nil {
+				t.Error("Wanted error, received nil")
+			}
+		})
+	}
+}
+
+func TestTokens_Handler(t *testing.T) {
+	scraper, scraperHash, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, signerHash, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := tokenFile(t)
+	writeTokenFile(t, path,
+		&TokenEntry{ID: "prometheus", SHA256: scraperHash, Scopes: []string{ScopeMetrics}},
+		&TokenEntry{ID: "validator", SHA256: signerHash, Scopes: []string{ScopeSign}},
+	)
+	tokens, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := tokens.Handler(ScopeMetrics, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := FromContext(r.Context())
+		if !ok {
+			t.Error("Expected token in request context")
+		}
+		fmt.Fprint(w, token.ID)
+	}))
+	tests := []struct {
+		name  string
+		token string
+		code  int
+	}{
+		{name: "scraper", token: scraper, code: http.StatusOK},
+		{name: "signer", token: signer, code: http.StatusForbidden},
+		{name: "no token", code: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tt.token != "" {
+				req.Header.Set(AuthorizationHeader, "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.code {
+				t.Errorf("Wanted status %d, received %d", tt.code, rec.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+/*
+Package certs serves the TLS certificate of the server from files which are
+reloaded whenever they change, so that certificates are rotated without
+restarting the server and missing slots. The certificate, its key and the
+optional CA of client certificates are polled for changes, and reloaded
+on demand such as on SIGHUP. A certificate, key or CA which fails to load
+is logged and the previous one is kept serving.
+*/
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.WithField("prefix", "certs")
+
+// Defaults of the reloader.
+const (
+	DefaultPollInterval  = 10 * time.Second
+	DefaultExpiryWarning = 7 * 24 * time.Hour
+)
+
+// expiryReminder is how often the upcoming expiry of a certificate is
+// logged again after the warning of its load.
+const expiryReminder = 24 * time.Hour
+
+var (
+	certificateExpiry = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "remote_signer_tls_certificate_expiry_timestamp_seconds",
+		Help: "Unix time at which the TLS certificate served by the server expires.",
+	})
+	reloadsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "remote_signer_tls_reloads_total",
+			Help: "Number of TLS certificate reloads, by result.",
+		},
+		[]string{"result"},
+	)
+)
+
+// Config options of the reloader.
+type Config struct {
+	CertPath string
+	KeyPath  string
+	// ClientCAPath, if set, requires clients to present a certificate
+	// signed by one of the CA certificates of the file.
+	ClientCAPath string
+	// PollInterval is how often files are checked for changes.
+	PollInterval time.Duration
+	// ExpiryWarning is how long before the expiry of the certificate
+	// warnings are logged.
+	ExpiryWarning time.Duration
+}
+
+// Reloader holds the current TLS certificate and client CA of the server.
+type Reloader struct {
+	cfg      Config
+	lock     sync.RWMutex
+	cert     *tls.Certificate
+	clientCA *x509.CertPool
+	notAfter time.Time
+	// modTimes are the modification times of the files last loaded, or
+	// which last failed to load.
+	modTimes map[string]time.Time
+	// warnedAt is when the expiry of the certificate was last logged.
+	warnedAt time.Time
+	now      func() time.Time
+}
+
+// NewReloader loads the certificate, key and client CA of the configuration,
+// failing if any of them cannot be loaded.
+func NewReloader(cfg *Config) (*Reloader, error) {
+	r := &Reloader{
+		cfg: *cfg,
+		now: time.Now,
+	}
+	if r.cfg.PollInterval == 0 {
+		r.cfg.PollInterval = DefaultPollInterval
+	}
+	if r.cfg.ExpiryWarning == 0 {
+		r.cfg.ExpiryWarning = DefaultExpiryWarning
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the certificate, key and client CA from their files, and
+// swaps them in at once. On error, the previous ones are kept, and the files
+// are not polled for reload again until they change.
+func (r *Reloader) Reload() error {
+	modTimes, err := r.stat()
+	if err != nil {
+		reloadsTotal.WithLabelValues("failure").Inc()
+		return err
+	}
+	r.lock.Lock()
+	r.modTimes = modTimes
+	r.lock.Unlock()
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertPath, r.cfg.KeyPath)
+	if err != nil {
+		reloadsTotal.WithLabelValues("failure").Inc()
+		return errors.Wrap(err, "could not load TLS certificate and key")
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		reloadsTotal.WithLabelValues("failure").Inc()
+		return errors.Wrap(err, "could not parse TLS certificate")
+	}
+	cert.Leaf = leaf
+	var clientCA *x509.CertPool
+	if r.cfg.ClientCAPath != "" {
+		enc, err := ioutil.ReadFile(r.cfg.ClientCAPath)
+		if err != nil {
+			reloadsTotal.WithLabelValues("failure").Inc()
+			return errors.Wrapf(err, "could not read client CA %s", r.cfg.ClientCAPath)
+		}
+		clientCA = x509.NewCertPool()
+		if !clientCA.AppendCertsFromPEM(enc) {
+			reloadsTotal.WithLabelValues("failure").Inc()
+			return errors.Errorf("no CA certificate found in %s", r.cfg.ClientCAPath)
+		}
+	}
+
+	r.lock.Lock()
+	r.cert = &cert
+	r.clientCA = clientCA
+	r.notAfter = leaf.NotAfter
+	r.warnedAt = time.Time{}
+	r.lock.Unlock()
+
+	reloadsTotal.WithLabelValues("success").Inc()
+	certificateExpiry.Set(float64(leaf.NotAfter.Unix()))
+	log.WithFields(logrus.Fields{
+		"crt-path": r.cfg.CertPath,
+		"key-path": r.cfg.KeyPath,
+		"subject":  leaf.Subject.String(),
+		"notAfter": leaf.NotAfter,
+	}).Info("Loaded TLS certificate")
+	r.checkExpiry()
+	return nil
+}
+
+// Run polls the files for changes, reloading them when they change, and
+// warns about the upcoming expiry of the certificate, until the context is done.
+func (r *Reloader) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if r.changed() {
+				if err := r.Reload(); err != nil {
+					log.WithError(err).Error("Could not reload TLS certificate, serving the previous one")
+				}
+				continue
+			}
+			r.checkExpiry()
+		}
+	}
+}
+
+// GetCertificate returns the current certificate, as a tls.Config callback.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.cert, nil
+}
+
+// TLSConfig returns a server TLS configuration serving the current
+// certificate, and verifying client certificates against the current
+// client CA if one is configured.
+func (r *Reloader) TLSConfig() *tls.Config {
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+	}
+	if r.cfg.ClientCAPath != "" {
+		cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.lock.RLock()
+			defer r.lock.RUnlock()
+			return &tls.Config{
+				MinVersion:     tls.VersionTLS12,
+				GetCertificate: r.GetCertificate,
+				ClientAuth:     tls.RequireAndVerifyClientCert,
+				ClientCAs:      r.clientCA,
+			}, nil
+		}
+	}
+	return cfg
+}
+
+// NotAfter returns the expiry of the current certificate.
+func (r *Reloader) NotAfter() time.Time {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.notAfter
+}
+
+// checkExpiry warns when the certificate expires soon, or has expired,
+// once when it is loaded and then every expiryReminder.
+func (r *Reloader) checkExpiry() {
+	notAfter, remaining, due := r.expiryWarningDue()
+	if !due {
+		return
+	}
+	fields := logrus.Fields{
+		"crt-path": r.cfg.CertPath,
+		"notAfter": notAfter,
+	}
+	switch {
+	case remaining <= 0:
+		log.WithFields(fields).Error("TLS certificate has expired")
+	default:
+		log.WithFields(fields).WithField("remaining", remaining.Round(time.Minute)).Warn("TLS certificate expires soon")
+	}
+}
+
+// expiryWarningDue returns the expiry of the certificate and the time
+// remaining until then, and whether a warning about it is due, in which
+// case it is recorded as logged.
+func (r *Reloader) expiryWarningDue() (time.Time, time.Duration, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	now := r.now()
+	remaining := r.notAfter.Sub(now)
+	if remaining > r.cfg.ExpiryWarning {
+		return r.notAfter, remaining, false
+	}
+	if !r.warnedAt.IsZero() && now.Sub(r.warnedAt) < expiryReminder {
+		return r.notAfter, remaining, false
+	}
+	r.warnedAt = now
+	return r.notAfter, remaining, true
+}
+
+// changed tells whether any file was modified since it was last loaded, or
+// failed to load.
+func (r *Reloader) changed() bool {
+	modTimes, err := r.stat()
+	if err != nil {
+		// Files are often replaced in several steps, try again on the next tick.
+		log.WithError(err).Debug("Could not check TLS files for changes")
+		return false
+	}
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	for path, modTime := range modTimes {
+		if !modTime.Equal(r.modTimes[path]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Reloader) stat() (map[string]time.Time, error) {
+	paths := []string{r.cfg.CertPath, r.cfg.KeyPath}
+	if r.cfg.ClientCAPath != "" {
+		paths = append(paths, r.cfg.ClientCAPath)
+	}
+	modTimes := make(map[string]time.Time, len(paths))
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not stat %s", path)
+		}
+		modTimes[path] = info.ModTime()
+	}
+	return modTimes, nil
+}
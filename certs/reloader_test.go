@@ -0,0 +1,212 @@
+package certs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCertificate writes a self-signed certificate and its key, valid until notAfter.
+func writeCertificate(t *testing.T, certPath, keyPath, name string, notAfter time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := ioutil.WriteFile(certPath, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "certs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	})
+	return dir
+}
+
+func currentName(t *testing.T, r *Reloader) string {
+	cert, err := r.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.Leaf.Subject.CommonName
+}
+
+func TestReloader_Reload(t *testing.T) {
+	dir := tempDir(t)
+	certPath, keyPath := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	writeCertificate(t, certPath, keyPath, "first", time.Now().Add(30*24*time.Hour))
+	r, err := NewReloader(&Config{CertPath: certPath, KeyPath: keyPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := currentName(t, r); name != "first" {
+		t.Errorf("Wanted certificate first, received %s", name)
+	}
+
+	writeCertificate(t, certPath, keyPath, "second", time.Now().Add(60*24*time.Hour))
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if name := currentName(t, r); name != "second" {
+		t.Errorf("Wanted certificate second, received %s", name)
+	}
+
+	if err := ioutil.WriteFile(keyPath, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reload(); err == nil {
+		t.Error("Wanted error reloading an invalid key, received nil")
+	}
+	if name := currentName(t, r); name != "second" {
+		t.Errorf("Wanted previous certificate kept, received %s", name)
+	}
+}
+
+func TestReloader_Run(t *testing.T) {
+	dir := tempDir(t)
+	certPath, keyPath := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	writeCertificate(t, certPath, keyPath, "first", time.Now().Add(24*time.Hour))
+	r, err := NewReloader(&Config{CertPath: certPath, KeyPath: keyPath, PollInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx)
+
+	// Some filesystems only record modification times to the second.
+	time.Sleep(1100 * time.Millisecond)
+	notAfter := time.Now().Add(90 * 24 * time.Hour).Truncate(time.Second)
+	writeCertificate(t, certPath, keyPath, "second", notAfter)
+	deadline := time.Now().Add(5 * time.Second)
+	for currentName(t, r) != "second" {
+		if time.Now().After(deadline) {
+			t.Fatal("Certificate was not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !r.NotAfter().Equal(notAfter) {
+		t.Errorf("Wanted expiry %v, received %v", notAfter, r.NotAfter())
+	}
+}
+
+func TestReloader_ExpiryWarning(t *testing.T) {
+	dir := tempDir(t)
+	certPath, keyPath := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	writeCertificate(t, certPath, keyPath, "server", time.Now().Add(3*24*time.Hour))
+	r, err := NewReloader(&Config{CertPath: certPath, KeyPath: keyPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	// The load warned already, polls only remind of the expiry daily.
+	if _, _, due := r.expiryWarningDue(); due {
+		t.Error("Wanted no warning right after the load")
+	}
+	now = now.Add(23 * time.Hour)
+	if _, _, due := r.expiryWarningDue(); due {
+		t.Error("Wanted no warning within a day of the last one")
+	}
+	now = now.Add(2 * time.Hour)
+	if _, _, due := r.expiryWarningDue(); !due {
+		t.Error("Wanted a daily warning")
+	}
+	if _, _, due := r.expiryWarningDue(); due {
+		t.Error("Wanted a single daily warning")
+	}
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, due := r.expiryWarningDue(); due {
+		t.Error("Wanted no warning right after the reload warned")
+	}
+}
+
+func TestReloader_FailedReloadNotRetried(t *testing.T) {
+	dir := tempDir(t)
+	certPath, keyPath := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	writeCertificate(t, certPath, keyPath, "first", time.Now().Add(30*24*time.Hour))
+	r, err := NewReloader(&Config{CertPath: certPath, KeyPath: keyPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyPath, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(keyPath, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if !r.changed() {
+		t.Fatal("Wanted the modified key detected")
+	}
+	if err := r.Reload(); err == nil {
+		t.Fatal("Wanted error reloading an invalid key, received nil")
+	}
+	// Polls retry once the files change again, not on every tick.
+	if r.changed() {
+		t.Error("Wanted the key which failed to load not reloaded again")
+	}
+	writeCertificate(t, certPath, keyPath, "second", time.Now().Add(30*24*time.Hour))
+	later := future.Add(time.Hour)
+	if err := os.Chtimes(keyPath, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if !r.changed() {
+		t.Error("Wanted the replaced key detected")
+	}
+}
+
+func TestNewReloader_InvalidClientCA(t *testing.T) {
+	dir := tempDir(t)
+	certPath, keyPath := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	writeCertificate(t, certPath, keyPath, "server", time.Now().Add(24*time.Hour))
+	caPath := filepath.Join(dir, "ca.crt")
+	if err := ioutil.WriteFile(caPath, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewReloader(&Config{CertPath: certPath, KeyPath: keyPath, ClientCAPath: caPath}); err == nil {
+		t.Error("Wanted error loading an invalid client CA, received nil")
+	}
+}
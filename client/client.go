@@ -0,0 +1,382 @@
+/*
+Package client is a Go client of the remote signer. It signs typed consensus
+objects, computing their signing roots locally, and fails over between
+several remote signer endpoints, such as the members of a signer cluster,
+retrying with backoff while they are unavailable. Signatures can optionally
+be verified against the public key before being returned.
+*/
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	emptypb "github.com/golang/protobuf/ptypes/empty"
+	"github.com/pkg/errors"
+	types "github.com/prysmaticlabs/eth2-types"
+	"github.com/prysmaticlabs/prysm/crypto/bls"
+	ethpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1"
+	validatorpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1/validator-client"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+var log = logrus.WithField("prefix", "client")
+
+// Defaults of the client configuration.
+const (
+	DefaultMaxAttempts    = 5
+	DefaultInitialBackoff = 100 * time.Millisecond
+	DefaultMaxBackoff     = 2 * time.Second
+	DefaultSlotsPerEpoch  = 32
+)
+
+var (
+	// ErrDenied is returned when the remote signer refuses to sign a request,
+	// such as a slashable one. Denied requests are never retried.
+	ErrDenied = errors.New("signing request denied")
+	// ErrInvalidSignature is returned when a signature does not verify against the public key.
+	ErrInvalidSignature = errors.New("invalid signature returned by the remote signer")
+)
+
+// Config options of the client.
+type Config struct {
+	// Endpoints are the host:port addresses of the remote signers, tried in order.
+	Endpoints []string
+	// Credentials secure the connections, see TLSCredentials and MutualTLSCredentials.
+	Credentials credentials.TransportCredentials
+	// Token, if set, is sent as a bearer token with every call, see TokenCredentials.
+	Token string
+	// DialOptions are appended to the options of every connection.
+	DialOptions []grpc.DialOption
+	// MaxAttempts bounds the number of calls made for a request, across endpoints.
+	MaxAttempts int
+	// InitialBackoff is the delay before retrying once every endpoint failed,
+	// doubled on each round up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// VerifySignatures verifies every signature against the public key.
+	VerifySignatures bool
+	// ForkInfo is the network the typed helpers compute signing roots for.
+	ForkInfo *ForkInfo
+	// SlotsPerEpoch of the network, to compute the epoch of a slot.
+	SlotsPerEpoch uint64
+}
+
+// Client of one or more remote signer endpoints.
+type Client struct {
+	cfg     *Config
+	conns   []*grpc.ClientConn
+	signers []validatorpb.RemoteSignerClient
+	lock    sync.Mutex
+	// current is the index of the endpoint which last answered.
+	current int
+}
+
+// New connects to the remote signer endpoints. Connections are established
+// in the background, and retried as needed.
+func New(cfg *Config) (*Client, error) {
+	if len(cfg.Endpoints) == 0 {
+		return nil, errors.New("expected at least one remote signer endpoint")
+	}
+	if cfg.Credentials == nil {
+		return nil, errors.New("expected transport credentials, remote signers only accept TLS connections")
+	}
+	var conns []*grpc.ClientConn
+	var signers []validatorpb.RemoteSignerClient
+	for _, endpoint := range cfg.Endpoints {
+		opts := []grpc.DialOption{grpc.WithTransportCredentials(cfg.Credentials)}
+		if cfg.Token != "" {
+			opts = append(opts, grpc.WithPerRPCCredentials(TokenCredentials(cfg.Token)))
+		}
+		opts = append(opts, cfg.DialOptions...)
+		conn, err := grpc.Dial(endpoint, opts...)
+		if err != nil {
+			for _, conn := range conns {
+				if closeErr := conn.Close(); closeErr != nil {
+					log.WithError(closeErr).Error("Could not close remote signer connection")
+				}
+			}
+			return nil, errors.Wrapf(err, "could not dial remote signer %s", endpoint)
+		}
+		conns = append(conns, conn)
+		signers = append(signers, validatorpb.NewRemoteSignerClient(conn))
+	}
+	c := newClient(cfg, signers)
+	c.conns = conns
+	return c, nil
+}
+
+// newClient instantiates a client of remote signers, one per endpoint.
+func newClient(cfg *Config, signers []validatorpb.RemoteSignerClient) *Client {
+	if cfg.MaxAttempts == 0 {
+		cfg.MaxAttempts = DefaultMaxAttempts
+	}
+	if cfg.InitialBackoff == 0 {
+		cfg.InitialBackoff = DefaultInitialBackoff
+	}
+	if cfg.MaxBackoff == 0 {
+		cfg.MaxBackoff = DefaultMaxBackoff
+	}
+	if cfg.SlotsPerEpoch == 0 {
+		cfg.SlotsPerEpoch = DefaultSlotsPerEpoch
+	}
+	return &Client{cfg: cfg, signers: signers}
+}
+
+// Close every connection.
+func (c *Client) Close() error {
+	var firstErr error
+	for _, conn := range c.conns {
+		if err := conn.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// ListValidatingPublicKeys returns the public keys the remote signer can sign with.
+func (c *Client) ListValidatingPublicKeys(ctx context.Context) ([][]byte, error) {
+	var keys [][]byte
+	err := c.call(ctx, func(ctx context.Context, signer validatorpb.RemoteSignerClient) error {
+		res, err := signer.ListValidatingPublicKeys(ctx, &emptypb.Empty{})
+		if err != nil {
+			return err
+		}
+		keys = res.ValidatingPublicKeys
+		return nil
+	})
+	return keys, err
+}
+
+// Sign sends a sign request as is, and returns the signature. It fails
+// with ErrDenied if the remote signer refuses to sign the request.
+func (c *Client) Sign(ctx context.Context, req *validatorpb.SignRequest) (bls.Signature, error) {
+	var res *validatorpb.SignResponse
+	err := c.call(ctx, func(ctx context.Context, signer validatorpb.RemoteSignerClient) error {
+		var err error
+		res, err = signer.Sign(ctx, req)
+		return err
+	})
+	if status.Code(err) == codes.PermissionDenied {
+		return nil, errors.Wrap(ErrDenied, status.Convert(err).Message())
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch res.Status {
+	case validatorpb.SignResponse_SUCCEEDED:
+	case validatorpb.SignResponse_DENIED:
+		return nil, ErrDenied
+	default:
+		return nil, errors.Errorf("signing failed with status %s", res.Status)
+	}
+	sig, err := bls.SignatureFromBytes(res.Signature)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not parse signature")
+	}
+	if c.cfg.VerifySignatures {
+		pubKey, err := bls.PublicKeyFromBytes(req.PublicKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not parse public key")
+		}
+		if !sig.Verify(pubKey, req.SigningRoot) {
+			return nil, ErrInvalidSignature
+		}
+	}
+	return sig, nil
+}
+
+// SignBlock signs a phase 0 beacon block.
+func (c *Client) SignBlock(ctx context.Context, pubKey []byte, block *ethpb.BeaconBlock) (bls.Signature, error) {
+	root, err := block.HashTreeRoot()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not compute block root")
+	}
+	return c.signObject(ctx, pubKey, root, DomainBeaconProposer, c.epochAt(block.Slot), &validatorpb.SignRequest{
+		Object: &validatorpb.SignRequest_Block{Block: block},
+	})
+}
+
+// SignBlockAltair signs an Altair beacon block.
+func (c *Client) SignBlockAltair(ctx context.Context, pubKey []byte, block *ethpb.BeaconBlockAltair) (bls.Signature, error) {
+	root, err := block.HashTreeRoot()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not compute block root")
+	}
+	return c.signObject(ctx, pubKey, root, DomainBeaconProposer, c.epochAt(block.Slot), &validatorpb.SignRequest{
+		Object: &validatorpb.SignRequest_BlockV2{BlockV2: block},
+	})
+}
+
+// SignAttestation signs attestation data.
+func (c *Client) SignAttestation(ctx context.Context, pubKey []byte, data *ethpb.AttestationData) (bls.Signature, error) {
+	if data.Target == nil {
+		return nil, errors.New("expected attestation target")
+	}
+	root, err := data.HashTreeRoot()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not compute attestation data root")
+	}
+	return c.signObject(ctx, pubKey, root, DomainBeaconAttester, data.Target.Epoch, &validatorpb.SignRequest{
+		Object: &validatorpb.SignRequest_AttestationData{AttestationData: data},
+	})
+}
+
+// SignAggregateAndProof signs an aggregate attestation and its selection proof.
+func (c *Client) SignAggregateAndProof(
+	ctx context.Context, pubKey []byte, agg *ethpb.AggregateAttestationAndProof,
+) (bls.Signature, error) {
+	if agg.Aggregate == nil || agg.Aggregate.Data == nil {
+		return nil, errors.New("expected aggregate attestation data")
+	}
+	root, err := agg.HashTreeRoot()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not compute aggregate and proof root")
+	}
+	epoch := c.epochAt(agg.Aggregate.Data.Slot)
+	return c.signObject(ctx, pubKey, root, DomainAggregateAndProof, epoch, &validatorpb.SignRequest{
+		Object: &validatorpb.SignRequest_AggregateAttestationAndProof{AggregateAttestationAndProof: agg},
+	})
+}
+
+// SignSelectionProof signs a slot, selecting the validator as an aggregator.
+func (c *Client) SignSelectionProof(ctx context.Context, pubKey []byte, slot types.Slot) (bls.Signature, error) {
+	return c.signObject(ctx, pubKey, uint64Root(uint64(slot)), DomainSelectionProof, c.epochAt(slot), &validatorpb.SignRequest{
+		Object: &validatorpb.SignRequest_Slot{Slot: slot},
+	})
+}
+
+// SignRandaoReveal signs an epoch, as the randao reveal of a block proposal.
+func (c *Client) SignRandaoReveal(ctx context.Context, pubKey []byte, epoch types.Epoch) (bls.Signature, error) {
+	return c.signObject(ctx, pubKey, uint64Root(uint64(epoch)), DomainRandao, epoch, &validatorpb.SignRequest{
+		Object: &validatorpb.SignRequest_Epoch{Epoch: epoch},
+	})
+}
+
+// SignExit signs a voluntary exit.
+func (c *Client) SignExit(ctx context.Context, pubKey []byte, exit *ethpb.VoluntaryExit) (bls.Signature, error) {
+	root, err := exit.HashTreeRoot()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not compute voluntary exit root")
+	}
+	return c.signObject(ctx, pubKey, root, DomainVoluntaryExit, exit.Epoch, &validatorpb.SignRequest{
+		Object: &validatorpb.SignRequest_Exit{Exit: exit},
+	})
+}
+
+// SignSyncCommitteeMessage signs the block root of a sync committee message
+// at a slot, which sets the domain of the signature but is not sent to the signer.
+func (c *Client) SignSyncCommitteeMessage(
+	ctx context.Context, pubKey []byte, slot types.Slot, blockRoot []byte,
+) (bls.Signature, error) {
+	if len(blockRoot) != 32 {
+		return nil, errors.New("expected a 32 byte block root")
+	}
+	var root [32]byte
+	copy(root[:], blockRoot)
+	return c.signObject(ctx, pubKey, root, DomainSyncCommittee, c.epochAt(slot), &validatorpb.SignRequest{
+		Object: &validatorpb.SignRequest_SyncMessageBlockRoot{SyncMessageBlockRoot: blockRoot},
+	})
+}
+
+// SignSyncAggregatorSelection signs a slot and subcommittee, selecting the
+// validator as a sync committee aggregator.
+func (c *Client) SignSyncAggregatorSelection(
+	ctx context.Context, pubKey []byte, data *ethpb.SyncAggregatorSelectionData,
+) (bls.Signature, error) {
+	root, err := data.HashTreeRoot()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not compute sync aggregator selection data root")
+	}
+	return c.signObject(ctx, pubKey, root, DomainSyncCommitteeSelectionProof, c.epochAt(data.Slot), &validatorpb.SignRequest{
+		Object: &validatorpb.SignRequest_SyncAggregatorSelectionData{SyncAggregatorSelectionData: data},
+	})
+}
+
+// SignContributionAndProof signs a sync committee contribution and its selection proof.
+func (c *Client) SignContributionAndProof(
+	ctx context.Context, pubKey []byte, contribution *ethpb.ContributionAndProof,
+) (bls.Signature, error) {
+	if contribution.Contribution == nil {
+		return nil, errors.New("expected sync committee contribution")
+	}
+	root, err := contribution.HashTreeRoot()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not compute contribution and proof root")
+	}
+	epoch := c.epochAt(contribution.Contribution.Slot)
+	return c.signObject(ctx, pubKey, root, DomainContributionAndProof, epoch, &validatorpb.SignRequest{
+		Object: &validatorpb.SignRequest_ContributionAndProof{ContributionAndProof: contribution},
+	})
+}
+
+// signObject computes the signing root of an object in its domain, and signs it.
+func (c *Client) signObject(
+	ctx context.Context,
+	pubKey []byte,
+	objectRoot [32]byte,
+	domainType DomainType,
+	epoch types.Epoch,
+	req *validatorpb.SignRequest,
+) (bls.Signature, error) {
+	if c.cfg.ForkInfo == nil {
+		return nil, errors.New("expected fork info to compute signing roots")
+	}
+	domain, err := c.cfg.ForkInfo.Domain(domainType, epoch)
+	if err != nil {
+		return nil, err
+	}
+	signingRoot, err := SigningRoot(objectRoot, domain)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not compute signing root")
+	}
+	req.PublicKey = pubKey
+	req.SigningRoot = signingRoot[:]
+	req.SignatureDomain = domain
+	return c.Sign(ctx, req)
+}
+
+func (c *Client) epochAt(slot types.Slot) types.Epoch {
+	return types.Epoch(uint64(slot) / c.cfg.SlotsPerEpoch)
+}
+
+// call runs a request against the endpoints, starting with the one which
+// last answered. Unavailable endpoints are failed over, and once every
+// endpoint failed the request is retried after an exponential backoff.
+func (c *Client) call(ctx context.Context, fn func(context.Context, validatorpb.RemoteSignerClient) error) error {
+	c.lock.Lock()
+	start := c.current
+	c.lock.Unlock()
+	backoff := c.cfg.InitialBackoff
+	var err error
+	for attempt := 0; attempt < c.cfg.MaxAttempts; attempt++ {
+		if attempt > 0 && attempt%len(c.signers) == 0 {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return errors.Wrap(ctx.Err(), err.Error())
+			}
+			backoff *= 2
+			if backoff > c.cfg.MaxBackoff {
+				backoff = c.cfg.MaxBackoff
+			}
+		}
+		i := (start + attempt) % len(c.signers)
+		err = fn(ctx, c.signers[i])
+		if status.Code(err) != codes.Unavailable {
+			if err == nil {
+				c.lock.Lock()
+				c.current = i
+				c.lock.Unlock()
+			}
+			return err
+		}
+		log.WithError(err).WithField("endpoint", c.cfg.Endpoints[i]).Debug("Remote signer unavailable")
+	}
+	return err
+}
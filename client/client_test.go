@@ -0,0 +1,247 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	emptypb "github.com/golang/protobuf/ptypes/empty"
+	"github.com/pkg/errors"
+	types "github.com/prysmaticlabs/eth2-types"
+	"github.com/prysmaticlabs/prysm/crypto/bls"
+	ethpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1"
+	validatorpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1/validator-client"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// mockSigner signs every request with a key, unless it returns err.
+type mockSigner struct {
+	secretKey bls.SecretKey
+	err       error
+	// wrongRoot signs another root than the requested one.
+	wrongRoot bool
+	calls     int
+	last      *validatorpb.SignRequest
+}
+
+func (m *mockSigner) ListValidatingPublicKeys(
+	context.Context, *emptypb.Empty, ...grpc.CallOption,
+) (*validatorpb.ListPublicKeysResponse, error) {
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &validatorpb.ListPublicKeysResponse{
+		ValidatingPublicKeys: [][]byte{m.secretKey.PublicKey().Marshal()},
+	}, nil
+}
+
+func (m *mockSigner) Sign(_ context.Context, req *validatorpb.SignRequest, _ ...grpc.CallOption) (*validatorpb.SignResponse, error) {
+	m.calls++
+	m.last = req
+	if m.err != nil {
+		return nil, m.err
+	}
+	root := req.SigningRoot
+	if m.wrongRoot {
+		root = make([]byte, 32)
+	}
+	return &validatorpb.SignResponse{
+		Signature: m.secretKey.Sign(root).Marshal(),
+		Status:    validatorpb.SignResponse_SUCCEEDED,
+	}, nil
+}
+
+func testClient(t *testing.T, signers ...*mockSigner) *Client {
+	cfg := &Config{
+		InitialBackoff:   time.Millisecond,
+		VerifySignatures: true,
+		ForkInfo: &ForkInfo{
+			Fork: &ethpb.Fork{
+				PreviousVersion: []byte{0, 0, 0, 0},
+				CurrentVersion:  []byte{1, 0, 0, 0},
+				Epoch:           10,
+			},
+			GenesisValidatorsRoot: make([]byte, 32),
+		},
+	}
+	clients := make([]validatorpb.RemoteSignerClient, len(signers))
+	for i, s := range signers {
+		cfg.Endpoints = append(cfg.Endpoints, "signer")
+		clients[i] = s
+	}
+	return newClient(cfg, clients)
+}
+
+func randKey(t *testing.T) bls.SecretKey {
+	secretKey, err := bls.RandKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return secretKey
+}
+
+func attestationData() *ethpb.AttestationData {
+	return &ethpb.AttestationData{
+		Slot:            320,
+		BeaconBlockRoot: make([]byte, 32),
+		Source:          &ethpb.Checkpoint{Epoch: 9, Root: make([]byte, 32)},
+		Target:          &ethpb.Checkpoint{Epoch: 10, Root: make([]byte, 32)},
+	}
+}
+
+func TestClient_Failover(t *testing.T) {
+	ctx := context.Background()
+	secretKey := randKey(t)
+	down := &mockSigner{err: status.Error(codes.Unavailable, "Not the leader of the remote signer cluster")}
+	up := &mockSigner{secretKey: secretKey}
+	c := testClient(t, down, up)
+
+	pubKey := secretKey.PublicKey().Marshal()
+	sig, err := c.SignAttestation(ctx, pubKey, attestationData())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sig.Verify(secretKey.PublicKey(), up.last.SigningRoot) {
+		t.Error("Wanted signature of the signing root")
+	}
+	domain, err := c.cfg.ForkInfo.Domain(DomainBeaconAttester, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(up.last.SignatureDomain) != string(domain) {
+		t.Errorf("Wanted domain %#x, received %#x", domain, up.last.SignatureDomain)
+	}
+	// The endpoint which answered is tried first from now on.
+	if _, err := c.ListValidatingPublicKeys(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if down.calls != 1 || up.calls != 2 {
+		t.Errorf("Wanted 1 and 2 calls, received %d and %d", down.calls, up.calls)
+	}
+}
+
+func TestClient_RetriesWithBackoff(t *testing.T) {
+	down := &mockSigner{err: status.Error(codes.Unavailable, "unavailable")}
+	c := testClient(t, down)
+	c.cfg.MaxAttempts = 3
+	_, err := c.ListValidatingPublicKeys(context.Background())
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("Wanted Unavailable, received %v", err)
+	}
+	if down.calls != 3 {
+		t.Errorf("Wanted 3 attempts, received %d", down.calls)
+	}
+}
+
+func TestClient_DeniedIsNotRetried(t *testing.T) {
+	secretKey := randKey(t)
+	denying := &mockSigner{err: status.Error(codes.PermissionDenied, "Slashing protection: double vote")}
+	other := &mockSigner{secretKey: secretKey}
+	c := testClient(t, denying, other)
+	_, err := c.SignAttestation(context.Background(), secretKey.PublicKey().Marshal(), attestationData())
+	if !errors.Is(err, ErrDenied) {
+		t.Errorf("Wanted %v, received %v", ErrDenied, err)
+	}
+	if other.calls != 0 {
+		t.Errorf("Wanted no call to the other signer, received %d", other.calls)
+	}
+}
+
+func TestClient_VerifySignature(t *testing.T) {
+	secretKey := randKey(t)
+	c := testClient(t, &mockSigner{secretKey: secretKey, wrongRoot: true})
+	_, err := c.SignExit(context.Background(), secretKey.PublicKey().Marshal(), &ethpb.VoluntaryExit{Epoch: 12})
+	if !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Wanted %v, received %v", ErrInvalidSignature, err)
+	}
+}
+
+func TestClient_SyncCommitteeHelpers(t *testing.T) {
+	ctx := context.Background()
+	secretKey := randKey(t)
+	signer := &mockSigner{secretKey: secretKey}
+	c := testClient(t, signer)
+	pubKey := secretKey.PublicKey().Marshal()
+	slot := types.Slot(10*DefaultSlotsPerEpoch + 1)
+	tests := []struct {
+		name       string
+		domainType DomainType
+		sign       func() (bls.Signature, error)
+	}{
+		{
+			name:       "sync committee message",
+			domainType: DomainSyncCommittee,
+			sign: func() (bls.Signature, error) {
+				return c.SignSyncCommitteeMessage(ctx, pubKey, slot, make([]byte, 32))
+			},
+		},
+		{
+			name:       "sync aggregator selection",
+			domainType: DomainSyncCommitteeSelectionProof,
+			sign: func() (bls.Signature, error) {
+				return c.SignSyncAggregatorSelection(ctx, pubKey, &ethpb.SyncAggregatorSelectionData{Slot: slot, SubcommitteeIndex: 1})
+			},
+		},
+		{
+			name:       "contribution and proof",
+			domainType: DomainContributionAndProof,
+			sign: func() (bls.Signature, error) {
+				return c.SignContributionAndProof(ctx, pubKey, &ethpb.ContributionAndProof{
+					Contribution: &ethpb.SyncCommitteeContribution{
+						Slot:            slot,
+						BlockRoot:       make([]byte, 32),
+						AggregationBits: make([]byte, 16),
+						Signature:       make([]byte, 96),
+					},
+					SelectionProof: make([]byte, 96),
+				})
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.sign(); err != nil {
+				t.Fatal(err)
+			}
+			// The domain is the one of the epoch of the slot, after the fork.
+			domain, err := c.cfg.ForkInfo.Domain(tt.domainType, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(signer.last.SignatureDomain) != string(domain) {
+				t.Errorf("Wanted domain %#x, received %#x", domain, signer.last.SignatureDomain)
+			}
+		})
+	}
+	if _, err := c.SignSyncCommitteeMessage(ctx, pubKey, slot, make([]byte, 31)); err == nil {
+		t.Error("Wanted error for a short block root")
+	}
+}
+
+func TestForkInfo_Domain(t *testing.T) {
+	f := &ForkInfo{
+		Fork: &ethpb.Fork{
+			PreviousVersion: []byte{0, 0, 0, 0},
+			CurrentVersion:  []byte{1, 0, 0, 0},
+			Epoch:           10,
+		},
+		GenesisValidatorsRoot: make([]byte, 32),
+	}
+	before, err := f.Domain(DomainRandao, 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := f.Domain(DomainRandao, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(before[:4]) != string(DomainRandao[:]) || len(before) != 32 {
+		t.Errorf("Wanted a 32 byte domain starting with the domain type, received %#x", before)
+	}
+	if string(before) == string(after) {
+		t.Error("Wanted different domains before and after the fork")
+	}
+}
@@ -0,0 +1,71 @@
+package client
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+	types "github.com/prysmaticlabs/eth2-types"
+	ethpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1"
+)
+
+// DomainType identifies the kind of message a signature is for, as defined
+// by the consensus specification.
+type DomainType [4]byte
+
+// Domain types of the messages signed by validators.
+var (
+	DomainBeaconProposer    = DomainType{0x00, 0x00, 0x00, 0x00}
+	DomainBeaconAttester    = DomainType{0x01, 0x00, 0x00, 0x00}
+	DomainRandao            = DomainType{0x02, 0x00, 0x00, 0x00}
+	DomainVoluntaryExit     = DomainType{0x04, 0x00, 0x00, 0x00}
+	DomainSelectionProof    = DomainType{0x05, 0x00, 0x00, 0x00}
+	DomainAggregateAndProof = DomainType{0x06, 0x00, 0x00, 0x00}
+
+	DomainSyncCommittee               = DomainType{0x07, 0x00, 0x00, 0x00}
+	DomainSyncCommitteeSelectionProof = DomainType{0x08, 0x00, 0x00, 0x00}
+	DomainContributionAndProof        = DomainType{0x09, 0x00, 0x00, 0x00}
+)
+
+// ForkInfo is the fork schedule and genesis of the network signatures are for.
+type ForkInfo struct {
+	Fork                  *ethpb.Fork
+	GenesisValidatorsRoot []byte
+}
+
+// versionAt returns the fork version in effect at an epoch.
+func (f *ForkInfo) versionAt(epoch types.Epoch) []byte {
+	if epoch < f.Fork.Epoch {
+		return f.Fork.PreviousVersion
+	}
+	return f.Fork.CurrentVersion
+}
+
+// Domain computes the signature domain of a domain type at an epoch.
+func (f *ForkInfo) Domain(domainType DomainType, epoch types.Epoch) ([]byte, error) {
+	if f == nil || f.Fork == nil || len(f.GenesisValidatorsRoot) != 32 {
+		return nil, errors.New("expected a fork and a 32 byte genesis validators root")
+	}
+	forkDataRoot, err := (&ethpb.ForkData{
+		CurrentVersion:        f.versionAt(epoch),
+		GenesisValidatorsRoot: f.GenesisValidatorsRoot,
+	}).HashTreeRoot()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not compute fork data root")
+	}
+	return append(domainType[:], forkDataRoot[:28]...), nil
+}
+
+// SigningRoot computes the root signed for an object root in a domain.
+func SigningRoot(objectRoot [32]byte, domain []byte) ([32]byte, error) {
+	return (&ethpb.SigningData{
+		ObjectRoot: objectRoot[:],
+		Domain:     domain,
+	}).HashTreeRoot()
+}
+
+// uint64Root returns the hash tree root of an SSZ uint64.
+func uint64Root(v uint64) [32]byte {
+	var root [32]byte
+	binary.LittleEndian.PutUint64(root[:8], v)
+	return root
+}
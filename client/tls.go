@@ -0,0 +1,81 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/local"
+)
+
+// TLSCredentials returns transport credentials verifying the server
+// certificate against the CA at caPath. The expected server name defaults
+// to the host of each endpoint when empty.
+func TLSCredentials(caPath, serverName string) (credentials.TransportCredentials, error) {
+	pool, err := loadCertPool(caPath)
+	if err != nil {
+		return nil, err
+	}
+	return credentials.NewTLS(&tls.Config{
+		RootCAs:    pool,
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS12,
+	}), nil
+}
+
+// MutualTLSCredentials returns transport credentials verifying the server
+// certificate like TLSCredentials, and presenting a client certificate.
+func MutualTLSCredentials(caPath, certPath, keyPath, serverName string) (credentials.TransportCredentials, error) {
+	pool, err := loadCertPool(caPath)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not load client certificate")
+	}
+	return credentials.NewTLS(&tls.Config{
+		RootCAs:      pool,
+		Certificates: []tls.Certificate{cert},
+		ServerName:   serverName,
+		MinVersion:   tls.VersionTLS12,
+	}), nil
+}
+
+// LocalCredentials returns transport credentials without TLS, for
+// endpoints on a Unix domain socket such as unix:///run/remote-signer.sock.
+func LocalCredentials() credentials.TransportCredentials {
+	return local.NewCredentials()
+}
+
+// TokenCredentials returns per-RPC credentials sending a bearer token,
+// for servers authenticating their callers with tokens. The token is
+// never sent over connections without transport security.
+func TokenCredentials(token string) credentials.PerRPCCredentials {
+	return tokenCredentials(token)
+}
+
+type tokenCredentials string
+
+func (t tokenCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+func (t tokenCredentials) RequireTransportSecurity() bool {
+	return true
+}
+
+func loadCertPool(caPath string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(caPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read CA certificate %s", caPath)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.Errorf("no certificate found in %s", caPath)
+	}
+	return pool, nil
+}
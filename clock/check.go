@@ -0,0 +1,111 @@
+package clock
+
+import (
+	"math"
+
+	"github.com/pkg/errors"
+	types "github.com/prysmaticlabs/eth2-types"
+	ethpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1"
+	validatorpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1/validator-client"
+)
+
+// DefaultMaxFutureSlots is how many slots ahead of the wall clock sign requests may be.
+const DefaultMaxFutureSlots = 2
+
+// ErrFutureSlot is returned for sign requests too far ahead of the wall clock.
+var ErrFutureSlot = errors.New("sign request is too far ahead of the wall clock")
+
+// CheckSignRequest returns an error wrapping ErrFutureSlot if a block,
+// attestation, aggregation or sync committee sign request is for a slot more
+// than maxFutureSlots after the current slot. Such requests come from a
+// validator client with a bad clock or a beacon node feeding far future data,
+// and signing them would poison the slashing protection history. Attestations
+// are checked against the start of their target epoch as well as their slot,
+// and target epochs starting after the last slot are denied. Sync committee
+// messages, which only carry a block root, and other objects without a slot
+// of their own are checked against the signing slot of the request.
+func (c *Clock) CheckSignRequest(req *validatorpb.SignRequest, maxFutureSlots types.Slot) error {
+	slot, ok, err := c.requestSlot(req)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		slot = req.SigningSlot
+	}
+	current := c.CurrentSlot()
+	if slot > current && slot-current > maxFutureSlots {
+		return errors.Wrapf(ErrFutureSlot, "slot %d is more than %d slots after current slot %d", slot, maxFutureSlots, current)
+	}
+	return nil
+}
+
+// requestSlot returns the latest slot a sign request is for, if it has one.
+func (c *Clock) requestSlot(req *validatorpb.SignRequest) (types.Slot, bool, error) {
+	switch o := req.Object.(type) {
+	case *validatorpb.SignRequest_Block:
+		if o.Block == nil {
+			return 0, false, nil
+		}
+		return o.Block.Slot, true, nil
+	case *validatorpb.SignRequest_BlockV2:
+		if o.BlockV2 == nil {
+			return 0, false, nil
+		}
+		return o.BlockV2.Slot, true, nil
+	case *validatorpb.SignRequest_AttestationData:
+		if o.AttestationData == nil {
+			return 0, false, nil
+		}
+		slot, err := c.attestationSlot(o.AttestationData)
+		return slot, true, err
+	case *validatorpb.SignRequest_AggregateAttestationAndProof:
+		agg := o.AggregateAttestationAndProof
+		if agg == nil || agg.Aggregate == nil || agg.Aggregate.Data == nil {
+			return 0, false, nil
+		}
+		slot, err := c.attestationSlot(agg.Aggregate.Data)
+		return slot, true, err
+	case *validatorpb.SignRequest_Slot:
+		return o.Slot, true, nil
+	case *validatorpb.SignRequest_SyncAggregatorSelectionData:
+		if o.SyncAggregatorSelectionData == nil {
+			return 0, false, nil
+		}
+		return o.SyncAggregatorSelectionData.Slot, true, nil
+	case *validatorpb.SignRequest_ContributionAndProof:
+		cp := o.ContributionAndProof
+		if cp == nil || cp.Contribution == nil {
+			return 0, false, nil
+		}
+		return cp.Contribution.Slot, true, nil
+	default:
+		return 0, false, nil
+	}
+}
+
+// attestationSlot returns the latest of the slot of attestation data and
+// the first slot of its target epoch.
+func (c *Clock) attestationSlot(data *ethpb.AttestationData) (types.Slot, error) {
+	slot := data.Slot
+	if data.Target == nil {
+		return slot, nil
+	}
+	start, err := c.epochStart(data.Target.Epoch)
+	if err != nil {
+		return 0, err
+	}
+	if start > slot {
+		slot = start
+	}
+	return slot, nil
+}
+
+// epochStart returns the first slot of an epoch, or an error wrapping
+// ErrFutureSlot for epochs starting after the last slot, whose first slot
+// would otherwise wrap around to a past slot.
+func (c *Clock) epochStart(epoch types.Epoch) (types.Slot, error) {
+	if uint64(epoch) > math.MaxUint64/c.slotsPerEpoch {
+		return 0, errors.Wrapf(ErrFutureSlot, "epoch %d starts after the last slot", epoch)
+	}
+	return types.Slot(uint64(epoch) * c.slotsPerEpoch), nil
+}
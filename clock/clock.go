@@ -0,0 +1,69 @@
+/*
+Package clock computes the current eth2 slot and epoch from the wall clock,
+given the genesis time of the chain and its slot duration.
+*/
+package clock
+
+import (
+	"time"
+
+	types "github.com/prysmaticlabs/eth2-types"
+)
+
+// Mainnet defaults for the duration of slots and epochs.
+const (
+	DefaultSecondsPerSlot = 12
+	DefaultSlotsPerEpoch  = 32
+)
+
+// Clock tells the current slot and epoch of a chain.
+type Clock struct {
+	genesis        time.Time
+	secondsPerSlot uint64
+	slotsPerEpoch  uint64
+	now            func() time.Time
+}
+
+// New instantiates a clock for a chain started at genesis.
+func New(genesis time.Time, secondsPerSlot, slotsPerEpoch uint64) *Clock {
+	return NewWithTimeSource(genesis, secondsPerSlot, slotsPerEpoch, time.Now)
+}
+
+// NewWithTimeSource instantiates a clock reading the time from now, which is useful in tests.
+func NewWithTimeSource(genesis time.Time, secondsPerSlot, slotsPerEpoch uint64, now func() time.Time) *Clock {
+	return &Clock{
+		genesis:        genesis,
+		secondsPerSlot: secondsPerSlot,
+		slotsPerEpoch:  slotsPerEpoch,
+		now:            now,
+	}
+}
+
+// CurrentSlot returns the current slot, or 0 before genesis.
+func (c *Clock) CurrentSlot() types.Slot {
+	now := c.now()
+	if now.Before(c.genesis) {
+		return 0
+	}
+	return types.Slot(uint64(now.Sub(c.genesis).Seconds()) / c.secondsPerSlot)
+}
+
+// CurrentEpoch returns the current epoch, or 0 before genesis.
+func (c *Clock) CurrentEpoch() types.Epoch {
+	return c.EpochAt(c.CurrentSlot())
+}
+
+// EpochAt returns the epoch of a slot.
+func (c *Clock) EpochAt(slot types.Slot) types.Epoch {
+	return types.Epoch(uint64(slot) / c.slotsPerEpoch)
+}
+
+// SlotsPerEpoch returns the number of slots in an epoch.
+func (c *Clock) SlotsPerEpoch() uint64 {
+	return c.slotsPerEpoch
+}
+
+// SlotDuration returns the duration of a slot.
+func (c *Clock) SlotDuration() time.Duration {
+	return time.Duration(c.secondsPerSlot) * time.Second
+}
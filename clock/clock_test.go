@@ -0,0 +1,101 @@
+package clock
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	types "github.com/prysmaticlabs/eth2-types"
+	ethpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1"
+	validatorpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1/validator-client"
+)
+
+func TestClock_CurrentSlotAndEpoch(t *testing.T) {
+	genesis := time.Unix(1606824023, 0)
+	now := genesis
+	c := NewWithTimeSource(genesis, 12, 32, func() time.Time { return now })
+
+	if c.CurrentSlot() != 0 || c.CurrentEpoch() != 0 {
+		t.Errorf("Wanted slot 0 at genesis, received %d", c.CurrentSlot())
+	}
+	now = genesis.Add(-time.Hour)
+	if c.CurrentSlot() != 0 {
+		t.Errorf("Wanted slot 0 before genesis, received %d", c.CurrentSlot())
+	}
+	now = genesis.Add(12*time.Second*65 + 5*time.Second)
+	if c.CurrentSlot() != types.Slot(65) {
+		t.Errorf("Wanted slot 65, received %d", c.CurrentSlot())
+	}
+	if c.CurrentEpoch() != types.Epoch(2) {
+		t.Errorf("Wanted epoch 2, received %d", c.CurrentEpoch())
+	}
+}
+
+func TestClock_CheckSignRequest(t *testing.T) {
+	genesis := time.Unix(1606824023, 0)
+	now := genesis.Add(12 * time.Second * 100)
+	c := NewWithTimeSource(genesis, 12, 32, func() time.Time { return now })
+
+	block := func(slot types.Slot) *validatorpb.SignRequest {
+		return &validatorpb.SignRequest{
+			Object: &validatorpb.SignRequest_Block{Block: &ethpb.BeaconBlock{Slot: slot}},
+		}
+	}
+	attestation := func(slot types.Slot, target types.Epoch) *validatorpb.SignRequest {
+		return &validatorpb.SignRequest{
+			Object: &validatorpb.SignRequest_AttestationData{AttestationData: &ethpb.AttestationData{
+				Slot:   slot,
+				Target: &ethpb.Checkpoint{Epoch: target},
+			}},
+		}
+	}
+	syncMessage := func(slot types.Slot) *validatorpb.SignRequest {
+		return &validatorpb.SignRequest{
+			Object:      &validatorpb.SignRequest_SyncMessageBlockRoot{SyncMessageBlockRoot: make([]byte, 32)},
+			SigningSlot: slot,
+		}
+	}
+	tests := []struct {
+		name    string
+		req     *validatorpb.SignRequest
+		allowed bool
+	}{
+		{name: "current block", req: block(100), allowed: true},
+		{name: "past block", req: block(1), allowed: true},
+		{name: "block within tolerance", req: block(102), allowed: true},
+		{name: "far future block", req: block(103)},
+		{name: "current attestation", req: attestation(100, 3), allowed: true},
+		{name: "far future target", req: attestation(100, 1000)},
+		{name: "far future attestation slot", req: attestation(200, 3)},
+		// The first slot of these targets would wrap around to slot 0.
+		{name: "target starting after the last slot", req: attestation(100, types.Epoch(math.MaxUint64/32+1))},
+		{name: "target at the last epoch", req: attestation(100, types.Epoch(math.MaxUint64/32))},
+		{name: "max target epoch", req: attestation(100, math.MaxUint64)},
+		{
+			name:    "exit",
+			req:     &validatorpb.SignRequest{Object: &validatorpb.SignRequest_Exit{Exit: &ethpb.VoluntaryExit{Epoch: 1000}}},
+			allowed: true,
+		},
+		{name: "current sync committee message", req: syncMessage(100), allowed: true},
+		{name: "far future sync committee message", req: syncMessage(103)},
+		{
+			name: "exit at far future signing slot",
+			req: &validatorpb.SignRequest{
+				Object:      &validatorpb.SignRequest_Exit{Exit: &ethpb.VoluntaryExit{Epoch: 1}},
+				SigningSlot: 200,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := c.CheckSignRequest(tt.req, DefaultMaxFutureSlots)
+			if tt.allowed && err != nil {
+				t.Errorf("Wanted request allowed, received %v", err)
+			}
+			if !tt.allowed && !errors.Is(err, ErrFutureSlot) {
+				t.Errorf("Wanted %v, received %v", ErrFutureSlot, err)
+			}
+		})
+	}
+}
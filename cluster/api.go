@@ -0,0 +1,301 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/raft"
+	"github.com/prysmaticlabs/remote-signer/rpc/jsoncodec"
+	"github.com/prysmaticlabs/remote-signer/slashing/replication"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ServiceName is the fully qualified gRPC service name of the Raft API.
+const ServiceName = "remotesigner.cluster.v1.Raft"
+
+// SnapshotChunk is a message of a snapshot stream: the first carries the
+// request, and the following ones the data of the snapshot.
+type SnapshotChunk struct {
+	Request *raft.InstallSnapshotRequest `json:"request,omitempty"`
+	Data    []byte                       `json:"data,omitempty"`
+}
+
+// Server is the server API of the Raft service.
+type Server interface {
+	RequestVote(context.Context, *raft.RequestVoteRequest) (*raft.RequestVoteResponse, error)
+	AppendEntries(context.Context, *raft.AppendEntriesRequest) (*raft.AppendEntriesResponse, error)
+	TimeoutNow(context.Context, *raft.TimeoutNowRequest) (*raft.TimeoutNowResponse, error)
+	InstallSnapshot(InstallSnapshotServer) error
+}
+
+// InstallSnapshotServer is the server side of a snapshot stream.
+type InstallSnapshotServer interface {
+	SendAndClose(*raft.InstallSnapshotResponse) error
+	Recv() (*SnapshotChunk, error)
+	grpc.ServerStream
+}
+
+type installSnapshotServer struct {
+	grpc.ServerStream
+}
+
+func (s *installSnapshotServer) SendAndClose(res *raft.InstallSnapshotResponse) error {
+	return s.ServerStream.SendMsg(res)
+}
+
+func (s *installSnapshotServer) Recv() (*SnapshotChunk, error) {
+	chunk := new(SnapshotChunk)
+	if err := s.ServerStream.RecvMsg(chunk); err != nil {
+		return nil, err
+	}
+	return chunk, nil
+}
+
+// RegisterServer registers a Raft server implementation on a gRPC server.
+func RegisterServer(s *grpc.Server, srv Server) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*Server)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "RequestVote",
+			Handler: unaryHandler("RequestVote", func() interface{} { return new(raft.RequestVoteRequest) },
+				func(ctx context.Context, srv Server, req interface{}) (interface{}, error) {
+					return srv.RequestVote(ctx, req.(*raft.RequestVoteRequest))
+				},
+			),
+		},
+		{
+			MethodName: "AppendEntries",
+			Handler: unaryHandler("AppendEntries", func() interface{} { return new(raft.AppendEntriesRequest) },
+				func(ctx context.Context, srv Server, req interface{}) (interface{}, error) {
+					return srv.AppendEntries(ctx, req.(*raft.AppendEntriesRequest))
+				},
+			),
+		},
+		{
+			MethodName: "TimeoutNow",
+			Handler: unaryHandler("TimeoutNow", func() interface{} { return new(raft.TimeoutNowRequest) },
+				func(ctx context.Context, srv Server, req interface{}) (interface{}, error) {
+					return srv.TimeoutNow(ctx, req.(*raft.TimeoutNowRequest))
+				},
+			),
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "InstallSnapshot",
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				return srv.(Server).InstallSnapshot(&installSnapshotServer{stream})
+			},
+			ClientStreams: true,
+		},
+	},
+	Metadata: "cluster/api.go",
+}
+
+type handlerFunc func(ctx context.Context, srv Server, req interface{}) (interface{}, error)
+
+// unaryHandler builds a gRPC method handler which decodes the request,
+// and runs the server interceptors before calling the server method.
+func unaryHandler(
+	method string, newReq func() interface{}, call handlerFunc,
+) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	fullMethod := fmt.Sprintf("/%s/%s", ServiceName, method)
+	return func(
+		srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor,
+	) (interface{}, error) {
+		req := newReq()
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return call(ctx, srv.(Server), req)
+		}
+		info := &grpc.UnaryServerInfo{
+			Server:     srv,
+			FullMethod: fullMethod,
+		}
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			return call(ctx, srv.(Server), req)
+		}
+		return interceptor(ctx, req, info, handler)
+	}
+}
+
+// transportServer serves the Raft API of a signer to the other members,
+// authenticated with the shared cluster token, handing their requests to
+// the Raft node through its transport.
+type transportServer struct {
+	transport *Transport
+}
+
+// NewServer instantiates a Raft server handing requests to the Raft node of a transport.
+func NewServer(transport *Transport) Server {
+	return &transportServer{transport: transport}
+}
+
+func (s *transportServer) RequestVote(ctx context.Context, req *raft.RequestVoteRequest) (*raft.RequestVoteResponse, error) {
+	if err := replication.Authenticate(ctx, s.transport.token); err != nil {
+		return nil, err
+	}
+	res, err := s.transport.handle(ctx, req, nil)
+	if err != nil {
+		return nil, handlerError(err)
+	}
+	return res.(*raft.RequestVoteResponse), nil
+}
+
+func (s *transportServer) AppendEntries(ctx context.Context, req *raft.AppendEntriesRequest) (*raft.AppendEntriesResponse, error) {
+	if err := replication.Authenticate(ctx, s.transport.token); err != nil {
+		return nil, err
+	}
+	res, err := s.transport.handle(ctx, req, nil)
+	if err != nil {
+		return nil, handlerError(err)
+	}
+	return res.(*raft.AppendEntriesResponse), nil
+}
+
+func (s *transportServer) TimeoutNow(ctx context.Context, req *raft.TimeoutNowRequest) (*raft.TimeoutNowResponse, error) {
+	if err := replication.Authenticate(ctx, s.transport.token); err != nil {
+		return nil, err
+	}
+	res, err := s.transport.handle(ctx, req, nil)
+	if err != nil {
+		return nil, handlerError(err)
+	}
+	return res.(*raft.TimeoutNowResponse), nil
+}
+
+// InstallSnapshot hands the snapshot to the Raft node as it is streamed.
+func (s *transportServer) InstallSnapshot(stream InstallSnapshotServer) error {
+	if err := replication.Authenticate(stream.Context(), s.transport.token); err != nil {
+		return err
+	}
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	if first.Request == nil {
+		return status.Error(codes.InvalidArgument, "Expected snapshot request in first message")
+	}
+	res, err := s.transport.handle(stream.Context(), first.Request, &snapshotReader{stream: stream, buf: first.Data})
+	if err != nil {
+		return handlerError(err)
+	}
+	return stream.SendAndClose(res.(*raft.InstallSnapshotResponse))
+}
+
+// snapshotReader reads the data of a snapshot stream.
+type snapshotReader struct {
+	stream InstallSnapshotServer
+	buf    []byte
+}
+
+func (r *snapshotReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		chunk, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		r.buf = chunk.Data
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func handlerError(err error) error {
+	return status.Errorf(codes.Unavailable, "Could not handle raft request: %v", err)
+}
+
+// Client is the client API of the Raft service.
+type Client interface {
+	RequestVote(ctx context.Context, in *raft.RequestVoteRequest, opts ...grpc.CallOption) (*raft.RequestVoteResponse, error)
+	AppendEntries(ctx context.Context, in *raft.AppendEntriesRequest, opts ...grpc.CallOption) (*raft.AppendEntriesResponse, error)
+	TimeoutNow(ctx context.Context, in *raft.TimeoutNowRequest, opts ...grpc.CallOption) (*raft.TimeoutNowResponse, error)
+	InstallSnapshot(ctx context.Context, opts ...grpc.CallOption) (InstallSnapshotClient, error)
+}
+
+// InstallSnapshotClient is the client side of a snapshot stream.
+type InstallSnapshotClient interface {
+	Send(*SnapshotChunk) error
+	CloseAndRecv() (*raft.InstallSnapshotResponse, error)
+	grpc.ClientStream
+}
+
+type installSnapshotClient struct {
+	grpc.ClientStream
+}
+
+func (c *installSnapshotClient) Send(chunk *SnapshotChunk) error {
+	return c.ClientStream.SendMsg(chunk)
+}
+
+func (c *installSnapshotClient) CloseAndRecv() (*raft.InstallSnapshotResponse, error) {
+	if err := c.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	res := new(raft.InstallSnapshotResponse)
+	if err := c.ClientStream.RecvMsg(res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+type client struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewClient instantiates a Raft client on top of a gRPC connection.
+func NewClient(cc grpc.ClientConnInterface) Client {
+	return &client{cc: cc}
+}
+
+// RequestVote requests the vote of a member for a candidate.
+func (c *client) RequestVote(ctx context.Context, in *raft.RequestVoteRequest, opts ...grpc.CallOption) (*raft.RequestVoteResponse, error) {
+	out := new(raft.RequestVoteResponse)
+	if err := c.invoke(ctx, "RequestVote", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AppendEntries replicates log entries to a follower.
+func (c *client) AppendEntries(ctx context.Context, in *raft.AppendEntriesRequest, opts ...grpc.CallOption) (*raft.AppendEntriesResponse, error) {
+	out := new(raft.AppendEntriesResponse)
+	if err := c.invoke(ctx, "AppendEntries", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// TimeoutNow asks a member to start an election.
+func (c *client) TimeoutNow(ctx context.Context, in *raft.TimeoutNowRequest, opts ...grpc.CallOption) (*raft.TimeoutNowResponse, error) {
+	out := new(raft.TimeoutNowResponse)
+	if err := c.invoke(ctx, "TimeoutNow", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// InstallSnapshot opens a stream sending a snapshot of the slashing protection history to a follower.
+func (c *client) InstallSnapshot(ctx context.Context, opts ...grpc.CallOption) (InstallSnapshotClient, error) {
+	opts = append([]grpc.CallOption{grpc.CallContentSubtype(jsoncodec.Name)}, opts...)
+	stream, err := c.cc.NewStream(ctx, &serviceDesc.Streams[0], fmt.Sprintf("/%s/InstallSnapshot", ServiceName), opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &installSnapshotClient{stream}, nil
+}
+
+func (c *client) invoke(ctx context.Context, method string, in, out interface{}, opts ...grpc.CallOption) error {
+	opts = append([]grpc.CallOption{grpc.CallContentSubtype(jsoncodec.Name)}, opts...)
+	return c.cc.Invoke(ctx, fmt.Sprintf("/%s/%s", ServiceName, method), in, out, opts...)
+}
@@ -0,0 +1,394 @@
+/*
+Package cluster runs a group of signers replicating their slashing protection
+database with Raft, as implemented by github.com/hashicorp/raft. Every signing
+decision is a command of the replicated log, and a request is only signed once
+its record is committed by a majority of the signers and applied without being
+found slashable. The cluster thus keeps signing through the loss of a minority
+of its signers, and never double signs as a majority always holds every signed
+message.
+*/
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb/v2"
+	"github.com/pkg/errors"
+	validatorpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1/validator-client"
+	"github.com/prysmaticlabs/remote-signer/slashing"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+)
+
+var log = logrus.WithField("prefix", "cluster")
+
+// DefaultTimeout bounds how long signing waits for a decision to be committed.
+const DefaultTimeout = 2 * time.Second
+
+// retainSnapshots is the number of snapshots kept in the Raft directory.
+const retainSnapshots = 2
+
+var (
+	// ErrNotLeader is returned when signing on, or changing the members
+	// from, a signer which is not the leader of the cluster.
+	ErrNotLeader = raft.ErrNotLeader
+	// ErrLeadershipLost is returned when the leader stepped down before a
+	// decision was applied, in which case it may or may not be committed.
+	ErrLeadershipLost = raft.ErrLeadershipLost
+)
+
+// Members of a cluster, mapping signer IDs to the addresses of their gRPC servers.
+type Members map[string]string
+
+// Status describes a signer and its view of the cluster.
+type Status struct {
+	ID          string  `json:"id"`
+	State       string  `json:"state"`
+	Term        uint64  `json:"term"`
+	Leader      string  `json:"leader,omitempty"`
+	Members     Members `json:"members"`
+	CommitIndex uint64  `json:"commit_index"`
+	LastApplied uint64  `json:"last_applied"`
+	LastIndex   uint64  `json:"last_index"`
+}
+
+// Config options of a cluster member.
+type Config struct {
+	// ID of this signer in the cluster.
+	ID string
+	// Dir holds the Raft log and snapshots.
+	Dir string
+	// Members bootstrap a new cluster, mapping signer IDs to the addresses of
+	// their gRPC servers. They are ignored once the signer has Raft state, and
+	// must not be set on signers joining an existing cluster.
+	Members Members
+	// DB is the local slashing protection database.
+	DB *slashing.DB
+	// Transport exchanges Raft requests with the other members, such as a
+	// Transport over gRPC.
+	Transport raft.Transport
+	// Timeout bounds how long signing waits for a decision to be committed.
+	Timeout time.Duration
+	// ElectionTimeout, SnapshotThreshold, SnapshotInterval and TrailingLogs
+	// tune the Raft node, and use its defaults when unset.
+	ElectionTimeout   time.Duration
+	SnapshotThreshold uint64
+	SnapshotInterval  time.Duration
+	TrailingLogs      uint64
+}
+
+// Cluster is a signer's membership of the cluster. It is the slashing
+// protector of the signer, and serves the Raft API to the other members.
+type Cluster struct {
+	cfg       *Config
+	raftCfg   *raft.Config
+	fsm       *fsm
+	store     *raftboltdb.BoltStore
+	snapshots raft.SnapshotStore
+	logWriter *io.PipeWriter
+	raft      *raft.Raft
+}
+
+// New opens the Raft state of a signer, bootstrapping a new cluster if needed.
+// A signer without Raft state must have an empty slashing protection history,
+// which the cluster replaces with its own.
+func New(cfg *Config) (*Cluster, error) {
+	if cfg.ID == "" || cfg.Dir == "" || cfg.DB == nil || cfg.Transport == nil {
+		return nil, errors.New("expected a signer ID, directory, slashing protection database and transport")
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if err := os.MkdirAll(cfg.Dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "could not create Raft directory")
+	}
+	logWriter := log.Writer()
+	raftCfg := raft.DefaultConfig()
+	raftCfg.LocalID = raft.ServerID(cfg.ID)
+	raftCfg.Logger = hclog.New(&hclog.LoggerOptions{
+		Name:   "raft",
+		Level:  hclog.Info,
+		Output: logWriter,
+	})
+	if cfg.ElectionTimeout > 0 {
+		raftCfg.HeartbeatTimeout = cfg.ElectionTimeout
+		raftCfg.ElectionTimeout = cfg.ElectionTimeout
+		raftCfg.LeaderLeaseTimeout = cfg.ElectionTimeout / 2
+	}
+	if cfg.SnapshotThreshold > 0 {
+		raftCfg.SnapshotThreshold = cfg.SnapshotThreshold
+	}
+	if cfg.SnapshotInterval > 0 {
+		raftCfg.SnapshotInterval = cfg.SnapshotInterval
+	}
+	if cfg.TrailingLogs > 0 {
+		raftCfg.TrailingLogs = cfg.TrailingLogs
+	}
+	c := &Cluster{
+		cfg:       cfg,
+		raftCfg:   raftCfg,
+		fsm:       &fsm{db: cfg.DB},
+		logWriter: logWriter,
+	}
+	if err := c.open(); err != nil {
+		if closeErr := c.close(); closeErr != nil {
+			log.WithError(closeErr).Error("Could not close Raft state")
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+// open opens the Raft log and snapshots, and checks that the signer can
+// join the cluster, or bootstraps it.
+func (c *Cluster) open() error {
+	var err error
+	c.store, err = raftboltdb.NewBoltStore(filepath.Join(c.cfg.Dir, "raft.db"))
+	if err != nil {
+		return errors.Wrap(err, "could not open Raft log")
+	}
+	c.snapshots, err = raft.NewFileSnapshotStoreWithLogger(c.cfg.Dir, retainSnapshots, c.raftCfg.Logger)
+	if err != nil {
+		return errors.Wrap(err, "could not open Raft snapshots")
+	}
+	hasState, err := raft.HasExistingState(c.store, c.store, c.snapshots)
+	if err != nil {
+		return errors.Wrap(err, "could not read Raft state")
+	}
+	if hasState {
+		if len(c.cfg.Members) > 0 {
+			log.Debug("Raft state found, ignoring bootstrap members")
+		}
+		return nil
+	}
+	// The history of the cluster would replace the local one, losing the
+	// records of messages this signer signed on its own.
+	seq, _, err := c.cfg.DB.Head()
+	if err != nil {
+		return err
+	}
+	if seq > 0 {
+		return errors.Errorf(
+			"slashing protection database holds %d records but no Raft state: "+
+				"a signer must join a cluster with an empty signing history", seq,
+		)
+	}
+	if len(c.cfg.Members) == 0 {
+		return nil
+	}
+	configuration := raft.Configuration{}
+	for id, address := range c.cfg.Members {
+		configuration.Servers = append(configuration.Servers, raft.Server{
+			Suffrage: raft.Voter,
+			ID:       raft.ServerID(id),
+			Address:  raft.ServerAddress(address),
+		})
+	}
+	if err := raft.BootstrapCluster(
+		c.raftCfg, c.store, c.store, c.snapshots, c.cfg.Transport, configuration,
+	); err != nil {
+		return errors.Wrap(err, "could not bootstrap cluster")
+	}
+	log.WithField("numMembers", len(c.cfg.Members)).Info("Bootstrapped signer cluster")
+	return nil
+}
+
+// Start the Raft node. The slashing protection database is rebuilt from the
+// last snapshot, if any, and the committed log.
+func (c *Cluster) Start() error {
+	r, err := raft.NewRaft(c.raftCfg, c.fsm, c.store, c.store, c.snapshots, c.cfg.Transport)
+	if err != nil {
+		return errors.Wrap(err, "could not start Raft node")
+	}
+	c.raft = r
+	return nil
+}
+
+// Stop the Raft node.
+func (c *Cluster) Stop() error {
+	if c.raft != nil {
+		if err := c.raft.Shutdown().Error(); err != nil {
+			log.WithError(err).Error("Could not stop Raft node")
+		}
+	}
+	return c.close()
+}
+
+func (c *Cluster) close() error {
+	var err error
+	if c.store != nil {
+		err = c.store.Close()
+	}
+	if closeErr := c.logWriter.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// RegisterServer serves the Raft API of the signer on a gRPC server, when
+// its transport is a Transport over gRPC.
+func (c *Cluster) RegisterServer(s *grpc.Server) {
+	if t, ok := c.cfg.Transport.(*Transport); ok {
+		RegisterServer(s, NewServer(t))
+	}
+}
+
+// CheckAndRecord commits the record of a sign request to the replicated log,
+// and returns once applied whether the request may be signed. Only the leader
+// of the cluster can sign, and other members fail with ErrNotLeader.
+func (c *Cluster) CheckAndRecord(ctx context.Context, pubKey [48]byte, req *validatorpb.SignRequest) error {
+	rec, err := slashing.RecordFromRequest(pubKey, req)
+	if err != nil {
+		return errors.Wrap(slashing.ErrSlashable, err.Error())
+	}
+	if rec == nil {
+		return nil
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if c.raft == nil || c.raft.State() != raft.Leader {
+		return c.notLeaderError()
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+	future := c.raft.Apply(data, c.cfg.Timeout)
+	done := make(chan error, 1)
+	go func() {
+		done <- future.Error()
+	}()
+	select {
+	case err := <-done:
+		if errors.Is(err, raft.ErrNotLeader) {
+			return c.notLeaderError()
+		}
+		if err != nil {
+			return errors.Wrap(err, "could not commit signing decision")
+		}
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "could not commit signing decision")
+	}
+	if err, ok := future.Response().(error); ok {
+		return err
+	}
+	return nil
+}
+
+// notLeaderError returns ErrNotLeader with the known leader, if any.
+func (c *Cluster) notLeaderError() error {
+	st := c.Status()
+	if st.Leader == "" {
+		return ErrNotLeader
+	}
+	return errors.Wrapf(ErrNotLeader, "leader is %s at %s", st.Leader, st.Members[st.Leader])
+}
+
+// IsLeader returns whether the signer is the leader of the cluster.
+func (c *Cluster) IsLeader() bool {
+	return c.raft != nil && c.raft.State() == raft.Leader
+}
+
+// Status returns the state of the signer and its view of the members.
+func (c *Cluster) Status() *Status {
+	st := &Status{
+		ID:      c.cfg.ID,
+		State:   "stopped",
+		Members: make(Members),
+	}
+	if c.raft == nil {
+		return st
+	}
+	st.State = strings.ToLower(c.raft.State().String())
+	stats := c.raft.Stats()
+	st.Term = parseStat(stats, "term")
+	st.CommitIndex = parseStat(stats, "commit_index")
+	st.LastApplied = parseStat(stats, "applied_index")
+	st.LastIndex = parseStat(stats, "last_log_index")
+	future := c.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		log.WithError(err).Error("Could not read cluster members")
+		return st
+	}
+	leader := c.raft.Leader()
+	for _, server := range future.Configuration().Servers {
+		st.Members[string(server.ID)] = string(server.Address)
+		if leader != "" && server.Address == leader {
+			st.Leader = string(server.ID)
+		}
+	}
+	return st
+}
+
+func parseStat(stats map[string]string, key string) uint64 {
+	v, err := strconv.ParseUint(stats[key], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+// AddMember adds a signer to the cluster, or changes its address. It must be
+// called on the leader, and returns once the change is committed.
+func (c *Cluster) AddMember(ctx context.Context, id, address string) error {
+	if id == "" || address == "" {
+		return errors.New("expected a member ID and address")
+	}
+	if c.raft == nil {
+		return ErrNotLeader
+	}
+	return waitFuture(ctx, c.raft.AddVoter(raft.ServerID(id), raft.ServerAddress(address), 0, c.cfg.Timeout))
+}
+
+// RemoveMember removes a signer from the cluster. It must be called on the
+// leader, and returns once the change is committed.
+func (c *Cluster) RemoveMember(ctx context.Context, id string) error {
+	if id == "" {
+		return errors.New("expected a member ID")
+	}
+	if c.raft == nil {
+		return ErrNotLeader
+	}
+	return waitFuture(ctx, c.raft.RemoveServer(raft.ServerID(id), 0, c.cfg.Timeout))
+}
+
+// waitFuture waits for a membership change until the context is done.
+func waitFuture(ctx context.Context, future raft.Future) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- future.Error()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// LoadMembers reads the JSON object mapping the IDs of the initial members
+// of a cluster to the addresses of their gRPC servers.
+func LoadMembers(path string) (Members, error) {
+	enc, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read members file %s", path)
+	}
+	members := make(Members)
+	if err := json.Unmarshal(enc, &members); err != nil {
+		return nil, errors.Wrapf(err, "could not parse members file %s", path)
+	}
+	if len(members) == 0 {
+		return nil, errors.Errorf("no members in members file %s", path)
+	}
+	return members, nil
+}
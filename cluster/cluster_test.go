@@ -0,0 +1,476 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	types "github.com/prysmaticlabs/eth2-types"
+	ethpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1"
+	validatorpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1/validator-client"
+	"github.com/prysmaticlabs/remote-signer/slashing"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func blockRequest(slot types.Slot, root byte) *validatorpb.SignRequest {
+	return &validatorpb.SignRequest{
+		SigningRoot: []byte{root},
+		Object: &validatorpb.SignRequest_Block{
+			Block: &ethpb.BeaconBlock{Slot: slot},
+		},
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "cluster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	})
+	return dir
+}
+
+func openDB(t *testing.T, path string) *slashing.DB {
+	db, err := slashing.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := db.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+	return db
+}
+
+// startMember starts a cluster member, stopped at the end of the test.
+func startMember(t *testing.T, cfg *Config) *Cluster {
+	cfg.ElectionTimeout = 50 * time.Millisecond
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := c.Stop(); err != nil {
+			t.Error(err)
+		}
+	})
+	return c
+}
+
+// startCluster runs signers in-process over in-memory transports.
+func startCluster(t *testing.T, ids ...string) (map[string]*Cluster, map[string]*raft.InmemTransport) {
+	dir := tempDir(t)
+	members := make(Members)
+	transports := make(map[string]*raft.InmemTransport)
+	for _, id := range ids {
+		members[id] = id
+		_, transports[id] = raft.NewInmemTransport(raft.ServerAddress(id))
+	}
+	for _, from := range transports {
+		for id, to := range transports {
+			from.Connect(raft.ServerAddress(id), to)
+		}
+	}
+	clusters := make(map[string]*Cluster)
+	for _, id := range ids {
+		clusters[id] = startMember(t, &Config{
+			ID:        id,
+			Dir:       filepath.Join(dir, id, "raft"),
+			Members:   members,
+			DB:        openDB(t, filepath.Join(dir, id, "slashing-protection.db")),
+			Transport: transports[id],
+		})
+	}
+	return clusters, transports
+}
+
+// leader waits for a leader among the connected signers.
+func leader(t *testing.T, clusters map[string]*Cluster, except string) *Cluster {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for id, c := range clusters {
+			if id != except && c.IsLeader() {
+				return c
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("No leader elected")
+	return nil
+}
+
+func TestCluster_NoDoubleSigningAcrossFailover(t *testing.T) {
+	ctx := context.Background()
+	clusters, transports := startCluster(t, "a", "b", "c")
+	pubKey := [48]byte{1}
+
+	first := leader(t, clusters, "")
+	for slot := types.Slot(1); slot <= 10; slot++ {
+		if err := first.CheckAndRecord(ctx, pubKey, blockRequest(slot, 1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := first.CheckAndRecord(ctx, pubKey, blockRequest(3, 2)); !errors.Is(err, slashing.ErrSlashable) {
+		t.Errorf("Wanted %v, received %v", slashing.ErrSlashable, err)
+	}
+	for id, c := range clusters {
+		if c == first {
+			continue
+		}
+		err := c.CheckAndRecord(ctx, pubKey, blockRequest(11, 1))
+		if !errors.Is(err, ErrNotLeader) {
+			t.Errorf("Wanted %v from follower %s, received %v", ErrNotLeader, id, err)
+		}
+	}
+
+	// The new leader holds every committed decision of the old one.
+	transports[first.cfg.ID].DisconnectAll()
+	for id, transport := range transports {
+		if id != first.cfg.ID {
+			transport.Disconnect(raft.ServerAddress(first.cfg.ID))
+		}
+	}
+	second := leader(t, clusters, first.cfg.ID)
+	var err error
+	for i := 0; i < 10; i++ {
+		if err = second.CheckAndRecord(ctx, pubKey, blockRequest(10, 2)); !errors.Is(err, ErrNotLeader) {
+			break
+		}
+		second = leader(t, clusters, first.cfg.ID)
+	}
+	if !errors.Is(err, slashing.ErrSlashable) {
+		t.Errorf("Wanted %v, received %v", slashing.ErrSlashable, err)
+	}
+	if err := second.CheckAndRecord(ctx, pubKey, blockRequest(11, 1)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCluster_RestartKeepsHistory(t *testing.T) {
+	ctx := context.Background()
+	dir := tempDir(t)
+	db := openDB(t, filepath.Join(dir, "slashing-protection.db"))
+	_, transport := raft.NewInmemTransport("a")
+	cfg := &Config{
+		ID:              "a",
+		Dir:             filepath.Join(dir, "raft"),
+		Members:         Members{"a": "a"},
+		DB:              db,
+		Transport:       transport,
+		ElectionTimeout: 50 * time.Millisecond,
+	}
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	c = leader(t, map[string]*Cluster{"a": c}, "")
+	pubKey := [48]byte{1}
+	for slot := types.Slot(1); slot <= 6; slot++ {
+		if err := c.CheckAndRecord(ctx, pubKey, blockRequest(slot, 1)); err != nil {
+			t.Fatal(err)
+		}
+		// Snapshot half of the history, the other half only being in the log.
+		if slot == 3 {
+			if err := c.raft.Snapshot().Error(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := c.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The restarted signer restores the snapshot, and applies the log once
+	// committed again.
+	_, cfg.Transport = raft.NewInmemTransport("a")
+	c = startMember(t, cfg)
+	c = leader(t, map[string]*Cluster{"a": c}, "")
+	if err := c.CheckAndRecord(ctx, pubKey, blockRequest(5, 2)); !errors.Is(err, slashing.ErrSlashable) {
+		t.Errorf("Wanted %v, received %v", slashing.ErrSlashable, err)
+	}
+	seq, _, err := db.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seq != 6 {
+		t.Errorf("Wanted 6 records, received %d", seq)
+	}
+}
+
+func TestCluster_RefusesHistoryWithoutRaftState(t *testing.T) {
+	dir := tempDir(t)
+	db := openDB(t, filepath.Join(dir, "slashing-protection.db"))
+	if err := db.CheckAndRecord(context.Background(), [48]byte{1}, blockRequest(1, 1)); err != nil {
+		t.Fatal(err)
+	}
+	_, transport := raft.NewInmemTransport("a")
+	_, err := New(&Config{
+		ID:        "a",
+		Dir:       filepath.Join(dir, "raft"),
+		Members:   Members{"a": "a"},
+		DB:        db,
+		Transport: transport,
+	})
+	if err == nil {
+		t.Fatal("Wanted a signer with a signing history and no Raft state refused")
+	}
+	seq, _, err := db.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seq != 1 {
+		t.Errorf("Wanted the signing history kept, received %d records", seq)
+	}
+}
+
+// grpcNetwork serves the Raft API of signers over in-memory gRPC
+// connections, with TLS and the cluster token.
+type grpcNetwork struct {
+	t         *testing.T
+	cert      tls.Certificate
+	certCAs   *x509.CertPool
+	lock      sync.Mutex
+	listeners map[string]*bufconn.Listener
+}
+
+func newGRPCNetwork(t *testing.T) *grpcNetwork {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "signer"},
+		DNSNames:     []string{"signer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(parsed)
+	return &grpcNetwork{
+		t:         t,
+		cert:      tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key},
+		certCAs:   pool,
+		listeners: make(map[string]*bufconn.Listener),
+	}
+}
+
+// transport returns the gRPC transport of the signer at an address,
+// whose requests are served once serve is called.
+func (n *grpcNetwork) transport(address string) *Transport {
+	n.lock.Lock()
+	n.listeners[address] = bufconn.Listen(1 << 20)
+	n.lock.Unlock()
+	t := newTransport(
+		address,
+		"secret",
+		grpc.WithTransportCredentials(credentials.NewClientTLSFromCert(n.certCAs, "signer")),
+		grpc.WithContextDialer(func(ctx context.Context, target string) (net.Conn, error) {
+			lis := n.listener(target)
+			if lis == nil {
+				return nil, errors.Errorf("unknown address %s", target)
+			}
+			return lis.Dial()
+		}),
+	)
+	n.t.Cleanup(func() {
+		if err := t.Close(); err != nil {
+			n.t.Error(err)
+		}
+	})
+	return t
+}
+
+func (n *grpcNetwork) listener(address string) *bufconn.Listener {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return n.listeners[address]
+}
+
+// serve the Raft API of a signer.
+func (n *grpcNetwork) serve(address string, c *Cluster) {
+	server := grpc.NewServer(grpc.Creds(credentials.NewServerTLSFromCert(&n.cert)))
+	c.RegisterServer(server)
+	go func() {
+		if err := server.Serve(n.listener(address)); err != nil {
+			n.t.Log(err)
+		}
+	}()
+	n.t.Cleanup(server.Stop)
+}
+
+func TestCluster_JoinFromSnapshot(t *testing.T) {
+	ctx := context.Background()
+	dir := tempDir(t)
+	network := newGRPCNetwork(t)
+	first := startMember(t, &Config{
+		ID:           "a",
+		Dir:          filepath.Join(dir, "a", "raft"),
+		Members:      Members{"a": "a"},
+		DB:           openDB(t, filepath.Join(dir, "a", "slashing-protection.db")),
+		Transport:    network.transport("a"),
+		TrailingLogs: 1,
+	})
+	network.serve("a", first)
+	first = leader(t, map[string]*Cluster{"a": first}, "")
+	pubKey := [48]byte{1}
+	for slot := types.Slot(1); slot <= 20; slot++ {
+		if err := first.CheckAndRecord(ctx, pubKey, blockRequest(slot, 1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The log is compacted, so a joining signer can only catch up from a snapshot.
+	if err := first.raft.Snapshot().Error(); err != nil {
+		t.Fatal(err)
+	}
+
+	joinerDB := openDB(t, filepath.Join(dir, "b", "slashing-protection.db"))
+	joiner := startMember(t, &Config{
+		ID:        "b",
+		Dir:       filepath.Join(dir, "b", "raft"),
+		DB:        joinerDB,
+		Transport: network.transport("b"),
+	})
+	network.serve("b", joiner)
+	if err := first.AddMember(ctx, "b", "b"); err != nil {
+		t.Fatal(err)
+	}
+	want, wantHash, err := first.cfg.DB.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		seq, hash, err := joinerDB.Head()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seq == want && bytes.Equal(hash, wantHash) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Wanted joining signer at sequence %d, received %d", want, seq)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	st := first.Status()
+	if len(st.Members) != 2 || st.Leader != "a" {
+		t.Errorf("Wanted 2 members led by a, received %+v", st)
+	}
+}
+
+// memorySink is a snapshot sink in memory.
+type memorySink struct {
+	bytes.Buffer
+}
+
+func (s *memorySink) ID() string {
+	return "memory"
+}
+
+func (s *memorySink) Cancel() error {
+	return nil
+}
+
+func (s *memorySink) Close() error {
+	return nil
+}
+
+func TestFSM_SnapshotRestore(t *testing.T) {
+	ctx := context.Background()
+	dir := tempDir(t)
+	open := func(name string) *fsm {
+		return &fsm{db: openDB(t, filepath.Join(dir, name+".db"))}
+	}
+	source, target := open("source"), open("target")
+	for slot := types.Slot(1); slot <= 3; slot++ {
+		if _, err := source.db.CheckAndAppend(ctx, [48]byte{1}, blockRequest(slot, 1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Restoring replaces any previous history.
+	if _, err := target.db.CheckAndAppend(ctx, [48]byte{2}, blockRequest(1, 1)); err != nil {
+		t.Fatal(err)
+	}
+	snap, err := source.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Records applied after the snapshot are not part of it.
+	if _, err := source.db.CheckAndAppend(ctx, [48]byte{1}, blockRequest(4, 1)); err != nil {
+		t.Fatal(err)
+	}
+	sink := &memorySink{}
+	if err := snap.Persist(sink); err != nil {
+		t.Fatal(err)
+	}
+	data := sink.Bytes()
+
+	// A truncated snapshot leaves the history untouched.
+	if err := target.Restore(ioutil.NopCloser(bytes.NewReader(data[:len(data)-10]))); err == nil {
+		t.Error("Wanted error restoring a truncated snapshot")
+	}
+	if seq, _, err := target.db.Head(); err != nil || seq != 1 {
+		t.Errorf("Wanted history untouched, received %d records, %v", seq, err)
+	}
+
+	if err := target.Restore(ioutil.NopCloser(bytes.NewReader(data))); err != nil {
+		t.Fatal(err)
+	}
+	sourceHash, err := source.db.HashAt(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	targetSeq, targetHash, err := target.db.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if targetSeq != 3 || fmt.Sprintf("%x", sourceHash) != fmt.Sprintf("%x", targetHash) {
+		t.Errorf("Wanted head 3 %x, received %d %x", sourceHash, targetSeq, targetHash)
+	}
+	if err := target.db.CheckAndRecord(ctx, [48]byte{2}, blockRequest(1, 2)); err != nil {
+		t.Errorf("Wanted history of the other key discarded, received %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package cluster
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"github.com/prysmaticlabs/remote-signer/slashing"
+)
+
+// fsm is the replicated state machine of the cluster: the slashing protection
+// database. Commands are records of signing decisions, which every member
+// appends to its database in the same order, denying the slashable ones.
+type fsm struct {
+	db *slashing.DB
+}
+
+// Apply appends a record to the database, returning nil if it may be
+// signed, or the error denying it.
+func (f *fsm) Apply(entry *raft.Log) interface{} {
+	rec := &slashing.Record{}
+	if err := json.Unmarshal(entry.Data, rec); err != nil {
+		return errors.Wrap(err, "could not decode record")
+	}
+	if _, err := f.db.AppendRecord(rec); err != nil {
+		if !errors.Is(err, slashing.ErrSlashable) {
+			log.WithError(err).Error("Could not apply signing decision to slashing protection database")
+		}
+		return err
+	}
+	return nil
+}
+
+// Snapshot returns the signing history as of the last applied command. It
+// only reads the head of the history, which is streamed to the snapshot
+// while the following commands are applied.
+func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
+	seq, hash, err := f.db.Head()
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot{db: f.db, seq: seq, hash: hash}, nil
+}
+
+// Restore replaces the signing history with a snapshot.
+func (f *fsm) Restore(r io.ReadCloser) error {
+	defer func() {
+		if err := r.Close(); err != nil {
+			log.WithError(err).Error("Could not close snapshot")
+		}
+	}()
+	if err := f.db.ReplaceRecords(r); err != nil {
+		return errors.Wrap(err, "could not restore slashing protection database")
+	}
+	return nil
+}
+
+// snapshot is the signing history up to a record.
+type snapshot struct {
+	db   *slashing.DB
+	seq  uint64
+	hash []byte
+}
+
+// Persist writes the records of the snapshot to the sink.
+func (s *snapshot) Persist(sink raft.SnapshotSink) error {
+	if err := s.db.WriteRecords(sink, s.seq, s.hash); err != nil {
+		if cancelErr := sink.Cancel(); cancelErr != nil {
+			log.WithError(cancelErr).Error("Could not cancel snapshot")
+		}
+		return errors.Wrap(err, "could not write snapshot")
+	}
+	return sink.Close()
+}
+
+// Release is a no-op, the snapshot holding no resources.
+func (s *snapshot) Release() {}
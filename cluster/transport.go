@@ -0,0 +1,252 @@
+package cluster
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"github.com/prysmaticlabs/remote-signer/slashing/replication"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+const (
+	// rpcTimeout bounds the Raft requests sent to the other members.
+	rpcTimeout = 10 * time.Second
+	// snapshotTimeoutScale is the snapshot size sent per rpcTimeout.
+	snapshotTimeoutScale = 256 * 1024
+	// snapshotChunkSize is the size of the snapshot chunks streamed to followers.
+	snapshotChunkSize = 64 * 1024
+)
+
+// Transport exchanges Raft requests with the other members over gRPC, with
+// TLS and the shared cluster token. Connections are opened on first use by
+// address, since members may be added at runtime. Requests received by the
+// gRPC server of the signer, see RegisterServer, are handed to the Raft node.
+type Transport struct {
+	address   raft.ServerAddress
+	token     string
+	dialOpts  []grpc.DialOption
+	consumer  chan raft.RPC
+	lock      sync.Mutex
+	conns     map[raft.ServerAddress]*grpc.ClientConn
+	heartbeat func(raft.RPC)
+}
+
+// NewTransport instantiates the gRPC transport of the signer at address,
+// trusting the signers' TLS certificates issued by the CA at caPath.
+func NewTransport(address, caPath, serverName, token string) (*Transport, error) {
+	creds, err := credentials.NewClientTLSFromFile(caPath, serverName)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not load cluster TLS CA")
+	}
+	return newTransport(address, token, grpc.WithTransportCredentials(creds)), nil
+}
+
+func newTransport(address, token string, dialOpts ...grpc.DialOption) *Transport {
+	return &Transport{
+		address: raft.ServerAddress(address),
+		token:   token,
+		dialOpts: append([]grpc.DialOption{
+			grpc.WithPerRPCCredentials(replication.NewTokenCredentials(token)),
+		}, dialOpts...),
+		consumer: make(chan raft.RPC),
+		conns:    make(map[raft.ServerAddress]*grpc.ClientConn),
+	}
+}
+
+// Consumer returns the channel of the requests received from the other members.
+func (t *Transport) Consumer() <-chan raft.RPC {
+	return t.consumer
+}
+
+// LocalAddr returns the address of the signer.
+func (t *Transport) LocalAddr() raft.ServerAddress {
+	return t.address
+}
+
+// AppendEntriesPipeline is not supported, entries are sent one request at a time.
+func (t *Transport) AppendEntriesPipeline(raft.ServerID, raft.ServerAddress) (raft.AppendPipeline, error) {
+	return nil, raft.ErrPipelineReplicationNotSupported
+}
+
+// AppendEntries sends entries to a follower.
+func (t *Transport) AppendEntries(
+	_ raft.ServerID, target raft.ServerAddress, args *raft.AppendEntriesRequest, resp *raft.AppendEntriesResponse,
+) error {
+	c, err := t.client(target)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	res, err := c.AppendEntries(ctx, args)
+	if err != nil {
+		return err
+	}
+	*resp = *res
+	return nil
+}
+
+// RequestVote sends a vote request to a member.
+func (t *Transport) RequestVote(
+	_ raft.ServerID, target raft.ServerAddress, args *raft.RequestVoteRequest, resp *raft.RequestVoteResponse,
+) error {
+	c, err := t.client(target)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	res, err := c.RequestVote(ctx, args)
+	if err != nil {
+		return err
+	}
+	*resp = *res
+	return nil
+}
+
+// TimeoutNow asks a member to start an election, to transfer the leadership.
+func (t *Transport) TimeoutNow(
+	_ raft.ServerID, target raft.ServerAddress, args *raft.TimeoutNowRequest, resp *raft.TimeoutNowResponse,
+) error {
+	c, err := t.client(target)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	res, err := c.TimeoutNow(ctx, args)
+	if err != nil {
+		return err
+	}
+	*resp = *res
+	return nil
+}
+
+// InstallSnapshot streams a snapshot to a follower, in chunks read from data.
+func (t *Transport) InstallSnapshot(
+	_ raft.ServerID, target raft.ServerAddress, args *raft.InstallSnapshotRequest, resp *raft.InstallSnapshotResponse,
+	data io.Reader,
+) error {
+	c, err := t.client(target)
+	if err != nil {
+		return err
+	}
+	timeout := rpcTimeout * time.Duration(args.Size/snapshotTimeoutScale+1)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	stream, err := c.InstallSnapshot(ctx)
+	if err != nil {
+		return err
+	}
+	if err := stream.Send(&SnapshotChunk{Request: args}); err != nil {
+		return errors.Wrap(err, "could not send snapshot request")
+	}
+	buf := make([]byte, snapshotChunkSize)
+	for {
+		n, err := data.Read(buf)
+		if n > 0 {
+			if err := stream.Send(&SnapshotChunk{Data: buf[:n]}); err != nil {
+				return errors.Wrap(err, "could not send snapshot")
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, "could not read snapshot")
+		}
+	}
+	res, err := stream.CloseAndRecv()
+	if err != nil {
+		return err
+	}
+	*resp = *res
+	return nil
+}
+
+// EncodePeer encodes the address of a member.
+func (t *Transport) EncodePeer(_ raft.ServerID, address raft.ServerAddress) []byte {
+	return []byte(address)
+}
+
+// DecodePeer decodes the address of a member.
+func (t *Transport) DecodePeer(buf []byte) raft.ServerAddress {
+	return raft.ServerAddress(buf)
+}
+
+// SetHeartbeatHandler handles heartbeats of the leader without queuing them
+// behind the other requests.
+func (t *Transport) SetHeartbeatHandler(cb func(rpc raft.RPC)) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.heartbeat = cb
+}
+
+// Close every connection.
+func (t *Transport) Close() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	var firstErr error
+	for address, conn := range t.conns {
+		if err := conn.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(t.conns, address)
+	}
+	return firstErr
+}
+
+// handle hands a request received from another member to the Raft node,
+// and returns its response.
+func (t *Transport) handle(ctx context.Context, command interface{}, data io.Reader) (interface{}, error) {
+	respCh := make(chan raft.RPCResponse, 1)
+	rpc := raft.RPC{
+		Command:  command,
+		Reader:   data,
+		RespChan: respCh,
+	}
+	t.lock.Lock()
+	heartbeat := t.heartbeat
+	t.lock.Unlock()
+	if req, ok := command.(*raft.AppendEntriesRequest); ok && heartbeat != nil && isHeartbeat(req) {
+		heartbeat(rpc)
+	} else {
+		select {
+		case t.consumer <- rpc:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	select {
+	case res := <-respCh:
+		return res.Response, res.Error
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// isHeartbeat returns whether a request is a heartbeat of the leader, carrying no entries.
+func isHeartbeat(req *raft.AppendEntriesRequest) bool {
+	return req.Term != 0 && req.Leader != nil &&
+		req.PrevLogEntry == 0 && req.PrevLogTerm == 0 &&
+		len(req.Entries) == 0 && req.LeaderCommitIndex == 0
+}
+
+func (t *Transport) client(address raft.ServerAddress) (Client, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if conn, ok := t.conns[address]; ok {
+		return NewClient(conn), nil
+	}
+	conn, err := grpc.Dial(string(address), t.dialOpts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not dial cluster member %s", address)
+	}
+	t.conns[address] = conn
+	return NewClient(conn), nil
+}
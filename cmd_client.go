@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	types "github.com/prysmaticlabs/eth2-types"
+	"github.com/prysmaticlabs/prysm/crypto/bls"
+	ethpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1"
+	"github.com/prysmaticlabs/remote-signer/client"
+	"github.com/prysmaticlabs/remote-signer/threshold"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// metricsTimeout bounds how long the metrics subcommand waits for a scrape.
+const metricsTimeout = 10 * time.Second
+
+// signedObject is the output of the sign subcommand.
+type signedObject struct {
+	PublicKey string `json:"public_key"`
+	Signature string `json:"signature"`
+}
+
+// forkInfoFile is the fork of a network and its genesis validators root,
+// as returned by the fork and genesis endpoints of the beacon node API.
+type forkInfoFile struct {
+	Fork                  json.RawMessage `json:"fork"`
+	GenesisValidatorsRoot string          `json:"genesis_validators_root"`
+}
+
+// runClientCommand is an ad-hoc client of a running server:
+//
+//	client keys
+//	client sign --type=attestation --public-key=0x... --object=data.json --fork-info=fork.json
+//	client sign --type=randao-reveal --public-key=0x... --epoch=10 --fork-info=fork.json
+//	client verify --public-key=0x... --signing-root=0x... --signature=0x...
+//	client health
+//	client metrics --metrics-url=http://127.0.0.1:8081/metrics --filter=remote_signer
+//
+// Objects are read from JSON files in the format of the beacon node API, with
+// 0x prefixed hex encoded byte fields. The signing root of an object is computed
+// locally, and the signature is verified against the public key before being
+// printed. Keys are managed through the admin API with the keys subcommand.
+func runClientCommand(args []string) error {
+	fs := flag.NewFlagSet("client", flag.ExitOnError)
+	flags := newClientFlags(fs)
+	objectType := fs.String(
+		"type",
+		"",
+		"type of the object to sign: block | block-altair | attestation | aggregate-and-proof | exit | randao-reveal | selection-proof",
+	)
+	pubKey := fs.String("public-key", "", "hex encoded public key to sign with or verify against")
+	objectPath := fs.String("object", "", "/path/to/object.json to sign")
+	epoch := fs.Uint64("epoch", 0, "epoch of a randao reveal")
+	slot := fs.Uint64("slot", 0, "slot of a selection proof")
+	forkInfoPath := fs.String("fork-info", "", "/path/to/fork.json with the fork and genesis validators root of the network")
+	slotsPerEpoch := fs.Uint64("slots-per-epoch", client.DefaultSlotsPerEpoch, "slots per epoch of the network")
+	signingRoot := fs.String("signing-root", "", "hex encoded signing root of the signature to verify")
+	signature := fs.String("signature", "", "hex encoded signature to verify")
+	service := fs.String("service", "", "name of the gRPC service to check the health of, the whole server if empty")
+	metricsURL := fs.String("metrics-url", "http://127.0.0.1:8081/metrics", "URL of the prometheus metrics of the server")
+	filter := fs.String("filter", "", "only print the metrics whose name contains this string")
+	if len(args) == 0 {
+		return usageError(fs, "expected a client subcommand: keys | sign | verify | health | metrics")
+	}
+	action := args[0]
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	switch action {
+	case "keys":
+		c, err := newSignerClient(flags, nil, 0)
+		if err != nil {
+			return err
+		}
+		defer closeSignerClient(c)
+		keys, err := c.ListValidatingPublicKeys(ctx)
+		if err != nil {
+			return err
+		}
+		hexKeys := make([]string, len(keys))
+		for i, key := range keys {
+			hexKeys[i] = fmt.Sprintf("%#x", key)
+		}
+		return printJSON(hexKeys)
+	case "sign":
+		if *objectType == "" || *pubKey == "" || *forkInfoPath == "" {
+			return usageError(fs, "expected --type, --public-key and --fork-info flags")
+		}
+		rawPubKey, err := threshold.DecodeHex(*pubKey, 48)
+		if err != nil {
+			return errors.Wrap(err, "could not decode public key")
+		}
+		forkInfo, err := loadForkInfo(*forkInfoPath)
+		if err != nil {
+			return err
+		}
+		c, err := newSignerClient(flags, forkInfo, *slotsPerEpoch)
+		if err != nil {
+			return err
+		}
+		defer closeSignerClient(c)
+		sig, err := signObject(ctx, c, *objectType, rawPubKey, *objectPath, types.Epoch(*epoch), types.Slot(*slot))
+		if err != nil {
+			return err
+		}
+		return printJSON(&signedObject{
+			PublicKey: fmt.Sprintf("%#x", rawPubKey),
+			Signature: fmt.Sprintf("%#x", sig.Marshal()),
+		})
+	case "verify":
+		if *pubKey == "" || *signingRoot == "" || *signature == "" {
+			return usageError(fs, "expected --public-key, --signing-root and --signature flags")
+		}
+		return verifySignature(*pubKey, *signingRoot, *signature)
+	case "health":
+		conn, err := flags.dial(ctx)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := conn.Close(); err != nil {
+				log.WithError(err).Error("Could not close connection")
+			}
+		}()
+		res, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: *service})
+		if err != nil {
+			return err
+		}
+		fmt.Println(res.Status)
+		if res.Status != healthpb.HealthCheckResponse_SERVING {
+			return errors.Errorf("server is %s", res.Status)
+		}
+		return nil
+	case "metrics":
+		token, err := flags.token()
+		if err != nil {
+			return err
+		}
+		return printMetrics(ctx, *metricsURL, token, *filter)
+	default:
+		return usageError(fs, "unknown client subcommand %s", action)
+	}
+}
+
+// newSignerClient connects to the server with the client library.
+func newSignerClient(flags *clientFlags, forkInfo *client.ForkInfo, slotsPerEpoch uint64) (*client.Client, error) {
+	creds, err := flags.credentials()
+	if err != nil {
+		return nil, err
+	}
+	token, err := flags.token()
+	if err != nil {
+		return nil, err
+	}
+	return client.New(&client.Config{
+		Endpoints:        []string{*flags.addr},
+		Credentials:      creds,
+		Token:            token,
+		VerifySignatures: true,
+		ForkInfo:         forkInfo,
+		SlotsPerEpoch:    slotsPerEpoch,
+	})
+}
+
+func closeSignerClient(c *client.Client) {
+	if err := c.Close(); err != nil {
+		log.WithError(err).Error("Could not close connection")
+	}
+}
+
+// signObject signs an object of a type with the typed helper of the client library.
+func signObject(
+	ctx context.Context,
+	c *client.Client,
+	objectType string,
+	pubKey []byte,
+	objectPath string,
+	epoch types.Epoch,
+	slot types.Slot,
+) (bls.Signature, error) {
+	switch objectType {
+	case "randao-reveal":
+		return c.SignRandaoReveal(ctx, pubKey, epoch)
+	case "selection-proof":
+		return c.SignSelectionProof(ctx, pubKey, slot)
+	}
+	if objectPath == "" {
+		return nil, errors.Errorf("expected --object flag to sign a %s", objectType)
+	}
+	switch objectType {
+	case "block":
+		block := &ethpb.BeaconBlock{}
+		if err := loadObject(objectPath, block); err != nil {
+			return nil, err
+		}
+		return c.SignBlock(ctx, pubKey, block)
+	case "block-altair":
+		block := &ethpb.BeaconBlockAltair{}
+		if err := loadObject(objectPath, block); err != nil {
+			return nil, err
+		}
+		return c.SignBlockAltair(ctx, pubKey, block)
+	case "attestation":
+		data := &ethpb.AttestationData{}
+		if err := loadObject(objectPath, data); err != nil {
+			return nil, err
+		}
+		return c.SignAttestation(ctx, pubKey, data)
+	case "aggregate-and-proof":
+		agg := &ethpb.AggregateAttestationAndProof{}
+		if err := loadObject(objectPath, agg); err != nil {
+			return nil, err
+		}
+		return c.SignAggregateAndProof(ctx, pubKey, agg)
+	case "exit":
+		exit := &ethpb.VoluntaryExit{}
+		if err := loadObject(objectPath, exit); err != nil {
+			return nil, err
+		}
+		return c.SignExit(ctx, pubKey, exit)
+	default:
+		return nil, errors.Errorf("unknown object type %s", objectType)
+	}
+}
+
+// loadObject parses a JSON file into a protobuf message.
+func loadObject(path string, msg proto.Message) error {
+	enc, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "could not read %s", path)
+	}
+	return errors.Wrapf(unmarshalObject(enc, msg), "could not parse %s", path)
+}
+
+// unmarshalObject parses a JSON object into a protobuf message. Byte fields
+// are expected 0x prefixed hex encoded, as in the beacon node API, rather
+// than base64 encoded as in the protobuf JSON mapping.
+func unmarshalObject(enc []byte, msg proto.Message) error {
+	var v interface{}
+	if err := json.Unmarshal(enc, &v); err != nil {
+		return err
+	}
+	v, err := hexToBase64(v)
+	if err != nil {
+		return err
+	}
+	enc, err = json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return jsonpb.Unmarshal(bytes.NewReader(enc), msg)
+}
+
+// hexToBase64 re-encodes every 0x prefixed hex string of a JSON value in base64.
+func hexToBase64(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, elem := range v {
+			converted, err := hexToBase64(elem)
+			if err != nil {
+				return nil, errors.Wrapf(err, "field %s", k)
+			}
+			v[k] = converted
+		}
+	case []interface{}:
+		for i, elem := range v {
+			converted, err := hexToBase64(elem)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = converted
+		}
+	case string:
+		if !strings.HasPrefix(v, "0x") {
+			return v, nil
+		}
+		b, err := threshold.DecodeHex(v, len(v)/2-1)
+		if err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.EncodeToString(b), nil
+	}
+	return v, nil
+}
+
+// loadForkInfo reads the fork info of a network from a JSON file.
+func loadForkInfo(path string) (*client.ForkInfo, error) {
+	enc, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read fork info %s", path)
+	}
+	var f forkInfoFile
+	if err := json.Unmarshal(enc, &f); err != nil {
+		return nil, errors.Wrapf(err, "could not parse fork info %s", path)
+	}
+	fork := &ethpb.Fork{}
+	if err := unmarshalObject(f.Fork, fork); err != nil {
+		return nil, errors.Wrapf(err, "could not parse fork of %s", path)
+	}
+	root, err := threshold.DecodeHex(f.GenesisValidatorsRoot, 32)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not decode genesis validators root of %s", path)
+	}
+	return &client.ForkInfo{Fork: fork, GenesisValidatorsRoot: root}, nil
+}
+
+// verifySignature checks a signature of a signing root against a public key.
+func verifySignature(hexPubKey, hexSigningRoot, hexSignature string) error {
+	rawPubKey, err := threshold.DecodeHex(hexPubKey, 48)
+	if err != nil {
+		return errors.Wrap(err, "could not decode public key")
+	}
+	pubKey, err := bls.PublicKeyFromBytes(rawPubKey)
+	if err != nil {
+		return errors.Wrap(err, "could not parse public key")
+	}
+	signingRoot, err := threshold.DecodeHex(hexSigningRoot, 32)
+	if err != nil {
+		return errors.Wrap(err, "could not decode signing root")
+	}
+	rawSig, err := threshold.DecodeHex(hexSignature, 96)
+	if err != nil {
+		return errors.Wrap(err, "could not decode signature")
+	}
+	sig, err := bls.SignatureFromBytes(rawSig)
+	if err != nil {
+		return errors.Wrap(err, "could not parse signature")
+	}
+	if !sig.Verify(pubKey, signingRoot) {
+		return errors.New("invalid signature")
+	}
+	log.Info("Valid signature")
+	return nil
+}
+
+// printMetrics prints the prometheus metrics of the server, optionally only
+// those whose name contains filter.
+func printMetrics(ctx context.Context, url, token, filter string) error {
+	ctx, cancel := context.WithTimeout(ctx, metricsTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "could not scrape metrics from %s", url)
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			log.WithError(err).Error("Could not close response body")
+		}
+	}()
+	if res.StatusCode != http.StatusOK {
+		return errors.Errorf("could not scrape metrics from %s: %s", url, res.Status)
+	}
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if filter == "" || strings.Contains(line, filter) {
+			fmt.Println(line)
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"flag"
+
+	"github.com/prysmaticlabs/remote-signer/rpc/admin"
+	"github.com/sirupsen/logrus"
+)
+
+// runClusterCommand manages the members of a Raft signer cluster through the
+// admin API. Membership changes must be sent to the leader:
+//
+//	cluster members
+//	cluster add --id=signer-4 --member-addr=10.0.0.4:4000
+//	cluster remove --id=signer-1
+func runClusterCommand(args []string) error {
+	fs := flag.NewFlagSet("cluster", flag.ExitOnError)
+	client := newClientFlags(fs)
+	id := fs.String("id", "", "Raft ID of the signer to add or remove")
+	memberAddr := fs.String("member-addr", "", "host:port of the gRPC server of the signer to add")
+	if len(args) == 0 {
+		return usageError(fs, "expected a cluster subcommand: members | add | remove")
+	}
+	action := args[0]
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	switch action {
+	case "members":
+	case "add":
+		if *id == "" || *memberAddr == "" {
+			return usageError(fs, "expected --id and --member-addr flags")
+		}
+	case "remove":
+		if *id == "" {
+			return usageError(fs, "expected --id flag")
+		}
+	default:
+		return usageError(fs, "unknown cluster subcommand %s", action)
+	}
+
+	ctx := context.Background()
+	conn, err := client.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			log.WithError(err).Error("Could not close connection")
+		}
+	}()
+	adminClient := admin.NewClient(conn)
+
+	switch action {
+	case "members":
+		res, err := adminClient.ListMembers(ctx, &admin.ListMembersRequest{})
+		if err != nil {
+			return err
+		}
+		return printJSON(res)
+	case "add":
+		if _, err := adminClient.AddMember(ctx, &admin.AddMemberRequest{
+			ID:      *id,
+			Address: *memberAddr,
+		}); err != nil {
+			return err
+		}
+		log.WithFields(logrus.Fields{"id": *id, "address": *memberAddr}).Info("Added cluster member")
+	case "remove":
+		if _, err := adminClient.RemoveMember(ctx, &admin.RemoveMemberRequest{
+			ID: *id,
+		}); err != nil {
+			return err
+		}
+		log.WithField("id", *id).Info("Removed cluster member")
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/prysmaticlabs/remote-signer/exits"
+	"github.com/prysmaticlabs/remote-signer/rpc/admin"
+	"github.com/sirupsen/logrus"
+)
+
+// runExitsCommand approves or rejects the voluntary exits held by a running
+// server through the admin API. With signed approvals, operators sign their
+// decisions with the ed25519 key whose public key is in the operators file of
+// the server, generated with the keygen subcommand:
+//
+//	exits list
+//	exits approve --id=...
+//	exits approve --id=... --operator=alice --operator-key=alice.key
+//	exits reject --id=... --operator=bob --reason="..." --operator-key=bob.key
+//	exits keygen --operator-key=alice.key
+func runExitsCommand(args []string) error {
+	fs := flag.NewFlagSet("exits", flag.ExitOnError)
+	client := newClientFlags(fs)
+	id := fs.String("id", "", "ID of the voluntary exit to approve or reject")
+	operator := fs.String("operator", "", "name of the operator approving or rejecting the exit, with signed approvals")
+	operatorKey := fs.String(
+		"operator-key", "", "path to the hex encoded ed25519 private key of the operator, with signed approvals",
+	)
+	reason := fs.String("reason", "", "reason for rejecting the exit, recorded in the server logs")
+	if len(args) == 0 {
+		return usageError(fs, "expected an exits subcommand: list | approve | reject | keygen")
+	}
+	action := args[0]
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	switch action {
+	case "list":
+	case "approve":
+		if *id == "" {
+			return usageError(fs, "expected --id flag")
+		}
+	case "reject":
+		if *id == "" || *reason == "" {
+			return usageError(fs, "expected --id and --reason flags")
+		}
+	case "keygen":
+		if *operatorKey == "" {
+			return usageError(fs, "expected --operator-key flag")
+		}
+		return generateOperatorKey(*operatorKey)
+	default:
+		return usageError(fs, "unknown exits subcommand %s", action)
+	}
+	if (*operator == "") != (*operatorKey == "") {
+		return usageError(fs, "expected both --operator and --operator-key flags to sign the decision")
+	}
+
+	var sig string
+	if action != "list" && *operatorKey != "" {
+		key, err := loadOperatorKey(*operatorKey)
+		if err != nil {
+			return err
+		}
+		msg := exits.ApprovalMessage(*id)
+		if action == "reject" {
+			msg = exits.RejectionMessage(*id)
+		}
+		sig = fmt.Sprintf("%#x", ed25519.Sign(key, msg))
+	}
+
+	ctx := context.Background()
+	conn, err := client.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			log.WithError(err).Error("Could not close connection")
+		}
+	}()
+	adminClient := admin.NewClient(conn)
+
+	switch action {
+	case "list":
+		res, err := adminClient.ListExits(ctx, &admin.ListExitsRequest{})
+		if err != nil {
+			return err
+		}
+		return printJSON(res.Exits)
+	case "approve":
+		res, err := adminClient.ApproveExit(ctx, &admin.ApproveExitRequest{
+			ID:        *id,
+			Operator:  *operator,
+			Signature: sig,
+		})
+		if err != nil {
+			return err
+		}
+		log.WithFields(logrus.Fields{"id": *id, "state": res.Exit.State}).Info("Approved voluntary exit")
+	case "reject":
+		if _, err := adminClient.RejectExit(ctx, &admin.RejectExitRequest{
+			ID:        *id,
+			Operator:  *operator,
+			Reason:    *reason,
+			Signature: sig,
+		}); err != nil {
+			return err
+		}
+		log.WithField("id", *id).Info("Rejected voluntary exit")
+	}
+	return nil
+}
+
+// generateOperatorKey writes a new ed25519 private key of an operator, and
+// prints its public key to add to the operators file of the server.
+func generateOperatorKey(path string) error {
+	pubKey, privKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return errors.Wrap(err, "could not generate operator key")
+	}
+	if err := ioutil.WriteFile(path, []byte(hex.EncodeToString(privKey.Seed())), 0600); err != nil {
+		return errors.Wrapf(err, "could not write operator key %s", path)
+	}
+	fmt.Printf("%#x\n", []byte(pubKey))
+	return nil
+}
+
+// loadOperatorKey reads the hex encoded ed25519 private key of an operator.
+func loadOperatorKey(path string) (ed25519.PrivateKey, error) {
+	enc, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read operator key %s", path)
+	}
+	seed, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(string(enc)), "0x"))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, errors.Errorf("invalid ed25519 private key in %s", path)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
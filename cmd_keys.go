@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"flag"
+
+	"github.com/prysmaticlabs/remote-signer/rpc/admin"
+)
+
+// runKeysCommand manages the keys of a running server through the admin API:
+//
+//	keys list
+//	keys disable --public-key=0x... --reason="..."
+//	keys enable --public-key=0x...
+func runKeysCommand(args []string) error {
+	fs := flag.NewFlagSet("keys", flag.ExitOnError)
+	client := newClientFlags(fs)
+	pubKey := fs.String("public-key", "", "hex encoded public key of the key to disable or enable")
+	reason := fs.String("reason", "", "reason for disabling the key, recorded in the server logs")
+	if len(args) == 0 {
+		return usageError(fs, "expected a keys subcommand: list | disable | enable")
+	}
+	action := args[0]
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	switch action {
+	case "list":
+	case "disable":
+		if *pubKey == "" || *reason == "" {
+			return usageError(fs, "expected --public-key and --reason flags")
+		}
+	case "enable":
+		if *pubKey == "" {
+			return usageError(fs, "expected --public-key flag")
+		}
+	default:
+		return usageError(fs, "unknown keys subcommand %s", action)
+	}
+
+	ctx := context.Background()
+	conn, err := client.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			log.WithError(err).Error("Could not close connection")
+		}
+	}()
+	adminClient := admin.NewClient(conn)
+
+	switch action {
+	case "list":
+		res, err := adminClient.ListKeys(ctx, &admin.ListKeysRequest{})
+		if err != nil {
+			return err
+		}
+		return printJSON(res.Keys)
+	case "disable":
+		if _, err := adminClient.DisableKey(ctx, &admin.DisableKeyRequest{
+			PublicKey: *pubKey,
+			Reason:    *reason,
+		}); err != nil {
+			return err
+		}
+		log.WithField("publicKey", *pubKey).Info("Disabled key")
+	case "enable":
+		if _, err := adminClient.EnableKey(ctx, &admin.EnableKeyRequest{
+			PublicKey: *pubKey,
+		}); err != nil {
+			return err
+		}
+		log.WithField("publicKey", *pubKey).Info("Enabled key")
+	}
+	return nil
+}
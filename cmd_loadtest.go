@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+
+	emptypb "github.com/golang/protobuf/ptypes/empty"
+	"github.com/pkg/errors"
+	types "github.com/prysmaticlabs/eth2-types"
+	validatorpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1/validator-client"
+	"github.com/prysmaticlabs/remote-signer/loadtest"
+)
+
+// runLoadtestCommand replays the signing load of synthetic validators
+// against a running server, whose keys are the validators, or against an
+// in-process server with a deterministic keyvault, and reports the
+// throughput and latency percentiles of the signer:
+//
+//	loadtest --in-process --validators=10000 --slots=64
+//	loadtest --addr=signer:4000 --tls-ca-path=ca.crt --start-slot=2000000 --slot-duration=12s
+//
+// Requests against a running server are recorded by its slashing protection
+// like any other, so --start-slot must be ahead of the signing history of
+// its keys. Never run a load test against a signer holding live keys.
+func runLoadtestCommand(args []string) error {
+	fs := flag.NewFlagSet("loadtest", flag.ExitOnError)
+	flags := newClientFlags(fs)
+	inProcess := fs.Bool("in-process", false, "load an in-process server with a deterministic keyvault instead of a running server")
+	validators := fs.Int("validators", 1000, "number of synthetic validators, every key of a running server if 0")
+	slots := fs.Uint64("slots", 32, "number of slots to replay")
+	startSlot := fs.Uint64("start-slot", 0, "first slot to sign")
+	slotDuration := fs.Duration("slot-duration", 0, "duration of a slot, 12s on mainnet, slots following each other at once if 0")
+	concurrency := fs.Int("concurrency", loadtest.DefaultConcurrency, "number of sign requests in flight at once")
+	slotsPerEpoch := fs.Uint64("slots-per-epoch", loadtest.DefaultSlotsPerEpoch, "slots per epoch of the network")
+	syncCommitteeSize := fs.Int("sync-committee-size", loadtest.DefaultSyncCommitteeSize, "number of validators in the sync committee")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	var signer validatorpb.RemoteSignerClient
+	var pubKeys [][]byte
+	if *inProcess {
+		if *validators <= 0 {
+			return usageError(fs, "expected --validators flag for an in-process server")
+		}
+		srv, err := loadtest.StartServer(ctx, *validators)
+		if err != nil {
+			return errors.Wrap(err, "could not start in-process server")
+		}
+		defer func() {
+			if err := srv.Stop(); err != nil {
+				log.WithError(err).Error("Could not stop in-process server")
+			}
+		}()
+		signer, pubKeys = srv.Client, srv.PublicKeys
+	} else {
+		conn, err := flags.dial(ctx)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := conn.Close(); err != nil {
+				log.WithError(err).Error("Could not close connection")
+			}
+		}()
+		signer = validatorpb.NewRemoteSignerClient(conn)
+		res, err := signer.ListValidatingPublicKeys(ctx, &emptypb.Empty{})
+		if err != nil {
+			return errors.Wrap(err, "could not list public keys")
+		}
+		pubKeys = res.ValidatingPublicKeys
+		if *validators > 0 {
+			if *validators > len(pubKeys) {
+				return errors.Errorf("expected %d validators, the server holds %d keys", *validators, len(pubKeys))
+			}
+			pubKeys = pubKeys[:*validators]
+		}
+	}
+
+	report, err := loadtest.Run(ctx, signer, &loadtest.Config{
+		PublicKeys:        pubKeys,
+		StartSlot:         types.Slot(*startSlot),
+		Slots:             *slots,
+		SlotDuration:      *slotDuration,
+		Concurrency:       *concurrency,
+		SlotsPerEpoch:     *slotsPerEpoch,
+		SyncCommitteeSize: *syncCommitteeSize,
+	})
+	if err != nil {
+		return err
+	}
+	return report.Write(os.Stdout)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"flag"
+
+	"github.com/prysmaticlabs/remote-signer/rpc/admin"
+)
+
+// runMaintenanceCommand toggles the maintenance mode of a running server
+// through the admin API. In maintenance mode, public keys are still listed
+// but every sign request fails as unavailable:
+//
+//	maintenance status
+//	maintenance enable --reason="..."
+//	maintenance disable
+func runMaintenanceCommand(args []string) error {
+	fs := flag.NewFlagSet("maintenance", flag.ExitOnError)
+	client := newClientFlags(fs)
+	reason := fs.String("reason", "", "reason for entering maintenance mode, returned to the callers of Sign")
+	if len(args) == 0 {
+		return usageError(fs, "expected a maintenance subcommand: status | enable | disable")
+	}
+	action := args[0]
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	switch action {
+	case "status", "disable":
+	case "enable":
+		if *reason == "" {
+			return usageError(fs, "expected --reason flag")
+		}
+	default:
+		return usageError(fs, "unknown maintenance subcommand %s", action)
+	}
+
+	ctx := context.Background()
+	conn, err := client.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			log.WithError(err).Error("Could not close connection")
+		}
+	}()
+	adminClient := admin.NewClient(conn)
+
+	if action == "status" {
+		res, err := adminClient.GetMaintenance(ctx, &admin.GetMaintenanceRequest{})
+		if err != nil {
+			return err
+		}
+		return printJSON(res.Maintenance)
+	}
+	res, err := adminClient.SetMaintenance(ctx, &admin.SetMaintenanceRequest{
+		Enabled: action == "enable",
+		Reason:  *reason,
+	})
+	if err != nil {
+		return err
+	}
+	return printJSON(res.Maintenance)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/prysmaticlabs/remote-signer/slashing/replication"
+)
+
+// peerHistory is the state of the slashing protection history of a signer,
+// as reported by the slashing-check subcommand.
+type peerHistory struct {
+	Address      string `json:"address"`
+	LastSequence uint64 `json:"last_sequence,omitempty"`
+	LastHash     string `json:"last_hash,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// consistencyReport is the output of the slashing-check subcommand.
+type consistencyReport struct {
+	Consistent     bool           `json:"consistent"`
+	CommonSequence uint64         `json:"common_sequence"`
+	Peers          []*peerHistory `json:"peers"`
+}
+
+// runSlashingCheckCommand checks that the signers of a replication cluster
+// hold the same slashing protection history:
+//
+//	slashing-check --peers-file=peers.json --token-file=token.txt
+//
+// Histories are compared by the hash of their record at the last sequence
+// every signer has, since each record hash commits to the whole history up to
+// it. Signers lagging behind are consistent as long as they are a prefix.
+func runSlashingCheckCommand(args []string) error {
+	fs := flag.NewFlagSet("slashing-check", flag.ExitOnError)
+	peersFile := fs.String("peers-file", "", "path to the JSON list of signers to check, in the replication peers format")
+	tokenFile := fs.String("token-file", "", "path to the file holding the replication token of the signers")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *peersFile == "" || *tokenFile == "" {
+		return usageError(fs, "expected --peers-file and --token-file flags")
+	}
+	token, err := replication.LoadToken(*tokenFile)
+	if err != nil {
+		return err
+	}
+	peers, err := replication.LoadPeers(*peersFile)
+	if err != nil {
+		return err
+	}
+	clients, closePeers, err := replication.DialPeers(peers, token)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := closePeers(); err != nil {
+			log.WithError(err).Error("Could not close peer connections")
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	defer cancel()
+	report := &consistencyReport{Consistent: true}
+	reachable := make(map[string]replication.Client)
+	for address, client := range clients {
+		h := &peerHistory{Address: address}
+		report.Peers = append(report.Peers, h)
+		res, err := client.Status(ctx, &replication.StatusRequest{})
+		if err != nil {
+			h.Error = err.Error()
+			report.Consistent = false
+			continue
+		}
+		h.LastSequence = res.LastSequence
+		h.LastHash = fmt.Sprintf("%#x", res.LastHash)
+		if len(reachable) == 0 || res.LastSequence < report.CommonSequence {
+			report.CommonSequence = res.LastSequence
+		}
+		reachable[address] = client
+	}
+	sort.Slice(report.Peers, func(i, j int) bool {
+		return report.Peers[i].Address < report.Peers[j].Address
+	})
+
+	var commonHash []byte
+	for address, client := range reachable {
+		res, err := client.Status(ctx, &replication.StatusRequest{Sequence: report.CommonSequence})
+		if err != nil {
+			return errors.Wrapf(err, "could not fetch status of %s", address)
+		}
+		if commonHash == nil {
+			commonHash = res.Hash
+		} else if !bytes.Equal(commonHash, res.Hash) {
+			report.Consistent = false
+		}
+	}
+	if err := printJSON(report); err != nil {
+		return err
+	}
+	if !report.Consistent {
+		return errors.New("slashing protection histories are not consistent, or a signer is unreachable")
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/prysmaticlabs/remote-signer/slashing"
+	"github.com/prysmaticlabs/remote-signer/slashing/interchange"
+	"github.com/sirupsen/logrus"
+)
+
+// runSlashingImportCommand imports the slashing protection history exported
+// by another validator client, in the interchange format of EIP-3076, into
+// the database of a stopped signer:
+//
+//	slashing-import --datadir=remote-signer-data --interchange-file=history.json
+func runSlashingImportCommand(args []string) error {
+	fs := flag.NewFlagSet("slashing-import", flag.ExitOnError)
+	dataDir := fs.String("datadir", "remote-signer-data", "directory where the signer persists its state")
+	interchangeFile := fs.String("interchange-file", "", "path to the EIP-3076 interchange file to import")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *interchangeFile == "" {
+		return usageError(fs, "expected --interchange-file flag")
+	}
+	f, err := os.Open(*interchangeFile)
+	if err != nil {
+		return errors.Wrapf(err, "could not open interchange file %s", *interchangeFile)
+	}
+	history, err := interchange.Parse(f)
+	if closeErr := f.Close(); closeErr != nil {
+		log.WithError(closeErr).Error("Could not close interchange file")
+	}
+	if err != nil {
+		return errors.Wrapf(err, "could not parse interchange file %s", *interchangeFile)
+	}
+	db, err := slashing.Open(filepath.Join(*dataDir, slashingProtectionFileName))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.WithError(err).Error("Could not close slashing protection database")
+		}
+	}()
+	imported, err := db.Import(history)
+	if err != nil {
+		return errors.Wrap(err, "could not import slashing protection history")
+	}
+	log.WithFields(logrus.Fields{
+		"genesisValidatorsRoot": fmt.Sprintf("%#x", history.GenesisValidatorsRoot),
+		"numValidators":         len(history.Validators),
+		"numRecords":            imported,
+	}).Info("Imported slashing protection history")
+	return nil
+}
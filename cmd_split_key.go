@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/prysmaticlabs/prysm/crypto/bls"
+	"github.com/prysmaticlabs/remote-signer/keyvault/securemem"
+	"github.com/prysmaticlabs/remote-signer/threshold"
+)
+
+// runSplitKeyCommand splits a validator secret key into threshold shares:
+//
+//	split-key --secret-key-file=key.txt --threshold=2 --num-shares=3 --output-dir=out
+//
+// For each share index i, the share file is written to out/signer-<i>/ to be loaded
+// by the signer holding that share, and the key set with the verification keys of
+// every share is written to out/keysets/ to be loaded by the coordinator.
+func runSplitKeyCommand(args []string) error {
+	fs := flag.NewFlagSet("split-key", flag.ExitOnError)
+	secretKeyFile := fs.String("secret-key-file", "", "path to a file containing the hex encoded secret key to split")
+	t := fs.Int("threshold", 2, "number of shares required to produce a signature")
+	n := fs.Int("num-shares", 3, "total number of shares to generate, one per signer")
+	outputDir := fs.String("output-dir", "", "directory where share and key set files are written")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *secretKeyFile == "" || *outputDir == "" {
+		return usageError(fs, "expected --secret-key-file and --output-dir flags")
+	}
+
+	content, err := ioutil.ReadFile(*secretKeyFile)
+	if err != nil {
+		return errors.Wrap(err, "could not read secret key file")
+	}
+	defer securemem.Zero(content)
+	rawKey, err := threshold.DecodeHex(strings.TrimSpace(string(content)), 32)
+	if err != nil {
+		return errors.Wrap(err, "could not decode secret key")
+	}
+	defer securemem.Zero(rawKey)
+	secretKey, err := bls.SecretKeyFromBytes(rawKey)
+	if err != nil {
+		return errors.Wrap(err, "could not parse secret key")
+	}
+	groupPubKey := secretKey.PublicKey()
+	keyShares, err := threshold.Split(secretKey, *t, *n)
+	if err != nil {
+		return err
+	}
+
+	fileName := fmt.Sprintf("%#x.json", groupPubKey.Marshal()[:8])
+	for _, share := range keyShares {
+		dir := filepath.Join(*outputDir, fmt.Sprintf("signer-%d", share.Index))
+		if err := writeJSONFile(filepath.Join(dir, fileName), threshold.NewShareFile(groupPubKey, *t, share)); err != nil {
+			return err
+		}
+	}
+	keySetPath := filepath.Join(*outputDir, "keysets", fileName)
+	if err := writeJSONFile(keySetPath, threshold.NewKeySet(groupPubKey, *t, keyShares)); err != nil {
+		return err
+	}
+	log.WithField("publicKey", fmt.Sprintf("%#x", groupPubKey.Marshal())).Infof(
+		"Split key into %d shares with threshold %d, written to %s", *n, *t, *outputDir,
+	)
+	return nil
+}
+
+// writeJSONFile writes v as JSON to a file only readable by the current user.
+func writeJSONFile(path string, v interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return errors.Wrapf(err, "could not create directory for %s", path)
+	}
+	enc, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, enc, 0600); err != nil {
+		return errors.Wrapf(err, "could not write %s", path)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/prysmaticlabs/remote-signer/auth"
+)
+
+// runTokensCommand generates the bearer tokens of the callers of a server
+// started with --auth-token-file. The token is written to a file for the
+// caller, and the entry to add to the token file of the server is printed,
+// holding the hash of the token only:
+//
+//	tokens generate --id=validator-a --scopes=sign,list --token-out=validator-a.token
+//	tokens generate --id=operator --scopes=admin,metrics --public-keys=0x...,0x... --token-out=operator.token
+func runTokensCommand(args []string) error {
+	fs := flag.NewFlagSet("tokens", flag.ExitOnError)
+	id := fs.String("id", "", "ID of the token, recorded in the server logs")
+	scopes := fs.String("scopes", "", "comma separated scopes of the token: sign | list | admin | metrics")
+	pubKeys := fs.String("public-keys", "", "comma separated hex public keys the token is restricted to, every key if empty")
+	tokenOut := fs.String("token-out", "", "path to write the generated token to")
+	if len(args) == 0 {
+		return usageError(fs, "expected a tokens subcommand: generate")
+	}
+	action := args[0]
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if action != "generate" {
+		return usageError(fs, "unknown tokens subcommand %s", action)
+	}
+	if *id == "" || *scopes == "" || *tokenOut == "" {
+		return usageError(fs, "expected --id, --scopes and --token-out flags")
+	}
+
+	token, hash, err := auth.Generate()
+	if err != nil {
+		return err
+	}
+	entry := &auth.TokenEntry{
+		ID:     *id,
+		SHA256: hash,
+		Scopes: strings.Split(*scopes, ","),
+	}
+	if *pubKeys != "" {
+		entry.PublicKeys = strings.Split(*pubKeys, ",")
+	}
+	if err := ioutil.WriteFile(*tokenOut, []byte(token+"\n"), 0600); err != nil {
+		return errors.Wrapf(err, "could not write token %s", *tokenOut)
+	}
+	return printJSON(entry)
+}
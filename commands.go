@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prysmaticlabs/remote-signer/client"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// commands are the subcommands of the remote signer binary, such as
+// tools connecting to a running server through its gRPC API.
+var commands = map[string]func(args []string) error{
+	"client":          runClientCommand,
+	"cluster":         runClusterCommand,
+	"exits":           runExitsCommand,
+	"keys":            runKeysCommand,
+	"loadtest":        runLoadtestCommand,
+	"maintenance":     runMaintenanceCommand,
+	"slashing-check":  runSlashingCheckCommand,
+	"slashing-import": runSlashingImportCommand,
+	"split-key":       runSplitKeyCommand,
+	"tokens":          runTokensCommand,
+}
+
+// dialTimeout bounds how long subcommands wait to connect to the server.
+const dialTimeout = 10 * time.Second
+
+// clientFlags are the flags shared by every subcommand
+// connecting to a running remote signer server.
+type clientFlags struct {
+	addr       *string
+	caCertPath *string
+	certPath   *string
+	keyPath    *string
+	serverName *string
+	tokenFile  *string
+}
+
+func newClientFlags(fs *flag.FlagSet) *clientFlags {
+	return &clientFlags{
+		addr: fs.String(
+			"addr",
+			"127.0.0.1:4000",
+			"host:port of the remote signer gRPC server, or unix:///path/to/socket",
+		),
+		caCertPath: fs.String(
+			"tls-ca-path",
+			"",
+			"/path/to/ca.crt used to verify the server certificate",
+		),
+		certPath: fs.String(
+			"tls-cert-path",
+			"",
+			"/path/to/client.crt presented to servers requiring mutual TLS",
+		),
+		keyPath: fs.String(
+			"tls-key-path",
+			"",
+			"/path/to/client.key of the client certificate",
+		),
+		serverName: fs.String(
+			"tls-server-name",
+			"",
+			"override of the server name expected in the server certificate",
+		),
+		tokenFile: fs.String(
+			"token-file",
+			"",
+			"/path/to/a file holding the bearer token to authenticate with, if the server requires tokens",
+		),
+	}
+}
+
+// token reads the bearer token of the token file, if any.
+func (c *clientFlags) token() (string, error) {
+	if *c.tokenFile == "" {
+		return "", nil
+	}
+	enc, err := ioutil.ReadFile(*c.tokenFile)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not read token file %s", *c.tokenFile)
+	}
+	return strings.TrimSpace(string(enc)), nil
+}
+
+// unixSocket tells whether the server is reached on a Unix domain
+// socket, such as unix:///run/remote-signer.sock, without TLS.
+func (c *clientFlags) unixSocket() bool {
+	return strings.HasPrefix(*c.addr, "unix:")
+}
+
+// credentials returns the TLS credentials of the server, presenting the
+// client certificate if any, or plain credentials for its Unix domain socket.
+func (c *clientFlags) credentials() (credentials.TransportCredentials, error) {
+	if c.unixSocket() {
+		return client.LocalCredentials(), nil
+	}
+	if *c.caCertPath == "" {
+		return nil, errors.New("expected --tls-ca-path flag for secure connections")
+	}
+	if *c.certPath != "" || *c.keyPath != "" {
+		return client.MutualTLSCredentials(*c.caCertPath, *c.certPath, *c.keyPath, *c.serverName)
+	}
+	return client.TLSCredentials(*c.caCertPath, *c.serverName)
+}
+
+// dial opens a TLS connection to the remote signer server,
+// or a plain connection to its Unix domain socket.
+func (c *clientFlags) dial(ctx context.Context) (*grpc.ClientConn, error) {
+	creds, err := c.credentials()
+	if err != nil {
+		return nil, err
+	}
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(creds), grpc.WithBlock()}
+	token, err := c.token()
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(client.TokenCredentials(token)))
+	}
+	ctx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, *c.addr, opts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not connect to %s", *c.addr)
+	}
+	return conn, nil
+}
+
+// printJSON writes v to stdout as indented JSON.
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// usageError returns an error describing the expected usage of a subcommand.
+func usageError(fs *flag.FlagSet, format string, args ...interface{}) error {
+	fs.Usage()
+	return fmt.Errorf(format, args...)
+}
@@ -0,0 +1,233 @@
+/*
+Package doppelganger protects against running the same validator keys in two
+places at once. Keys registered with the guard are put on probation: block and
+attestation signing requests are denied for a number of epochs, while a liveness
+checker looks for evidence that the validators are already active elsewhere.
+Keys found live on chain are disabled, the others are released.
+*/
+package doppelganger
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	types "github.com/prysmaticlabs/eth2-types"
+	"github.com/prysmaticlabs/prysm/crypto/bls"
+	validatorpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1/validator-client"
+	"github.com/prysmaticlabs/remote-signer/clock"
+	"github.com/prysmaticlabs/remote-signer/keyvault"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.WithField("prefix", "doppelganger")
+
+// DisabledReason is the reason recorded when disabling a key found live elsewhere.
+const DisabledReason = "doppelganger detected"
+
+var (
+	// ErrProbation is returned when signing with a key still under doppelganger protection.
+	ErrProbation = errors.New("key is under doppelganger protection")
+	// ErrDetected is returned when signing with a key found live elsewhere.
+	ErrDetected = errors.New("key was detected as live elsewhere")
+)
+
+// Config options for the doppelganger guard.
+type Config struct {
+	// Checker reports the liveness of validators on chain.
+	Checker LivenessChecker
+	// Clock tells the current epoch of the chain.
+	Clock *clock.Clock
+	// Epochs is the number of epochs a key stays on probation.
+	Epochs types.Epoch
+	// Disabler, if set, persistently disables keys found live elsewhere.
+	Disabler keyvault.ToggleStore
+}
+
+// probation tracks the liveness checks of a registered key.
+type probation struct {
+	// nextEpoch is the next epoch to check for liveness.
+	nextEpoch types.Epoch
+	// releaseEpoch is the epoch after the last one to check.
+	releaseEpoch types.Epoch
+	detected     bool
+}
+
+// Guard denies signing requests for keys on probation.
+type Guard struct {
+	cfg  *Config
+	lock sync.RWMutex
+	keys map[[48]byte]*probation
+}
+
+// NewGuard instantiates a doppelganger guard.
+func NewGuard(cfg *Config) (*Guard, error) {
+	if cfg.Checker == nil || cfg.Clock == nil {
+		return nil, errors.New("expected a liveness checker and a clock")
+	}
+	if cfg.Epochs == 0 {
+		return nil, errors.New("expected at least one epoch of doppelganger protection")
+	}
+	return &Guard{
+		cfg:  cfg,
+		keys: make(map[[48]byte]*probation),
+	}, nil
+}
+
+// Register puts keys on probation, such as after startup or when importing
+// keys. Liveness is checked from the next epoch on: the validators may have
+// been live in the previous and current epochs through this very signer
+// before a restart, while keys on probation are denied any later signature.
+func (g *Guard) Register(pubKeys []bls.PublicKey) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	first := g.cfg.Clock.CurrentEpoch() + 1
+	for _, pubKey := range pubKeys {
+		g.keys[toBytes48(pubKey)] = &probation{
+			nextEpoch:    first,
+			releaseEpoch: first + g.cfg.Epochs,
+		}
+	}
+	log.WithFields(logrus.Fields{
+		"numKeys":      len(pubKeys),
+		"epoch":        first,
+		"releaseEpoch": first + g.cfg.Epochs,
+	}).Info("Started doppelganger protection")
+}
+
+// CheckSign returns an error if the signing request must be denied, which is
+// the case for blocks and attestations signed by keys on probation or detected
+// live elsewhere. Other requests, such as exits, are not slashable and allowed.
+func (g *Guard) CheckSign(pubKey [48]byte, req *validatorpb.SignRequest) error {
+	switch req.Object.(type) {
+	case *validatorpb.SignRequest_Block,
+		*validatorpb.SignRequest_BlockV2,
+		*validatorpb.SignRequest_AttestationData,
+		*validatorpb.SignRequest_AggregateAttestationAndProof:
+	default:
+		return nil
+	}
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	p, ok := g.keys[pubKey]
+	if !ok {
+		return nil
+	}
+	if p.detected {
+		return ErrDetected
+	}
+	return errors.Wrapf(ErrProbation, "until epoch %d", p.releaseEpoch)
+}
+
+// Run checks the liveness of keys on probation every slot, until the context is canceled.
+func (g *Guard) Run(ctx context.Context) {
+	ticker := time.NewTicker(g.cfg.Clock.SlotDuration())
+	defer ticker.Stop()
+	for {
+		g.CheckLiveness(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// CheckLiveness checks the liveness of keys on probation in every completed
+// epoch not yet checked. Keys live in any of them are detected and disabled,
+// keys which were not live in any of them once their probation ends are released.
+// If the liveness checker fails, keys stay on probation until the next check.
+func (g *Guard) CheckLiveness(ctx context.Context) {
+	current := g.cfg.Clock.CurrentEpoch()
+	for {
+		epoch, pubKeys := g.pending(current)
+		if len(pubKeys) == 0 {
+			return
+		}
+		live, err := g.cfg.Checker.IsLive(ctx, epoch, pubKeys)
+		if err != nil {
+			log.WithError(err).WithField("epoch", epoch).Warn("Could not check validator liveness")
+			return
+		}
+		g.update(ctx, epoch, pubKeys, live)
+	}
+}
+
+// pending returns the earliest completed epoch still to check, and the keys to check in it.
+func (g *Guard) pending(current types.Epoch) (types.Epoch, [][48]byte) {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	var epoch types.Epoch
+	var pubKeys [][48]byte
+	for pubKey, p := range g.keys {
+		if p.detected || p.nextEpoch >= current {
+			continue
+		}
+		if len(pubKeys) == 0 || p.nextEpoch < epoch {
+			epoch = p.nextEpoch
+			pubKeys = pubKeys[:0]
+		}
+		if p.nextEpoch == epoch {
+			pubKeys = append(pubKeys, pubKey)
+		}
+	}
+	return epoch, pubKeys
+}
+
+// update records the liveness of keys checked in an epoch.
+func (g *Guard) update(ctx context.Context, epoch types.Epoch, pubKeys [][48]byte, live map[[48]byte]bool) {
+	var detected [][48]byte
+	g.lock.Lock()
+	for _, pubKey := range pubKeys {
+		p, ok := g.keys[pubKey]
+		if !ok {
+			continue
+		}
+		fields := logrus.Fields{"publicKey": fmt.Sprintf("%#x", pubKey), "epoch": epoch}
+		if live[pubKey] {
+			p.detected = true
+			detected = append(detected, pubKey)
+			log.WithFields(fields).Error("Doppelganger detected, validator is live elsewhere")
+			continue
+		}
+		p.nextEpoch = epoch + 1
+		if p.nextEpoch >= p.releaseEpoch {
+			delete(g.keys, pubKey)
+			log.WithFields(fields).Info("Released key from doppelganger protection")
+		}
+	}
+	g.lock.Unlock()
+
+	for _, pubKey := range detected {
+		g.disable(ctx, pubKey)
+	}
+}
+
+// disable persistently disables a detected key. Once disabled, the key
+// is denied by the keyvault and can be enabled again by an operator,
+// so the guard forgets about it. Otherwise, the guard keeps denying it.
+func (g *Guard) disable(ctx context.Context, pubKey [48]byte) {
+	if g.cfg.Disabler == nil {
+		return
+	}
+	blsPubKey, err := bls.PublicKeyFromBytes(pubKey[:])
+	if err != nil {
+		log.WithError(err).Error("Could not parse detected public key")
+		return
+	}
+	if err := g.cfg.Disabler.DisableKey(ctx, blsPubKey, DisabledReason); err != nil {
+		log.WithError(err).WithField("publicKey", fmt.Sprintf("%#x", pubKey)).Error("Could not disable detected key")
+		return
+	}
+	g.lock.Lock()
+	delete(g.keys, pubKey)
+	g.lock.Unlock()
+}
+
+func toBytes48(pubKey bls.PublicKey) [48]byte {
+	var b [48]byte
+	copy(b[:], pubKey.Marshal())
+	return b
+}
@@ -0,0 +1,165 @@
+package doppelganger
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	types "github.com/prysmaticlabs/eth2-types"
+	"github.com/prysmaticlabs/prysm/crypto/bls"
+	validatorpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1/validator-client"
+	"github.com/prysmaticlabs/remote-signer/clock"
+)
+
+type mockDisabler struct {
+	disabled map[[48]byte]string
+}
+
+func (m *mockDisabler) DisableKey(_ context.Context, pubKey bls.PublicKey, reason string) error {
+	m.disabled[toBytes48(pubKey)] = reason
+	return nil
+}
+
+func (m *mockDisabler) EnableKey(_ context.Context, pubKey bls.PublicKey) error {
+	delete(m.disabled, toBytes48(pubKey))
+	return nil
+}
+
+func setupGuard(t *testing.T, disabler *mockDisabler) (*Guard, *FakeLivenessChecker, func(types.Epoch)) {
+	genesis := time.Unix(1606824023, 0)
+	now := genesis
+	c := clock.NewWithTimeSource(genesis, 12, 32, func() time.Time { return now })
+	setEpoch := func(epoch types.Epoch) {
+		now = genesis.Add(time.Duration(uint64(epoch)*32*12) * time.Second)
+	}
+	setEpoch(10)
+	checker := NewFakeLivenessChecker()
+	cfg := &Config{
+		Checker: checker,
+		Clock:   c,
+		Epochs:  2,
+	}
+	if disabler != nil {
+		cfg.Disabler = disabler
+	}
+	g, err := NewGuard(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g, checker, setEpoch
+}
+
+func TestGuard_ReleasesKeysNotLive(t *testing.T) {
+	ctx := context.Background()
+	g, _, setEpoch := setupGuard(t, nil)
+	secretKey, err := bls.RandKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey := toBytes48(secretKey.PublicKey())
+	g.Register([]bls.PublicKey{secretKey.PublicKey()})
+
+	blockReq := &validatorpb.SignRequest{Object: &validatorpb.SignRequest_Block{}}
+	exitReq := &validatorpb.SignRequest{Object: &validatorpb.SignRequest_Exit{}}
+	if err := g.CheckSign(pubKey, blockReq); !errors.Is(err, ErrProbation) {
+		t.Errorf("Wanted %v, received %v", ErrProbation, err)
+	}
+	if err := g.CheckSign(pubKey, exitReq); err != nil {
+		t.Errorf("Wanted exits to be allowed, received %v", err)
+	}
+
+	// Epochs 11 and 12 are checked, the probation lasts until epoch 13.
+	setEpoch(12)
+	g.CheckLiveness(ctx)
+	if err := g.CheckSign(pubKey, blockReq); !errors.Is(err, ErrProbation) {
+		t.Errorf("Wanted %v, received %v", ErrProbation, err)
+	}
+	setEpoch(13)
+	g.CheckLiveness(ctx)
+	if err := g.CheckSign(pubKey, blockReq); err != nil {
+		t.Errorf("Wanted key to be released, received %v", err)
+	}
+}
+
+func TestGuard_DisablesLiveKeys(t *testing.T) {
+	ctx := context.Background()
+	disabler := &mockDisabler{disabled: make(map[[48]byte]string)}
+	g, checker, setEpoch := setupGuard(t, disabler)
+	secretKey, err := bls.RandKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey := toBytes48(secretKey.PublicKey())
+	g.Register([]bls.PublicKey{secretKey.PublicKey()})
+
+	checker.SetLive(pubKey, true)
+	setEpoch(12)
+	g.CheckLiveness(ctx)
+	if reason := disabler.disabled[pubKey]; reason != DisabledReason {
+		t.Errorf("Wanted key disabled with reason %q, received %q", DisabledReason, reason)
+	}
+}
+
+func TestGuard_IgnoresLivenessBeforeRegistration(t *testing.T) {
+	ctx := context.Background()
+	disabler := &mockDisabler{disabled: make(map[[48]byte]string)}
+	g, checker, setEpoch := setupGuard(t, disabler)
+	secretKey, err := bls.RandKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey := toBytes48(secretKey.PublicKey())
+	g.Register([]bls.PublicKey{secretKey.PublicKey()})
+
+	// After a restart in epoch 10, the validator was live in epochs 9
+	// and 10 through this signer, which is not a doppelganger.
+	checker.SetLive(pubKey, true)
+	setEpoch(11)
+	g.CheckLiveness(ctx)
+	if _, ok := disabler.disabled[pubKey]; ok {
+		t.Error("Wanted key not disabled for liveness before its probation")
+	}
+	req := &validatorpb.SignRequest{Object: &validatorpb.SignRequest_AttestationData{}}
+	if err := g.CheckSign(pubKey, req); !errors.Is(err, ErrProbation) {
+		t.Errorf("Wanted %v, received %v", ErrProbation, err)
+	}
+}
+
+func TestGuard_KeepsDetectedKeysWithoutDisabler(t *testing.T) {
+	ctx := context.Background()
+	g, checker, setEpoch := setupGuard(t, nil)
+	secretKey, err := bls.RandKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey := toBytes48(secretKey.PublicKey())
+	g.Register([]bls.PublicKey{secretKey.PublicKey()})
+
+	checker.SetLive(pubKey, true)
+	setEpoch(20)
+	g.CheckLiveness(ctx)
+	req := &validatorpb.SignRequest{Object: &validatorpb.SignRequest_AttestationData{}}
+	if err := g.CheckSign(pubKey, req); err != ErrDetected {
+		t.Errorf("Wanted %v, received %v", ErrDetected, err)
+	}
+}
+
+func TestGuard_StaysOnProbationWhenCheckFails(t *testing.T) {
+	ctx := context.Background()
+	g, checker, setEpoch := setupGuard(t, nil)
+	secretKey, err := bls.RandKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey := toBytes48(secretKey.PublicKey())
+	g.Register([]bls.PublicKey{secretKey.PublicKey()})
+
+	checker.SetError(errors.New("beacon node unavailable"))
+	setEpoch(20)
+	g.CheckLiveness(ctx)
+	req := &validatorpb.SignRequest{Object: &validatorpb.SignRequest_BlockV2{}}
+	if err := g.CheckSign(pubKey, req); !errors.Is(err, ErrProbation) {
+		t.Errorf("Wanted %v, received %v", ErrProbation, err)
+	}
+}
@@ -0,0 +1,205 @@
+package doppelganger
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	types "github.com/prysmaticlabs/eth2-types"
+)
+
+// LivenessChecker reports whether validators were seen active on
+// chain during an epoch, usually by querying a beacon node.
+type LivenessChecker interface {
+	// IsLive returns the subset of the public keys which were live during the epoch.
+	IsLive(ctx context.Context, epoch types.Epoch, pubKeys [][48]byte) (map[[48]byte]bool, error)
+}
+
+// beaconRequestTimeout bounds the duration of every beacon node API request.
+const beaconRequestTimeout = 10 * time.Second
+
+// BeaconNodeChecker checks liveness through the standard beacon node API.
+type BeaconNodeChecker struct {
+	endpoint string
+	client   *http.Client
+	lock     sync.Mutex
+	indices  map[[48]byte]string
+}
+
+// NewBeaconNodeChecker instantiates a liveness checker for the
+// beacon node API served at endpoint, e.g. http://localhost:3500.
+func NewBeaconNodeChecker(endpoint string) *BeaconNodeChecker {
+	return &BeaconNodeChecker{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		client:   &http.Client{Timeout: beaconRequestTimeout},
+		indices:  make(map[[48]byte]string),
+	}
+}
+
+type validatorsResponse struct {
+	Data []struct {
+		Index     string `json:"index"`
+		Validator struct {
+			Pubkey string `json:"pubkey"`
+		} `json:"validator"`
+	} `json:"data"`
+}
+
+type livenessResponse struct {
+	Data []struct {
+		Index  string `json:"index"`
+		IsLive bool   `json:"is_live"`
+	} `json:"data"`
+}
+
+// IsLive resolves the validator indices of the public keys, and queries
+// their liveness. Validators which are not yet known by the beacon node
+// cannot have been live, and are reported as such.
+func (b *BeaconNodeChecker) IsLive(ctx context.Context, epoch types.Epoch, pubKeys [][48]byte) (map[[48]byte]bool, error) {
+	indices, err := b.resolveIndices(ctx, pubKeys)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not resolve validator indices")
+	}
+	live := make(map[[48]byte]bool)
+	if len(indices) == 0 {
+		return live, nil
+	}
+	indexToPubKey := make(map[string][48]byte, len(indices))
+	body := make([]string, 0, len(indices))
+	for pubKey, idx := range indices {
+		indexToPubKey[idx] = pubKey
+		body = append(body, idx)
+	}
+	res := &livenessResponse{}
+	url := fmt.Sprintf("%s/eth/v1/validator/liveness/%d", b.endpoint, epoch)
+	if err := b.do(ctx, http.MethodPost, url, body, res); err != nil {
+		return nil, errors.Wrap(err, "could not query validator liveness")
+	}
+	for _, d := range res.Data {
+		if pubKey, ok := indexToPubKey[d.Index]; ok && d.IsLive {
+			live[pubKey] = true
+		}
+	}
+	return live, nil
+}
+
+// resolveIndices returns the validator index of every public key known by the beacon node.
+func (b *BeaconNodeChecker) resolveIndices(ctx context.Context, pubKeys [][48]byte) (map[[48]byte]string, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	ids := make([]string, 0)
+	for _, pubKey := range pubKeys {
+		if _, ok := b.indices[pubKey]; !ok {
+			ids = append(ids, fmt.Sprintf("%#x", pubKey))
+		}
+	}
+	if len(ids) > 0 {
+		res := &validatorsResponse{}
+		url := fmt.Sprintf("%s/eth/v1/beacon/states/head/validators?id=%s", b.endpoint, strings.Join(ids, ","))
+		if err := b.do(ctx, http.MethodGet, url, nil, res); err != nil {
+			return nil, err
+		}
+		for _, d := range res.Data {
+			raw, err := hex.DecodeString(strings.TrimPrefix(d.Validator.Pubkey, "0x"))
+			if err != nil || len(raw) != 48 {
+				continue
+			}
+			var pubKey [48]byte
+			copy(pubKey[:], raw)
+			if _, err := strconv.ParseUint(d.Index, 10, 64); err != nil {
+				continue
+			}
+			b.indices[pubKey] = d.Index
+		}
+	}
+	indices := make(map[[48]byte]string, len(pubKeys))
+	for _, pubKey := range pubKeys {
+		if idx, ok := b.indices[pubKey]; ok {
+			indices[pubKey] = idx
+		}
+	}
+	return indices, nil
+}
+
+func (b *BeaconNodeChecker) do(ctx context.Context, method, url string, body, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		enc, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(enc)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			log.WithError(err).Debug("Could not close response body")
+		}
+	}()
+	if res.StatusCode != http.StatusOK {
+		return errors.Errorf("unexpected status %s from %s", res.Status, url)
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// FakeLivenessChecker is a liveness checker for tests, reporting
+// a fixed set of public keys as live in any epoch.
+type FakeLivenessChecker struct {
+	lock sync.Mutex
+	live map[[48]byte]bool
+	err  error
+}
+
+// NewFakeLivenessChecker instantiates a fake liveness checker with no live keys.
+func NewFakeLivenessChecker() *FakeLivenessChecker {
+	return &FakeLivenessChecker{
+		live: make(map[[48]byte]bool),
+	}
+}
+
+// SetLive marks a public key as live, or not, in every epoch.
+func (f *FakeLivenessChecker) SetLive(pubKey [48]byte, live bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.live[pubKey] = live
+}
+
+// SetError makes every liveness check fail with err, or succeed if err is nil.
+func (f *FakeLivenessChecker) SetError(err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.err = err
+}
+
+// IsLive returns the public keys marked as live.
+func (f *FakeLivenessChecker) IsLive(_ context.Context, _ types.Epoch, pubKeys [][48]byte) (map[[48]byte]bool, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	live := make(map[[48]byte]bool)
+	for _, pubKey := range pubKeys {
+		if f.live[pubKey] {
+			live[pubKey] = true
+		}
+	}
+	return live, nil
+}
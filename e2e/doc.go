@@ -0,0 +1,7 @@
+/*
+Package e2e tests the remote signer end to end: a real gRPC server is
+started in-process, with generated TLS certificates, a slashing protection
+database and persisted key states, and is called over the network through
+the Go client and the admin API, across restarts of the server.
+*/
+package e2e
@@ -0,0 +1,676 @@
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	types "github.com/prysmaticlabs/eth2-types"
+	"github.com/prysmaticlabs/prysm/crypto/bls"
+	ethpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1"
+	"github.com/prysmaticlabs/remote-signer/client"
+	"github.com/prysmaticlabs/remote-signer/keyvault"
+	"github.com/prysmaticlabs/remote-signer/keyvault/deterministic"
+	"github.com/prysmaticlabs/remote-signer/keyvault/keystate"
+	"github.com/prysmaticlabs/remote-signer/keyvault/mnemonic"
+	"github.com/prysmaticlabs/remote-signer/rpc"
+	"github.com/prysmaticlabs/remote-signer/rpc/admin"
+	"github.com/prysmaticlabs/remote-signer/slashing"
+	"google.golang.org/grpc"
+)
+
+// interopPubKey is the public key of the first of the interop validators,
+// whose deterministic keys are those of the consensus specification tests.
+const interopPubKey = "a99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c"
+
+// sampleMnemonic derives mnemonicPubKeys at EIP-2334 indices 0 and 1.
+const sampleMnemonic = "voice gospel easy verb front diesel sense worth sword equip giggle jeans shoe defy kid degree van frost like blush chef silk spoil obtain"
+
+var mnemonicPubKeys = []string{
+	"9731de7d206fcd68bb4fb34c515192adeb63448de22d8d84bd2faad9d1450a6869c46c5ce8a65b4243ad51cff120b9ae",
+	"98dbc04dbec1261cc26aebc684c7606288fcb890236b0f92a0436911b09ccb5c11b90867d2b94b1f5d67eb92cb8375b2",
+}
+
+const slotsPerEpoch = 32
+
+var forkInfo = &client.ForkInfo{
+	Fork: &ethpb.Fork{
+		PreviousVersion: []byte{0, 0, 0, 0},
+		CurrentVersion:  []byte{1, 0, 0, 0},
+		Epoch:           1,
+	},
+	GenesisValidatorsRoot: bytes.Repeat([]byte{0x42}, 32),
+}
+
+// signer is a remote signer server running in-process, and its clients.
+type signer struct {
+	t      *testing.T
+	srv    *rpc.Server
+	db     *slashing.DB
+	client *client.Client
+	conn   *grpc.ClientConn
+	admin  admin.Client
+}
+
+// startSigner serves a keyvault with the TLS certificates, slashing
+// protection database and key states of dir, which outlive the server
+// so that it is restarted by starting another one on the same dir.
+func startSigner(t *testing.T, dir string, vault keyvault.Store) *signer {
+	t.Helper()
+	store, err := keystate.NewStore(vault, filepath.Join(dir, "keystate.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := slashing.Open(filepath.Join(dir, "slashing.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := rpc.NewServer(context.Background(), &rpc.Config{
+		Host:               "127.0.0.1",
+		Port:               "0",
+		CertFlag:           filepath.Join(dir, "server.crt"),
+		KeyFlag:            filepath.Join(dir, "server.key"),
+		ClientCAFlag:       filepath.Join(dir, "ca.crt"),
+		EnableAdmin:        true,
+		KeyVault:           store,
+		SlashingProtection: db,
+	})
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	s := &signer{t: t, srv: srv, db: db}
+	s.client, s.conn = dial(t, dir, srv.Addrs()[0].String())
+	s.admin = admin.NewClient(s.conn)
+	return s
+}
+
+// dial connects to a server with the client certificate of dir, trusting
+// the CA certificate of dir.
+func dial(t *testing.T, dir, addr string) (*client.Client, *grpc.ClientConn) {
+	t.Helper()
+	creds, err := client.MutualTLSCredentials(
+		filepath.Join(dir, "ca.crt"),
+		filepath.Join(dir, "client.crt"),
+		filepath.Join(dir, "client.key"),
+		"localhost",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := client.New(&client.Config{
+		Endpoints:        []string{addr},
+		Credentials:      creds,
+		MaxAttempts:      1,
+		VerifySignatures: true,
+		ForkInfo:         forkInfo,
+		SlotsPerEpoch:    slotsPerEpoch,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, conn
+}
+
+// stop the server, keeping its dir.
+func (s *signer) stop() {
+	s.t.Helper()
+	if err := s.client.Close(); err != nil {
+		s.t.Error(err)
+	}
+	if err := s.conn.Close(); err != nil {
+		s.t.Error(err)
+	}
+	if err := s.srv.Stop(); err != nil {
+		s.t.Error(err)
+	}
+	if err := s.db.Close(); err != nil {
+		s.t.Error(err)
+	}
+}
+
+// testDir creates a directory holding the TLS certificates of a server.
+func testDir(t *testing.T) (string, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "e2e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeCertificates(dir); err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// writeCertificates generates a CA, and the certificates it issues to the
+// server for localhost and to the client, into dir.
+func writeCertificates(dir string) error {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "e2e CA"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		return err
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(
+		filepath.Join(dir, "ca.crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0600,
+	); err != nil {
+		return err
+	}
+	certs := map[string]*x509.Certificate{
+		"server": {
+			SerialNumber: big.NewInt(2),
+			Subject:      pkix.Name{CommonName: "localhost"},
+			DNSNames:     []string{"localhost"},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		},
+		"client": {
+			SerialNumber: big.NewInt(3),
+			Subject:      pkix.Name{CommonName: "operator"},
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		},
+	}
+	for name, tmpl := range certs {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return err
+		}
+		tmpl.NotBefore = time.Now().Add(-time.Minute)
+		tmpl.NotAfter = time.Now().Add(time.Hour)
+		tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+		if err != nil {
+			return err
+		}
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(
+			filepath.Join(dir, name+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600,
+		); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(
+			filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// root derives a distinct 32 byte root from a name.
+func root(name string) []byte {
+	h := sha256.Sum256([]byte(name))
+	return h[:]
+}
+
+func phase0Block(slot types.Slot, parent string) *ethpb.BeaconBlock {
+	return &ethpb.BeaconBlock{
+		Slot:       slot,
+		ParentRoot: root(parent),
+		StateRoot:  root("state"),
+		Body: &ethpb.BeaconBlockBody{
+			RandaoReveal: make([]byte, 96),
+			Eth1Data:     &ethpb.Eth1Data{DepositRoot: make([]byte, 32), BlockHash: make([]byte, 32)},
+			Graffiti:     make([]byte, 32),
+		},
+	}
+}
+
+func altairBlock(slot types.Slot, parent string) *ethpb.BeaconBlockAltair {
+	return &ethpb.BeaconBlockAltair{
+		Slot:       slot,
+		ParentRoot: root(parent),
+		StateRoot:  root("state"),
+		Body: &ethpb.BeaconBlockBodyAltair{
+			RandaoReveal: make([]byte, 96),
+			Eth1Data:     &ethpb.Eth1Data{DepositRoot: make([]byte, 32), BlockHash: make([]byte, 32)},
+			Graffiti:     make([]byte, 32),
+			SyncAggregate: &ethpb.SyncAggregate{
+				SyncCommitteeBits:      make([]byte, 64),
+				SyncCommitteeSignature: make([]byte, 96),
+			},
+		},
+	}
+}
+
+func attestationData(source, target types.Epoch, head string) *ethpb.AttestationData {
+	return &ethpb.AttestationData{
+		Slot:            types.Slot(uint64(target) * slotsPerEpoch),
+		BeaconBlockRoot: root(head),
+		Source:          &ethpb.Checkpoint{Epoch: source, Root: root("source")},
+		Target:          &ethpb.Checkpoint{Epoch: target, Root: root("target")},
+	}
+}
+
+func TestSigner_RequestTypes(t *testing.T) {
+	ctx := context.Background()
+	dir, cleanup := testDir(t)
+	defer cleanup()
+	vault, err := deterministic.NewStore(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := startSigner(t, dir, vault)
+	defer s.stop()
+
+	pubKeys, err := s.client.ListValidatingPublicKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pubKeys) != 2 || hex.EncodeToString(pubKeys[0]) != interopPubKey {
+		t.Fatalf("Wanted the interop keys, received %x", pubKeys)
+	}
+	pubKey := pubKeys[0]
+	slot := types.Slot(2*slotsPerEpoch + 1)
+	epoch := types.Epoch(2)
+	data := attestationData(1, epoch, "head")
+	selectionData := &ethpb.SyncAggregatorSelectionData{Slot: slot, SubcommitteeIndex: 1}
+	contribution := &ethpb.ContributionAndProof{
+		AggregatorIndex: 0,
+		Contribution: &ethpb.SyncCommitteeContribution{
+			Slot:              slot,
+			BlockRoot:         root("head"),
+			SubcommitteeIndex: 1,
+			AggregationBits:   make([]byte, 16),
+			Signature:         make([]byte, 96),
+		},
+		SelectionProof: make([]byte, 96),
+	}
+	// The expected signatures are those of the interop key over the signing
+	// roots of the objects as defined by the consensus specification, so a
+	// wrong domain or object root in the client or the signer fails.
+	tests := []struct {
+		name      string
+		sign      func() (bls.Signature, error)
+		signature string
+	}{
+		{
+			name: "block",
+			sign: func() (bls.Signature, error) {
+				return s.client.SignBlock(ctx, pubKey, phase0Block(slot, "parent"))
+			},
+			signature: "a56581f399633dad297e99494fd42a0b00ddaff7fdb9ff29b82e8edb8f4559d65ffbe3d4c56ce30a6c792cc6a35b4d19120b788e444b21a708111741e8137c274d11d986eb5a2dc1307743f847b855824a64e23edb508f9fe32d8150c3548944",
+		},
+		{
+			name: "altair block",
+			sign: func() (bls.Signature, error) {
+				return s.client.SignBlockAltair(ctx, pubKey, altairBlock(slot+1, "parent"))
+			},
+			signature: "b8905d0c0240e7a0da21facf251f6e877543f51eb6b87a528ef211ed2f203381b0d7bd2ad18f7104bf41f34c561333a810809f090aac3159bdec3a79d20bc4eb1b3afc73fab93a568c8fca4a1e224972e0c06a42dd98388b6f58456f23767b38",
+		},
+		{
+			name: "attestation",
+			sign: func() (bls.Signature, error) {
+				return s.client.SignAttestation(ctx, pubKey, data)
+			},
+			signature: "8850a4154cfef866d3fd3058400cda9f4806655a7e5a6af6d8ea33656cfe4c10e3cae0f4571a7d99e59e247f5b9f7f7508899fd7c5f4ea4fd8da33759cf02faea301c789d365866e5b22d0205c0d05b4002a95dc9fd19089b31592bfaa49ba1d",
+		},
+		{
+			name: "aggregate and proof",
+			sign: func() (bls.Signature, error) {
+				return s.client.SignAggregateAndProof(ctx, pubKey, &ethpb.AggregateAttestationAndProof{
+					Aggregate:      &ethpb.Attestation{AggregationBits: []byte{0x03}, Data: data, Signature: make([]byte, 96)},
+					SelectionProof: make([]byte, 96),
+				})
+			},
+			signature: "ae02b496173cee3c6292dd49707579c208cd9f1c6e2761f817a383a945a9c35652de0e9d5288fa1fa5a1c52c37bc223409b38ec147c8d0a46cd5e243244d0dbf93f1ee8b68c34241233d4cd773e8661ab4797d9b9168589bd6f468d627187cab",
+		},
+		{
+			name: "selection proof",
+			sign: func() (bls.Signature, error) {
+				return s.client.SignSelectionProof(ctx, pubKey, slot)
+			},
+			signature: "b93e3247bc298944de5f53e690752e5379ab4d26a67e98a03d5f586062c6960976268b81d4a628e825ade12dcff60e980678075ae07eb0cf42fc665540972f6fd3c4f289e21b5a119af400fb3ae8b0d64941655a60f4a98ef69fa3353634f06d",
+		},
+		{
+			name: "randao reveal",
+			sign: func() (bls.Signature, error) {
+				return s.client.SignRandaoReveal(ctx, pubKey, epoch)
+			},
+			signature: "a18a5b1e1b2392e36a725d368d3b7a7c4552fff1826c5f2c3b62cf60d865c0b8c680bbb3980fcea9fe22ddbb09cf9aa515b29a3cf9e4f40eb04696d12c53c873f66eac209e44d6dcc532c0e8828ff5dbd0856b5269e6b6c2a17eb2846cd1f3ff",
+		},
+		{
+			name: "voluntary exit",
+			sign: func() (bls.Signature, error) {
+				return s.client.SignExit(ctx, pubKey, &ethpb.VoluntaryExit{Epoch: epoch})
+			},
+			signature: "a67f2936bee9adf4b386a266748910d0c29f7344d13bbdaf256925064dab9e15fe29c2028b8cda94faa50280e1c990510bcb24e7b96cf4306d60b044cc3bd74659a00e32c87d72565998e1b23d729802cc8a97b813f4a9f3bd9aa0cb12422dcf",
+		},
+		{
+			name: "sync committee message",
+			sign: func() (bls.Signature, error) {
+				return s.client.SignSyncCommitteeMessage(ctx, pubKey, slot, root("head"))
+			},
+			signature: "aa755ff9439b14fb81b3c9f216ca2046ffc69b2862097c0a06227d29c1c6c6b8a4d5fd5b43a90c2ebd78b0c32c3e6f49154224cdf0650ad594ff7b7605c5a0fd5f685e6d517026f29b884fe3407e3c9f9357464637c18bb2eef61fd35f15bdc3",
+		},
+		{
+			name: "sync aggregator selection",
+			sign: func() (bls.Signature, error) {
+				return s.client.SignSyncAggregatorSelection(ctx, pubKey, selectionData)
+			},
+			signature: "8ba346116dda975ebf8488661e8140c3904514d35c759a6d0a03b42c41cfb280d1b9feb9b68b535c03ecc09a31ffab1e01f249eedd9c0dfdea290a6d6745c03f005232ed6d3bea1c1bb66f6fc186f0e7dc7920ef599090afebd0e720d58f1bf0",
+		},
+		{
+			name: "sync contribution and proof",
+			sign: func() (bls.Signature, error) {
+				return s.client.SignContributionAndProof(ctx, pubKey, contribution)
+			},
+			signature: "8b1db2f9b6c0e6592f0dc1a8a9003e8a68cf065e17818e44177fca2dbd39da1b2fba0468d681f6ab221e5049b6e1a4750fc6a80fcca40deecac8f9a717e9c042130f7c29720deed201ea5ce04ae7cc2c6cdc1fdc8e1b9e9f3da4eb2ae26b19e4",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sig, err := tt.sign()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hex.EncodeToString(sig.Marshal()) != tt.signature {
+				t.Errorf("Wanted signature %s, received %x", tt.signature, sig.Marshal())
+			}
+		})
+	}
+}
+
+func TestSigner_MnemonicKeys(t *testing.T) {
+	ctx := context.Background()
+	dir, cleanup := testDir(t)
+	defer cleanup()
+	vault, err := mnemonic.NewStore(sampleMnemonic, "", 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := startSigner(t, dir, vault)
+	pubKeys, err := s.client.ListValidatingPublicKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pubKeys) != 1 || hex.EncodeToString(pubKeys[0]) != mnemonicPubKeys[0] {
+		t.Fatalf("Wanted key %s, received %x", mnemonicPubKeys[0], pubKeys)
+	}
+	if _, err := s.client.SignAttestation(ctx, pubKeys[0], attestationData(0, 1, "head")); err != nil {
+		t.Fatal(err)
+	}
+	s.stop()
+
+	// Restarting with another key derived from the mnemonic loads it,
+	// along with the signing history of the first one.
+	vault, err = mnemonic.NewStore(sampleMnemonic, "", 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = startSigner(t, dir, vault)
+	defer s.stop()
+	pubKeys, err = s.client.ListValidatingPublicKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pubKeys) != 2 || hex.EncodeToString(pubKeys[1]) != mnemonicPubKeys[1] {
+		t.Fatalf("Wanted keys %v, received %x", mnemonicPubKeys, pubKeys)
+	}
+	if _, err := s.client.SignAttestation(ctx, pubKeys[1], attestationData(0, 1, "head")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.client.SignAttestation(ctx, pubKeys[0], attestationData(0, 1, "other head")); !errors.Is(err, client.ErrDenied) {
+		t.Errorf("Wanted %v for a double vote, received %v", client.ErrDenied, err)
+	}
+}
+
+func TestSigner_SlashingProtectionAcrossRestarts(t *testing.T) {
+	ctx := context.Background()
+	dir, cleanup := testDir(t)
+	defer cleanup()
+	newVault := func() keyvault.Store {
+		vault, err := deterministic.NewStore(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return vault
+	}
+	pubKey, err := hex.DecodeString(interopPubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := startSigner(t, dir, newVault())
+	if _, err := s.client.SignBlockAltair(ctx, pubKey, altairBlock(100, "parent")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.client.SignAttestation(ctx, pubKey, attestationData(2, 3, "head")); err != nil {
+		t.Fatal(err)
+	}
+	s.stop()
+
+	s = startSigner(t, dir, newVault())
+	defer s.stop()
+	tests := []struct {
+		name   string
+		sign   func() (bls.Signature, error)
+		denied bool
+	}{
+		{
+			name: "double proposal",
+			sign: func() (bls.Signature, error) {
+				return s.client.SignBlockAltair(ctx, pubKey, altairBlock(100, "other parent"))
+			},
+			denied: true,
+		},
+		{
+			name: "double vote",
+			sign: func() (bls.Signature, error) {
+				return s.client.SignAttestation(ctx, pubKey, attestationData(2, 3, "other head"))
+			},
+			denied: true,
+		},
+		{
+			name: "surrounding vote",
+			sign: func() (bls.Signature, error) {
+				return s.client.SignAttestation(ctx, pubKey, attestationData(1, 4, "head"))
+			},
+			denied: true,
+		},
+		{
+			name: "next proposal",
+			sign: func() (bls.Signature, error) {
+				return s.client.SignBlockAltair(ctx, pubKey, altairBlock(101, "parent"))
+			},
+		},
+		{
+			name: "next vote",
+			sign: func() (bls.Signature, error) {
+				return s.client.SignAttestation(ctx, pubKey, attestationData(3, 4, "head"))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.sign()
+			if tt.denied && !errors.Is(err, client.ErrDenied) {
+				t.Errorf("Wanted %v, received %v", client.ErrDenied, err)
+			}
+			if !tt.denied && err != nil {
+				t.Errorf("Wanted signature, received %v", err)
+			}
+		})
+	}
+}
+
+func TestSigner_DisabledKeyAcrossRestarts(t *testing.T) {
+	ctx := context.Background()
+	dir, cleanup := testDir(t)
+	defer cleanup()
+	newVault := func() keyvault.Store {
+		vault, err := deterministic.NewStore(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return vault
+	}
+	pubKey, err := hex.DecodeString(interopPubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := startSigner(t, dir, newVault())
+	if _, err := s.admin.DisableKey(ctx, &admin.DisableKeyRequest{
+		PublicKey: fmt.Sprintf("%#x", pubKey),
+		Reason:    "incident",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.client.SignSelectionProof(ctx, pubKey, 1); !errors.Is(err, client.ErrDenied) {
+		t.Errorf("Wanted %v for a disabled key, received %v", client.ErrDenied, err)
+	}
+	s.stop()
+
+	s = startSigner(t, dir, newVault())
+	defer s.stop()
+	res, err := s.admin.ListKeys(ctx, &admin.ListKeysRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Keys) != 1 || res.Keys[0].Enabled || res.Keys[0].DisabledReason != "incident" {
+		t.Fatalf("Wanted the key disabled after a restart, received %+v", res.Keys)
+	}
+	if _, err := s.client.SignSelectionProof(ctx, pubKey, 1); !errors.Is(err, client.ErrDenied) {
+		t.Errorf("Wanted %v for a disabled key, received %v", client.ErrDenied, err)
+	}
+	if _, err := s.admin.EnableKey(ctx, &admin.EnableKeyRequest{PublicKey: fmt.Sprintf("%#x", pubKey)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.client.SignSelectionProof(ctx, pubKey, 1); err != nil {
+		t.Errorf("Wanted signature once the key is enabled, received %v", err)
+	}
+}
+
+func TestSigner_ReloadCertificates(t *testing.T) {
+	ctx := context.Background()
+	dir, cleanup := testDir(t)
+	defer cleanup()
+	vault, err := deterministic.NewStore(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := startSigner(t, dir, vault)
+	defer s.stop()
+	pubKey, err := hex.DecodeString(interopPubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Certificates issued by another CA are served to new connections
+	// once reloaded, while existing connections are kept.
+	if _, err := s.client.SignSelectionProof(ctx, pubKey, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeCertificates(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.srv.ReloadCertificates(); err != nil {
+		t.Fatal(err)
+	}
+	c, conn := dial(t, dir, s.srv.Addrs()[0].String())
+	defer func() {
+		if err := c.Close(); err != nil {
+			t.Error(err)
+		}
+		if err := conn.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	if _, err := c.SignSelectionProof(ctx, pubKey, 2); err != nil {
+		t.Errorf("Wanted signature with the reloaded certificates, received %v", err)
+	}
+	if _, err := s.client.SignSelectionProof(ctx, pubKey, 3); err != nil {
+		t.Errorf("Wanted signature on the existing connection, received %v", err)
+	}
+}
+
+func TestSigner_Shutdown(t *testing.T) {
+	ctx := context.Background()
+	dir, cleanup := testDir(t)
+	defer cleanup()
+	vault, err := deterministic.NewStore(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := startSigner(t, dir, vault)
+	pubKey, err := hex.DecodeString(interopPubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.client.SignSelectionProof(ctx, pubKey, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Requests racing the shutdown either succeed with a valid signature
+	// or fail, and every request fails once the server is stopped.
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(slot types.Slot) {
+			defer wg.Done()
+			_, err := s.client.SignSelectionProof(ctx, pubKey, slot)
+			if errors.Is(err, client.ErrInvalidSignature) {
+				t.Errorf("Received invalid signature during shutdown")
+			}
+		}(types.Slot(i))
+	}
+	if err := s.srv.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	if _, err := s.client.SignSelectionProof(ctx, pubKey, 1); err == nil {
+		t.Error("Wanted an error once the server is stopped")
+	}
+	if err := s.client.Close(); err != nil {
+		t.Error(err)
+	}
+	if err := s.conn.Close(); err != nil {
+		t.Error(err)
+	}
+	if err := s.db.Close(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,453 @@
+/*
+Package exits holds voluntary exit signing requests until they are approved
+by operators. A signed voluntary exit is irreversible, so exits wait in a
+pending queue until enough distinct operators approve them through the admin
+API, either authenticated callers of the admin API or, with signed approvals,
+authorized operators signing their approvals with their ed25519 key. The
+number of pending exits is capped, in total and for each key. The signing root
+of an exit is computed from the exit and its domain, so that operators approve
+the epoch and validator index of the exit which is signed. Approved exits are
+signed for the waiting caller, or for a later retry of the same request, until
+they expire.
+*/
+package exits
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	ethpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.WithField("prefix", "exits")
+
+// DefaultExpiry is how long an exit request waits for approval.
+const DefaultExpiry = 24 * time.Hour
+
+// DefaultMaxPending is how many exits may await approval at once, and
+// DefaultMaxPendingPerKey how many of them for each key.
+const (
+	DefaultMaxPending       = 128
+	DefaultMaxPendingPerKey = 2
+)
+
+// domainVoluntaryExit is the domain type of voluntary exit signatures.
+var domainVoluntaryExit = []byte{0x04, 0x00, 0x00, 0x00}
+
+var (
+	// ErrPending is returned when the caller stops waiting for an exit to be approved.
+	ErrPending = errors.New("voluntary exit is awaiting approval")
+	// ErrRejected is returned when an operator rejects an exit.
+	ErrRejected = errors.New("voluntary exit was rejected")
+	// ErrExpired is returned when an exit is not approved before it expires.
+	ErrExpired = errors.New("voluntary exit approval expired")
+	// ErrUnknownExit is returned when approving or rejecting an exit which is not queued.
+	ErrUnknownExit = errors.New("unknown voluntary exit")
+	// ErrNotPending is returned when approving or rejecting an exit which is no longer pending.
+	ErrNotPending = errors.New("voluntary exit is not pending")
+	// ErrUnauthorized is returned for approvals of unknown operators, or with invalid signatures.
+	ErrUnauthorized = errors.New("unauthorized operator")
+	// ErrAlreadyApproved is returned when an operator approves an exit twice.
+	ErrAlreadyApproved = errors.New("voluntary exit already approved by operator")
+	// ErrSigningRoot is returned for exit requests whose signing root is not
+	// the root of their exit in their domain.
+	ErrSigningRoot = errors.New("signing root is not the root of the voluntary exit")
+	// ErrTooManyPending is returned for exit requests beyond the pending
+	// exits allowed, in total or for their key.
+	ErrTooManyPending = errors.New("too many voluntary exits awaiting approval")
+)
+
+// State of a queued exit.
+type State string
+
+// States of a queued exit.
+const (
+	Pending  State = "pending"
+	Approved State = "approved"
+	Rejected State = "rejected"
+	Expired  State = "expired"
+)
+
+// Config options of the exit queue.
+type Config struct {
+	// Operators, if set, requires signed approvals: it maps the names of the
+	// only operators authorized to approve exits to the ed25519 public keys
+	// their approvals must be signed with. Otherwise approvals are only
+	// authenticated by the admin API, each distinct caller being an operator.
+	Operators map[string]ed25519.PublicKey
+	// Approvals is the number of distinct operators who must approve an exit.
+	Approvals int
+	// Expiry is how long an exit waits for approval, and stays approved.
+	Expiry time.Duration
+	// MaxPending caps the exits awaiting approval, DefaultMaxPending if
+	// unset, and MaxPendingPerKey those of each key, DefaultMaxPendingPerKey
+	// if unset.
+	MaxPending       int
+	MaxPendingPerKey int
+}
+
+// Exit is a voluntary exit signing request held in the queue.
+type Exit struct {
+	// ID identifies the exit, from its public key and signing root.
+	ID             string
+	PublicKey      [48]byte
+	SigningRoot    []byte
+	Epoch          uint64
+	ValidatorIndex uint64
+	CreatedAt      time.Time
+	ExpiresAt      time.Time
+	State          State
+	// Approvals are the names of the operators who approved the exit.
+	Approvals    []string
+	RejectedBy   string
+	RejectReason string
+
+	// done is closed once the exit is no longer pending.
+	done chan struct{}
+}
+
+// Queue of voluntary exits awaiting approval.
+type Queue struct {
+	cfg   *Config
+	lock  sync.Mutex
+	exits map[string]*Exit
+}
+
+// NewQueue instantiates an exit approval queue.
+func NewQueue(cfg *Config) (*Queue, error) {
+	if cfg.Approvals < 1 {
+		return nil, errors.New("expected at least one approval")
+	}
+	if len(cfg.Operators) > 0 {
+		for name, pubKey := range cfg.Operators {
+			if len(pubKey) != ed25519.PublicKeySize {
+				return nil, errors.Errorf("expected ed25519 public key of operator %s", name)
+			}
+		}
+		if len(cfg.Operators) < cfg.Approvals {
+			return nil, errors.Errorf(
+				"%d approvals can never be reached by %d operators", cfg.Approvals, len(cfg.Operators),
+			)
+		}
+	}
+	if cfg.Expiry == 0 {
+		cfg.Expiry = DefaultExpiry
+	}
+	if cfg.MaxPending == 0 {
+		cfg.MaxPending = DefaultMaxPending
+	}
+	if cfg.MaxPendingPerKey == 0 {
+		cfg.MaxPendingPerKey = DefaultMaxPendingPerKey
+	}
+	return &Queue{
+		cfg:   cfg,
+		exits: make(map[string]*Exit),
+	}, nil
+}
+
+// SignedApprovals returns whether operators must sign their approvals and
+// rejections, rather than being the authenticated callers of the admin API.
+func (q *Queue) SignedApprovals() bool {
+	return len(q.cfg.Operators) > 0
+}
+
+// ID of the exit signing request of a public key for a signing root.
+func ID(pubKey [48]byte, signingRoot []byte) string {
+	h := sha256.New()
+	h.Write(pubKey[:])
+	h.Write(signingRoot)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// SigningRoot computes the root signed for a voluntary exit in a domain,
+// which must be of the voluntary exit domain type.
+func SigningRoot(exit *ethpb.VoluntaryExit, domain []byte) ([]byte, error) {
+	if exit == nil {
+		return nil, errors.New("expected voluntary exit")
+	}
+	if len(domain) != 32 || !bytes.Equal(domain[:4], domainVoluntaryExit) {
+		return nil, errors.Errorf("signature domain %#x is not of the voluntary exit domain type", domain)
+	}
+	objectRoot, err := exit.HashTreeRoot()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not compute voluntary exit root")
+	}
+	signingRoot, err := (&ethpb.SigningData{
+		ObjectRoot: objectRoot[:],
+		Domain:     domain,
+	}).HashTreeRoot()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not compute signing root")
+	}
+	return signingRoot[:], nil
+}
+
+// ApprovalMessage is the message operators sign to approve an exit.
+func ApprovalMessage(id string) []byte {
+	return []byte("remote-signer approve exit " + id)
+}
+
+// RejectionMessage is the message operators sign to reject an exit.
+func RejectionMessage(id string) []byte {
+	return []byte("remote-signer reject exit " + id)
+}
+
+// Await queues an exit signing request, and waits until it is approved,
+// rejected, expires or ctx is done. A request already approved returns
+// immediately, so callers can retry requests they stopped waiting for.
+// Requests whose signing root is not the one of their exit in their
+// domain are not queued, and return ErrSigningRoot. New requests beyond
+// the pending exits allowed are not queued either, and return
+// ErrTooManyPending.
+func (q *Queue) Await(
+	ctx context.Context, pubKey [48]byte, exit *ethpb.VoluntaryExit, domain, signingRoot []byte,
+) error {
+	root, err := SigningRoot(exit, domain)
+	if err != nil {
+		return errors.Wrap(ErrSigningRoot, err.Error())
+	}
+	if !bytes.Equal(root, signingRoot) {
+		return errors.Wrapf(ErrSigningRoot, "received %#x, wanted %#x", signingRoot, root)
+	}
+	id := ID(pubKey, signingRoot)
+	q.lock.Lock()
+	q.expire()
+	e, ok := q.exits[id]
+	if !ok {
+		if err := q.checkPending(pubKey); err != nil {
+			q.lock.Unlock()
+			return err
+		}
+		now := time.Now()
+		e = &Exit{
+			ID:             id,
+			PublicKey:      pubKey,
+			SigningRoot:    signingRoot,
+			Epoch:          uint64(exit.Epoch),
+			ValidatorIndex: uint64(exit.ValidatorIndex),
+			CreatedAt:      now,
+			ExpiresAt:      now.Add(q.cfg.Expiry),
+			State:          Pending,
+			done:           make(chan struct{}),
+		}
+		q.exits[id] = e
+		log.WithFields(exitFields(e)).Warn("Voluntary exit awaiting approval")
+	}
+	expiresAt := e.ExpiresAt
+	q.lock.Unlock()
+
+	timer := time.NewTimer(time.Until(expiresAt))
+	defer timer.Stop()
+	select {
+	case <-e.done:
+	case <-timer.C:
+		q.lock.Lock()
+		q.expire()
+		q.lock.Unlock()
+	case <-ctx.Done():
+		return errors.Wrapf(ErrPending, "id %s", id)
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	switch e.State {
+	case Approved:
+		return nil
+	case Rejected:
+		return errors.Wrapf(ErrRejected, "by %s: %s", e.RejectedBy, e.RejectReason)
+	case Expired:
+		return errors.Wrapf(ErrExpired, "id %s", id)
+	default:
+		return errors.Wrapf(ErrPending, "id %s", id)
+	}
+}
+
+// List returns the queued exits, oldest first.
+func (q *Queue) List() []*Exit {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.expire()
+	exits := make([]*Exit, 0, len(q.exits))
+	for _, e := range q.exits {
+		exits = append(exits, e.copy())
+	}
+	sort.Slice(exits, func(i, j int) bool {
+		return exits[i].CreatedAt.Before(exits[j].CreatedAt)
+	})
+	return exits
+}
+
+// Approve records the approval of an exit by an operator, with its ed25519
+// signature of the ApprovalMessage if approvals are signed. The exit is
+// approved once enough distinct operators approved it.
+func (q *Queue) Approve(id, operator string, sig []byte) (*Exit, error) {
+	if err := q.authorize(operator, ApprovalMessage(id), sig); err != nil {
+		return nil, err
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	e, err := q.pending(id)
+	if err != nil {
+		return nil, err
+	}
+	for _, approver := range e.Approvals {
+		if approver == operator {
+			return nil, errors.Wrap(ErrAlreadyApproved, operator)
+		}
+	}
+	e.Approvals = append(e.Approvals, operator)
+	fields := exitFields(e)
+	fields["operator"] = operator
+	if len(e.Approvals) < q.cfg.Approvals {
+		log.WithFields(fields).Info("Recorded voluntary exit approval")
+		return e.copy(), nil
+	}
+	e.State = Approved
+	e.ExpiresAt = time.Now().Add(q.cfg.Expiry)
+	close(e.done)
+	log.WithFields(fields).Warn("Approved voluntary exit")
+	return e.copy(), nil
+}
+
+// Reject rejects an exit on behalf of an operator, with its ed25519 signature
+// of the RejectionMessage if approvals are signed. Rejected exits are denied
+// until they expire.
+func (q *Queue) Reject(id, operator, reason string, sig []byte) (*Exit, error) {
+	if err := q.authorize(operator, RejectionMessage(id), sig); err != nil {
+		return nil, err
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	e, err := q.pending(id)
+	if err != nil {
+		return nil, err
+	}
+	e.State = Rejected
+	e.RejectedBy = operator
+	e.RejectReason = reason
+	close(e.done)
+	fields := exitFields(e)
+	fields["operator"] = operator
+	log.WithFields(fields).WithField("reason", reason).Warn("Rejected voluntary exit")
+	return e.copy(), nil
+}
+
+// authorize checks that an operator may approve or reject exits, and signed
+// the message of its decision if approvals are signed.
+func (q *Queue) authorize(operator string, msg, sig []byte) error {
+	if operator == "" {
+		return errors.Wrap(ErrUnauthorized, "expected operator")
+	}
+	if !q.SignedApprovals() {
+		return nil
+	}
+	pubKey, ok := q.cfg.Operators[operator]
+	if !ok {
+		return errors.Wrap(ErrUnauthorized, operator)
+	}
+	if len(sig) != ed25519.SignatureSize || !ed25519.Verify(pubKey, msg, sig) {
+		return errors.Wrapf(ErrUnauthorized, "invalid signature of %s", operator)
+	}
+	return nil
+}
+
+// checkPending fails with ErrTooManyPending if no more exits, or exits of
+// a key, may await approval, and must be called with the lock held.
+func (q *Queue) checkPending(pubKey [48]byte) error {
+	var total, forKey int
+	for _, e := range q.exits {
+		if e.State != Pending {
+			continue
+		}
+		total++
+		if e.PublicKey == pubKey {
+			forKey++
+		}
+	}
+	if total >= q.cfg.MaxPending {
+		return errors.Wrapf(ErrTooManyPending, "%d exits are pending", total)
+	}
+	if forKey >= q.cfg.MaxPendingPerKey {
+		return errors.Wrapf(ErrTooManyPending, "%d exits of key %#x are pending", forKey, pubKey)
+	}
+	return nil
+}
+
+// pending returns a pending exit, and must be called with the lock held.
+func (q *Queue) pending(id string) (*Exit, error) {
+	q.expire()
+	e, ok := q.exits[id]
+	if !ok {
+		return nil, errors.Wrap(ErrUnknownExit, id)
+	}
+	if e.State != Pending {
+		return nil, errors.Wrapf(ErrNotPending, "%s is %s", id, e.State)
+	}
+	return e, nil
+}
+
+// expire drops the exits past their expiry, and must be called with the lock held.
+// Waiters of pending exits are released with ErrExpired.
+func (q *Queue) expire() {
+	now := time.Now()
+	for id, e := range q.exits {
+		if now.Before(e.ExpiresAt) {
+			continue
+		}
+		if e.State == Pending {
+			e.State = Expired
+			close(e.done)
+			log.WithFields(exitFields(e)).Warn("Voluntary exit approval expired")
+		}
+		delete(q.exits, id)
+	}
+}
+
+func (e *Exit) copy() *Exit {
+	cp := *e
+	cp.Approvals = append([]string(nil), e.Approvals...)
+	return &cp
+}
+
+func exitFields(e *Exit) logrus.Fields {
+	return logrus.Fields{
+		"id":             e.ID,
+		"publicKey":      fmt.Sprintf("%#x", e.PublicKey),
+		"validatorIndex": e.ValidatorIndex,
+		"epoch":          e.Epoch,
+	}
+}
+
+// LoadOperators reads the JSON object mapping the names of the operators
+// authorized to approve exits to their hex encoded ed25519 public keys.
+func LoadOperators(path string) (map[string]ed25519.PublicKey, error) {
+	enc, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read operators file %s", path)
+	}
+	var hexKeys map[string]string
+	if err := json.Unmarshal(enc, &hexKeys); err != nil {
+		return nil, errors.Wrapf(err, "could not parse operators file %s", path)
+	}
+	operators := make(map[string]ed25519.PublicKey, len(hexKeys))
+	for name, hexKey := range hexKeys {
+		key, err := hex.DecodeString(strings.TrimPrefix(hexKey, "0x"))
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, errors.Errorf("invalid ed25519 public key of operator %s in %s", name, path)
+		}
+		operators[name] = key
+	}
+	return operators, nil
+}
@@ -0,0 +1,282 @@
+package exits
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	types "github.com/prysmaticlabs/eth2-types"
+	ethpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1"
+)
+
+var domain = append([]byte{0x04, 0x00, 0x00, 0x00}, make([]byte, 28)...)
+
+func setupQueue(t *testing.T, approvals int, expiry time.Duration) (*Queue, map[string]ed25519.PrivateKey) {
+	keys := make(map[string]ed25519.PrivateKey)
+	operators := make(map[string]ed25519.PublicKey)
+	for _, operator := range []string{"alice", "bob"} {
+		pubKey, privKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[operator] = privKey
+		operators[operator] = pubKey
+	}
+	q, err := NewQueue(&Config{
+		Operators: operators,
+		Approvals: approvals,
+		Expiry:    expiry,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q, keys
+}
+
+// exitRequest returns a voluntary exit at an epoch, and its signing root.
+func exitRequest(t *testing.T, epoch types.Epoch) (*ethpb.VoluntaryExit, []byte) {
+	exit := &ethpb.VoluntaryExit{Epoch: epoch, ValidatorIndex: 1}
+	signingRoot, err := SigningRoot(exit, domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return exit, signingRoot
+}
+
+// await runs Await in the background, and returns the channel of its result
+// once the exit is queued.
+func await(t *testing.T, q *Queue, pubKey [48]byte, exit *ethpb.VoluntaryExit, signingRoot []byte) (string, chan error) {
+	res := make(chan error, 1)
+	go func() {
+		res <- q.Await(context.Background(), pubKey, exit, domain, signingRoot)
+	}()
+	id := ID(pubKey, signingRoot)
+	for i := 0; i < 100; i++ {
+		for _, e := range q.List() {
+			if e.ID == id {
+				return id, res
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Exit was never queued")
+	return "", nil
+}
+
+func TestQueue_TwoPersonApproval(t *testing.T) {
+	q, keys := setupQueue(t, 2, time.Minute)
+	pubKey := [48]byte{1}
+	exit, signingRoot := exitRequest(t, 10)
+	id, res := await(t, q, pubKey, exit, signingRoot)
+
+	e, err := q.Approve(id, "alice", ed25519.Sign(keys["alice"], ApprovalMessage(id)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.State != Pending {
+		t.Errorf("Wanted exit pending after one approval, received %s", e.State)
+	}
+	if e.Epoch != 10 || e.ValidatorIndex != 1 {
+		t.Errorf("Wanted the epoch and validator index of the exit, received %d and %d", e.Epoch, e.ValidatorIndex)
+	}
+	if _, err := q.Approve(id, "alice", ed25519.Sign(keys["alice"], ApprovalMessage(id))); !errors.Is(err, ErrAlreadyApproved) {
+		t.Errorf("Wanted %v, received %v", ErrAlreadyApproved, err)
+	}
+	if _, err := q.Approve(id, "mallory", nil); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Wanted %v, received %v", ErrUnauthorized, err)
+	}
+	// Every operator must sign its approval of this very exit.
+	if _, err := q.Approve(id, "bob", nil); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Wanted %v, received %v", ErrUnauthorized, err)
+	}
+	if _, err := q.Approve(id, "bob", ed25519.Sign(keys["bob"], RejectionMessage(id))); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Wanted %v, received %v", ErrUnauthorized, err)
+	}
+	if _, err := q.Approve(id, "bob", ed25519.Sign(keys["alice"], ApprovalMessage(id))); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Wanted %v, received %v", ErrUnauthorized, err)
+	}
+	select {
+	case err := <-res:
+		t.Fatalf("Wanted exit to wait for a second approval, received %v", err)
+	default:
+	}
+
+	e, err = q.Approve(id, "bob", ed25519.Sign(keys["bob"], ApprovalMessage(id)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.State != Approved {
+		t.Errorf("Wanted exit approved, received %s", e.State)
+	}
+	if err := <-res; err != nil {
+		t.Errorf("Wanted waiting caller released, received %v", err)
+	}
+	// A later retry of the same request is signed without waiting.
+	if err := q.Await(context.Background(), pubKey, exit, domain, signingRoot); err != nil {
+		t.Errorf("Wanted approved exit, received %v", err)
+	}
+	if _, err := q.Approve(id, "alice", ed25519.Sign(keys["alice"], ApprovalMessage(id))); !errors.Is(err, ErrNotPending) {
+		t.Errorf("Wanted %v, received %v", ErrNotPending, err)
+	}
+}
+
+func TestQueue_WrongSigningRoot(t *testing.T) {
+	q, _ := setupQueue(t, 1, time.Minute)
+	exit, _ := exitRequest(t, 10)
+	// The signing root of another exit would be approved as this one.
+	_, otherRoot := exitRequest(t, 11)
+	if err := q.Await(context.Background(), [48]byte{1}, exit, domain, otherRoot); !errors.Is(err, ErrSigningRoot) {
+		t.Errorf("Wanted %v, received %v", ErrSigningRoot, err)
+	}
+	attesterDomain := append([]byte{0x01, 0x00, 0x00, 0x00}, make([]byte, 28)...)
+	if err := q.Await(context.Background(), [48]byte{1}, exit, attesterDomain, otherRoot); !errors.Is(err, ErrSigningRoot) {
+		t.Errorf("Wanted %v for another domain type, received %v", ErrSigningRoot, err)
+	}
+	if len(q.List()) != 0 {
+		t.Error("Wanted no exit queued")
+	}
+}
+
+func TestQueue_Reject(t *testing.T) {
+	q, keys := setupQueue(t, 1, time.Minute)
+	exit, signingRoot := exitRequest(t, 10)
+	id, res := await(t, q, [48]byte{1}, exit, signingRoot)
+	if _, err := q.Reject(id, "alice", "not planned", nil); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Wanted %v, received %v", ErrUnauthorized, err)
+	}
+	if _, err := q.Reject(id, "alice", "not planned", ed25519.Sign(keys["alice"], RejectionMessage(id))); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-res; !errors.Is(err, ErrRejected) {
+		t.Errorf("Wanted %v, received %v", ErrRejected, err)
+	}
+	if err := q.Await(context.Background(), [48]byte{1}, exit, domain, signingRoot); !errors.Is(err, ErrRejected) {
+		t.Errorf("Wanted %v, received %v", ErrRejected, err)
+	}
+}
+
+func TestQueue_Expiry(t *testing.T) {
+	q, keys := setupQueue(t, 1, 50*time.Millisecond)
+	exit, signingRoot := exitRequest(t, 10)
+	id, res := await(t, q, [48]byte{1}, exit, signingRoot)
+	if err := <-res; !errors.Is(err, ErrExpired) {
+		t.Errorf("Wanted %v, received %v", ErrExpired, err)
+	}
+	if _, err := q.Approve(id, "alice", ed25519.Sign(keys["alice"], ApprovalMessage(id))); !errors.Is(err, ErrUnknownExit) {
+		t.Errorf("Wanted %v, received %v", ErrUnknownExit, err)
+	}
+}
+
+func TestQueue_CallerStopsWaiting(t *testing.T) {
+	q, keys := setupQueue(t, 1, time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	pubKey := [48]byte{1}
+	exit, signingRoot := exitRequest(t, 10)
+	if err := q.Await(ctx, pubKey, exit, domain, signingRoot); !errors.Is(err, ErrPending) {
+		t.Fatalf("Wanted %v, received %v", ErrPending, err)
+	}
+	id := ID(pubKey, signingRoot)
+	if _, err := q.Approve(id, "alice", ed25519.Sign(keys["alice"], ApprovalMessage(id))); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Await(context.Background(), pubKey, exit, domain, signingRoot); err != nil {
+		t.Errorf("Wanted approved exit on retry, received %v", err)
+	}
+}
+
+func TestQueue_UnsignedApprovals(t *testing.T) {
+	q, err := NewQueue(&Config{Approvals: 2, Expiry: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.SignedApprovals() {
+		t.Fatal("Wanted approvals without operators unsigned")
+	}
+	exit, signingRoot := exitRequest(t, 10)
+	id, res := await(t, q, [48]byte{1}, exit, signingRoot)
+	if _, err := q.Approve(id, "", nil); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Wanted %v without operator, received %v", ErrUnauthorized, err)
+	}
+	if _, err := q.Approve(id, "token:alice", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Approve(id, "token:alice", nil); !errors.Is(err, ErrAlreadyApproved) {
+		t.Errorf("Wanted %v, received %v", ErrAlreadyApproved, err)
+	}
+	e, err := q.Approve(id, "token:bob", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.State != Approved {
+		t.Errorf("Wanted exit approved by two distinct operators, received %s", e.State)
+	}
+	if err := <-res; err != nil {
+		t.Errorf("Wanted waiting caller released, received %v", err)
+	}
+}
+
+func TestQueue_MaxPending(t *testing.T) {
+	q, err := NewQueue(&Config{Approvals: 1, Expiry: time.Minute, MaxPending: 3, MaxPendingPerKey: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	queue := func(pubKey [48]byte, epoch types.Epoch) error {
+		exit, signingRoot := exitRequest(t, epoch)
+		return q.Await(ctx, pubKey, exit, domain, signingRoot)
+	}
+	for _, epoch := range []types.Epoch{10, 11} {
+		if err := queue([48]byte{1}, epoch); !errors.Is(err, ErrPending) {
+			t.Fatalf("Wanted %v, received %v", ErrPending, err)
+		}
+	}
+	if err := queue([48]byte{1}, 12); !errors.Is(err, ErrTooManyPending) {
+		t.Errorf("Wanted %v for a third exit of the key, received %v", ErrTooManyPending, err)
+	}
+	// Retries of a pending exit are not new exits.
+	if err := queue([48]byte{1}, 10); !errors.Is(err, ErrPending) {
+		t.Errorf("Wanted %v for a retry, received %v", ErrPending, err)
+	}
+	if err := queue([48]byte{2}, 10); !errors.Is(err, ErrPending) {
+		t.Fatalf("Wanted %v, received %v", ErrPending, err)
+	}
+	if err := queue([48]byte{3}, 10); !errors.Is(err, ErrTooManyPending) {
+		t.Errorf("Wanted %v beyond the pending exits allowed, received %v", ErrTooManyPending, err)
+	}
+	if len(q.List()) != 3 {
+		t.Errorf("Wanted 3 exits queued, received %d", len(q.List()))
+	}
+}
+
+func TestNewQueue_UnreachableApprovals(t *testing.T) {
+	pubKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewQueue(&Config{
+		Operators: map[string]ed25519.PublicKey{"alice": pubKey},
+		Approvals: 2,
+	})
+	if err == nil {
+		t.Error("Wanted error for more approvals than operators")
+	}
+}
+
+func TestNewQueue_OperatorWithoutKey(t *testing.T) {
+	pubKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewQueue(&Config{
+		Operators: map[string]ed25519.PublicKey{"alice": pubKey, "bob": nil},
+		Approvals: 1,
+	})
+	if err == nil {
+		t.Error("Wanted error for an operator without a public key")
+	}
+}
@@ -1,14 +1,25 @@
 module github.com/prysmaticlabs/remote-signer
 
-go 1.14
+go 1.16
 
 require (
 	github.com/golang/protobuf v1.5.2
+	github.com/hashicorp/go-hclog v0.9.1
+	github.com/hashicorp/raft v1.3.1
+	github.com/hashicorp/raft-boltdb/v2 v2.0.0-20210422161416-485fa74b0b01
 	github.com/kr/text v0.2.0 // indirect
 	github.com/pkg/errors v0.9.1
+	github.com/prometheus/client_golang v1.11.0
+	github.com/prysmaticlabs/eth2-types v0.0.0-20210303084904-c9735a06829d
 	github.com/prysmaticlabs/prysm v1.4.2-0.20210927203955-328e3e6caf83
 	github.com/sirupsen/logrus v1.7.0
-	google.golang.org/grpc v1.37.0
+	go.etcd.io/bbolt v1.3.6
+	go.etcd.io/etcd/server/v3 v3.5.5
+	go.opentelemetry.io/otel v1.0.1
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.0.1
+	go.opentelemetry.io/otel/sdk v1.0.1
+	go.opentelemetry.io/otel/trace v1.0.1
+	google.golang.org/grpc v1.41.0
 )
 
 replace github.com/ethereum/go-ethereum => github.com/prysmaticlabs/bazel-go-ethereum v0.0.0-20210707101027-e8523651bf6f
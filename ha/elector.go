@@ -0,0 +1,174 @@
+/*
+Package ha runs remote signers in an active/passive high availability setup.
+Every instance competes for a shared lock, only the instance holding it is the
+leader and signs, so two instances never sign with the same keys at once.
+*/
+package ha
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.WithField("prefix", "ha")
+
+// DefaultRetryInterval is the default delay between attempts to become the leader.
+const DefaultRetryInterval = time.Second
+
+// releaseTimeout bounds how long releasing the lock may take at shutdown.
+const releaseTimeout = 5 * time.Second
+
+// ErrNotLeader is returned when fencing a write of an instance which is
+// not, or may no longer be, the leader.
+var ErrNotLeader = errors.New("not the leader")
+
+// LockProvider is a lock shared by every instance of a cluster,
+// such as a file on a shared filesystem or a lease in etcd.
+type LockProvider interface {
+	// Acquire blocks until the lock is held, or the context is done. It
+	// returns the fencing token of the acquisition, greater than the token
+	// of any previous one, and a channel closed if the lock is lost before
+	// being released.
+	Acquire(ctx context.Context) (uint64, <-chan struct{}, error)
+	// Check returns an error unless the lock acquired with the fencing
+	// token is still held, as confirmed by the backend of the lock.
+	Check(ctx context.Context, token uint64) error
+	// Release gives up the lock, allowing another instance to acquire it.
+	Release(ctx context.Context) error
+}
+
+// Config options for the leader elector.
+type Config struct {
+	// Provider is the lock held by the leader.
+	Provider LockProvider
+	// Sync, if set, brings the local slashing protection state up to date.
+	// It is called with the fencing token once the lock is held, and the
+	// instance only becomes the leader once it returns successfully.
+	Sync func(ctx context.Context, token uint64) error
+	// RetryInterval is the delay between attempts to become the leader.
+	RetryInterval time.Duration
+}
+
+// Elector tells whether this instance is the leader of its cluster.
+type Elector struct {
+	cfg    *Config
+	lock   sync.RWMutex
+	leader bool
+	token  uint64
+}
+
+// NewElector instantiates a leader elector.
+func NewElector(cfg *Config) (*Elector, error) {
+	if cfg.Provider == nil {
+		return nil, errors.New("expected a lock provider")
+	}
+	if cfg.RetryInterval == 0 {
+		cfg.RetryInterval = DefaultRetryInterval
+	}
+	return &Elector{cfg: cfg}, nil
+}
+
+// IsLeader returns true if this instance holds the lock and may sign.
+func (e *Elector) IsLeader() bool {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	return e.leader
+}
+
+// Fence returns the fencing token of the current leadership, once the lock
+// provider confirmed that the lock is still held. It is called right before
+// every write only the leader may do, so that an instance paused for longer
+// than its lock lasts does not write once resumed, and the token lets other
+// instances reject the writes of a previous leader.
+func (e *Elector) Fence(ctx context.Context) (uint64, error) {
+	e.lock.RLock()
+	leader, token := e.leader, e.token
+	e.lock.RUnlock()
+	if !leader {
+		return 0, ErrNotLeader
+	}
+	if err := e.cfg.Provider.Check(ctx, token); err != nil {
+		return 0, errors.Wrap(ErrNotLeader, err.Error())
+	}
+	return token, nil
+}
+
+func (e *Elector) setLeader(leader bool, token uint64) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.leader = leader
+	e.token = token
+}
+
+// Run competes for leadership until the context is canceled, at which
+// point leadership is given up and the lock released.
+func (e *Elector) Run(ctx context.Context) {
+	for {
+		token, lost, err := e.cfg.Provider.Acquire(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.WithError(err).Warn("Could not acquire leader lock")
+			if !e.wait(ctx) {
+				return
+			}
+			continue
+		}
+		if e.cfg.Sync != nil {
+			log.WithField("fencingToken", token).Info("Acquired leader lock, syncing slashing protection state")
+			if err := e.cfg.Sync(ctx, token); err != nil {
+				log.WithError(err).Error("Could not sync slashing protection state, giving up leader lock")
+				e.release()
+				if !e.wait(ctx) {
+					return
+				}
+				continue
+			}
+		}
+		select {
+		case <-lost:
+			log.Warn("Lost leader lock while syncing slashing protection state")
+			e.release()
+			continue
+		default:
+		}
+		e.setLeader(true, token)
+		log.WithField("fencingToken", token).Info("Became the leader, signing requests")
+
+		select {
+		case <-lost:
+			e.setLeader(false, 0)
+			log.Warn("Lost leader lock, no longer signing requests")
+			e.release()
+		case <-ctx.Done():
+			e.setLeader(false, 0)
+			log.Info("Stepping down as the leader")
+			e.release()
+			return
+		}
+	}
+}
+
+// release gives up the lock, even if the elector context is already canceled.
+func (e *Elector) release() {
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+	if err := e.cfg.Provider.Release(ctx); err != nil {
+		log.WithError(err).Error("Could not release leader lock")
+	}
+}
+
+// wait sleeps for the retry interval, returning false if the context is done first.
+func (e *Elector) wait(ctx context.Context) bool {
+	select {
+	case <-time.After(e.cfg.RetryInterval):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
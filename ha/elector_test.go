@@ -0,0 +1,231 @@
+package ha
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// sharedLock is an in-memory lock shared by the providers of a test cluster.
+type sharedLock struct {
+	lock   sync.Mutex
+	holder *memoryLock
+	token  uint64
+}
+
+// memoryLock is a lock provider for tests, which can be made to lose its lock.
+type memoryLock struct {
+	shared *sharedLock
+	lost   chan struct{}
+}
+
+func (m *memoryLock) Acquire(ctx context.Context) (uint64, <-chan struct{}, error) {
+	for {
+		m.shared.lock.Lock()
+		if m.shared.holder == nil {
+			m.shared.holder = m
+			m.shared.token++
+			m.lost = make(chan struct{})
+			token := m.shared.token
+			m.shared.lock.Unlock()
+			return token, m.lost, nil
+		}
+		m.shared.lock.Unlock()
+		select {
+		case <-time.After(time.Millisecond):
+		case <-ctx.Done():
+			return 0, nil, ctx.Err()
+		}
+	}
+}
+
+func (m *memoryLock) Check(_ context.Context, token uint64) error {
+	m.shared.lock.Lock()
+	defer m.shared.lock.Unlock()
+	if m.shared.holder != m || m.shared.token != token {
+		return errors.New("lock not held")
+	}
+	return nil
+}
+
+func (m *memoryLock) Release(context.Context) error {
+	m.shared.lock.Lock()
+	defer m.shared.lock.Unlock()
+	if m.shared.holder == m {
+		m.shared.holder = nil
+	}
+	return nil
+}
+
+// loseLock hands the lock over to another provider, as if it expired.
+func (m *memoryLock) loseLock(to *memoryLock) {
+	m.shared.lock.Lock()
+	defer m.shared.lock.Unlock()
+	m.shared.holder = to
+	m.shared.token++
+	close(m.lost)
+}
+
+// expire hands the lock over to another provider without notifying the
+// holder, as when it is paused for longer than the lock lasts.
+func (m *memoryLock) expire(to *memoryLock) {
+	m.shared.lock.Lock()
+	defer m.shared.lock.Unlock()
+	m.shared.holder = to
+	m.shared.token++
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestElector_SingleLeader(t *testing.T) {
+	shared := &sharedLock{}
+	providers := []*memoryLock{{shared: shared}, {shared: shared}}
+	electors := make([]*Elector, len(providers))
+	cancels := make([]context.CancelFunc, len(providers))
+	done := make([]chan struct{}, len(providers))
+	for i, p := range providers {
+		e, err := NewElector(&Config{Provider: p, RetryInterval: time.Millisecond})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		electors[i], cancels[i], done[i] = e, cancel, make(chan struct{})
+		go func(i int) {
+			electors[i].Run(ctx)
+			close(done[i])
+		}(i)
+	}
+	defer func() {
+		for i := range cancels {
+			cancels[i]()
+			<-done[i]
+		}
+	}()
+
+	waitFor(t, "a leader", func() bool {
+		return electors[0].IsLeader() || electors[1].IsLeader()
+	})
+	leader, follower := 0, 1
+	if electors[1].IsLeader() {
+		leader, follower = 1, 0
+	}
+	if electors[follower].IsLeader() {
+		t.Fatal("Wanted a single leader")
+	}
+
+	// Stepping down releases the lock to the follower.
+	cancels[leader]()
+	<-done[leader]
+	if electors[leader].IsLeader() {
+		t.Error("Wanted stopped elector to step down")
+	}
+	waitFor(t, "the follower to take over", electors[follower].IsLeader)
+}
+
+func TestElector_LostLock(t *testing.T) {
+	p := &memoryLock{shared: &sharedLock{}}
+	e, err := NewElector(&Config{Provider: p, RetryInterval: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		e.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	waitFor(t, "leadership", e.IsLeader)
+	p.loseLock(&memoryLock{shared: p.shared})
+	waitFor(t, "leadership to be lost", func() bool { return !e.IsLeader() })
+}
+
+func TestElector_SyncBeforeLeading(t *testing.T) {
+	p := &memoryLock{shared: &sharedLock{}}
+	synced := make(chan struct{})
+	var e *Elector
+	var leaderDuringSync bool
+	e, err := NewElector(&Config{
+		Provider: p,
+		Sync: func(ctx context.Context, _ uint64) error {
+			leaderDuringSync = e.IsLeader()
+			close(synced)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		e.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	<-synced
+	waitFor(t, "leadership", e.IsLeader)
+	if leaderDuringSync {
+		t.Error("Wanted elector to become the leader only after syncing")
+	}
+}
+
+func TestElector_Fence(t *testing.T) {
+	ctx := context.Background()
+	p := &memoryLock{shared: &sharedLock{}}
+	e, err := NewElector(&Config{Provider: p, RetryInterval: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Fence(ctx); !errors.Is(err, ErrNotLeader) {
+		t.Fatalf("Wanted %v before leading, received %v", ErrNotLeader, err)
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		e.Run(runCtx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	waitFor(t, "leadership", e.IsLeader)
+	token, err := e.Fence(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The elector still believes to be the leader, but its lock was taken
+	// over by another instance, whose fencing token is greater.
+	next := &memoryLock{shared: p.shared}
+	p.expire(next)
+	if !e.IsLeader() {
+		t.Fatal("Wanted elector unaware of the expiry")
+	}
+	if _, err := e.Fence(ctx); !errors.Is(err, ErrNotLeader) {
+		t.Errorf("Wanted %v after expiry, received %v", ErrNotLeader, err)
+	}
+	if p.shared.token <= token {
+		t.Errorf("Wanted new fencing token greater than %d, received %d", token, p.shared.token)
+	}
+}
@@ -0,0 +1,302 @@
+package ha
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Defaults for the lease held by the leader in etcd.
+const (
+	DefaultEtcdKey      = "/remote-signer/leader"
+	DefaultEtcdLeaseTTL = 10 * time.Second
+)
+
+// etcdRequestTimeout bounds the duration of every etcd API request.
+const etcdRequestTimeout = 5 * time.Second
+
+// EtcdLease is a lock provider backed by a key attached to a lease in etcd,
+// or any server implementing the etcd v3 JSON gateway API. The key is only
+// created if it does not exist, and is deleted by etcd when the lease expires.
+// The fencing token is the revision at which the key was created, which
+// increases with every acquisition.
+type EtcdLease struct {
+	endpoint     string
+	key          string
+	ttl          time.Duration
+	pollInterval time.Duration
+	client       *http.Client
+	lock         sync.Mutex
+	leaseID      int64
+	token        uint64
+	lost         chan struct{}
+	stop         chan struct{}
+	done         chan struct{}
+}
+
+// NewEtcdLease instantiates a lock provider holding key in the etcd
+// cluster served at endpoint, e.g. http://localhost:2379.
+func NewEtcdLease(endpoint, key string, ttl time.Duration) (*EtcdLease, error) {
+	if ttl < 3*time.Second {
+		return nil, errors.Errorf("lease TTL %v is too short, expected at least 3s", ttl)
+	}
+	return &EtcdLease{
+		endpoint:     strings.TrimSuffix(endpoint, "/"),
+		key:          key,
+		ttl:          ttl,
+		pollInterval: ttl / 3,
+		client:       &http.Client{Timeout: etcdRequestTimeout},
+	}, nil
+}
+
+type leaseGrantRequest struct {
+	TTL int64 `json:"TTL,string"`
+}
+
+type leaseGrantResponse struct {
+	ID  int64 `json:"ID,string"`
+	TTL int64 `json:"TTL,string"`
+}
+
+type leaseRequest struct {
+	ID int64 `json:"ID,string"`
+}
+
+type leaseKeepAliveResponse struct {
+	Result struct {
+		ID  int64 `json:"ID,string"`
+		TTL int64 `json:"TTL,string"`
+	} `json:"result"`
+}
+
+type txnCompare struct {
+	Key            string `json:"key"`
+	Target         string `json:"target"`
+	CreateRevision int64  `json:"create_revision,string"`
+}
+
+type txnPut struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Lease int64  `json:"lease,string"`
+}
+
+type txnOp struct {
+	RequestPut *txnPut `json:"request_put"`
+}
+
+type txnRequest struct {
+	Compare []txnCompare `json:"compare"`
+	Success []txnOp      `json:"success"`
+}
+
+type responseHeader struct {
+	Revision int64 `json:"revision,string"`
+}
+
+type txnResponse struct {
+	Header    responseHeader `json:"header"`
+	Succeeded bool           `json:"succeeded"`
+}
+
+type rangeRequest struct {
+	Key string `json:"key"`
+}
+
+type rangeResponse struct {
+	Kvs []struct {
+		CreateRevision int64 `json:"create_revision,string"`
+		Lease          int64 `json:"lease,string"`
+	} `json:"kvs"`
+}
+
+// Acquire blocks until the key is created with a lease of this instance.
+// The lease is then kept alive in the background, and considered lost if it
+// could not be renewed for half of its TTL, well before etcd expires it.
+func (e *EtcdLease) Acquire(ctx context.Context) (uint64, <-chan struct{}, error) {
+	for {
+		leaseID, token, err := e.tryAcquire(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return 0, nil, ctx.Err()
+			}
+			return 0, nil, err
+		}
+		if token > 0 {
+			lost := make(chan struct{})
+			e.lock.Lock()
+			e.leaseID = leaseID
+			e.token = token
+			e.lost = lost
+			e.stop = make(chan struct{})
+			e.done = make(chan struct{})
+			go e.keepAlive(leaseID, lost, e.stop, e.done)
+			e.lock.Unlock()
+			return token, lost, nil
+		}
+		select {
+		case <-time.After(e.pollInterval):
+		case <-ctx.Done():
+			return 0, nil, ctx.Err()
+		}
+	}
+}
+
+// tryAcquire grants a lease and creates the key with it, if the key does not
+// exist yet. It returns the lease and the revision of the key, or 0 if the
+// key is held by another instance.
+func (e *EtcdLease) tryAcquire(ctx context.Context) (int64, uint64, error) {
+	grant := &leaseGrantResponse{}
+	if err := e.do(ctx, "/v3/lease/grant", &leaseGrantRequest{TTL: int64(e.ttl.Seconds())}, grant); err != nil {
+		return 0, 0, errors.Wrap(err, "could not grant lease")
+	}
+	holder, err := os.Hostname()
+	if err != nil {
+		holder = "unknown"
+	}
+	txn := &txnRequest{
+		Compare: []txnCompare{{
+			Key:            encodeKey(e.key),
+			Target:         "CREATE",
+			CreateRevision: 0,
+		}},
+		Success: []txnOp{{
+			RequestPut: &txnPut{
+				Key:   encodeKey(e.key),
+				Value: encodeKey(fmt.Sprintf("%s/%d", holder, os.Getpid())),
+				Lease: grant.ID,
+			},
+		}},
+	}
+	res := &txnResponse{}
+	if err := e.do(ctx, "/v3/kv/txn", txn, res); err != nil {
+		e.revoke(ctx, grant.ID)
+		return 0, 0, errors.Wrap(err, "could not create leader key")
+	}
+	if !res.Succeeded || res.Header.Revision <= 0 {
+		e.revoke(ctx, grant.ID)
+		return 0, 0, nil
+	}
+	return grant.ID, uint64(res.Header.Revision), nil
+}
+
+// Check reads the leader key back from etcd, and returns an error unless it
+// is still attached to the lease of this instance and was created with the
+// fencing token, or if the lease could not be renewed in time.
+func (e *EtcdLease) Check(ctx context.Context, token uint64) error {
+	e.lock.Lock()
+	leaseID, held, lost := e.leaseID, e.token, e.lost
+	e.lock.Unlock()
+	if lost == nil || held != token {
+		return errors.Errorf("leader lease is not held with fencing token %d", token)
+	}
+	select {
+	case <-lost:
+		return errors.New("leader lease was lost")
+	default:
+	}
+	ctx, cancel := context.WithTimeout(ctx, etcdRequestTimeout)
+	defer cancel()
+	res := &rangeResponse{}
+	if err := e.do(ctx, "/v3/kv/range", &rangeRequest{Key: encodeKey(e.key)}, res); err != nil {
+		return errors.Wrap(err, "could not read leader key")
+	}
+	if len(res.Kvs) != 1 || res.Kvs[0].Lease != leaseID || uint64(res.Kvs[0].CreateRevision) != token {
+		return errors.Errorf("leader key is no longer held with fencing token %d", token)
+	}
+	return nil
+}
+
+// keepAlive renews the lease until stopped, closing lost if it could not be renewed in time.
+func (e *EtcdLease) keepAlive(leaseID int64, lost, stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+	lastRenewed := time.Now()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+		res := &leaseKeepAliveResponse{}
+		err := e.do(ctx, "/v3/lease/keepalive", &leaseRequest{ID: leaseID}, res)
+		cancel()
+		if err == nil && res.Result.TTL <= 0 {
+			log.Warn("Leader lease expired")
+			close(lost)
+			return
+		}
+		if err == nil {
+			lastRenewed = time.Now()
+			continue
+		}
+		log.WithError(err).Warn("Could not renew leader lease")
+		if time.Since(lastRenewed) > e.ttl/2 {
+			close(lost)
+			return
+		}
+	}
+}
+
+// Release stops renewing the lease and revokes it, deleting the key.
+func (e *EtcdLease) Release(ctx context.Context) error {
+	e.lock.Lock()
+	leaseID, stop, done := e.leaseID, e.stop, e.done
+	e.leaseID, e.token, e.lost, e.stop, e.done = 0, 0, nil, nil, nil
+	e.lock.Unlock()
+	if stop == nil {
+		return nil
+	}
+	close(stop)
+	<-done
+	if err := e.do(ctx, "/v3/lease/revoke", &leaseRequest{ID: leaseID}, &struct{}{}); err != nil {
+		return errors.Wrap(err, "could not revoke lease")
+	}
+	return nil
+}
+
+func (e *EtcdLease) revoke(ctx context.Context, leaseID int64) {
+	if err := e.do(ctx, "/v3/lease/revoke", &leaseRequest{ID: leaseID}, &struct{}{}); err != nil {
+		log.WithError(err).Debug("Could not revoke unused lease")
+	}
+}
+
+func (e *EtcdLease) do(ctx context.Context, path string, body, out interface{}) error {
+	enc, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint+path, bytes.NewReader(enc))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			log.WithError(err).Debug("Could not close response body")
+		}
+	}()
+	if res.StatusCode != http.StatusOK {
+		return errors.Errorf("unexpected status %s from %s", res.Status, path)
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+func encodeKey(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
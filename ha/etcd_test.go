@@ -0,0 +1,171 @@
+package ha
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+// freeURL returns the URL of a local port which is not in use.
+func freeURL(t *testing.T) url.URL {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := lis.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	return url.URL{Scheme: "http", Host: lis.Addr().String()}
+}
+
+// startEtcd runs a single member etcd cluster in-process, and returns
+// the endpoint of its JSON gateway API.
+func startEtcd(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "etcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := embed.NewConfig()
+	cfg.Dir = dir
+	cfg.LogLevel = "error"
+	clientURL, peerURL := freeURL(t), freeURL(t)
+	cfg.LCUrls, cfg.ACUrls = []url.URL{clientURL}, []url.URL{clientURL}
+	cfg.LPUrls, cfg.APUrls = []url.URL{peerURL}, []url.URL{peerURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+	etcd, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		etcd.Close()
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	})
+	select {
+	case <-etcd.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		t.Fatal("Timed out waiting for etcd to start")
+	}
+	return clientURL.String()
+}
+
+func TestEtcdLease_Exclusive(t *testing.T) {
+	endpoint := startEtcd(t)
+	first, err := NewEtcdLease(endpoint, DefaultEtcdKey, DefaultEtcdLeaseTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewEtcdLease(endpoint, DefaultEtcdKey, DefaultEtcdLeaseTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.pollInterval = 10 * time.Millisecond
+
+	ctx := context.Background()
+	firstToken, _, err := first.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Check(ctx, firstToken); err != nil {
+		t.Fatal(err)
+	}
+	timeoutCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if _, _, err := second.Acquire(timeoutCtx); err != context.DeadlineExceeded {
+		t.Fatalf("Wanted lease to be held, received %v", err)
+	}
+	if err := first.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	secondToken, _, err := second.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secondToken <= firstToken {
+		t.Errorf("Wanted fencing token greater than %d, received %d", firstToken, secondToken)
+	}
+	if err := second.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEtcdLease_LostOnRevoke(t *testing.T) {
+	endpoint := startEtcd(t)
+	l, err := NewEtcdLease(endpoint, DefaultEtcdKey, 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	token, lost, err := l.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An operator revoking the lease deletes the key, which the next
+	// renewal notices.
+	l.revoke(ctx, l.leaseID)
+	select {
+	case <-lost:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wanted lease to be lost after revocation")
+	}
+	if err := l.Check(ctx, token); err == nil {
+		t.Error("Wanted revoked lease to fail the check")
+	}
+	if err := l.Release(ctx); err != nil {
+		t.Log(err)
+	}
+}
+
+func TestEtcdLease_FencedAfterPause(t *testing.T) {
+	endpoint := startEtcd(t)
+	paused, err := NewEtcdLease(endpoint, DefaultEtcdKey, 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := NewEtcdLease(endpoint, DefaultEtcdKey, 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next.pollInterval = 100 * time.Millisecond
+
+	ctx := context.Background()
+	token, lost, err := paused.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Stop renewing the lease, as if the process was paused, until etcd
+	// expires it and another instance acquires the key.
+	close(paused.stop)
+	<-paused.done
+	nextToken, _, err := next.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := next.Release(ctx); err != nil {
+			t.Error(err)
+		}
+	}()
+	if nextToken <= token {
+		t.Errorf("Wanted fencing token greater than %d, received %d", token, nextToken)
+	}
+	// Once resumed, the paused instance has not noticed the expiry yet,
+	// but it is fenced off before writing.
+	select {
+	case <-lost:
+		t.Fatal("Wanted the paused instance unaware of the expiry")
+	default:
+	}
+	if err := paused.Check(ctx, token); err == nil {
+		t.Error("Wanted expired lease to fail the check")
+	}
+}
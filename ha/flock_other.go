@@ -0,0 +1,36 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package ha
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+var errUnsupported = errors.New("file locks are not supported on this platform")
+
+// FileLock is a lock provider backed by an exclusive flock on a file,
+// which is not supported on this platform.
+type FileLock struct{}
+
+// NewFileLock instantiates a lock provider for the file at path.
+func NewFileLock(string) *FileLock {
+	return &FileLock{}
+}
+
+// Acquire always fails on this platform.
+func (*FileLock) Acquire(context.Context) (uint64, <-chan struct{}, error) {
+	return 0, nil, errUnsupported
+}
+
+// Check always fails on this platform.
+func (*FileLock) Check(context.Context, uint64) error {
+	return errUnsupported
+}
+
+// Release always fails on this platform.
+func (*FileLock) Release(context.Context) error {
+	return errUnsupported
+}
@@ -0,0 +1,133 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package ha
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultFileLockPollInterval is the default delay between attempts to lock the file.
+const DefaultFileLockPollInterval = time.Second
+
+// FileLock is a lock provider backed by an exclusive flock on a file,
+// usually on a filesystem shared by every instance of the cluster.
+// The lock is held until released, or until the process exits. The
+// file holds the fencing token of the last holder, followed by its
+// process id.
+type FileLock struct {
+	path         string
+	pollInterval time.Duration
+	lock         sync.Mutex
+	file         *os.File
+	token        uint64
+}
+
+// NewFileLock instantiates a lock provider for the file at path.
+func NewFileLock(path string) *FileLock {
+	return &FileLock{
+		path:         path,
+		pollInterval: DefaultFileLockPollInterval,
+	}
+}
+
+// Acquire blocks until the file is exclusively locked, then increments the
+// fencing token in it and records the process id of the holder. A file lock
+// is never lost once held.
+func (f *FileLock) Acquire(ctx context.Context) (uint64, <-chan struct{}, error) {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return 0, nil, errors.Wrapf(err, "could not open lock file %s", f.path)
+	}
+	for {
+		err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if err != syscall.EWOULDBLOCK {
+			closeFile(file)
+			return 0, nil, errors.Wrapf(err, "could not lock file %s", f.path)
+		}
+		select {
+		case <-time.After(f.pollInterval):
+		case <-ctx.Done():
+			closeFile(file)
+			return 0, nil, ctx.Err()
+		}
+	}
+	token, err := nextToken(file)
+	if err != nil {
+		if err := syscall.Flock(int(file.Fd()), syscall.LOCK_UN); err != nil {
+			log.WithError(err).Debug("Could not unlock file")
+		}
+		closeFile(file)
+		return 0, nil, errors.Wrapf(err, "could not record fencing token in lock file %s", f.path)
+	}
+	f.lock.Lock()
+	f.file = file
+	f.token = token
+	f.lock.Unlock()
+	return token, make(chan struct{}), nil
+}
+
+// nextToken increments the fencing token of the locked file, and durably
+// records it with the process id of the new holder.
+func nextToken(file *os.File) (uint64, error) {
+	enc, err := ioutil.ReadAll(file)
+	if err != nil {
+		return 0, err
+	}
+	var token uint64
+	// The file is empty when first created.
+	if _, err := fmt.Sscan(string(enc), &token); err != nil {
+		token = 0
+	}
+	token++
+	if err := file.Truncate(0); err != nil {
+		return 0, err
+	}
+	if _, err := file.WriteAt([]byte(fmt.Sprintf("%d %d\n", token, os.Getpid())), 0); err != nil {
+		return 0, err
+	}
+	return token, file.Sync()
+}
+
+// Check returns an error unless the file is locked with the fencing token.
+func (f *FileLock) Check(_ context.Context, token uint64) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.file == nil || f.token != token {
+		return errors.Errorf("lock file %s is not held with fencing token %d", f.path, token)
+	}
+	return nil
+}
+
+// Release unlocks the file.
+func (f *FileLock) Release(_ context.Context) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	file := f.file
+	f.file, f.token = nil, 0
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_UN); err != nil {
+		closeFile(file)
+		return errors.Wrapf(err, "could not unlock file %s", f.path)
+	}
+	return file.Close()
+}
+
+func closeFile(file *os.File) {
+	if err := file.Close(); err != nil {
+		log.WithError(err).Debug("Could not close lock file")
+	}
+}
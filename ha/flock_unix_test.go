@@ -0,0 +1,58 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package ha
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileLock_Exclusive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}()
+	path := filepath.Join(dir, "leader.lock")
+	first, second := NewFileLock(path), NewFileLock(path)
+	second.pollInterval = time.Millisecond
+
+	ctx := context.Background()
+	firstToken, _, err := first.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Check(ctx, firstToken); err != nil {
+		t.Fatal(err)
+	}
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, _, err := second.Acquire(timeoutCtx); err != context.DeadlineExceeded {
+		t.Fatalf("Wanted lock to be held, received %v", err)
+	}
+	if err := first.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Check(ctx, firstToken); err == nil {
+		t.Error("Wanted released lock to fail the check")
+	}
+	secondToken, _, err := second.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secondToken <= firstToken {
+		t.Errorf("Wanted fencing token greater than %d, received %d", firstToken, secondToken)
+	}
+	if err := second.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
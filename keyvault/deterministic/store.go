@@ -11,20 +11,33 @@ package deterministic
 import (
 	"context"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
+	types "github.com/prysmaticlabs/eth2-types"
 	"github.com/prysmaticlabs/prysm/crypto/bls"
 	"github.com/prysmaticlabs/prysm/encoding/bytesutil"
 	"github.com/prysmaticlabs/prysm/runtime/interop"
+	"github.com/prysmaticlabs/remote-signer/keyvault"
+	"github.com/prysmaticlabs/remote-signer/keyvault/securemem"
 	"github.com/sirupsen/logrus"
 )
 
 var log = logrus.WithField("prefix", "deterministic-keyvault")
 
+// Source identifies keys loaded from a deterministic keyvault in key metadata.
+const Source = "deterministic"
+
+var errClosed = errors.New("deterministic keyvault is closed")
+
 // Store defines a deterministic keyvault, written for demonstrative purposes.
 type Store struct {
-	pubKeysToSecretKeys map[[48]byte]bls.SecretKey
+	lock                sync.RWMutex
+	pubKeysToSecretKeys map[[48]byte]*securemem.Buffer
+	pubKeysToMetadata   map[[48]byte]*keyvault.KeyMetadata
 	pubKeys             []bls.PublicKey
+	closed              bool
 }
 
 // NewStore instantiates a deterministic keyvault using a set number of keys.
@@ -36,32 +49,99 @@ func NewStore(numKeys int) (*Store, error) {
 	if err != nil {
 		return nil, errors.Wrapf(err, "Could not deterministically generate %d keys", numKeys)
 	}
-	pubKeysToSecretKeys := make(map[[48]byte]bls.SecretKey)
+	s := &Store{
+		pubKeys:             pubKeys,
+		pubKeysToSecretKeys: make(map[[48]byte]*securemem.Buffer),
+		pubKeysToMetadata:   make(map[[48]byte]*keyvault.KeyMetadata),
+	}
+	createdAt := time.Now()
 	for i := 0; i < len(pubKeys); i++ {
 		pubKey := bytesutil.ToBytes48(pubKeys[i].Marshal())
-		pubKeysToSecretKeys[pubKey] = secretKeys[i]
+		buf, err := securemem.NewBufferFromBytes(secretKeys[i].Marshal())
+		if err != nil {
+			s.destroyKeys()
+			return nil, errors.Wrapf(err, "Could not allocate secure memory for key %d", i)
+		}
+		s.pubKeysToSecretKeys[pubKey] = buf
+		// Deterministic keys are the interop keys, which are assigned
+		// the validator index matching their generation index at genesis.
+		validatorIndex := types.ValidatorIndex(i)
+		s.pubKeysToMetadata[pubKey] = &keyvault.KeyMetadata{
+			PublicKey:      pubKeys[i],
+			ValidatorIndex: &validatorIndex,
+			Source:         Source,
+			CreatedAt:      createdAt,
+			Enabled:        true,
+		}
 	}
 	log.WithField(
 		"numKeys", numKeys,
 	).Info("Initialized deterministic keyvault")
-	s := &Store{
-		pubKeys:             pubKeys,
-		pubKeysToSecretKeys: pubKeysToSecretKeys,
-	}
 	return s, nil
 }
 
 // GetSecretKey returns the corresponding secret key for a BLS12-381 public key.
 func (s *Store) GetSecretKey(ctx context.Context, pubKey bls.PublicKey) (bls.SecretKey, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.closed {
+		return nil, errClosed
+	}
 	key := bytesutil.ToBytes48(pubKey.Marshal())
-	secretKey, ok := s.pubKeysToSecretKeys[key]
+	buf, ok := s.pubKeysToSecretKeys[key]
 	if !ok {
 		return nil, fmt.Errorf("could not find secret key for public key %#x", key)
 	}
+	var secretKey bls.SecretKey
+	err := buf.Use(func(raw []byte) error {
+		var err error
+		secretKey, err = bls.SecretKeyFromBytes(raw)
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not load secret key for public key %#x", key)
+	}
 	return secretKey, nil
 }
 
 // GetPublicKeys returns all available BLS12-381 public keys in the deterministic keyvault.
 func (s *Store) GetPublicKeys(context.Context) ([]bls.PublicKey, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.closed {
+		return nil, errClosed
+	}
 	return s.pubKeys, nil
 }
+
+// GetKeyMetadata returns the metadata for a BLS12-381 public key in the deterministic keyvault.
+func (s *Store) GetKeyMetadata(_ context.Context, pubKey bls.PublicKey) (*keyvault.KeyMetadata, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	key := bytesutil.ToBytes48(pubKey.Marshal())
+	m, ok := s.pubKeysToMetadata[key]
+	if !ok {
+		return nil, fmt.Errorf("could not find metadata for public key %#x", key)
+	}
+	return m, nil
+}
+
+// Close zeroes all secret keys held by the keyvault.
+func (s *Store) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.destroyKeys()
+	s.closed = true
+	log.Debug("Closed deterministic keyvault")
+	return nil
+}
+
+func (s *Store) destroyKeys() {
+	for pubKey, buf := range s.pubKeysToSecretKeys {
+		buf.Destroy()
+		delete(s.pubKeysToSecretKeys, pubKey)
+	}
+}
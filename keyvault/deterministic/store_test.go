@@ -0,0 +1,58 @@
+package deterministic
+
+import (
+	"context"
+	"testing"
+)
+
+func TestStore_Close(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewStore(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKeys, err := s.GetPublicKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetSecretKey(ctx, pubKeys[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.pubKeysToSecretKeys) != 0 {
+		t.Errorf("Expected secret keys to be destroyed, %d remaining", len(s.pubKeysToSecretKeys))
+	}
+	if _, err := s.GetSecretKey(ctx, pubKeys[0]); err == nil {
+		t.Error("Expected error retrieving secret key from closed keyvault")
+	}
+	// Closing twice is a no-op.
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func BenchmarkStore_GetSecretKey(b *testing.B) {
+	ctx := context.Background()
+	s, err := NewStore(1)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer func() {
+		if err := s.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}()
+	pubKeys, err := s.GetPublicKeys(ctx)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.GetSecretKey(ctx, pubKeys[0]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+/*
+Package keystate wraps a keyvault with a per-key enabled/disabled state
+persisted on disk, so operators can stop individual validators from signing
+during incident response without removing their key material.
+*/
+package keystate
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prysmaticlabs/prysm/crypto/bls"
+	"github.com/prysmaticlabs/prysm/encoding/bytesutil"
+	"github.com/prysmaticlabs/remote-signer/keyvault"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.WithField("prefix", "keystate")
+
+// DisabledKey records why and when a key was disabled.
+type DisabledKey struct {
+	Reason     string    `json:"reason"`
+	DisabledAt time.Time `json:"disabled_at"`
+}
+
+// fileContents is the on-disk representation of the key states,
+// keyed by hex encoded public key.
+type fileContents struct {
+	Disabled map[string]*DisabledKey `json:"disabled"`
+}
+
+// Store wraps a keyvault, reporting disabled keys in their metadata.
+type Store struct {
+	keyvault.Store
+	path     string
+	lock     sync.RWMutex
+	disabled map[[48]byte]*DisabledKey
+}
+
+// NewStore wraps a keyvault with key states persisted in the file at path,
+// which is created on the first state change if it does not exist yet.
+func NewStore(store keyvault.Store, path string) (*Store, error) {
+	s := &Store{
+		Store:    store,
+		path:     path,
+		disabled: make(map[[48]byte]*DisabledKey),
+	}
+	enc, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read key state file %s", path)
+	}
+	contents := &fileContents{}
+	if err := json.Unmarshal(enc, contents); err != nil {
+		return nil, errors.Wrapf(err, "could not parse key state file %s", path)
+	}
+	for hexKey, d := range contents.Disabled {
+		pubKey, err := hex.DecodeString(strings.TrimPrefix(hexKey, "0x"))
+		if err != nil || len(pubKey) != 48 {
+			return nil, fmt.Errorf("invalid public key %s in key state file", hexKey)
+		}
+		s.disabled[bytesutil.ToBytes48(pubKey)] = d
+	}
+	if len(s.disabled) > 0 {
+		log.WithField("numDisabled", len(s.disabled)).Warn("Loaded disabled keys, they will not sign any request")
+	}
+	return s, nil
+}
+
+// GetKeyMetadata returns the metadata of the wrapped keyvault, marking the key as disabled if needed.
+func (s *Store) GetKeyMetadata(ctx context.Context, pubKey bls.PublicKey) (*keyvault.KeyMetadata, error) {
+	m, err := keyvault.GetKeyMetadata(ctx, s.Store, pubKey)
+	if err != nil {
+		return nil, err
+	}
+	s.lock.RLock()
+	d, ok := s.disabled[bytesutil.ToBytes48(pubKey.Marshal())]
+	s.lock.RUnlock()
+	if !ok {
+		return m, nil
+	}
+	disabled := *m
+	disabled.Enabled = false
+	disabled.DisabledReason = d.Reason
+	return &disabled, nil
+}
+
+// DisableKey disables signing with a key held by the keyvault and persists the state.
+func (s *Store) DisableKey(ctx context.Context, pubKey bls.PublicKey, reason string) error {
+	if err := s.checkKnownKey(ctx, pubKey); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	key := bytesutil.ToBytes48(pubKey.Marshal())
+	previous, wasDisabled := s.disabled[key]
+	s.disabled[key] = &DisabledKey{
+		Reason:     reason,
+		DisabledAt: time.Now(),
+	}
+	if err := s.save(); err != nil {
+		if wasDisabled {
+			s.disabled[key] = previous
+		} else {
+			delete(s.disabled, key)
+		}
+		return err
+	}
+	log.WithFields(logrus.Fields{
+		"publicKey": fmt.Sprintf("%#x", key),
+		"reason":    reason,
+	}).Warn("Disabled key")
+	return nil
+}
+
+// EnableKey re-enables signing with a previously disabled key and persists the state.
+func (s *Store) EnableKey(ctx context.Context, pubKey bls.PublicKey) error {
+	if err := s.checkKnownKey(ctx, pubKey); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	key := bytesutil.ToBytes48(pubKey.Marshal())
+	previous, ok := s.disabled[key]
+	if !ok {
+		return nil
+	}
+	delete(s.disabled, key)
+	if err := s.save(); err != nil {
+		s.disabled[key] = previous
+		return err
+	}
+	log.WithField("publicKey", fmt.Sprintf("%#x", key)).Info("Enabled key")
+	return nil
+}
+
+func (s *Store) checkKnownKey(ctx context.Context, pubKey bls.PublicKey) error {
+	pubKeys, err := s.Store.GetPublicKeys(ctx)
+	if err != nil {
+		return err
+	}
+	for _, k := range pubKeys {
+		if k.Equals(pubKey) {
+			return nil
+		}
+	}
+	return errors.Wrapf(keyvault.ErrUnknownKey, "%#x", pubKey.Marshal())
+}
+
+// save atomically writes the key states to disk. The caller must hold the lock.
+func (s *Store) save() error {
+	contents := &fileContents{
+		Disabled: make(map[string]*DisabledKey, len(s.disabled)),
+	}
+	for key, d := range s.disabled {
+		contents.Disabled[fmt.Sprintf("%#x", key)] = d
+	}
+	enc, err := json.MarshalIndent(contents, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return errors.Wrap(err, "could not create key state directory")
+	}
+	// The file is synced before it replaces the previous one, and the
+	// directory after, so that a crash leaves either state on disk.
+	tmpPath := s.path + ".tmp"
+	if err := writeFileSync(tmpPath, enc); err != nil {
+		return errors.Wrap(err, "could not write key state file")
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return errors.Wrap(err, "could not replace key state file")
+	}
+	return errors.Wrap(syncDir(filepath.Dir(s.path)), "could not sync key state directory")
+}
+
+// writeFileSync writes a file and flushes it to disk.
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		closeFile(f)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		closeFile(f)
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir flushes the entries of a directory to disk, such as a renamed
+// file. Directories cannot be synced on Windows, where this is a no-op.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	if err := d.Sync(); err != nil {
+		closeFile(d)
+		return err
+	}
+	return d.Close()
+}
+
+func closeFile(f *os.File) {
+	if err := f.Close(); err != nil {
+		log.WithError(err).Debug("Could not close file")
+	}
+}
@@ -0,0 +1,113 @@
+package keystate
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prysmaticlabs/prysm/crypto/bls"
+	"github.com/prysmaticlabs/remote-signer/keyvault"
+	"github.com/prysmaticlabs/remote-signer/keyvault/deterministic"
+)
+
+func setup(t *testing.T) (*deterministic.Store, []bls.PublicKey, string, func()) {
+	vault, err := deterministic.NewStore(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKeys, err := vault.GetPublicKeys(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "keystate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return vault, pubKeys, filepath.Join(dir, "state", "key-state.json"), func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestStore_DisableEnableKey(t *testing.T) {
+	ctx := context.Background()
+	vault, pubKeys, path, cleanup := setup(t)
+	defer cleanup()
+	s, err := NewStore(vault, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DisableKey(ctx, pubKeys[0], "incident 42"); err != nil {
+		t.Fatal(err)
+	}
+	m, err := s.GetKeyMetadata(ctx, pubKeys[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Enabled || m.DisabledReason != "incident 42" {
+		t.Errorf("Expected key to be disabled with reason, received %+v", m)
+	}
+	// Metadata of the underlying store must still be reported.
+	if m.Source != deterministic.Source {
+		t.Errorf("Wanted source %s, received %s", deterministic.Source, m.Source)
+	}
+	m, err = s.GetKeyMetadata(ctx, pubKeys[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Enabled {
+		t.Error("Expected other key to remain enabled")
+	}
+
+	// The disabled state survives a restart.
+	s, err = NewStore(vault, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err = s.GetKeyMetadata(ctx, pubKeys[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Enabled {
+		t.Error("Expected key to remain disabled after reloading state")
+	}
+
+	if err := s.EnableKey(ctx, pubKeys[0]); err != nil {
+		t.Fatal(err)
+	}
+	s, err = NewStore(vault, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err = s.GetKeyMetadata(ctx, pubKeys[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Enabled {
+		t.Error("Expected key to be enabled after reloading state")
+	}
+}
+
+func TestStore_DisableUnknownKey(t *testing.T) {
+	vault, _, path, cleanup := setup(t)
+	defer cleanup()
+	s, err := NewStore(vault, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sk, err := bls.RandKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.DisableKey(context.Background(), sk.PublicKey(), "unknown")
+	if !errors.Is(err, keyvault.ErrUnknownKey) {
+		t.Errorf("Wanted %v, received %v", keyvault.ErrUnknownKey, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Expected no key state file to be written")
+	}
+}
@@ -0,0 +1,166 @@
+package keyvault
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	types "github.com/prysmaticlabs/eth2-types"
+	"github.com/prysmaticlabs/prysm/crypto/bls"
+	"github.com/prysmaticlabs/prysm/encoding/bytesutil"
+)
+
+// UnknownSource is reported as the source backend of keys
+// held by a keyvault which does not provide any metadata.
+const UnknownSource = "unknown"
+
+// KeyMetadata describes a validating key held by a keyvault.
+type KeyMetadata struct {
+	PublicKey bls.PublicKey
+	// ValidatorIndex is nil if the index of the validator is not known.
+	ValidatorIndex *types.ValidatorIndex
+	Label          string
+	DerivationPath string
+	// Source is the kind of keyvault backend the key was loaded from.
+	Source    string
+	CreatedAt time.Time
+	Enabled   bool
+	// DisabledReason explains why signing with the key was disabled, if it is disabled.
+	DisabledReason string
+	// FeeRecipient is the 20 byte execution address for the validator, or nil if unset.
+	FeeRecipient []byte
+}
+
+// MetadataStore is an optional interface which keyvaults can implement
+// to describe the keys they hold beyond their bare public keys.
+type MetadataStore interface {
+	GetKeyMetadata(context.Context, bls.PublicKey) (*KeyMetadata, error)
+}
+
+// ToggleStore is an optional interface which keyvaults can implement to
+// disable and re-enable signing with individual keys at runtime, without
+// removing their key material.
+type ToggleStore interface {
+	DisableKey(ctx context.Context, pubKey bls.PublicKey, reason string) error
+	EnableKey(ctx context.Context, pubKey bls.PublicKey) error
+}
+
+// GetKeyMetadata returns the metadata for a public key held by a store. If
+// the store does not implement MetadataStore, default metadata is returned
+// with an unknown source and the key enabled.
+func GetKeyMetadata(ctx context.Context, store Store, pubKey bls.PublicKey) (*KeyMetadata, error) {
+	if ms, ok := store.(MetadataStore); ok {
+		return ms.GetKeyMetadata(ctx, pubKey)
+	}
+	return &KeyMetadata{
+		PublicKey: pubKey,
+		Source:    UnknownSource,
+		Enabled:   true,
+	}, nil
+}
+
+// ListKeyMetadata returns the metadata of every public key held by a store.
+func ListKeyMetadata(ctx context.Context, store Store) ([]*KeyMetadata, error) {
+	pubKeys, err := store.GetPublicKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	metadata := make([]*KeyMetadata, len(pubKeys))
+	for i, pubKey := range pubKeys {
+		m, err := GetKeyMetadata(ctx, store, pubKey)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not get metadata for public key %#x", pubKey.Marshal())
+		}
+		metadata[i] = m
+	}
+	return metadata, nil
+}
+
+// Annotation defines operator provided metadata for a key, which
+// takes precedence over the metadata reported by a keyvault.
+type Annotation struct {
+	ValidatorIndex *types.ValidatorIndex `json:"validator_index,omitempty"`
+	Label          string                `json:"label,omitempty"`
+	FeeRecipient   string                `json:"fee_recipient,omitempty"`
+}
+
+// LoadAnnotations reads a JSON file mapping hex encoded
+// public keys to their annotations.
+func LoadAnnotations(path string) (map[[48]byte]*Annotation, error) {
+	enc, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read key metadata file %s", path)
+	}
+	raw := make(map[string]*Annotation)
+	if err := json.Unmarshal(enc, &raw); err != nil {
+		return nil, errors.Wrapf(err, "could not parse key metadata file %s", path)
+	}
+	annotations := make(map[[48]byte]*Annotation, len(raw))
+	for hexKey, a := range raw {
+		pubKey, err := decodeHex(hexKey, 48)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid public key %s in key metadata file", hexKey)
+		}
+		if a.FeeRecipient != "" {
+			if _, err := decodeHex(a.FeeRecipient, 20); err != nil {
+				return nil, errors.Wrapf(err, "invalid fee recipient for public key %s", hexKey)
+			}
+		}
+		annotations[bytesutil.ToBytes48(pubKey)] = a
+	}
+	return annotations, nil
+}
+
+// AnnotatedStore wraps a keyvault, overlaying operator provided
+// annotations on top of the key metadata reported by the keyvault.
+type AnnotatedStore struct {
+	Store
+	annotations map[[48]byte]*Annotation
+}
+
+// NewAnnotatedStore wraps a store with a set of key annotations.
+func NewAnnotatedStore(store Store, annotations map[[48]byte]*Annotation) *AnnotatedStore {
+	return &AnnotatedStore{
+		Store:       store,
+		annotations: annotations,
+	}
+}
+
+// GetKeyMetadata returns the metadata of the wrapped store with annotations applied.
+func (s *AnnotatedStore) GetKeyMetadata(ctx context.Context, pubKey bls.PublicKey) (*KeyMetadata, error) {
+	m, err := GetKeyMetadata(ctx, s.Store, pubKey)
+	if err != nil {
+		return nil, err
+	}
+	a, ok := s.annotations[bytesutil.ToBytes48(pubKey.Marshal())]
+	if !ok {
+		return m, nil
+	}
+	annotated := *m
+	if a.ValidatorIndex != nil {
+		annotated.ValidatorIndex = a.ValidatorIndex
+	}
+	if a.Label != "" {
+		annotated.Label = a.Label
+	}
+	if a.FeeRecipient != "" {
+		// The fee recipient was validated when loading annotations.
+		annotated.FeeRecipient, _ = decodeHex(a.FeeRecipient, 20)
+	}
+	return &annotated, nil
+}
+
+func decodeHex(s string, wantLen int) ([]byte, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != wantLen {
+		return nil, errors.Errorf("wrong byte length %d, expected %d", len(b), wantLen)
+	}
+	return b, nil
+}
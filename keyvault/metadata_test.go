@@ -0,0 +1,139 @@
+package keyvault_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prysmaticlabs/prysm/crypto/bls"
+	"github.com/prysmaticlabs/prysm/encoding/bytesutil"
+	"github.com/prysmaticlabs/remote-signer/keyvault"
+	"github.com/prysmaticlabs/remote-signer/keyvault/deterministic"
+)
+
+type bareStore struct {
+	pubKeys []bls.PublicKey
+}
+
+func (b *bareStore) GetSecretKey(context.Context, bls.PublicKey) (bls.SecretKey, error) {
+	return bls.RandKey()
+}
+
+func (b *bareStore) GetPublicKeys(context.Context) ([]bls.PublicKey, error) {
+	return b.pubKeys, nil
+}
+
+func (b *bareStore) Close() error {
+	return nil
+}
+
+func TestListKeyMetadata_DefaultsForBareStore(t *testing.T) {
+	sk, err := bls.RandKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &bareStore{pubKeys: []bls.PublicKey{sk.PublicKey()}}
+	metadata, err := keyvault.ListKeyMetadata(context.Background(), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metadata) != 1 {
+		t.Fatalf("Wanted 1 key, received %d", len(metadata))
+	}
+	m := metadata[0]
+	if m.Source != keyvault.UnknownSource || !m.Enabled || m.ValidatorIndex != nil {
+		t.Errorf("Unexpected default metadata %+v", m)
+	}
+}
+
+func TestAnnotatedStore_GetKeyMetadata(t *testing.T) {
+	ctx := context.Background()
+	store, err := deterministic.NewStore(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKeys, err := store.GetPublicKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "annotations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}()
+	path := filepath.Join(dir, "keys.json")
+	feeRecipient := bytes.Repeat([]byte{0xab}, 20)
+	content := fmt.Sprintf(
+		`{"%#x": {"label": "validator-a", "validator_index": 100, "fee_recipient": "%#x"}}`,
+		pubKeys[1].Marshal(),
+		feeRecipient,
+	)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	annotations, err := keyvault.LoadAnnotations(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	annotated := keyvault.NewAnnotatedStore(store, annotations)
+
+	m, err := keyvault.GetKeyMetadata(ctx, annotated, pubKeys[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Source != deterministic.Source || m.Label != "" || *m.ValidatorIndex != 0 {
+		t.Errorf("Unexpected metadata for unannotated key %+v", m)
+	}
+
+	m, err = keyvault.GetKeyMetadata(ctx, annotated, pubKeys[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Label != "validator-a" {
+		t.Errorf("Wanted label %s, received %s", "validator-a", m.Label)
+	}
+	if *m.ValidatorIndex != 100 {
+		t.Errorf("Wanted validator index %d, received %d", 100, *m.ValidatorIndex)
+	}
+	if !bytes.Equal(m.FeeRecipient, feeRecipient) {
+		t.Errorf("Wanted fee recipient %#x, received %#x", feeRecipient, m.FeeRecipient)
+	}
+	// The metadata held by the underlying store must not be modified.
+	original, err := store.GetKeyMetadata(ctx, pubKeys[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if original.Label != "" {
+		t.Errorf("Expected underlying metadata to be untouched, received label %s", original.Label)
+	}
+	if _, ok := annotations[bytesutil.ToBytes48(pubKeys[1].Marshal())]; !ok {
+		t.Error("Expected annotation to be keyed by public key")
+	}
+}
+
+func TestLoadAnnotations_InvalidPublicKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "annotations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}()
+	path := filepath.Join(dir, "keys.json")
+	if err := ioutil.WriteFile(path, []byte(`{"0x1234": {"label": "bad"}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keyvault.LoadAnnotations(path); err == nil {
+		t.Error("Expected error loading annotation with invalid public key")
+	}
+}
@@ -43,3 +43,33 @@ func TestMnemonicGeneration(t *testing.T) {
 		}
 	}
 }
+
+func TestNewStore_InvalidMnemonic(t *testing.T) {
+	if _, err := mnemonic.NewStore("voice gospel easy verb", "", 0, 1); err == nil {
+		t.Error("Wanted error for an invalid mnemonic, received nil")
+	}
+}
+
+func BenchmarkStore_GetSecretKey(b *testing.B) {
+	ctx := context.Background()
+	vault, err := mnemonic.NewStore(
+		"voice gospel easy verb front diesel sense worth sword equip giggle jeans shoe defy kid degree van frost like blush chef silk spoil obtain",
+		"",
+		0,
+		1,
+	)
+	if err != nil {
+		b.Fatal(err)
+	}
+	pubKeys, err := vault.GetPublicKeys(ctx)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := vault.GetSecretKey(ctx, pubKeys[0]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -9,10 +9,14 @@ package mnemonic
 import (
 	"context"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/prysmaticlabs/prysm/crypto/bls"
 	"github.com/prysmaticlabs/prysm/encoding/bytesutil"
+	"github.com/prysmaticlabs/remote-signer/keyvault"
+	"github.com/prysmaticlabs/remote-signer/keyvault/securemem"
 	"github.com/sirupsen/logrus"
 
 	"github.com/prysmaticlabs/prysm/validator/accounts/wallet"
@@ -21,10 +25,21 @@ import (
 
 var log = logrus.WithField("prefix", "mnemonic-keyvault")
 
+// Source identifies keys loaded from a mnemonic keyvault in key metadata.
+const Source = "mnemonic"
+
+// signingKeyPath is the EIP-2334 derivation path of a validator signing key.
+const signingKeyPath = "m/12381/3600/%d/0/0"
+
+var errClosed = errors.New("mnemonic keyvault is closed")
+
 // Store defines a mnemonic keyvault, written for demonstrative purposes.
 type Store struct {
-	pubKeysToSecretKeys map[[48]byte]bls.SecretKey
+	lock                sync.RWMutex
+	pubKeysToSecretKeys map[[48]byte]*securemem.Buffer
+	pubKeysToMetadata   map[[48]byte]*keyvault.KeyMetadata
 	pubKeys             []bls.PublicKey
+	closed              bool
 }
 
 // NewStore instantiates a mnemonic keyvault using a set number of keys.
@@ -50,36 +65,60 @@ func NewStore(
 	// If a startIndex is provided, keys in range [0, startIndex] are also generated but not used.
 	// This is done for convenience as hoisting the code from RecoverAccountsFromMnemonic can't
 	// be done due to Go package constraints.
-	err = km.RecoverAccountsFromMnemonic(ctx, mnemonicPhrase, mnemonicPassword, startIndex+numKeys)
+	if err := km.RecoverAccountsFromMnemonic(ctx, mnemonicPhrase, mnemonicPassword, startIndex+numKeys); err != nil {
+		return nil, errors.Wrap(err, "could not recover accounts from mnemonic")
+	}
 
 	publicKeys, err := km.FetchValidatingPublicKeys(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not fetch validating public keys")
+	}
 	privateKeys, err := km.FetchValidatingPrivateKeys(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not fetch validating private keys")
+	}
 
 	mnemonicPubKeys := make([]bls.PublicKey, numKeys)
-	mnemonicPrivKeys := make([]bls.SecretKey, numKeys)
-	pubKeysToSecretKeys := make(map[[48]byte]bls.SecretKey)
+	s := &Store{
+		pubKeys:             mnemonicPubKeys,
+		pubKeysToSecretKeys: make(map[[48]byte]*securemem.Buffer),
+		pubKeysToMetadata:   make(map[[48]byte]*keyvault.KeyMetadata),
+	}
+	createdAt := time.Now()
+	// Zero every derived key, including the ones below the start index which are not used.
+	defer func() {
+		for i := range privateKeys {
+			securemem.Zero(privateKeys[i][:])
+		}
+	}()
 
 	// Copy only the keys that we are interested in
 	for i := startIndex; i < (numKeys + startIndex); i++ {
 		log.Infof("Key from mnemonic at index %d, %x", i, publicKeys[i])
-		log.Infof("Private Key from mnemonic %d, %x", i, privateKeys[i])
 
 		blsPrivate, err := bls.SecretKeyFromBytes(privateKeys[i][:])
 		if err != nil {
+			s.destroyKeys()
 			return nil, errors.Wrapf(err, "could not create bls secret key at index %d from raw bytes", i)
 		}
 
 		exportIndex := i - startIndex
 
-		mnemonicPrivKeys[exportIndex] = blsPrivate
 		mnemonicPubKeys[exportIndex] = blsPrivate.PublicKey()
 
-		pubKeysToSecretKeys[publicKeys[i]] = mnemonicPrivKeys[exportIndex]
-	}
-
-	s := &Store{
-		pubKeys:             mnemonicPubKeys,
-		pubKeysToSecretKeys: pubKeysToSecretKeys,
+		buf, err := securemem.NewBufferFromBytes(blsPrivate.Marshal())
+		if err != nil {
+			s.destroyKeys()
+			return nil, errors.Wrapf(err, "could not allocate secure memory for key at index %d", i)
+		}
+		s.pubKeysToSecretKeys[publicKeys[i]] = buf
+		s.pubKeysToMetadata[publicKeys[i]] = &keyvault.KeyMetadata{
+			PublicKey:      mnemonicPubKeys[exportIndex],
+			DerivationPath: fmt.Sprintf(signingKeyPath, i),
+			Source:         Source,
+			CreatedAt:      createdAt,
+			Enabled:        true,
+		}
 	}
 
 	return s, nil
@@ -87,15 +126,66 @@ func NewStore(
 
 // GetSecretKey returns the corresponding secret key for a BLS12-381 public key.
 func (s *Store) GetSecretKey(ctx context.Context, pubKey bls.PublicKey) (bls.SecretKey, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.closed {
+		return nil, errClosed
+	}
 	key := bytesutil.ToBytes48(pubKey.Marshal())
-	secretKey, ok := s.pubKeysToSecretKeys[key]
+	buf, ok := s.pubKeysToSecretKeys[key]
 	if !ok {
 		return nil, fmt.Errorf("could not find secret key for public key %#x", key)
 	}
+	var secretKey bls.SecretKey
+	err := buf.Use(func(raw []byte) error {
+		var err error
+		secretKey, err = bls.SecretKeyFromBytes(raw)
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not load secret key for public key %#x", key)
+	}
 	return secretKey, nil
 }
 
 // GetPublicKeys returns all available BLS12-381 public keys in the mnemonic keyvault.
 func (s *Store) GetPublicKeys(context.Context) ([]bls.PublicKey, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.closed {
+		return nil, errClosed
+	}
 	return s.pubKeys, nil
 }
+
+// GetKeyMetadata returns the metadata for a BLS12-381 public key in the mnemonic keyvault.
+func (s *Store) GetKeyMetadata(_ context.Context, pubKey bls.PublicKey) (*keyvault.KeyMetadata, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	key := bytesutil.ToBytes48(pubKey.Marshal())
+	m, ok := s.pubKeysToMetadata[key]
+	if !ok {
+		return nil, fmt.Errorf("could not find metadata for public key %#x", key)
+	}
+	return m, nil
+}
+
+// Close zeroes all secret keys held by the keyvault.
+func (s *Store) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.destroyKeys()
+	s.closed = true
+	log.Debug("Closed mnemonic keyvault")
+	return nil
+}
+
+func (s *Store) destroyKeys() {
+	for pubKey, buf := range s.pubKeysToSecretKeys {
+		buf.Destroy()
+		delete(s.pubKeysToSecretKeys, pubKey)
+	}
+}
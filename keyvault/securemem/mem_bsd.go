@@ -0,0 +1,10 @@
+//go:build darwin || freebsd
+// +build darwin freebsd
+
+package securemem
+
+func excludeFromCoreDump([]byte) {}
+
+func disableDumpable() error {
+	return nil
+}
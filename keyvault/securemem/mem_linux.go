@@ -0,0 +1,25 @@
+package securemem
+
+import (
+	"syscall"
+)
+
+// madvDontDump is MADV_DONTDUMP from linux/mman.h, which is not
+// exported by the syscall package.
+const madvDontDump = 0x10
+
+func excludeFromCoreDump(data []byte) {
+	if err := syscall.Madvise(data, madvDontDump); err != nil {
+		log.WithError(err).Debug("Could not exclude secure buffer from core dumps")
+	}
+}
+
+// disableDumpable marks the process as non-dumpable, which also prevents
+// other processes of the same user from attaching to it via ptrace.
+func disableDumpable() error {
+	_, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, syscall.PR_SET_DUMPABLE, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
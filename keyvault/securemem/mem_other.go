@@ -0,0 +1,31 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package securemem
+
+import (
+	"errors"
+)
+
+var errUnsupported = errors.New("memory locking is not supported on this platform")
+
+func alloc(size int) ([]byte, error) {
+	return make([]byte, size), nil
+}
+
+func free([]byte) error {
+	return nil
+}
+
+func lock([]byte) error {
+	return errUnsupported
+}
+
+func unlock([]byte) error {
+	return nil
+}
+
+// DisableCoreDumps is not supported on this platform.
+func DisableCoreDumps() error {
+	return errUnsupported
+}
@@ -0,0 +1,46 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package securemem
+
+import (
+	"syscall"
+)
+
+// alloc maps anonymous memory outside of the Go heap, so the garbage
+// collector never moves or copies the secret contents around.
+func alloc(size int) ([]byte, error) {
+	data, err := syscall.Mmap(
+		-1,
+		0,
+		size,
+		syscall.PROT_READ|syscall.PROT_WRITE,
+		syscall.MAP_ANON|syscall.MAP_PRIVATE,
+	)
+	if err != nil {
+		return nil, err
+	}
+	excludeFromCoreDump(data)
+	return data, nil
+}
+
+func free(data []byte) error {
+	return syscall.Munmap(data)
+}
+
+func lock(data []byte) error {
+	return syscall.Mlock(data)
+}
+
+func unlock(data []byte) error {
+	return syscall.Munlock(data)
+}
+
+// DisableCoreDumps sets the core file size limit of the process to zero,
+// so a crash never writes secret key material to disk.
+func DisableCoreDumps() error {
+	if err := syscall.Setrlimit(syscall.RLIMIT_CORE, &syscall.Rlimit{Cur: 0, Max: 0}); err != nil {
+		return err
+	}
+	return disableDumpable()
+}
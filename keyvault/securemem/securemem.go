@@ -0,0 +1,116 @@
+/*
+Package securemem provides memory hygiene primitives for secret key
+material held by keyvault implementations. Raw secret key bytes are kept
+in buffers allocated outside of the Go heap, locked into RAM so they are
+never written to swap, excluded from core dumps where the platform allows
+it, and zeroed as soon as they are no longer needed.
+
+Note: a bls.SecretKey reconstructed from a Buffer is a regular Go value,
+so callers should keep such values short-lived and never cache them.
+*/
+package securemem
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.WithField("prefix", "securemem")
+
+// ErrDestroyed is returned when accessing a buffer which has already been destroyed.
+var ErrDestroyed = errors.New("secure buffer has been destroyed")
+
+// warnOnce ensures we only warn a single time if memory cannot be locked,
+// as a low RLIMIT_MEMLOCK would otherwise flood the logs for every key.
+var warnOnce sync.Once
+
+// Buffer is a fixed-size region of memory holding secret bytes.
+type Buffer struct {
+	lock      sync.RWMutex
+	data      []byte
+	locked    bool
+	destroyed bool
+}
+
+// NewBuffer allocates a new secure buffer of the given size.
+func NewBuffer(size int) (*Buffer, error) {
+	if size <= 0 {
+		return nil, errors.New("secure buffer size must be positive")
+	}
+	data, err := alloc(size)
+	if err != nil {
+		return nil, err
+	}
+	b := &Buffer{data: data}
+	if err := lock(data); err != nil {
+		warnOnce.Do(func() {
+			log.WithError(err).Warn(
+				"Could not lock secret key memory, keys may be written to swap. " +
+					"Consider raising the RLIMIT_MEMLOCK limit of the process",
+			)
+		})
+	} else {
+		b.locked = true
+	}
+	return b, nil
+}
+
+// NewBufferFromBytes allocates a secure buffer holding a copy of src,
+// and zeroes src before returning.
+func NewBufferFromBytes(src []byte) (*Buffer, error) {
+	defer Zero(src)
+	b, err := NewBuffer(len(src))
+	if err != nil {
+		return nil, err
+	}
+	copy(b.data, src)
+	return b, nil
+}
+
+// Use calls fn with the secret contents of the buffer. The slice passed to fn
+// must not be retained after fn returns.
+func (b *Buffer) Use(fn func([]byte) error) error {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if b.destroyed {
+		return ErrDestroyed
+	}
+	return fn(b.data)
+}
+
+// Locked returns true if the buffer memory was successfully locked into RAM.
+func (b *Buffer) Locked() bool {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return b.locked
+}
+
+// Destroy zeroes the buffer contents, unlocks and releases its memory.
+// It is safe to call Destroy multiple times.
+func (b *Buffer) Destroy() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.destroyed {
+		return
+	}
+	Zero(b.data)
+	if b.locked {
+		if err := unlock(b.data); err != nil {
+			log.WithError(err).Debug("Could not unlock secure buffer")
+		}
+	}
+	if err := free(b.data); err != nil {
+		log.WithError(err).Debug("Could not release secure buffer")
+	}
+	b.data = nil
+	b.destroyed = true
+}
+
+// Zero overwrites every byte of b with zero.
+func Zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
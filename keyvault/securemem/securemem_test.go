@@ -0,0 +1,59 @@
+package securemem
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNewBufferFromBytes_ZeroesSource(t *testing.T) {
+	src := []byte("super secret key material")
+	want := make([]byte, len(src))
+	copy(want, src)
+	buf, err := NewBufferFromBytes(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer buf.Destroy()
+	if !bytes.Equal(src, make([]byte, len(src))) {
+		t.Errorf("Expected source to be zeroed, received %#x", src)
+	}
+	err = buf.Use(func(b []byte) error {
+		if !bytes.Equal(b, want) {
+			t.Errorf("Wanted %#x, received %#x", want, b)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuffer_Destroy(t *testing.T) {
+	buf, err := NewBufferFromBytes([]byte{1, 2, 3, 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Destroy()
+	buf.Destroy() // Destroying twice must not panic.
+	err = buf.Use(func([]byte) error {
+		t.Error("Expected use of destroyed buffer to not call fn")
+		return nil
+	})
+	if err != ErrDestroyed {
+		t.Errorf("Wanted %v, received %v", ErrDestroyed, err)
+	}
+}
+
+func TestNewBuffer_InvalidSize(t *testing.T) {
+	if _, err := NewBuffer(0); err == nil {
+		t.Error("Expected error for empty buffer")
+	}
+}
+
+func TestZero(t *testing.T) {
+	b := []byte{1, 2, 3}
+	Zero(b)
+	if !bytes.Equal(b, []byte{0, 0, 0}) {
+		t.Errorf("Expected zeroed slice, received %#x", b)
+	}
+}
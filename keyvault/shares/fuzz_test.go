@@ -0,0 +1,72 @@
+//go:build go1.18
+// +build go1.18
+
+package shares
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/prysmaticlabs/prysm/crypto/bls"
+	"github.com/prysmaticlabs/remote-signer/keyvault"
+	"github.com/prysmaticlabs/remote-signer/keyvault/securemem"
+	"github.com/prysmaticlabs/remote-signer/threshold"
+)
+
+// FuzzStore_addShare decodes share files, the JSON files holding the key
+// material of the keyvault. Malformed files must be rejected without
+// crashing, and the key of a file which is accepted must be served.
+func FuzzStore_addShare(f *testing.F) {
+	secretKey, err := bls.RandKey()
+	if err != nil {
+		f.Fatal(err)
+	}
+	keyShares, err := threshold.Split(secretKey, 2, 3)
+	if err != nil {
+		f.Fatal(err)
+	}
+	enc, err := json.Marshal(threshold.NewShareFile(secretKey.PublicKey(), 2, keyShares[0]))
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(enc)
+	f.Add([]byte(`{"group_public_key":"0x00","threshold":2,"index":1,"secret_share":"0x00"}`))
+	f.Add([]byte(`{}`))
+
+	f.Fuzz(func(t *testing.T, enc []byte) {
+		file := &threshold.ShareFile{}
+		if err := json.Unmarshal(enc, file); err != nil {
+			return
+		}
+		s := &Store{
+			pubKeysToSecretKeys: make(map[[48]byte]*securemem.Buffer),
+			pubKeysToMetadata:   make(map[[48]byte]*keyvault.KeyMetadata),
+		}
+		defer func() {
+			if err := s.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+		if err := s.addShare(file, time.Now()); err != nil {
+			return
+		}
+		ctx := context.Background()
+		pubKeys, err := s.GetPublicKeys(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rawPubKey, err := threshold.DecodeHex(file.GroupPublicKey, 48)
+		if err != nil {
+			t.Fatalf("Accepted invalid group public key: %v", err)
+		}
+		if len(pubKeys) != 1 || !bytes.Equal(pubKeys[0].Marshal(), rawPubKey) {
+			t.Fatalf("Wanted group public key %s, received %v", file.GroupPublicKey, pubKeys)
+		}
+		if _, err := s.GetSecretKey(ctx, pubKeys[0]); err != nil {
+			t.Fatalf("Could not retrieve accepted share: %v", err)
+		}
+	})
+}
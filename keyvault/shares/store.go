@@ -0,0 +1,164 @@
+/*
+Package shares defines a keyvault holding threshold shares of validator
+keys. Public keys are the group public keys of the shared validators, so
+a remote signer using this keyvault returns partial signatures which a
+threshold coordinator combines into the validator signature.
+
+WARN: secret shares are read from unencrypted files, NOT MEANT FOR PRODUCTION.
+*/
+package shares
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prysmaticlabs/prysm/crypto/bls"
+	"github.com/prysmaticlabs/prysm/encoding/bytesutil"
+	"github.com/prysmaticlabs/remote-signer/keyvault"
+	"github.com/prysmaticlabs/remote-signer/keyvault/securemem"
+	"github.com/prysmaticlabs/remote-signer/threshold"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.WithField("prefix", "shares-keyvault")
+
+// Source identifies keys loaded from a threshold shares keyvault in key metadata.
+const Source = "threshold-share"
+
+var errClosed = errors.New("shares keyvault is closed")
+
+// Store defines a keyvault of secret key shares, keyed by group public key.
+type Store struct {
+	lock                sync.RWMutex
+	pubKeysToSecretKeys map[[48]byte]*securemem.Buffer
+	pubKeysToMetadata   map[[48]byte]*keyvault.KeyMetadata
+	pubKeys             []bls.PublicKey
+	closed              bool
+}
+
+// NewStore instantiates a shares keyvault from the share files in a directory.
+func NewStore(dir string) (*Store, error) {
+	files, err := threshold.LoadShareFiles(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not load share files")
+	}
+	s := &Store{
+		pubKeysToSecretKeys: make(map[[48]byte]*securemem.Buffer, len(files)),
+		pubKeysToMetadata:   make(map[[48]byte]*keyvault.KeyMetadata, len(files)),
+	}
+	createdAt := time.Now()
+	for _, f := range files {
+		if err := s.addShare(f, createdAt); err != nil {
+			s.destroyKeys()
+			return nil, errors.Wrapf(err, "invalid share of %s", f.GroupPublicKey)
+		}
+	}
+	log.WithField("numKeys", len(s.pubKeys)).Info("Initialized threshold shares keyvault")
+	return s, nil
+}
+
+func (s *Store) addShare(f *threshold.ShareFile, createdAt time.Time) error {
+	rawPubKey, err := threshold.DecodeHex(f.GroupPublicKey, 48)
+	if err != nil {
+		return err
+	}
+	groupPubKey, err := bls.PublicKeyFromBytes(rawPubKey)
+	if err != nil {
+		return err
+	}
+	key := bytesutil.ToBytes48(rawPubKey)
+	if _, ok := s.pubKeysToSecretKeys[key]; ok {
+		return errors.New("duplicate share for group public key")
+	}
+	rawShare, err := threshold.DecodeHex(f.SecretShare, 32)
+	if err != nil {
+		return errors.Wrap(err, "could not decode secret share")
+	}
+	if _, err := bls.SecretKeyFromBytes(rawShare); err != nil {
+		securemem.Zero(rawShare)
+		return errors.Wrap(err, "could not parse secret share")
+	}
+	buf, err := securemem.NewBufferFromBytes(rawShare)
+	if err != nil {
+		return err
+	}
+	s.pubKeysToSecretKeys[key] = buf
+	s.pubKeysToMetadata[key] = &keyvault.KeyMetadata{
+		PublicKey: groupPubKey,
+		Label:     fmt.Sprintf("threshold share %d", f.Index),
+		Source:    Source,
+		CreatedAt: createdAt,
+		Enabled:   true,
+	}
+	s.pubKeys = append(s.pubKeys, groupPubKey)
+	return nil
+}
+
+// GetSecretKey returns the secret key share for a BLS12-381 group public key.
+func (s *Store) GetSecretKey(ctx context.Context, pubKey bls.PublicKey) (bls.SecretKey, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.closed {
+		return nil, errClosed
+	}
+	key := bytesutil.ToBytes48(pubKey.Marshal())
+	buf, ok := s.pubKeysToSecretKeys[key]
+	if !ok {
+		return nil, fmt.Errorf("could not find secret share for public key %#x", key)
+	}
+	var secretKey bls.SecretKey
+	err := buf.Use(func(raw []byte) error {
+		var err error
+		secretKey, err = bls.SecretKeyFromBytes(raw)
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not load secret share for public key %#x", key)
+	}
+	return secretKey, nil
+}
+
+// GetPublicKeys returns the group public keys of all shares in the keyvault.
+func (s *Store) GetPublicKeys(context.Context) ([]bls.PublicKey, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.closed {
+		return nil, errClosed
+	}
+	return s.pubKeys, nil
+}
+
+// GetKeyMetadata returns the metadata for a BLS12-381 group public key in the keyvault.
+func (s *Store) GetKeyMetadata(_ context.Context, pubKey bls.PublicKey) (*keyvault.KeyMetadata, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	key := bytesutil.ToBytes48(pubKey.Marshal())
+	m, ok := s.pubKeysToMetadata[key]
+	if !ok {
+		return nil, fmt.Errorf("could not find metadata for public key %#x", key)
+	}
+	return m, nil
+}
+
+// Close zeroes all secret shares held by the keyvault.
+func (s *Store) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.destroyKeys()
+	s.closed = true
+	log.Debug("Closed threshold shares keyvault")
+	return nil
+}
+
+func (s *Store) destroyKeys() {
+	for pubKey, buf := range s.pubKeysToSecretKeys {
+		buf.Destroy()
+		delete(s.pubKeysToSecretKeys, pubKey)
+	}
+}
@@ -0,0 +1,57 @@
+package shares
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prysmaticlabs/prysm/crypto/bls"
+	"github.com/prysmaticlabs/remote-signer/threshold"
+)
+
+func BenchmarkStore_GetSecretKey(b *testing.B) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "shares")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			b.Fatal(err)
+		}
+	}()
+	secretKey, err := bls.RandKey()
+	if err != nil {
+		b.Fatal(err)
+	}
+	keyShares, err := threshold.Split(secretKey, 2, 3)
+	if err != nil {
+		b.Fatal(err)
+	}
+	enc, err := json.Marshal(threshold.NewShareFile(secretKey.PublicKey(), 2, keyShares[0]))
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "share.json"), enc, 0600); err != nil {
+		b.Fatal(err)
+	}
+	s, err := NewStore(dir)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer func() {
+		if err := s.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.GetSecretKey(ctx, secretKey.PublicKey()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -10,13 +10,20 @@ package keyvault
 
 import (
 	"context"
+	"errors"
 
 	"github.com/prysmaticlabs/prysm/crypto/bls"
 )
 
+// ErrUnknownKey is returned when a public key is not held by a keyvault.
+var ErrUnknownKey = errors.New("public key not found in keyvault")
+
 // Store defines a struct which has capabilities of retrieving
 // BLS12-381 eth2 secret keys and public keys from a secure source.
+// Close zeroes any secret key material held in memory by the store,
+// after which the store can no longer be used.
 type Store interface {
 	GetSecretKey(context.Context, bls.PublicKey) (bls.SecretKey, error)
 	GetPublicKeys(context.Context) ([]bls.PublicKey, error)
+	Close() error
 }
@@ -1,5 +1,13 @@
-package keyvault
+package keyvault_test
 
-import "github.com/prysmaticlabs/remote-signer/keyvault/deterministic"
+import (
+	"github.com/prysmaticlabs/remote-signer/keyvault"
+	"github.com/prysmaticlabs/remote-signer/keyvault/deterministic"
+	"github.com/prysmaticlabs/remote-signer/keyvault/mnemonic"
+)
 
-var _ = Store(&deterministic.Store{})
+var _ = keyvault.Store(&deterministic.Store{})
+var _ = keyvault.Store(&mnemonic.Store{})
+var _ = keyvault.MetadataStore(&deterministic.Store{})
+var _ = keyvault.MetadataStore(&mnemonic.Store{})
+var _ = keyvault.MetadataStore(&keyvault.AnnotatedStore{})
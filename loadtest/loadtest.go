@@ -0,0 +1,260 @@
+/*
+Package loadtest generates the signing load of many validators against a
+remote signer, to find out how many validators one signer can carry. The
+synthetic validators replay the requests validator clients make every slot,
+attestations, aggregates, block proposals and sync committee messages, and
+the throughput and latency percentiles of the signer are reported, by
+request type and for the whole of each slot.
+*/
+package loadtest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	types "github.com/prysmaticlabs/eth2-types"
+	validatorpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1/validator-client"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var log = logrus.WithField("prefix", "loadtest")
+
+// Defaults of the load test configuration, as on mainnet.
+const (
+	DefaultSlotsPerEpoch     = 32
+	DefaultSyncCommitteeSize = 512
+	DefaultAggregatorModulo  = 8
+	DefaultConcurrency       = 64
+)
+
+// Config of a load test.
+type Config struct {
+	// PublicKeys of the synthetic validators, held by the remote signer.
+	PublicKeys [][]byte
+	// StartSlot is the first slot signed. Slots must be ahead of the
+	// signing history of the keys, for the requests not to be denied
+	// by slashing protection.
+	StartSlot types.Slot
+	// Slots is the number of slots replayed.
+	Slots uint64
+	// SlotDuration paces the slots, 12 seconds on mainnet. If zero, each
+	// slot starts once the requests of the previous one are served, to
+	// measure the maximum throughput.
+	SlotDuration time.Duration
+	// Concurrency is the number of requests in flight at once.
+	Concurrency int
+	// SlotsPerEpoch, SyncCommitteeSize and AggregatorModulo shape the
+	// requests of each slot, see slotRequests.
+	SlotsPerEpoch     uint64
+	SyncCommitteeSize int
+	AggregatorModulo  int
+}
+
+// Stats of the latency of requests.
+type Stats struct {
+	Count  int
+	Denied int
+	Failed int
+	Mean   time.Duration
+	P50    time.Duration
+	P90    time.Duration
+	P99    time.Duration
+	Max    time.Duration
+}
+
+// Report of a load test.
+type Report struct {
+	Validators int
+	Slots      uint64
+	Duration   time.Duration
+	// Throughput is the number of requests served per second.
+	Throughput float64
+	// Total is the latency of every request, ByType by request type.
+	Total  Stats
+	ByType map[string]*Stats
+	// SlotCompletion is the time from the start of a slot until its
+	// requests are all served.
+	SlotCompletion Stats
+}
+
+// Run the load test against a remote signer.
+func Run(ctx context.Context, signer validatorpb.RemoteSignerClient, cfg *Config) (*Report, error) {
+	if len(cfg.PublicKeys) == 0 {
+		return nil, errors.New("expected public keys of the validators")
+	}
+	if cfg.SlotsPerEpoch == 0 {
+		cfg.SlotsPerEpoch = DefaultSlotsPerEpoch
+	}
+	if cfg.AggregatorModulo <= 0 {
+		cfg.AggregatorModulo = DefaultAggregatorModulo
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = DefaultConcurrency
+	}
+
+	type result struct {
+		kind    string
+		latency time.Duration
+		code    codes.Code
+	}
+	type job struct {
+		*request
+		done func()
+	}
+	jobs := make(chan job)
+	var lock sync.Mutex
+	var results []result
+	var workers sync.WaitGroup
+	for i := 0; i < cfg.Concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for j := range jobs {
+				start := time.Now()
+				res, err := signer.Sign(ctx, j.req)
+				r := result{kind: j.kind, latency: time.Since(start), code: status.Code(err)}
+				if err == nil && res.Status == validatorpb.SignResponse_DENIED {
+					r.code = codes.PermissionDenied
+				}
+				lock.Lock()
+				results = append(results, r)
+				lock.Unlock()
+				j.done()
+			}
+		}()
+	}
+
+	var slotTimes []time.Duration
+	var slotsDone sync.WaitGroup
+	begin := time.Now()
+	for i := uint64(0); i < cfg.Slots && ctx.Err() == nil; i++ {
+		if cfg.SlotDuration > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Until(begin.Add(time.Duration(i) * cfg.SlotDuration))):
+			}
+		}
+		slotStart := time.Now()
+		reqs := cfg.slotRequests(cfg.StartSlot + types.Slot(i))
+		var pending sync.WaitGroup
+		pending.Add(len(reqs))
+		slotsDone.Add(1)
+		go func() {
+			defer slotsDone.Done()
+			pending.Wait()
+			lock.Lock()
+			slotTimes = append(slotTimes, time.Since(slotStart))
+			lock.Unlock()
+		}()
+		for _, r := range reqs {
+			jobs <- job{request: r, done: pending.Done}
+		}
+		if cfg.SlotDuration == 0 {
+			pending.Wait()
+		}
+	}
+	close(jobs)
+	workers.Wait()
+	slotsDone.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		Validators: len(cfg.PublicKeys),
+		Slots:      cfg.Slots,
+		Duration:   time.Since(begin),
+		ByType:     make(map[string]*Stats),
+	}
+	all := make([]time.Duration, 0, len(results))
+	byType := make(map[string][]time.Duration)
+	for _, r := range results {
+		all = append(all, r.latency)
+		byType[r.kind] = append(byType[r.kind], r.latency)
+		stats, ok := report.ByType[r.kind]
+		if !ok {
+			stats = &Stats{}
+			report.ByType[r.kind] = stats
+		}
+		switch r.code {
+		case codes.OK:
+		case codes.PermissionDenied:
+			stats.Denied++
+			report.Total.Denied++
+		default:
+			stats.Failed++
+			report.Total.Failed++
+		}
+	}
+	fillStats(&report.Total, all)
+	for kind, latencies := range byType {
+		fillStats(report.ByType[kind], latencies)
+	}
+	fillStats(&report.SlotCompletion, slotTimes)
+	if report.Duration > 0 {
+		report.Throughput = float64(len(results)) / report.Duration.Seconds()
+	}
+	return report, nil
+}
+
+// fillStats computes the count, mean, percentiles and maximum of latencies.
+func fillStats(s *Stats, latencies []time.Duration) {
+	s.Count = len(latencies)
+	if len(latencies) == 0 {
+		return
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	var sum time.Duration
+	for _, l := range latencies {
+		sum += l
+	}
+	s.Mean = sum / time.Duration(len(latencies))
+	s.P50 = percentile(latencies, 0.50)
+	s.P90 = percentile(latencies, 0.90)
+	s.P99 = percentile(latencies, 0.99)
+	s.Max = latencies[len(latencies)-1]
+}
+
+// percentile returns the latency below which a share q of sorted latencies are.
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	i := int(math.Ceil(q*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+// Write the report as a table.
+func (r *Report) Write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "%d validators, %d slots in %v, %.1f requests/s\n\n", r.Validators, r.Slots, r.Duration.Round(time.Millisecond), r.Throughput)
+	fmt.Fprintln(tw, "type\tcount\tdenied\tfailed\tmean\tp50\tp90\tp99\tmax\t")
+	kinds := make([]string, 0, len(r.ByType))
+	for kind := range r.ByType {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	row := func(name string, s *Stats) {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%v\t%v\t%v\t%v\t%v\t\n", name, s.Count, s.Denied, s.Failed,
+			round(s.Mean), round(s.P50), round(s.P90), round(s.P99), round(s.Max))
+	}
+	for _, kind := range kinds {
+		row(kind, r.ByType[kind])
+	}
+	row("total", &r.Total)
+	row("slot", &r.SlotCompletion)
+	return tw.Flush()
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(10 * time.Microsecond)
+}
@@ -0,0 +1,105 @@
+package loadtest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	validatorpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1/validator-client"
+	"google.golang.org/grpc"
+)
+
+// countingSigner succeeds every sign request, denying blocks.
+type countingSigner struct {
+	validatorpb.RemoteSignerClient
+	lock  sync.Mutex
+	count int
+}
+
+func (c *countingSigner) Sign(
+	_ context.Context, req *validatorpb.SignRequest, _ ...grpc.CallOption,
+) (*validatorpb.SignResponse, error) {
+	c.lock.Lock()
+	c.count++
+	c.lock.Unlock()
+	if _, ok := req.Object.(*validatorpb.SignRequest_BlockV2); ok {
+		return &validatorpb.SignResponse{Status: validatorpb.SignResponse_DENIED}, nil
+	}
+	return &validatorpb.SignResponse{Status: validatorpb.SignResponse_SUCCEEDED}, nil
+}
+
+func testKeys(n int) [][]byte {
+	keys := make([][]byte, n)
+	for i := range keys {
+		keys[i] = make([]byte, 48)
+		keys[i][0] = byte(i)
+	}
+	return keys
+}
+
+func TestConfig_SlotRequests(t *testing.T) {
+	cfg := &Config{
+		PublicKeys:        testKeys(128),
+		SlotsPerEpoch:     32,
+		SyncCommitteeSize: 16,
+		AggregatorModulo:  2,
+	}
+	counts := make(map[string]int)
+	for _, r := range cfg.slotRequests(33) {
+		counts[r.kind]++
+	}
+	want := map[string]int{
+		// Validators 1, 33, 65 and 97 attest at slot 33.
+		TypeAttestation:       4,
+		TypeSelectionProof:    4,
+		TypeAggregateAndProof: 2,
+		TypeBlock:             1,
+		TypeRandaoReveal:      1,
+		// Every sync committee member signs every slot.
+		TypeSyncCommitteeMessage:  16,
+		TypeSyncSelectionProof:    16,
+		TypeSyncContributionProof: 8,
+	}
+	for kind, n := range want {
+		if counts[kind] != n {
+			t.Errorf("Wanted %d %s requests, received %d", n, kind, counts[kind])
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	signer := &countingSigner{}
+	report, err := Run(context.Background(), signer, &Config{
+		PublicKeys:        testKeys(64),
+		Slots:             4,
+		SyncCommitteeSize: 8,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Total.Count != signer.count {
+		t.Errorf("Wanted %d requests reported, received %d", signer.count, report.Total.Count)
+	}
+	if report.Total.Denied != 4 || report.ByType[TypeBlock].Denied != 4 {
+		t.Errorf("Wanted the 4 blocks denied, received %d denied", report.Total.Denied)
+	}
+	if report.SlotCompletion.Count != 4 {
+		t.Errorf("Wanted 4 slots reported, received %d", report.SlotCompletion.Count)
+	}
+}
+
+func TestFillStats(t *testing.T) {
+	var latencies []time.Duration
+	for i := 100; i >= 1; i-- {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	s := &Stats{}
+	fillStats(s, latencies)
+	if s.P50 != 50*time.Millisecond || s.P99 != 99*time.Millisecond || s.Max != 100*time.Millisecond {
+		t.Errorf("Unexpected percentiles %+v", s)
+	}
+	if s.Mean != 50500*time.Microsecond {
+		t.Errorf("Wanted mean of 50.5ms, received %v", s.Mean)
+	}
+}
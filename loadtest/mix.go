@@ -0,0 +1,151 @@
+package loadtest
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+
+	types "github.com/prysmaticlabs/eth2-types"
+	ethpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1"
+	validatorpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1/validator-client"
+	"github.com/prysmaticlabs/remote-signer/client"
+	"github.com/prysmaticlabs/remote-signer/slashing"
+)
+
+// Request types, as reported.
+const (
+	TypeAttestation           = "attestation"
+	TypeSelectionProof        = "selection_proof"
+	TypeAggregateAndProof     = "aggregate_and_proof"
+	TypeBlock                 = "block"
+	TypeRandaoReveal          = "randao_reveal"
+	TypeSyncCommitteeMessage  = "sync_committee_message"
+	TypeSyncSelectionProof    = "sync_aggregator_selection"
+	TypeSyncContributionProof = "sync_contribution_and_proof"
+)
+
+// syncSubcommitteeCount is the number of subnets of the sync committee.
+const syncSubcommitteeCount = 4
+
+// request is a sign request of a synthetic validator.
+type request struct {
+	kind string
+	req  *validatorpb.SignRequest
+}
+
+// slotRequests returns the sign requests of the validators at a slot, as
+// made by validator clients of mainnet:
+//
+//   - every validator attests once per epoch, at the slot of its committee,
+//     and signs a selection proof to find out whether it aggregates
+//   - one in AggregatorModulo attesters is an aggregator, signing an
+//     aggregate and proof
+//   - one validator proposes a block, with its randao reveal, as if the
+//     signer held every validator of the network
+//   - the first SyncCommitteeSize validators sign a sync committee message
+//     and a sync aggregator selection proof every slot, and one in
+//     AggregatorModulo of them signs a contribution and proof
+func (c *Config) slotRequests(slot types.Slot) []*request {
+	n := len(c.PublicKeys)
+	epoch := types.Epoch(uint64(slot) / c.SlotsPerEpoch)
+	var reqs []*request
+	add := func(kind string, validator int, req *validatorpb.SignRequest) {
+		req.PublicKey = c.PublicKeys[validator]
+		req.SigningRoot = signingRoot(kind, slot, validator)
+		// Blocks and attestations are only signed for the root of their
+		// object in the domain of their type.
+		switch kind {
+		case TypeBlock:
+			req.SignatureDomain = signatureDomain(client.DomainBeaconProposer)
+		case TypeAttestation:
+			req.SignatureDomain = signatureDomain(client.DomainBeaconAttester)
+		}
+		if root, err := slashing.ComputeSigningRoot(req); err == nil && root != nil {
+			req.SigningRoot = root
+		}
+		reqs = append(reqs, &request{kind: kind, req: req})
+	}
+
+	committee := uint64(slot) % c.SlotsPerEpoch
+	for i := int(committee); i < n; i += int(c.SlotsPerEpoch) {
+		source := epoch
+		if source > 0 {
+			source--
+		}
+		data := &ethpb.AttestationData{
+			Slot:            slot,
+			BeaconBlockRoot: signingRoot("head", slot, 0),
+			Source:          &ethpb.Checkpoint{Epoch: source, Root: make([]byte, 32)},
+			Target:          &ethpb.Checkpoint{Epoch: epoch, Root: make([]byte, 32)},
+		}
+		add(TypeAttestation, i, &validatorpb.SignRequest{Object: &validatorpb.SignRequest_AttestationData{AttestationData: data}})
+		add(TypeSelectionProof, i, &validatorpb.SignRequest{Object: &validatorpb.SignRequest_Slot{Slot: slot}})
+		if (i/int(c.SlotsPerEpoch))%c.AggregatorModulo == 0 {
+			add(TypeAggregateAndProof, i, &validatorpb.SignRequest{Object: &validatorpb.SignRequest_AggregateAttestationAndProof{
+				AggregateAttestationAndProof: &ethpb.AggregateAttestationAndProof{
+					AggregatorIndex: types.ValidatorIndex(i),
+					Aggregate:       &ethpb.Attestation{Data: data, Signature: make([]byte, 96)},
+					SelectionProof:  make([]byte, 96),
+				},
+			}})
+		}
+	}
+
+	if n > 0 {
+		proposer := int(uint64(slot) % uint64(n))
+		add(TypeRandaoReveal, proposer, &validatorpb.SignRequest{Object: &validatorpb.SignRequest_Epoch{Epoch: epoch}})
+		add(TypeBlock, proposer, &validatorpb.SignRequest{Object: &validatorpb.SignRequest_BlockV2{BlockV2: &ethpb.BeaconBlockAltair{
+			Slot:          slot,
+			ProposerIndex: types.ValidatorIndex(proposer),
+			ParentRoot:    signingRoot("parent", slot, 0),
+			StateRoot:     signingRoot("state", slot, 0),
+		}}})
+	}
+
+	members := c.SyncCommitteeSize
+	if members > n {
+		members = n
+	}
+	for i := 0; i < members; i++ {
+		subcommittee := uint64(i % syncSubcommitteeCount)
+		add(TypeSyncCommitteeMessage, i, &validatorpb.SignRequest{Object: &validatorpb.SignRequest_SyncMessageBlockRoot{
+			SyncMessageBlockRoot: signingRoot("head", slot, 0),
+		}})
+		add(TypeSyncSelectionProof, i, &validatorpb.SignRequest{Object: &validatorpb.SignRequest_SyncAggregatorSelectionData{
+			SyncAggregatorSelectionData: &ethpb.SyncAggregatorSelectionData{Slot: slot, SubcommitteeIndex: subcommittee},
+		}})
+		if (i/syncSubcommitteeCount)%c.AggregatorModulo == 0 {
+			add(TypeSyncContributionProof, i, &validatorpb.SignRequest{Object: &validatorpb.SignRequest_ContributionAndProof{
+				ContributionAndProof: &ethpb.ContributionAndProof{
+					AggregatorIndex: types.ValidatorIndex(i),
+					Contribution: &ethpb.SyncCommitteeContribution{
+						Slot:              slot,
+						BlockRoot:         signingRoot("head", slot, 0),
+						SubcommitteeIndex: subcommittee,
+						Signature:         make([]byte, 96),
+					},
+					SelectionProof: make([]byte, 96),
+				},
+			}})
+		}
+	}
+	return reqs
+}
+
+// signatureDomain returns a domain of a domain type, with a zero fork data root.
+func signatureDomain(domainType client.DomainType) []byte {
+	domain := make([]byte, 32)
+	copy(domain, domainType[:])
+	return domain
+}
+
+// signingRoot derives a distinct root for each message, the remote signer
+// signing the roots of other objects as given.
+func signingRoot(kind string, slot types.Slot, validator int) []byte {
+	var buf [16]byte
+	binary.BigEndian.PutUint64(buf[:8], uint64(slot))
+	binary.BigEndian.PutUint64(buf[8:], uint64(validator))
+	h := sha256.New()
+	_, _ = h.Write([]byte(kind))
+	_, _ = h.Write(buf[:])
+	return h.Sum(nil)
+}
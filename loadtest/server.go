@@ -0,0 +1,161 @@
+package loadtest
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	validatorpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1/validator-client"
+	"github.com/prysmaticlabs/remote-signer/client"
+	"github.com/prysmaticlabs/remote-signer/keyvault/deterministic"
+	"github.com/prysmaticlabs/remote-signer/rpc"
+	"github.com/prysmaticlabs/remote-signer/slashing"
+	"google.golang.org/grpc"
+)
+
+// Server is a remote signer served in-process, with a deterministic keyvault
+// and a slashing protection database in a temporary directory. It is called
+// over a Unix socket, through the whole gRPC stack of the server.
+type Server struct {
+	// PublicKeys of the deterministic keyvault.
+	PublicKeys [][]byte
+	// Client calls the server.
+	Client validatorpb.RemoteSignerClient
+	dir    string
+	vault  *deterministic.Store
+	srv    *rpc.Server
+	db     *slashing.DB
+	conn   *grpc.ClientConn
+}
+
+// StartServer starts an in-process remote signer holding the keys of a
+// number of validators.
+func StartServer(ctx context.Context, validators int) (*Server, error) {
+	dir, err := ioutil.TempDir("", "remote-signer-loadtest")
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create temporary directory")
+	}
+	s := &Server{dir: dir}
+	if err := s.start(ctx, validators); err != nil {
+		if stopErr := s.Stop(); stopErr != nil {
+			log.WithError(stopErr).Error("Could not stop in-process server")
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Server) start(ctx context.Context, validators int) error {
+	var err error
+	s.vault, err = deterministic.NewStore(validators)
+	if err != nil {
+		return err
+	}
+	pubKeys, err := s.vault.GetPublicKeys(ctx)
+	if err != nil {
+		return err
+	}
+	for _, pubKey := range pubKeys {
+		s.PublicKeys = append(s.PublicKeys, pubKey.Marshal())
+	}
+	s.db, err = slashing.Open(filepath.Join(s.dir, "slashing.db"))
+	if err != nil {
+		return err
+	}
+	certPath, keyPath, err := writeSelfSignedCertificate(s.dir)
+	if err != nil {
+		return err
+	}
+	socket := filepath.Join(s.dir, "signer.sock")
+	s.srv = rpc.NewServer(ctx, &rpc.Config{
+		Host:               "127.0.0.1",
+		Port:               "0",
+		CertFlag:           certPath,
+		KeyFlag:            keyPath,
+		UnixSocket:         socket,
+		KeyVault:           s.vault,
+		SlashingProtection: s.db,
+	})
+	if err := s.srv.Start(); err != nil {
+		return err
+	}
+	s.conn, err = grpc.DialContext(
+		ctx,
+		"unix://"+socket,
+		grpc.WithTransportCredentials(client.LocalCredentials()),
+	)
+	if err != nil {
+		return errors.Wrap(err, "could not connect to in-process server")
+	}
+	s.Client = validatorpb.NewRemoteSignerClient(s.conn)
+	return nil
+}
+
+// Stop the server and remove its temporary directory.
+func (s *Server) Stop() error {
+	if s.conn != nil {
+		if err := s.conn.Close(); err != nil {
+			log.WithError(err).Error("Could not close connection to in-process server")
+		}
+	}
+	// The server closes the keyvault once it is stopped.
+	if s.srv != nil {
+		if err := s.srv.Stop(); err != nil {
+			return err
+		}
+	} else if s.vault != nil {
+		if err := s.vault.Close(); err != nil {
+			return err
+		}
+	}
+	if s.db != nil {
+		if err := s.db.Close(); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(s.dir)
+}
+
+// writeSelfSignedCertificate writes the certificate and key the server
+// requires, although it is only called over its Unix socket.
+func writeSelfSignedCertificate(dir string) (string, string, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", errors.Wrap(err, "could not generate TLS key")
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return "", "", errors.Wrap(err, "could not create TLS certificate")
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return "", "", errors.Wrap(err, "could not encode TLS key")
+	}
+	certPath, keyPath := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	if err := ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		return "", "", errors.Wrap(err, "could not write TLS certificate")
+	}
+	if err := ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return "", "", errors.Wrap(err, "could not write TLS key")
+	}
+	return certPath, keyPath, nil
+}
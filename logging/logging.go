@@ -0,0 +1,113 @@
+/*
+Package logging configures the log output of the remote signer, as text or
+as JSON for log aggregators, at a given level, to stderr or to a file which
+is rotated once it grows past a size. It also carries the correlation IDs
+of requests, propagated in the x-request-id gRPC metadata so that the logs
+of a request are tied together across the coordinator and its signers.
+*/
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Log formats.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Defaults of the rotation of log files.
+const (
+	DefaultMaxSizeMB  = 100
+	DefaultMaxBackups = 5
+)
+
+// RequestIDKey is the gRPC metadata key carrying the correlation ID of a request.
+const RequestIDKey = "x-request-id"
+
+// Config of the log output.
+type Config struct {
+	// Format is text, the default, or json.
+	Format string
+	// Level is a logrus level such as debug, info or warn, info by default.
+	Level string
+	// File, if set, is written to instead of stderr, and rotated once it
+	// grows past MaxSizeMB megabytes, keeping MaxBackups rotated files.
+	File       string
+	MaxSizeMB  int
+	MaxBackups int
+}
+
+// Configure sets up the standard logrus logger. The returned closer closes
+// the log file, if any.
+func Configure(cfg *Config) (io.Closer, error) {
+	level := logrus.InfoLevel
+	if cfg.Level != "" {
+		l, err := logrus.ParseLevel(cfg.Level)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid log level %s", cfg.Level)
+		}
+		level = l
+	}
+	var formatter logrus.Formatter
+	switch strings.ToLower(cfg.Format) {
+	case "", FormatText:
+		formatter = &logrus.TextFormatter{FullTimestamp: true}
+	case FormatJSON:
+		formatter = &logrus.JSONFormatter{}
+	default:
+		return nil, errors.Errorf("unknown log format %s, expected %s or %s", cfg.Format, FormatText, FormatJSON)
+	}
+	var out io.WriteCloser = nopCloser{os.Stderr}
+	if cfg.File != "" {
+		f, err := OpenRotatingFile(cfg.File, cfg.MaxSizeMB, cfg.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		out = f
+	}
+	logrus.SetLevel(level)
+	logrus.SetFormatter(formatter)
+	logrus.SetOutput(out)
+	return out, nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// requestIDKey is the context key of the correlation ID of a request.
+type requestIDKey struct{}
+
+// NewRequestID generates a random correlation ID.
+func NewRequestID() string {
+	raw := make([]byte, 8)
+	if _, err := rand.Read(raw); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(raw)
+}
+
+// WithRequestID returns a context carrying the correlation ID of a request.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the correlation ID of a request, if any.
+func RequestID(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	return id, ok && id != ""
+}
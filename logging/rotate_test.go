@@ -0,0 +1,63 @@
+package logging
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRotatingFile_Rotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	path := filepath.Join(dir, "signer.log")
+	f, err := OpenRotatingFile(path, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.maxSize = 10
+
+	for _, line := range []string{"aaaaaaaa\n", "bbbbbbbb\n", "cccccccc\n", "dddddddd\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		path:        "dddddddd\n",
+		path + ".1": "cccccccc\n",
+		path + ".2": "bbbbbbbb\n",
+	}
+	for p, content := range want {
+		got, err := ioutil.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != content {
+			t.Errorf("Wanted %s to hold %q, received %q", filepath.Base(p), content, got)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("Wanted rotated files beyond the backups removed")
+	}
+}
+
+func TestConfigure_InvalidFlags(t *testing.T) {
+	if _, err := Configure(&Config{Level: "loud"}); err == nil || !strings.Contains(err.Error(), "invalid log level") {
+		t.Errorf("Wanted invalid log level error, received %v", err)
+	}
+	if _, err := Configure(&Config{Format: "xml"}); err == nil || !strings.Contains(err.Error(), "unknown log format") {
+		t.Errorf("Wanted unknown log format error, received %v", err)
+	}
+}
@@ -2,21 +2,57 @@ package main
 
 import (
 	"context"
+	"crypto/ed25519"
 	"flag"
 	"io/ioutil"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/pkg/errors"
+	types "github.com/prysmaticlabs/eth2-types"
+	"github.com/prysmaticlabs/remote-signer/auth"
+	"github.com/prysmaticlabs/remote-signer/clock"
+	"github.com/prysmaticlabs/remote-signer/cluster"
+	"github.com/prysmaticlabs/remote-signer/doppelganger"
+	"github.com/prysmaticlabs/remote-signer/exits"
+	"github.com/prysmaticlabs/remote-signer/ha"
 	"github.com/prysmaticlabs/remote-signer/keyvault"
 	"github.com/prysmaticlabs/remote-signer/keyvault/deterministic"
+	"github.com/prysmaticlabs/remote-signer/keyvault/keystate"
 	"github.com/prysmaticlabs/remote-signer/keyvault/mnemonic"
+	"github.com/prysmaticlabs/remote-signer/keyvault/securemem"
+	"github.com/prysmaticlabs/remote-signer/keyvault/shares"
+	"github.com/prysmaticlabs/remote-signer/logging"
+	"github.com/prysmaticlabs/remote-signer/monitoring"
+	"github.com/prysmaticlabs/remote-signer/policy"
 	"github.com/prysmaticlabs/remote-signer/rpc"
+	"github.com/prysmaticlabs/remote-signer/slashing"
+	"github.com/prysmaticlabs/remote-signer/slashing/replication"
+	"github.com/prysmaticlabs/remote-signer/threshold"
+	"github.com/prysmaticlabs/remote-signer/tracing"
 	"github.com/sirupsen/logrus"
 )
 
 var log = logrus.WithField("prefix", "main")
 
+// Files of the data directory.
+const (
+	// keyStateFileName persists disabled keys.
+	keyStateFileName = "key-state.json"
+	// slashingProtectionFileName is the slashing protection database.
+	slashingProtectionFileName = "slashing-protection.db"
+	// raftDirName holds the Raft log and snapshots of a signer cluster member.
+	raftDirName = "raft"
+	// shutdownGracePeriod bounds how long closing the backends may take after
+	// the server drained its requests, before the process exits regardless.
+	shutdownGracePeriod = 10 * time.Second
+)
+
 var (
 	grpcServerHostFlag = flag.String(
 		"grpc-server-host",
@@ -28,6 +64,36 @@ var (
 		"4000",
 		"port for the grpc server",
 	)
+	grpcListenAddressesFlag = flag.String(
+		"grpc-listen-addresses",
+		"",
+		"Comma separated host:port addresses the grpc server listens on, besides the host and port above",
+	)
+	unixSocketFlag = flag.String(
+		"unix-socket",
+		"",
+		"Path of a Unix domain socket the grpc server listens on without TLS, for validator clients on the same host",
+	)
+	unixSocketModeFlag = flag.Uint(
+		"unix-socket-mode",
+		uint(rpc.DefaultUnixSocketMode),
+		"File permissions of the Unix domain socket, restricting which local users may connect",
+	)
+	unixSocketGroupFlag = flag.String(
+		"unix-socket-group",
+		"",
+		"Group owning the Unix domain socket, whose members may connect with the default permissions",
+	)
+	unixSocketUIDsFlag = flag.String(
+		"unix-socket-allowed-uids",
+		"",
+		"Comma separated user IDs of the only processes allowed to call the server over the Unix domain socket",
+	)
+	unixSocketGIDsFlag = flag.String(
+		"unix-socket-allowed-gids",
+		"",
+		"Comma separated primary group IDs of the only processes allowed to call the server over the Unix domain socket",
+	)
 	tlsCertPathFlag = flag.String(
 		"tls-crt-path",
 		"",
@@ -38,11 +104,32 @@ var (
 		"",
 		"/path/to/server.key for secure TLS connections",
 	)
+	authTokenFileFlag = flag.String(
+		"auth-token-file",
+		"",
+		"JSON file of the hashed bearer tokens, with their scopes, required to call the remote signer and admin APIs",
+	)
+	authMetricsFlag = flag.Bool(
+		"auth-metrics",
+		false,
+		"Require a bearer token of --auth-token-file with the metrics scope to scrape metrics",
+	)
+	tlsClientCAPathFlag = flag.String(
+		"tls-client-ca-path",
+		"",
+		"/path/to/ca.crt of client certificates, requiring clients to authenticate with mutual TLS",
+	)
+	enableAdminFlag = flag.Bool(
+		"enable-admin-api",
+		false,
+		"Serve the admin API, to disable keys, approve exits and manage the cluster, "+
+			"which requires --tls-client-ca-path or --auth-token-file to authenticate its callers",
+	)
 	keyVaultFlag = flag.String(
 		"keyvault",
 		"deterministic",
 		"Type of keyvault. Examples: "+
-			"deterministic (default) | mnemonic | s3 (unimplemented) | hashicorp (unimplemented)",
+			"deterministic (default) | mnemonic | threshold-share | s3 (unimplemented) | hashicorp (unimplemented)",
 	)
 	numDeterministicKeysFlag = flag.Int(
 		"num-deterministic-keys",
@@ -69,90 +156,935 @@ var (
 		"",
 		"Password of the mnemonic phrase",
 	)
+	keyMetadataFileFlag = flag.String(
+		"key-metadata-file",
+		"",
+		"Path to a JSON file mapping public keys to metadata such as label, validator index and fee recipient",
+	)
+	monitoringHostFlag = flag.String(
+		"monitoring-host",
+		"127.0.0.1",
+		"host address for the prometheus metrics server",
+	)
+	monitoringPortFlag = flag.String(
+		"monitoring-port",
+		"8081",
+		"port for the prometheus metrics server, metrics are disabled if empty",
+	)
+	dataDirFlag = flag.String(
+		"datadir",
+		"remote-signer-data",
+		"Directory where the remote signer persists its state, such as disabled keys",
+	)
+	hideDisabledKeysFlag = flag.Bool(
+		"hide-disabled-keys",
+		false,
+		"Omit disabled keys from the validating public keys listed to validator clients",
+	)
+	thresholdSharesDirFlag = flag.String(
+		"threshold-shares-dir",
+		"",
+		"Directory of secret key share files for a threshold-share keyvault, as written by split-key",
+	)
+	thresholdCoordinatorFlag = flag.Bool(
+		"threshold-coordinator",
+		false,
+		"Run as a threshold signing coordinator, combining partial signatures from peer signers instead of holding keys",
+	)
+	thresholdPeersFileFlag = flag.String(
+		"threshold-peers-file",
+		"",
+		"Path to the JSON list of peer signers of a threshold coordinator",
+	)
+	thresholdKeySetsDirFlag = flag.String(
+		"threshold-keysets-dir",
+		"",
+		"Directory of key set files of a threshold coordinator, as written by split-key",
+	)
+	enableDoppelgangerFlag = flag.Bool(
+		"enable-doppelganger-protection",
+		false,
+		"Deny block and attestation signing at startup until keys are found not to be live elsewhere",
+	)
+	doppelgangerEpochsFlag = flag.Uint64(
+		"doppelganger-epochs",
+		2,
+		"Number of epochs keys stay on probation under doppelganger protection",
+	)
+	beaconNodeURLFlag = flag.String(
+		"beacon-node-url",
+		"",
+		"URL of the beacon node API used to check validator liveness, e.g. http://localhost:3500",
+	)
+	genesisTimeFlag = flag.Int64(
+		"genesis-time",
+		0,
+		"Genesis time of the chain as a unix timestamp",
+	)
+	secondsPerSlotFlag = flag.Uint64(
+		"seconds-per-slot",
+		clock.DefaultSecondsPerSlot,
+		"Duration of a slot of the chain in seconds",
+	)
+	slotsPerEpochFlag = flag.Uint64(
+		"slots-per-epoch",
+		clock.DefaultSlotsPerEpoch,
+		"Number of slots in an epoch of the chain",
+	)
+	haLockFileFlag = flag.String(
+		"ha-lock-file",
+		"",
+		"Path to a lock file on a filesystem shared by a high availability cluster, only the instance holding it signs",
+	)
+	haEtcdEndpointFlag = flag.String(
+		"ha-etcd-endpoint",
+		"",
+		"URL of an etcd cluster holding the lease of the high availability cluster leader, e.g. http://localhost:2379",
+	)
+	haEtcdKeyFlag = flag.String(
+		"ha-etcd-key",
+		ha.DefaultEtcdKey,
+		"etcd key holding the lease of the high availability cluster leader",
+	)
+	haLeaseTTLFlag = flag.Duration(
+		"ha-lease-ttl",
+		ha.DefaultEtcdLeaseTTL,
+		"Time to live of the etcd lease of the high availability cluster leader",
+	)
+	replicationPeersFileFlag = flag.String(
+		"slashing-replication-peers-file",
+		"",
+		"Path to the JSON list of peer signers the slashing protection history is replicated to",
+	)
+	replicationTokenFileFlag = flag.String(
+		"slashing-replication-token-file",
+		"",
+		"Path to a file holding the secret token shared by the signers replicating slashing protection history",
+	)
+	replicationQuorumFlag = flag.Int(
+		"slashing-replication-quorum",
+		0,
+		"Number of peers which must store a signing record before signing, defaults to a majority of the cluster",
+	)
+	replicationTimeoutFlag = flag.Duration(
+		"slashing-replication-timeout",
+		replication.DefaultTimeout,
+		"Maximum duration to wait for a quorum of peers to store a signing record",
+	)
+	raftIDFlag = flag.String(
+		"raft-id",
+		"",
+		"ID of this signer in its Raft cluster, enabling the cluster",
+	)
+	raftAddressFlag = flag.String(
+		"raft-address",
+		"",
+		"gRPC address at which the other Raft cluster members reach this signer, defaults to its address in the members file",
+	)
+	raftMembersFileFlag = flag.String(
+		"raft-members-file",
+		"",
+		"Path to the JSON object mapping the IDs of the initial Raft cluster members to their gRPC addresses, "+
+			"only used to bootstrap a new cluster",
+	)
+	raftTokenFileFlag = flag.String(
+		"raft-token-file",
+		"",
+		"Path to a file holding the secret token shared by the members of the Raft cluster",
+	)
+	raftTLSCAPathFlag = flag.String(
+		"raft-tls-ca-path",
+		"",
+		"Path to the CA certificate of the TLS certificates of the Raft cluster members",
+	)
+	raftTLSServerNameFlag = flag.String(
+		"raft-tls-server-name",
+		"",
+		"Server name expected in the TLS certificates of the Raft cluster members, defaults to their host",
+	)
+	raftTimeoutFlag = flag.Duration(
+		"raft-timeout",
+		cluster.DefaultTimeout,
+		"Maximum duration to wait for a signing decision to be committed by the Raft cluster",
+	)
+	exitApprovalsFlag = flag.Int(
+		"exit-approvals",
+		0,
+		"Number of distinct operators who must approve a voluntary exit before it is signed, 0 disables exit approval",
+	)
+	exitOperatorsFileFlag = flag.String(
+		"exit-operators-file",
+		"",
+		"Path to a JSON file mapping the only operators authorized to approve exits to their hex encoded ed25519 "+
+			"public keys, requiring signed approvals instead of any distinct caller of the admin API",
+	)
+	exitApprovalExpiryFlag = flag.Duration(
+		"exit-approval-expiry",
+		exits.DefaultExpiry,
+		"Duration a voluntary exit waits for approval, and stays approved",
+	)
+	exitMaxPendingFlag = flag.Int(
+		"exit-max-pending",
+		exits.DefaultMaxPending,
+		"Maximum number of voluntary exits awaiting approval at once",
+	)
+	exitMaxPendingPerKeyFlag = flag.Int(
+		"exit-max-pending-per-key",
+		exits.DefaultMaxPendingPerKey,
+		"Maximum number of voluntary exits of each key awaiting approval at once",
+	)
+	signingPolicyFileFlag = flag.String(
+		"signing-policy-file",
+		"",
+		"Path to a JSON file of signing policy rules, rules on epochs require the --genesis-time flag",
+	)
+	enableClockChecksFlag = flag.Bool(
+		"enable-clock-checks",
+		false,
+		"Deny block, attestation and sync committee sign requests for slots too far ahead of the wall clock, requires the --genesis-time flag",
+	)
+	maxFutureSlotsFlag = flag.Uint64(
+		"max-future-slots",
+		clock.DefaultMaxFutureSlots,
+		"Number of slots sign requests may be ahead of the wall clock with --enable-clock-checks",
+	)
+	maintenanceFlag = flag.Bool(
+		"maintenance",
+		false,
+		"Start in maintenance mode, refusing sign requests until it is disabled through the admin API or SIGUSR2",
+	)
+	clientRateLimitFlag = flag.Float64(
+		"rate-limit-client",
+		0,
+		"Requests per second each client may make to the remote signer and admin APIs, unlimited if 0",
+	)
+	clientRateBurstFlag = flag.Int(
+		"rate-limit-client-burst",
+		100,
+		"Requests each client may make at once beyond --rate-limit-client",
+	)
+	keyRateLimitFlag = flag.Float64(
+		"rate-limit-key",
+		0,
+		"Sign requests per second for each public key, unlimited if 0",
+	)
+	keyRateBurstFlag = flag.Int(
+		"rate-limit-key-burst",
+		10,
+		"Sign requests for each public key at once beyond --rate-limit-key",
+	)
+	maxConcurrentSignsFlag = flag.Int(
+		"max-concurrent-signs",
+		0,
+		"Maximum number of sign requests served at once, unlimited if 0",
+	)
+	logFormatFlag = flag.String(
+		"log-format",
+		logging.FormatText,
+		"Format of the logs: text | json",
+	)
+	logLevelFlag = flag.String(
+		"log-level",
+		"info",
+		"Level of the logs: trace | debug | info | warn | error",
+	)
+	logFileFlag = flag.String(
+		"log-file",
+		"",
+		"Path to write the logs to instead of stderr, rotated once it grows past --log-file-max-size",
+	)
+	logFileMaxSizeFlag = flag.Int(
+		"log-file-max-size",
+		logging.DefaultMaxSizeMB,
+		"Size in megabytes past which the log file is rotated",
+	)
+	logFileMaxBackupsFlag = flag.Int(
+		"log-file-max-backups",
+		logging.DefaultMaxBackups,
+		"Number of rotated log files to keep",
+	)
+	tracingEndpointFlag = flag.String(
+		"tracing-endpoint",
+		"",
+		"Base URL of the OTLP/HTTP receiver of an OpenTelemetry collector to export traces to, such as http://localhost:4318, tracing is disabled if empty",
+	)
+	tracingSampleRatioFlag = flag.Float64(
+		"tracing-sample-ratio",
+		1,
+		"Share of the traces started by the remote signer which are exported, from 0 to 1, traces started by validator clients following their sampling decision",
+	)
+	tracingServiceNameFlag = flag.String(
+		"tracing-service-name",
+		tracing.DefaultServiceName,
+		"Service name of the remote signer in the traces",
+	)
+	shutdownTimeoutFlag = flag.Duration(
+		"shutdown-timeout",
+		rpc.DefaultShutdownTimeout,
+		"Maximum duration to wait for in-flight requests on shutdown before forcibly closing connections",
+	)
 )
 
 func main() {
+	// Subcommands talk to a running server, so we dispatch
+	// them before parsing any of the server flags.
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			if err := cmd(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
 	flag.Parse()
+	logFile, err := logging.Configure(&logging.Config{
+		Format:     *logFormatFlag,
+		Level:      *logLevelFlag,
+		File:       *logFileFlag,
+		MaxSizeMB:  *logFileMaxSizeFlag,
+		MaxBackups: *logFileMaxBackupsFlag,
+	})
+	if err != nil {
+		log.Fatalf("Could not configure logging: %v", err)
+	}
+	defer func() {
+		if err := logFile.Close(); err != nil {
+			log.WithError(err).Error("Could not close log file")
+		}
+	}()
 	ctx := context.Background()
 	grpcServerHost := *grpcServerHostFlag
 	grpcServerPort := *grpcServerPortFlag
 	tlsCertPath := *tlsCertPathFlag
 	tlsKeyPath := *tlsKeyPathFlag
+	tlsClientCAPath := *tlsClientCAPathFlag
+	authTokenFile := *authTokenFileFlag
+	enableAdmin := *enableAdminFlag
+	authMetrics := *authMetricsFlag
+	var grpcListenAddresses []string
+	if *grpcListenAddressesFlag != "" {
+		grpcListenAddresses = strings.Split(*grpcListenAddressesFlag, ",")
+	}
+	unixSocket := *unixSocketFlag
+	unixSocketMode := os.FileMode(*unixSocketModeFlag)
+	unixSocketGroup := *unixSocketGroupFlag
 	keyVaultKind := *keyVaultFlag
 	numDeterministicKeys := *numDeterministicKeysFlag
 	numMnemonicKeys := *numMnemonicKeysFlag
 	startIndexForMnemonic := *startIndexForMnemonicFlag
 	mnemonicFile := *mnemonicFileFlag
 	mnemonicPassword := *mnemonicPasswordFlag
+	keyMetadataFile := *keyMetadataFileFlag
+	monitoringHost := *monitoringHostFlag
+	monitoringPort := *monitoringPortFlag
+	dataDir := *dataDirFlag
+	hideDisabledKeys := *hideDisabledKeysFlag
+	thresholdSharesDir := *thresholdSharesDirFlag
+	thresholdCoordinator := *thresholdCoordinatorFlag
+	thresholdPeersFile := *thresholdPeersFileFlag
+	thresholdKeySetsDir := *thresholdKeySetsDirFlag
+	enableDoppelganger := *enableDoppelgangerFlag
+	doppelgangerEpochs := *doppelgangerEpochsFlag
+	beaconNodeURL := *beaconNodeURLFlag
+	genesisTime := *genesisTimeFlag
+	secondsPerSlot := *secondsPerSlotFlag
+	slotsPerEpoch := *slotsPerEpochFlag
+	haLockFile := *haLockFileFlag
+	haEtcdEndpoint := *haEtcdEndpointFlag
+	haEtcdKey := *haEtcdKeyFlag
+	haLeaseTTL := *haLeaseTTLFlag
+	replicationPeersFile := *replicationPeersFileFlag
+	replicationTokenFile := *replicationTokenFileFlag
+	replicationQuorum := *replicationQuorumFlag
+	replicationTimeout := *replicationTimeoutFlag
+	raftID := *raftIDFlag
+	raftAddress := *raftAddressFlag
+	raftMembersFile := *raftMembersFileFlag
+	raftTokenFile := *raftTokenFileFlag
+	raftTLSCAPath := *raftTLSCAPathFlag
+	raftTLSServerName := *raftTLSServerNameFlag
+	raftTimeout := *raftTimeoutFlag
+	exitApprovals := *exitApprovalsFlag
+	exitOperatorsFile := *exitOperatorsFileFlag
+	exitApprovalExpiry := *exitApprovalExpiryFlag
+	exitMaxPending := *exitMaxPendingFlag
+	exitMaxPendingPerKey := *exitMaxPendingPerKeyFlag
+	signingPolicyFile := *signingPolicyFileFlag
+	enableClockChecks := *enableClockChecksFlag
+	maxFutureSlots := *maxFutureSlotsFlag
+	startInMaintenance := *maintenanceFlag
+	shutdownTimeout := *shutdownTimeoutFlag
+	limits := &rpc.Limits{
+		ClientRate:         *clientRateLimitFlag,
+		ClientBurst:        *clientRateBurstFlag,
+		KeyRate:            *keyRateLimitFlag,
+		KeyBurst:           *keyRateBurstFlag,
+		MaxConcurrentSigns: *maxConcurrentSignsFlag,
+	}
 
 	if tlsCertPath == "" || tlsKeyPath == "" {
 		log.Fatal("Expected --tls-crt-path and --tls-key-path flags for secure connections")
 	}
 
-	// Initialize keyvault kind as specified by user.
+	// Secret keys must never end up on disk, so we disable core dumps
+	// before any key material is loaded into memory.
+	if err := securemem.DisableCoreDumps(); err != nil {
+		log.WithError(err).Warn("Could not disable core dumps")
+	}
+
+	// A threshold coordinator holds no keys, it combines
+	// partial signatures from its peer signers instead.
 	var vault keyvault.Store
-	var err error
+	var coordinator *threshold.Coordinator
+	var closePeers func() error
+	var slashingDB *slashing.DB
+	var replicator *replication.Replicator
+	var closeReplicationPeers func() error
+	var signerCluster *cluster.Cluster
+	var raftTransport *cluster.Transport
+	if thresholdCoordinator {
+		coordinator, closePeers, err = newCoordinator(thresholdPeersFile, thresholdKeySetsDir)
+		if err != nil {
+			log.Fatalf("Could not initialize threshold coordinator: %v", err)
+		}
+	} else {
+		vault, err = newKeyVault(
+			keyVaultKind,
+			numDeterministicKeys,
+			numMnemonicKeys,
+			startIndexForMnemonic,
+			mnemonicFile,
+			mnemonicPassword,
+			thresholdSharesDir,
+		)
+		if err != nil {
+			log.Fatalf("Could not initialize keyvault: %v", err)
+		}
+		if keyMetadataFile != "" {
+			annotations, err := keyvault.LoadAnnotations(keyMetadataFile)
+			if err != nil {
+				log.Fatalf("Could not load key metadata: %v", err)
+			}
+			vault = keyvault.NewAnnotatedStore(vault, annotations)
+		}
+		// The key state store must wrap every other store, so the
+		// admin API can find it to disable and enable keys.
+		vault, err = keystate.NewStore(vault, filepath.Join(dataDir, keyStateFileName))
+		if err != nil {
+			log.Fatalf("Could not load key state: %v", err)
+		}
+		slashingDB, err = slashing.Open(filepath.Join(dataDir, slashingProtectionFileName))
+		if err != nil {
+			log.Fatalf("Could not open slashing protection database: %v", err)
+		}
+	}
+
+	var tokens *auth.Tokens
+	if authTokenFile != "" {
+		tokens, err = auth.Load(authTokenFile)
+		if err != nil {
+			log.Fatalf("Could not load bearer tokens: %v", err)
+		}
+	}
+
+	var metrics *monitoring.Service
+	if monitoringPort != "" {
+		var metricsOpts []monitoring.Option
+		if authMetrics {
+			if tokens == nil {
+				log.Fatal("Expected --auth-token-file flag to require bearer tokens for metrics")
+			}
+			metricsOpts = append(metricsOpts, monitoring.WithTokens(tokens))
+		}
+		metrics = monitoring.NewService(monitoringHost, monitoringPort, metricsOpts...)
+		metrics.Start()
+	}
+
+	var tracerProvider *tracing.Provider
+	if *tracingEndpointFlag != "" {
+		tracerProvider, err = tracing.NewProvider(ctx, &tracing.Config{
+			Endpoint:    *tracingEndpointFlag,
+			ServiceName: *tracingServiceNameFlag,
+			SampleRatio: *tracingSampleRatioFlag,
+		})
+		if err != nil {
+			log.Fatalf("Could not initialize tracing: %v", err)
+		}
+	}
+
+	// The maintenance mode is toggled at runtime through the admin API or signals.
+	maintenance := rpc.NewMaintenance()
+	if startInMaintenance {
+		maintenance.Enable("enabled at startup")
+	}
+	watchMaintenanceSignals(maintenance)
+
+	unixSocketUIDs, err := parseIDs(*unixSocketUIDsFlag)
+	if err != nil {
+		log.Fatalf("Invalid --unix-socket-allowed-uids flag: %v", err)
+	}
+	unixSocketGIDs, err := parseIDs(*unixSocketGIDsFlag)
+	if err != nil {
+		log.Fatalf("Invalid --unix-socket-allowed-gids flag: %v", err)
+	}
+
+	// Initialize new gRPC server.
+	cfg := &rpc.Config{
+		Host:             grpcServerHost,
+		Port:             grpcServerPort,
+		CertFlag:         tlsCertPath,
+		KeyFlag:          tlsKeyPath,
+		ClientCAFlag:     tlsClientCAPath,
+		Addresses:        grpcListenAddresses,
+		UnixSocket:       unixSocket,
+		UnixSocketMode:   unixSocketMode,
+		UnixSocketGroup:  unixSocketGroup,
+		UnixSocketUIDs:   unixSocketUIDs,
+		UnixSocketGIDs:   unixSocketGIDs,
+		Tokens:           tokens,
+		EnableAdmin:      enableAdmin,
+		Limits:           limits,
+		KeyVault:         vault,
+		HideDisabledKeys: hideDisabledKeys,
+		Maintenance:      maintenance,
+		ShutdownTimeout:  shutdownTimeout,
+	}
+	if coordinator != nil {
+		cfg.RemoteSigner = coordinator
+	}
+	if enableDoppelganger {
+		if coordinator != nil {
+			log.Fatal("Doppelganger protection is enforced by the threshold signers, not the coordinator")
+		}
+		guard, err := newDoppelgangerGuard(
+			vault,
+			beaconNodeURL,
+			genesisTime,
+			secondsPerSlot,
+			slotsPerEpoch,
+			doppelgangerEpochs,
+		)
+		if err != nil {
+			log.Fatalf("Could not initialize doppelganger protection: %v", err)
+		}
+		cfg.Doppelganger = guard
+	}
+	if enableClockChecks {
+		if coordinator != nil {
+			log.Fatal("Wall clock checks are enforced by the threshold signers, not the coordinator")
+		}
+		if genesisTime == 0 || secondsPerSlot == 0 || slotsPerEpoch == 0 {
+			log.Fatal("Expected --genesis-time and non-zero --seconds-per-slot and --slots-per-epoch flags for wall clock checks")
+		}
+		cfg.Clock = clock.New(time.Unix(genesisTime, 0), secondsPerSlot, slotsPerEpoch)
+		cfg.MaxFutureSlots = types.Slot(maxFutureSlots)
+	}
+	if signingPolicyFile != "" {
+		if coordinator != nil {
+			log.Fatal("The signing policy is enforced by the threshold signers, not the coordinator")
+		}
+		var chainClock *clock.Clock
+		if genesisTime != 0 {
+			chainClock = clock.New(time.Unix(genesisTime, 0), secondsPerSlot, slotsPerEpoch)
+		}
+		cfg.Policy, err = policy.Load(signingPolicyFile, chainClock)
+		if err != nil {
+			log.Fatalf("Could not load signing policy: %v", err)
+		}
+	}
+	if exitApprovals > 0 {
+		if coordinator != nil {
+			log.Fatal("Voluntary exit approval is enforced by the threshold signers, not the coordinator")
+		}
+		if exitMaxPending < 1 || exitMaxPendingPerKey < 1 {
+			log.Fatal("Expected at least one pending voluntary exit allowed")
+		}
+		var operators map[string]ed25519.PublicKey
+		if exitOperatorsFile != "" {
+			operators, err = exits.LoadOperators(exitOperatorsFile)
+			if err != nil {
+				log.Fatalf("Could not load exit operators: %v", err)
+			}
+		}
+		cfg.ExitApproval, err = exits.NewQueue(&exits.Config{
+			Operators:        operators,
+			Approvals:        exitApprovals,
+			Expiry:           exitApprovalExpiry,
+			MaxPending:       exitMaxPending,
+			MaxPendingPerKey: exitMaxPendingPerKey,
+		})
+		if err != nil {
+			log.Fatalf("Could not initialize voluntary exit approval: %v", err)
+		}
+	}
+	if slashingDB != nil {
+		cfg.SlashingProtection = slashingDB
+	}
+	if replicationPeersFile != "" || replicationTokenFile != "" {
+		if slashingDB == nil {
+			log.Fatal("Slashing protection replication is not supported for a threshold coordinator")
+		}
+		// Peers only reject the records of a previous leader given the
+		// fencing token of the leader lock.
+		if haLockFile == "" && haEtcdEndpoint == "" {
+			log.Fatal("Slashing protection replication requires a leader lock, set --ha-lock-file or --ha-etcd-endpoint")
+		}
+		var token string
+		replicator, closeReplicationPeers, token, err = newReplicator(
+			slashingDB,
+			replicationPeersFile,
+			replicationTokenFile,
+			replicationQuorum,
+			replicationTimeout,
+		)
+		if err != nil {
+			log.Fatalf("Could not initialize slashing protection replication: %v", err)
+		}
+		cfg.SlashingProtection = replicator
+		cfg.Replication = replication.NewDBServer(slashingDB, token)
+	}
+	if raftID != "" {
+		if slashingDB == nil {
+			log.Fatal("A Raft cluster is not supported for a threshold coordinator")
+		}
+		if replicator != nil || haLockFile != "" || haEtcdEndpoint != "" {
+			log.Fatal("A Raft cluster replaces slashing protection replication and high availability flags")
+		}
+		signerCluster, raftTransport, err = newCluster(
+			slashingDB,
+			raftID,
+			raftAddress,
+			filepath.Join(dataDir, raftDirName),
+			raftMembersFile,
+			raftTokenFile,
+			raftTLSCAPath,
+			raftTLSServerName,
+			raftTimeout,
+		)
+		if err != nil {
+			log.Fatalf("Could not initialize Raft cluster: %v", err)
+		}
+		cfg.Cluster = signerCluster
+	}
+	if haLockFile != "" || haEtcdEndpoint != "" {
+		if coordinator != nil {
+			log.Fatal("High availability is not supported for a threshold coordinator")
+		}
+		// A new leader must catch up with the signing history of the
+		// previous leader before signing anything.
+		var syncHistory func(ctx context.Context, token uint64) error
+		if replicator != nil {
+			syncHistory = replicator.Sync
+		} else {
+			log.Warn("High availability without slashing protection replication, signing history is not shared")
+		}
+		elector, err := newElector(haLockFile, haEtcdEndpoint, haEtcdKey, haLeaseTTL, syncHistory)
+		if err != nil {
+			log.Fatalf("Could not initialize high availability: %v", err)
+		}
+		cfg.Elector = elector
+	}
+	if replicator != nil {
+		replicator.Start()
+	}
+	if signerCluster != nil {
+		if err := signerCluster.Start(); err != nil {
+			log.Fatalf("Could not start Raft cluster member: %v", err)
+		}
+	}
+	srv := rpc.NewServer(ctx, cfg)
+	if err := srv.Start(); err != nil {
+		log.Fatalf("Could not start server: %v", err)
+	}
+	watchReloadSignals(srv)
+
+	// Listen for any process interrupts.
+	stop := make(chan struct{})
+	go func() {
+		sigc := make(chan os.Signal, 1)
+		signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+		defer signal.Stop(sigc)
+		<-sigc
+		log.Info("Got interrupt, shutting down...")
+		// Shutdown is bounded, in case closing a backend hangs, and
+		// a second interrupt exits right away.
+		go func() {
+			select {
+			case <-sigc:
+				log.Fatal("Got second interrupt, exiting without completing shutdown")
+			case <-time.After(shutdownTimeout + shutdownGracePeriod):
+				log.Fatal("Shutdown did not complete in time, exiting")
+			}
+		}()
+		// The other backends, and the slashing protection database in
+		// particular, are closed even if the server did not stop cleanly.
+		if err := srv.Stop(); err != nil {
+			log.WithError(err).Error("Could not stop server")
+		}
+		if closePeers != nil {
+			if err := closePeers(); err != nil {
+				log.WithError(err).Error("Could not close peer connections")
+			}
+		}
+		if replicator != nil {
+			replicator.Stop()
+			if err := closeReplicationPeers(); err != nil {
+				log.WithError(err).Error("Could not close replication peer connections")
+			}
+		}
+		if signerCluster != nil {
+			if err := signerCluster.Stop(); err != nil {
+				log.WithError(err).Error("Could not stop Raft cluster member")
+			}
+			if err := raftTransport.Close(); err != nil {
+				log.WithError(err).Error("Could not close Raft cluster connections")
+			}
+		}
+		if slashingDB != nil {
+			if err := slashingDB.Close(); err != nil {
+				log.WithError(err).Error("Could not close slashing protection database")
+			}
+		}
+		if metrics != nil {
+			if err := metrics.Stop(); err != nil {
+				log.WithError(err).Error("Could not stop metrics server")
+			}
+		}
+		if tracerProvider != nil {
+			flushCtx, cancel := context.WithTimeout(ctx, shutdownGracePeriod)
+			if err := tracerProvider.Shutdown(flushCtx); err != nil {
+				log.WithError(err).Error("Could not export remaining spans")
+			}
+			cancel()
+		}
+		stop <- struct{}{}
+	}()
+
+	// Wait for stop channel to be closed.
+	<-stop
+}
+
+// newKeyVault initializes the keyvault kind as specified by user.
+func newKeyVault(
+	keyVaultKind string,
+	numDeterministicKeys int,
+	numMnemonicKeys int,
+	startIndexForMnemonic int,
+	mnemonicFile string,
+	mnemonicPassword string,
+	thresholdSharesDir string,
+) (keyvault.Store, error) {
 	switch keyVaultKind {
 	case "deterministic":
 		log.Warn(
 			"You are using a deterministic keyvault (only for reference purposes) " +
 				"DO NOT USE in production",
 		)
-		vault, err = deterministic.NewStore(numDeterministicKeys)
+		return deterministic.NewStore(numDeterministicKeys)
 	case "mnemonic":
 		log.Warn(
 			"Using a mnemonic to recover keys from",
 		)
 
 		if mnemonicFile == "" {
-			log.Info("You must provide a --mnemonic-file")
-			return
+			return nil, errors.New("you must provide a --mnemonic-file")
 		}
 
 		content, err := ioutil.ReadFile(mnemonicFile)
 		if err != nil {
-			log.Info("File reading error", err)
-			return
+			return nil, errors.Wrap(err, "file reading error")
 		}
 		mnemonicPhrase := string(content)
-		log.Info("Contents of file: ", mnemonicPhrase)
 
-		vault, err = mnemonic.NewStore(
+		return mnemonic.NewStore(
 			mnemonicPhrase,
 			mnemonicPassword,
 			startIndexForMnemonic,
 			numMnemonicKeys)
+	case "threshold-share":
+		if thresholdSharesDir == "" {
+			return nil, errors.New("you must provide a --threshold-shares-dir")
+		}
+		return shares.NewStore(thresholdSharesDir)
 	default:
-		log.Fatalf("Keyvault kind %s not yet supported", keyVaultKind)
+		return nil, errors.Errorf("keyvault kind %s not yet supported", keyVaultKind)
+	}
+}
+
+// newCoordinator initializes a threshold signing coordinator and connects to its peers.
+func newCoordinator(peersFile, keySetsDir string) (*threshold.Coordinator, func() error, error) {
+	if peersFile == "" || keySetsDir == "" {
+		return nil, nil, errors.New("expected --threshold-peers-file and --threshold-keysets-dir flags")
+	}
+	peers, err := threshold.LoadPeers(peersFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	keySets, err := threshold.LoadKeySets(keySetsDir)
+	if err != nil {
+		return nil, nil, err
 	}
+	clients, closePeers, err := threshold.DialPeers(peers)
 	if err != nil {
-		log.Fatalf("Could not initialize keyvault: %v", err)
+		return nil, nil, err
 	}
+	coordinator, err := threshold.NewCoordinator(clients, keySets)
+	if err != nil {
+		if closeErr := closePeers(); closeErr != nil {
+			log.WithError(closeErr).Error("Could not close peer connections")
+		}
+		return nil, nil, err
+	}
+	return coordinator, closePeers, nil
+}
 
-	// Initialize new gRPC server.
-	srv := rpc.NewServer(ctx, &rpc.Config{
-		Host:     grpcServerHost,
-		Port:     grpcServerPort,
-		CertFlag: tlsCertPath,
-		KeyFlag:  tlsKeyPath,
-		KeyVault: vault,
+// newDoppelgangerGuard initializes doppelganger protection, checking liveness
+// through the beacon node API and disabling keys found live elsewhere.
+func newDoppelgangerGuard(
+	vault keyvault.Store,
+	beaconNodeURL string,
+	genesisTime int64,
+	secondsPerSlot uint64,
+	slotsPerEpoch uint64,
+	epochs uint64,
+) (*doppelganger.Guard, error) {
+	if beaconNodeURL == "" || genesisTime == 0 {
+		return nil, errors.New("expected --beacon-node-url and --genesis-time flags")
+	}
+	if secondsPerSlot == 0 || slotsPerEpoch == 0 {
+		return nil, errors.New("expected non-zero --seconds-per-slot and --slots-per-epoch flags")
+	}
+	cfg := &doppelganger.Config{
+		Checker: doppelganger.NewBeaconNodeChecker(beaconNodeURL),
+		Clock:   clock.New(time.Unix(genesisTime, 0), secondsPerSlot, slotsPerEpoch),
+		Epochs:  types.Epoch(epochs),
+	}
+	if disabler, ok := vault.(keyvault.ToggleStore); ok {
+		cfg.Disabler = disabler
+	}
+	return doppelganger.NewGuard(cfg)
+}
+
+// newElector initializes the leader elector of a high availability
+// cluster, sharing either a lock file or an etcd lease.
+func newElector(
+	lockFile, etcdEndpoint, etcdKey string, leaseTTL time.Duration, syncHistory func(ctx context.Context, token uint64) error,
+) (*ha.Elector, error) {
+	var provider ha.LockProvider
+	switch {
+	case lockFile != "" && etcdEndpoint != "":
+		return nil, errors.New("expected only one of --ha-lock-file and --ha-etcd-endpoint flags")
+	case lockFile != "":
+		provider = ha.NewFileLock(lockFile)
+	default:
+		lease, err := ha.NewEtcdLease(etcdEndpoint, etcdKey, leaseTTL)
+		if err != nil {
+			return nil, err
+		}
+		provider = lease
+	}
+	return ha.NewElector(&ha.Config{
+		Provider: provider,
+		Sync:     syncHistory,
 	})
-	srv.Start()
+}
 
-	// Listen for any process interrupts.
-	stop := make(chan struct{})
-	go func() {
-		sigc := make(chan os.Signal, 1)
-		signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
-		defer signal.Stop(sigc)
-		<-sigc
-		log.Info("Got interrupt, shutting down...")
-		if err := srv.Stop(); err != nil {
-			log.Fatal(err)
+// newReplicator connects to the peer signers the slashing protection history is replicated to.
+func newReplicator(
+	db *slashing.DB, peersFile, tokenFile string, quorum int, timeout time.Duration,
+) (*replication.Replicator, func() error, string, error) {
+	if peersFile == "" || tokenFile == "" {
+		return nil, nil, "", errors.New(
+			"expected --slashing-replication-peers-file and --slashing-replication-token-file flags",
+		)
+	}
+	token, err := replication.LoadToken(tokenFile)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	peers, err := replication.LoadPeers(peersFile)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	clients, closePeers, err := replication.DialPeers(peers, token)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	replicator, err := replication.NewReplicator(&replication.Config{
+		DB:      db,
+		Peers:   clients,
+		Quorum:  quorum,
+		Timeout: timeout,
+	})
+	if err != nil {
+		if closeErr := closePeers(); closeErr != nil {
+			log.WithError(closeErr).Error("Could not close replication peer connections")
 		}
-		stop <- struct{}{}
-	}()
+		return nil, nil, "", err
+	}
+	return replicator, closePeers, token, nil
+}
 
-	// Wait for stop channel to be closed.
-	<-stop
+// newCluster initializes the Raft cluster member of this signer, bootstrapping
+// a new cluster from the members file when the signer has no Raft state yet.
+func newCluster(
+	db *slashing.DB,
+	id, address, dir, membersFile, tokenFile, caPath, serverName string,
+	timeout time.Duration,
+) (*cluster.Cluster, *cluster.Transport, error) {
+	if tokenFile == "" || caPath == "" {
+		return nil, nil, errors.New("expected --raft-token-file and --raft-tls-ca-path flags")
+	}
+	token, err := replication.LoadToken(tokenFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	var members cluster.Members
+	if membersFile != "" {
+		members, err = cluster.LoadMembers(membersFile)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if address == "" {
+		address = members[id]
+	}
+	if address == "" {
+		return nil, nil, errors.New("expected --raft-address flag, or the address of this signer in --raft-members-file")
+	}
+	transport, err := cluster.NewTransport(address, caPath, serverName, token)
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err := cluster.New(&cluster.Config{
+		ID:        id,
+		Dir:       dir,
+		Members:   members,
+		DB:        db,
+		Transport: transport,
+		Timeout:   timeout,
+	})
+	if err != nil {
+		if closeErr := transport.Close(); closeErr != nil {
+			log.WithError(closeErr).Error("Could not close Raft cluster connections")
+		}
+		return nil, nil, err
+	}
+	return c, transport, nil
+}
+
+// parseIDs parses comma separated user or group IDs.
+func parseIDs(list string) ([]uint32, error) {
+	if list == "" {
+		return nil, nil
+	}
+	var ids []uint32
+	for _, field := range strings.Split(list, ",") {
+		id, err := strconv.ParseUint(strings.TrimSpace(field), 10, 32)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid ID %s", field)
+		}
+		ids = append(ids, uint32(id))
+	}
+	return ids, nil
 }
@@ -0,0 +1,12 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package main
+
+import (
+	"github.com/prysmaticlabs/remote-signer/rpc"
+)
+
+// watchMaintenanceSignals is a no-op on platforms without user signals, where
+// the maintenance mode is toggled through the admin API only.
+func watchMaintenanceSignals(*rpc.Maintenance) {}
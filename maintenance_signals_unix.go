@@ -0,0 +1,27 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/prysmaticlabs/remote-signer/rpc"
+)
+
+// watchMaintenanceSignals enters maintenance mode on SIGUSR1, and leaves it on SIGUSR2.
+func watchMaintenanceSignals(m *rpc.Maintenance) {
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for sig := range sigc {
+			if sig == syscall.SIGUSR1 {
+				m.Enable("enabled by SIGUSR1")
+			} else {
+				m.Disable()
+			}
+		}
+	}()
+}
@@ -0,0 +1,78 @@
+/*
+Package monitoring exposes the prometheus metrics of the remote
+signer over HTTP, to be scraped by a monitoring system.
+*/
+package monitoring
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prysmaticlabs/remote-signer/auth"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.WithField("prefix", "monitoring")
+
+// shutdownTimeout bounds how long we wait for in-flight scrapes on stop.
+const shutdownTimeout = 5 * time.Second
+
+// Service serves metrics over HTTP.
+type Service struct {
+	server *http.Server
+}
+
+// Option configures a metrics service.
+type Option func(*options)
+
+type options struct {
+	tokens *auth.Tokens
+}
+
+// WithTokens only serves metrics to callers presenting a bearer
+// token granted the metrics scope.
+func WithTokens(t *auth.Tokens) Option {
+	return func(o *options) {
+		o.tokens = t
+	}
+}
+
+// NewService instantiates a metrics service listening on host:port.
+func NewService(host, port string, opts ...Option) *Service {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	handler := promhttp.Handler()
+	if o.tokens != nil {
+		handler = o.tokens.Handler(auth.ScopeMetrics, handler)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", handler)
+	return &Service{
+		server: &http.Server{
+			Addr:    fmt.Sprintf("%s:%s", host, port),
+			Handler: mux,
+		},
+	}
+}
+
+// Start serving metrics in a background goroutine.
+func (s *Service) Start() {
+	go func() {
+		log.WithField("address", s.server.Addr).Info("Serving metrics")
+		if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.WithError(err).Error("Could not serve metrics")
+		}
+	}()
+}
+
+// Stop the metrics server.
+func (s *Service) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return s.server.Shutdown(ctx)
+}
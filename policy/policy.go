@@ -0,0 +1,318 @@
+/*
+Package policy evaluates declarative signing rules beyond slashing protection,
+such as denying blocks for slots far in the future, randao reveals outside of
+the current epoch, or any voluntary exit. Rules are read from a JSON file:
+
+	{
+	  "dry_run": false,
+	  "rules": [
+	    {"name": "no-future-blocks", "types": ["block"], "max_future_epochs": 2},
+	    {"name": "current-randao", "types": ["randao_reveal"], "max_future_epochs": 1, "max_past_epochs": 1},
+	    {"name": "sync-committee-keys", "types": ["sync_committee_message"], "allowed_public_keys": ["0x..."]},
+	    {"name": "no-exits", "types": ["exit"], "deny": true}
+	  ]
+	}
+
+A rule applies to the requests of its types, or to every request if it has
+none, and denies those breaking any of its conditions. In dry run, globally
+or for a rule, would-be denials are logged and counted but not enforced.
+*/
+package policy
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	types "github.com/prysmaticlabs/eth2-types"
+	validatorpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1/validator-client"
+	"github.com/prysmaticlabs/remote-signer/clock"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.WithField("prefix", "policy")
+
+// ErrDenied is returned for sign requests denied by a rule.
+var ErrDenied = errors.New("denied by signing policy")
+
+var denialsTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "remote_signer_policy_denials_total",
+		Help: "Number of sign requests denied by the signing policy, by rule and whether in dry run.",
+	},
+	[]string{"rule", "dry_run"},
+)
+
+// Types of sign requests rules apply to.
+const (
+	TypeBlock                    = "block"
+	TypeAttestation              = "attestation"
+	TypeAggregateAndProof        = "aggregate_and_proof"
+	TypeExit                     = "exit"
+	TypeSelectionProof           = "selection_proof"
+	TypeRandaoReveal             = "randao_reveal"
+	TypeSyncAggregatorSelection  = "sync_aggregator_selection"
+	TypeSyncContributionAndProof = "sync_contribution_and_proof"
+	TypeSyncCommitteeMessage     = "sync_committee_message"
+)
+
+var knownTypes = map[string]bool{
+	TypeBlock:                    true,
+	TypeAttestation:              true,
+	TypeAggregateAndProof:        true,
+	TypeExit:                     true,
+	TypeSelectionProof:           true,
+	TypeRandaoReveal:             true,
+	TypeSyncAggregatorSelection:  true,
+	TypeSyncContributionAndProof: true,
+	TypeSyncCommitteeMessage:     true,
+}
+
+// Config is the signing policy, as read from its file.
+type Config struct {
+	// DryRun logs would-be denials of every rule without enforcing them.
+	DryRun bool    `json:"dry_run,omitempty"`
+	Rules  []*Rule `json:"rules"`
+}
+
+// Rule denies the sign requests of its types breaking any of its conditions.
+type Rule struct {
+	Name string `json:"name"`
+	// Types of the requests the rule applies to, every request if empty.
+	Types []string `json:"types,omitempty"`
+	// Deny every request the rule applies to.
+	Deny bool `json:"deny,omitempty"`
+	// AllowedPublicKeys, if set, are the only keys allowed to sign.
+	AllowedPublicKeys []string `json:"allowed_public_keys,omitempty"`
+	// DeniedPublicKeys are never allowed to sign.
+	DeniedPublicKeys []string `json:"denied_public_keys,omitempty"`
+	// MaxFutureEpochs denies requests for epochs further after the current epoch.
+	MaxFutureEpochs *uint64 `json:"max_future_epochs,omitempty"`
+	// MaxPastEpochs denies requests for epochs further before the current epoch.
+	MaxPastEpochs *uint64 `json:"max_past_epochs,omitempty"`
+	// DryRun logs would-be denials of the rule without enforcing them.
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// rule is a rule parsed for evaluation.
+type rule struct {
+	*Rule
+	types   map[string]bool
+	allowed map[[48]byte]bool
+	denied  map[[48]byte]bool
+}
+
+// Engine evaluates sign requests against the rules of a policy.
+type Engine struct {
+	dryRun bool
+	rules  []*rule
+	clock  *clock.Clock
+}
+
+// Load reads a signing policy file. The clock is required by rules on epochs.
+func Load(path string, c *clock.Clock) (*Engine, error) {
+	enc, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read signing policy %s", path)
+	}
+	cfg := &Config{}
+	if err := json.Unmarshal(enc, cfg); err != nil {
+		return nil, errors.Wrapf(err, "could not parse signing policy %s", path)
+	}
+	return New(cfg, c)
+}
+
+// New instantiates a policy engine. The clock is required by rules on epochs.
+func New(cfg *Config, c *clock.Clock) (*Engine, error) {
+	e := &Engine{
+		dryRun: cfg.DryRun,
+		clock:  c,
+	}
+	names := make(map[string]bool, len(cfg.Rules))
+	for i, r := range cfg.Rules {
+		if r.Name == "" {
+			return nil, errors.Errorf("rule %d has no name", i)
+		}
+		if names[r.Name] {
+			return nil, errors.Errorf("duplicate rule %s", r.Name)
+		}
+		names[r.Name] = true
+		parsed, err := parseRule(r)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid rule %s", r.Name)
+		}
+		if (r.MaxFutureEpochs != nil || r.MaxPastEpochs != nil) && c == nil {
+			return nil, errors.Errorf("rule %s on epochs requires the genesis time of the chain", r.Name)
+		}
+		e.rules = append(e.rules, parsed)
+	}
+	log.WithFields(logrus.Fields{
+		"numRules": len(e.rules),
+		"dryRun":   e.dryRun,
+	}).Info("Loaded signing policy")
+	return e, nil
+}
+
+func parseRule(r *Rule) (*rule, error) {
+	parsed := &rule{Rule: r, types: make(map[string]bool, len(r.Types))}
+	for _, t := range r.Types {
+		if !knownTypes[t] {
+			return nil, errors.Errorf("unknown request type %s", t)
+		}
+		parsed.types[t] = true
+	}
+	var err error
+	if parsed.allowed, err = parseKeys(r.AllowedPublicKeys); err != nil {
+		return nil, err
+	}
+	if parsed.denied, err = parseKeys(r.DeniedPublicKeys); err != nil {
+		return nil, err
+	}
+	return parsed, nil
+}
+
+func parseKeys(hexKeys []string) (map[[48]byte]bool, error) {
+	if len(hexKeys) == 0 {
+		return nil, nil
+	}
+	keys := make(map[[48]byte]bool, len(hexKeys))
+	for _, hexKey := range hexKeys {
+		raw, err := hex.DecodeString(strings.TrimPrefix(hexKey, "0x"))
+		if err != nil || len(raw) != 48 {
+			return nil, errors.Errorf("invalid public key %s", hexKey)
+		}
+		var key [48]byte
+		copy(key[:], raw)
+		keys[key] = true
+	}
+	return keys, nil
+}
+
+// Evaluate returns an error wrapping ErrDenied if a rule denies the sign
+// request. Every rule is evaluated, so that dry run rules log their would-be
+// denials even when another rule denies the request.
+func (e *Engine) Evaluate(pubKey [48]byte, req *validatorpb.SignRequest) error {
+	reqType, epoch, hasEpoch := describe(req, e.clock)
+	var denial error
+	for _, r := range e.rules {
+		if len(r.types) > 0 && !r.types[reqType] {
+			continue
+		}
+		reason := r.check(pubKey, epoch, hasEpoch, e.clock)
+		if reason == "" {
+			continue
+		}
+		dryRun := e.dryRun || r.DryRun
+		denialsTotal.WithLabelValues(r.Name, fmt.Sprintf("%t", dryRun)).Inc()
+		fields := logrus.Fields{
+			"rule":      r.Name,
+			"type":      reqType,
+			"publicKey": fmt.Sprintf("%#x", pubKey),
+			"reason":    reason,
+		}
+		if dryRun {
+			log.WithFields(fields).Warn("Signing policy would deny request")
+			continue
+		}
+		log.WithFields(fields).Debug("Signing policy denied request")
+		if denial == nil {
+			denial = errors.Wrapf(ErrDenied, "rule %s: %s", r.Name, reason)
+		}
+	}
+	return denial
+}
+
+// check returns why the rule denies a request, or an empty string.
+func (r *rule) check(pubKey [48]byte, epoch types.Epoch, hasEpoch bool, c *clock.Clock) string {
+	if r.Deny {
+		return "requests are denied"
+	}
+	if r.allowed != nil && !r.allowed[pubKey] {
+		return "key is not allowed"
+	}
+	if r.denied[pubKey] {
+		return "key is denied"
+	}
+	if !hasEpoch || (r.MaxFutureEpochs == nil && r.MaxPastEpochs == nil) {
+		return ""
+	}
+	// Distances are compared rather than sums, which would wrap around for
+	// epochs or bounds close to the maximum.
+	current := c.CurrentEpoch()
+	if r.MaxFutureEpochs != nil && epoch > current && uint64(epoch-current) > *r.MaxFutureEpochs {
+		return fmt.Sprintf("epoch %d is more than %d epochs after current epoch %d", epoch, *r.MaxFutureEpochs, current)
+	}
+	if r.MaxPastEpochs != nil && epoch < current && uint64(current-epoch) > *r.MaxPastEpochs {
+		return fmt.Sprintf("epoch %d is more than %d epochs before current epoch %d", epoch, *r.MaxPastEpochs, current)
+	}
+	return ""
+}
+
+// describe returns the type of a sign request, and the epoch of its object
+// when it has one. Epochs are computed from slots with the clock, if any.
+func describe(req *validatorpb.SignRequest, c *clock.Clock) (string, types.Epoch, bool) {
+	epochAt := func(slot types.Slot) (types.Epoch, bool) {
+		if c == nil {
+			return 0, false
+		}
+		return c.EpochAt(slot), true
+	}
+	switch o := req.Object.(type) {
+	case *validatorpb.SignRequest_Block:
+		if o.Block == nil {
+			return TypeBlock, 0, false
+		}
+		epoch, ok := epochAt(o.Block.Slot)
+		return TypeBlock, epoch, ok
+	case *validatorpb.SignRequest_BlockV2:
+		if o.BlockV2 == nil {
+			return TypeBlock, 0, false
+		}
+		epoch, ok := epochAt(o.BlockV2.Slot)
+		return TypeBlock, epoch, ok
+	case *validatorpb.SignRequest_AttestationData:
+		if o.AttestationData == nil || o.AttestationData.Target == nil {
+			return TypeAttestation, 0, false
+		}
+		return TypeAttestation, o.AttestationData.Target.Epoch, true
+	case *validatorpb.SignRequest_AggregateAttestationAndProof:
+		agg := o.AggregateAttestationAndProof
+		if agg == nil || agg.Aggregate == nil || agg.Aggregate.Data == nil {
+			return TypeAggregateAndProof, 0, false
+		}
+		epoch, ok := epochAt(agg.Aggregate.Data.Slot)
+		return TypeAggregateAndProof, epoch, ok
+	case *validatorpb.SignRequest_Exit:
+		if o.Exit == nil {
+			return TypeExit, 0, false
+		}
+		return TypeExit, o.Exit.Epoch, true
+	case *validatorpb.SignRequest_Slot:
+		epoch, ok := epochAt(o.Slot)
+		return TypeSelectionProof, epoch, ok
+	case *validatorpb.SignRequest_Epoch:
+		return TypeRandaoReveal, o.Epoch, true
+	case *validatorpb.SignRequest_SyncAggregatorSelectionData:
+		if o.SyncAggregatorSelectionData == nil {
+			return TypeSyncAggregatorSelection, 0, false
+		}
+		epoch, ok := epochAt(o.SyncAggregatorSelectionData.Slot)
+		return TypeSyncAggregatorSelection, epoch, ok
+	case *validatorpb.SignRequest_ContributionAndProof:
+		cp := o.ContributionAndProof
+		if cp == nil || cp.Contribution == nil {
+			return TypeSyncContributionAndProof, 0, false
+		}
+		epoch, ok := epochAt(cp.Contribution.Slot)
+		return TypeSyncContributionAndProof, epoch, ok
+	case *validatorpb.SignRequest_SyncMessageBlockRoot:
+		return TypeSyncCommitteeMessage, 0, false
+	default:
+		return "", 0, false
+	}
+}
@@ -0,0 +1,169 @@
+package policy
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	types "github.com/prysmaticlabs/eth2-types"
+	ethpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1"
+	validatorpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1/validator-client"
+	"github.com/prysmaticlabs/remote-signer/clock"
+)
+
+// clockAt returns a clock at the start of an epoch.
+func clockAt(epoch uint64) *clock.Clock {
+	genesis := time.Unix(1606824023, 0)
+	now := genesis.Add(time.Duration(epoch*32*12) * time.Second)
+	return clock.NewWithTimeSource(genesis, 12, 32, func() time.Time { return now })
+}
+
+func uint64Ptr(v uint64) *uint64 {
+	return &v
+}
+
+func blockAt(slot types.Slot) *validatorpb.SignRequest {
+	return &validatorpb.SignRequest{
+		Object: &validatorpb.SignRequest_Block{Block: &ethpb.BeaconBlock{Slot: slot}},
+	}
+}
+
+func randaoAt(epoch types.Epoch) *validatorpb.SignRequest {
+	return &validatorpb.SignRequest{
+		Object: &validatorpb.SignRequest_Epoch{Epoch: epoch},
+	}
+}
+
+func TestEngine_Evaluate(t *testing.T) {
+	allowed := [48]byte{1}
+	other := [48]byte{2}
+	e, err := New(&Config{
+		Rules: []*Rule{
+			{Name: "no-future-blocks", Types: []string{TypeBlock}, MaxFutureEpochs: uint64Ptr(2)},
+			{
+				Name:            "current-randao",
+				Types:           []string{TypeRandaoReveal},
+				MaxFutureEpochs: uint64Ptr(1),
+				MaxPastEpochs:   uint64Ptr(1),
+			},
+			{
+				Name:              "sync-committee-keys",
+				Types:             []string{TypeSyncCommitteeMessage},
+				AllowedPublicKeys: []string{fmt.Sprintf("%#x", allowed)},
+			},
+			{Name: "no-exits", Types: []string{TypeExit}, Deny: true},
+			{
+				Name:            "unbounded-selection-proofs",
+				Types:           []string{TypeSelectionProof},
+				MaxFutureEpochs: uint64Ptr(math.MaxUint64),
+				MaxPastEpochs:   uint64Ptr(math.MaxUint64),
+			},
+		},
+	}, clockAt(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	syncMessage := &validatorpb.SignRequest{
+		Object: &validatorpb.SignRequest_SyncMessageBlockRoot{SyncMessageBlockRoot: make([]byte, 32)},
+	}
+	tests := []struct {
+		name    string
+		pubKey  [48]byte
+		req     *validatorpb.SignRequest
+		allowed bool
+	}{
+		{name: "block of current epoch", req: blockAt(10 * 32), allowed: true},
+		{name: "block two epochs ahead", req: blockAt(12*32 + 31), allowed: true},
+		{name: "block three epochs ahead", req: blockAt(13 * 32)},
+		{name: "randao of previous epoch", req: randaoAt(9), allowed: true},
+		{name: "randao of next epoch", req: randaoAt(11), allowed: true},
+		{name: "randao two epochs ago", req: randaoAt(8)},
+		{name: "randao two epochs ahead", req: randaoAt(12)},
+		// Bounds close to the maximum must not wrap around to deny every epoch.
+		{
+			name:    "selection proof with unbounded epochs",
+			req:     &validatorpb.SignRequest{Object: &validatorpb.SignRequest_Slot{Slot: 10 * 32}},
+			allowed: true,
+		},
+		{name: "randao of the max epoch", req: randaoAt(math.MaxUint64)},
+		{name: "sync message of allowed key", pubKey: allowed, req: syncMessage, allowed: true},
+		{name: "sync message of other key", pubKey: other, req: syncMessage},
+		{
+			name: "exit",
+			req: &validatorpb.SignRequest{
+				Object: &validatorpb.SignRequest_Exit{Exit: &ethpb.VoluntaryExit{Epoch: 10}},
+			},
+		},
+		{
+			name: "attestation without rule",
+			req: &validatorpb.SignRequest{
+				Object: &validatorpb.SignRequest_AttestationData{AttestationData: &ethpb.AttestationData{
+					Target: &ethpb.Checkpoint{Epoch: 100},
+				}},
+			},
+			allowed: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := e.Evaluate(tt.pubKey, tt.req)
+			if tt.allowed && err != nil {
+				t.Errorf("Wanted request allowed, received %v", err)
+			}
+			if !tt.allowed && !errors.Is(err, ErrDenied) {
+				t.Errorf("Wanted %v, received %v", ErrDenied, err)
+			}
+		})
+	}
+}
+
+func TestEngine_DryRun(t *testing.T) {
+	exit := &validatorpb.SignRequest{
+		Object: &validatorpb.SignRequest_Exit{Exit: &ethpb.VoluntaryExit{Epoch: 10}},
+	}
+	e, err := New(&Config{
+		DryRun: true,
+		Rules:  []*Rule{{Name: "no-exits", Types: []string{TypeExit}, Deny: true}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Evaluate([48]byte{}, exit); err != nil {
+		t.Errorf("Wanted no denial in dry run, received %v", err)
+	}
+	e, err = New(&Config{
+		Rules: []*Rule{
+			{Name: "audit-exits", Types: []string{TypeExit}, Deny: true, DryRun: true},
+			{Name: "no-exits", Types: []string{TypeExit}, Deny: true},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Evaluate([48]byte{}, exit); !errors.Is(err, ErrDenied) {
+		t.Errorf("Wanted %v, received %v", ErrDenied, err)
+	}
+}
+
+func TestNew_InvalidRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []*Rule
+		clock *clock.Clock
+	}{
+		{name: "no name", rules: []*Rule{{Deny: true}}},
+		{name: "duplicate", rules: []*Rule{{Name: "a"}, {Name: "a"}}},
+		{name: "unknown type", rules: []*Rule{{Name: "a", Types: []string{"blocks"}}}},
+		{name: "invalid key", rules: []*Rule{{Name: "a", DeniedPublicKeys: []string{"0x01"}}}},
+		{name: "epochs without clock", rules: []*Rule{{Name: "a", MaxFutureEpochs: uint64Ptr(1)}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(&Config{Rules: tt.rules}, tt.clock); err == nil {
+				t.Error("Wanted error, received nil")
+			}
+		})
+	}
+}
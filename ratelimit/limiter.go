@@ -0,0 +1,103 @@
+/*
+Package ratelimit implements token bucket rate limits keyed by caller, such
+as per client identity or per public key. Each key has its own bucket,
+holding up to a burst of tokens and refilled at a steady rate. Buckets which
+were refilled in full are forgotten, so that memory only grows with the keys
+active within the time it takes to refill a bucket.
+*/
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// pruneInterval is how often full buckets are forgotten.
+const pruneInterval = time.Minute
+
+// Limiter holds a token bucket per key.
+type Limiter struct {
+	rate      float64
+	burst     float64
+	lock      sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// New instantiates a limiter allowing rate requests per second per key,
+// with bursts of up to burst requests, at least one.
+func New(rate float64, burst int) *Limiter {
+	return NewWithTimeSource(rate, burst, time.Now)
+}
+
+// NewWithTimeSource instantiates a limiter reading the time from now, which is useful in tests.
+func NewWithTimeSource(rate float64, burst int, now func() time.Time) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		rate:      rate,
+		burst:     float64(burst),
+		buckets:   make(map[string]*bucket),
+		lastPrune: now(),
+		now:       now,
+	}
+}
+
+// Allow takes a token from the bucket of a key. If the bucket is empty, it
+// returns false and how long until a token is available.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := l.now()
+	if now.Sub(l.lastPrune) >= pruneInterval {
+		l.prune(now)
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	l.refill(b, now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if l.rate <= 0 {
+		return false, time.Duration(math.MaxInt64)
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// Len returns the number of keys currently tracked.
+func (l *Limiter) Len() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return len(l.buckets)
+}
+
+func (l *Limiter) refill(b *bucket, now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(l.burst, b.tokens+elapsed.Seconds()*l.rate)
+		b.last = now
+	}
+}
+
+// prune forgets the buckets which are full again, as if never used.
+func (l *Limiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		l.refill(b, now)
+		if b.tokens >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastPrune = now
+}
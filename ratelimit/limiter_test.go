@@ -0,0 +1,50 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	now := time.Unix(1606824023, 0)
+	l := NewWithTimeSource(2, 3, func() time.Time { return now })
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("Wanted request %d of the burst allowed", i)
+		}
+	}
+	ok, wait := l.Allow("a")
+	if ok {
+		t.Fatal("Wanted request beyond the burst denied")
+	}
+	if wait != 500*time.Millisecond {
+		t.Errorf("Wanted retry after 500ms, received %v", wait)
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Error("Wanted other key allowed")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Error("Wanted request allowed once a token was refilled")
+	}
+	if ok, _ := l.Allow("a"); ok {
+		t.Error("Wanted request denied once the refilled token was taken")
+	}
+}
+
+func TestLimiter_Prune(t *testing.T) {
+	now := time.Unix(1606824023, 0)
+	l := NewWithTimeSource(1, 1, func() time.Time { return now })
+	l.Allow("a")
+	l.Allow("b")
+	if l.Len() != 2 {
+		t.Fatalf("Wanted 2 keys tracked, received %d", l.Len())
+	}
+	now = now.Add(pruneInterval)
+	l.Allow("c")
+	if l.Len() != 1 {
+		t.Errorf("Wanted full buckets forgotten, received %d keys", l.Len())
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package main
+
+import (
+	"github.com/prysmaticlabs/remote-signer/rpc"
+)
+
+// watchReloadSignals is a no-op on platforms without SIGHUP, where TLS
+// certificates and bearer tokens are only reloaded when their files change.
+func watchReloadSignals(*rpc.Server) {}
@@ -0,0 +1,29 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/prysmaticlabs/remote-signer/rpc"
+)
+
+// watchReloadSignals reloads the TLS certificates and bearer tokens of the server on SIGHUP.
+func watchReloadSignals(srv *rpc.Server) {
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGHUP)
+	go func() {
+		for range sigc {
+			log.Info("Got SIGHUP, reloading TLS certificates and bearer tokens")
+			if err := srv.ReloadCertificates(); err != nil {
+				log.WithError(err).Error("Could not reload TLS certificates, serving the previous ones")
+			}
+			if err := srv.ReloadTokens(); err != nil {
+				log.WithError(err).Error("Could not reload bearer tokens, keeping the previous ones")
+			}
+		}
+	}()
+}
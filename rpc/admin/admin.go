@@ -0,0 +1,486 @@
+/*
+Package admin defines the administrative gRPC API of the remote signer,
+used by operators to inspect and manage a running server. It is served
+on the same gRPC server and TLS listener as the remote signer service.
+*/
+package admin
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prysmaticlabs/remote-signer/exits"
+	"github.com/prysmaticlabs/remote-signer/keyvault"
+	"google.golang.org/grpc"
+)
+
+// ServiceName is the fully qualified gRPC service name of the admin API.
+const ServiceName = "remotesigner.admin.v1.Admin"
+
+// Key describes a validating key held by the remote signer.
+type Key struct {
+	PublicKey      string    `json:"public_key"`
+	ValidatorIndex *uint64   `json:"validator_index,omitempty"`
+	Label          string    `json:"label,omitempty"`
+	DerivationPath string    `json:"derivation_path,omitempty"`
+	Source         string    `json:"source"`
+	CreatedAt      time.Time `json:"created_at"`
+	Enabled        bool      `json:"enabled"`
+	DisabledReason string    `json:"disabled_reason,omitempty"`
+	FeeRecipient   string    `json:"fee_recipient,omitempty"`
+}
+
+// ListKeysRequest is the request of the ListKeys method.
+type ListKeysRequest struct{}
+
+// ListKeysResponse is the response of the ListKeys method.
+type ListKeysResponse struct {
+	Keys []*Key `json:"keys"`
+}
+
+// DisableKeyRequest is the request of the DisableKey method.
+type DisableKeyRequest struct {
+	PublicKey string `json:"public_key"`
+	Reason    string `json:"reason"`
+}
+
+// DisableKeyResponse is the response of the DisableKey method.
+type DisableKeyResponse struct{}
+
+// EnableKeyRequest is the request of the EnableKey method.
+type EnableKeyRequest struct {
+	PublicKey string `json:"public_key"`
+}
+
+// EnableKeyResponse is the response of the EnableKey method.
+type EnableKeyResponse struct{}
+
+// Member is a signer of the Raft cluster.
+type Member struct {
+	ID      string `json:"id"`
+	Address string `json:"address"`
+	Leader  bool   `json:"leader,omitempty"`
+}
+
+// ListMembersRequest is the request of the ListMembers method.
+type ListMembersRequest struct{}
+
+// ListMembersResponse is the response of the ListMembers method, as seen by the signer.
+type ListMembersResponse struct {
+	Members     []*Member `json:"members"`
+	State       string    `json:"state"`
+	Term        uint64    `json:"term"`
+	CommitIndex uint64    `json:"commit_index"`
+}
+
+// AddMemberRequest is the request of the AddMember method.
+type AddMemberRequest struct {
+	ID      string `json:"id"`
+	Address string `json:"address"`
+}
+
+// AddMemberResponse is the response of the AddMember method.
+type AddMemberResponse struct{}
+
+// RemoveMemberRequest is the request of the RemoveMember method.
+type RemoveMemberRequest struct {
+	ID string `json:"id"`
+}
+
+// RemoveMemberResponse is the response of the RemoveMember method.
+type RemoveMemberResponse struct{}
+
+// Exit is a voluntary exit signing request awaiting approval.
+type Exit struct {
+	ID             string    `json:"id"`
+	PublicKey      string    `json:"public_key"`
+	ValidatorIndex uint64    `json:"validator_index"`
+	Epoch          uint64    `json:"epoch"`
+	State          string    `json:"state"`
+	Approvals      []string  `json:"approvals"`
+	RejectedBy     string    `json:"rejected_by,omitempty"`
+	RejectReason   string    `json:"reject_reason,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
+// ListExitsRequest is the request of the ListExits method.
+type ListExitsRequest struct{}
+
+// ListExitsResponse is the response of the ListExits method.
+type ListExitsResponse struct {
+	Exits []*Exit `json:"exits"`
+}
+
+// ApproveExitRequest is the request of the ApproveExit method. With signed
+// approvals, the signature is the hex encoded ed25519 signature of
+// exits.ApprovalMessage by the operator. Otherwise the operator is the
+// authenticated caller, and the operator and signature are ignored.
+type ApproveExitRequest struct {
+	ID        string `json:"id"`
+	Operator  string `json:"operator"`
+	Signature string `json:"signature"`
+}
+
+// ApproveExitResponse is the response of the ApproveExit method.
+type ApproveExitResponse struct {
+	Exit *Exit `json:"exit"`
+}
+
+// RejectExitRequest is the request of the RejectExit method. With signed
+// approvals, the signature is the hex encoded ed25519 signature of
+// exits.RejectionMessage by the operator. Otherwise the operator is the
+// authenticated caller, and the operator and signature are ignored.
+type RejectExitRequest struct {
+	ID        string `json:"id"`
+	Operator  string `json:"operator"`
+	Reason    string `json:"reason"`
+	Signature string `json:"signature"`
+}
+
+// RejectExitResponse is the response of the RejectExit method.
+type RejectExitResponse struct {
+	Exit *Exit `json:"exit"`
+}
+
+// Maintenance is the maintenance mode of the remote signer.
+type Maintenance struct {
+	Enabled bool       `json:"enabled"`
+	Reason  string     `json:"reason,omitempty"`
+	Since   *time.Time `json:"since,omitempty"`
+}
+
+// GetMaintenanceRequest is the request of the GetMaintenance method.
+type GetMaintenanceRequest struct{}
+
+// GetMaintenanceResponse is the response of the GetMaintenance method.
+type GetMaintenanceResponse struct {
+	Maintenance *Maintenance `json:"maintenance"`
+}
+
+// SetMaintenanceRequest is the request of the SetMaintenance method.
+type SetMaintenanceRequest struct {
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// SetMaintenanceResponse is the response of the SetMaintenance method.
+type SetMaintenanceResponse struct {
+	Maintenance *Maintenance `json:"maintenance"`
+}
+
+// KeyFromMetadata converts keyvault metadata into its admin API representation.
+func KeyFromMetadata(m *keyvault.KeyMetadata) *Key {
+	k := &Key{
+		PublicKey:      fmt.Sprintf("%#x", m.PublicKey.Marshal()),
+		Label:          m.Label,
+		DerivationPath: m.DerivationPath,
+		Source:         m.Source,
+		CreatedAt:      m.CreatedAt,
+		Enabled:        m.Enabled,
+		DisabledReason: m.DisabledReason,
+	}
+	if m.ValidatorIndex != nil {
+		idx := uint64(*m.ValidatorIndex)
+		k.ValidatorIndex = &idx
+	}
+	if len(m.FeeRecipient) > 0 {
+		k.FeeRecipient = fmt.Sprintf("%#x", m.FeeRecipient)
+	}
+	return k
+}
+
+// ExitFromQueue converts a queued exit into its admin API representation.
+func ExitFromQueue(e *exits.Exit) *Exit {
+	return &Exit{
+		ID:             e.ID,
+		PublicKey:      fmt.Sprintf("%#x", e.PublicKey),
+		ValidatorIndex: e.ValidatorIndex,
+		Epoch:          e.Epoch,
+		State:          string(e.State),
+		Approvals:      e.Approvals,
+		RejectedBy:     e.RejectedBy,
+		RejectReason:   e.RejectReason,
+		CreatedAt:      e.CreatedAt,
+		ExpiresAt:      e.ExpiresAt,
+	}
+}
+
+// Server is the server API of the admin service.
+type Server interface {
+	ListKeys(context.Context, *ListKeysRequest) (*ListKeysResponse, error)
+	DisableKey(context.Context, *DisableKeyRequest) (*DisableKeyResponse, error)
+	EnableKey(context.Context, *EnableKeyRequest) (*EnableKeyResponse, error)
+	ListMembers(context.Context, *ListMembersRequest) (*ListMembersResponse, error)
+	AddMember(context.Context, *AddMemberRequest) (*AddMemberResponse, error)
+	RemoveMember(context.Context, *RemoveMemberRequest) (*RemoveMemberResponse, error)
+	ListExits(context.Context, *ListExitsRequest) (*ListExitsResponse, error)
+	ApproveExit(context.Context, *ApproveExitRequest) (*ApproveExitResponse, error)
+	RejectExit(context.Context, *RejectExitRequest) (*RejectExitResponse, error)
+	GetMaintenance(context.Context, *GetMaintenanceRequest) (*GetMaintenanceResponse, error)
+	SetMaintenance(context.Context, *SetMaintenanceRequest) (*SetMaintenanceResponse, error)
+}
+
+// RegisterServer registers an admin server implementation on a gRPC server.
+func RegisterServer(s *grpc.Server, srv Server) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*Server)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListKeys",
+			Handler: unaryHandler("ListKeys", func() interface{} { return new(ListKeysRequest) },
+				func(ctx context.Context, srv Server, req interface{}) (interface{}, error) {
+					return srv.ListKeys(ctx, req.(*ListKeysRequest))
+				},
+			),
+		},
+		{
+			MethodName: "DisableKey",
+			Handler: unaryHandler("DisableKey", func() interface{} { return new(DisableKeyRequest) },
+				func(ctx context.Context, srv Server, req interface{}) (interface{}, error) {
+					return srv.DisableKey(ctx, req.(*DisableKeyRequest))
+				},
+			),
+		},
+		{
+			MethodName: "EnableKey",
+			Handler: unaryHandler("EnableKey", func() interface{} { return new(EnableKeyRequest) },
+				func(ctx context.Context, srv Server, req interface{}) (interface{}, error) {
+					return srv.EnableKey(ctx, req.(*EnableKeyRequest))
+				},
+			),
+		},
+		{
+			MethodName: "ListMembers",
+			Handler: unaryHandler("ListMembers", func() interface{} { return new(ListMembersRequest) },
+				func(ctx context.Context, srv Server, req interface{}) (interface{}, error) {
+					return srv.ListMembers(ctx, req.(*ListMembersRequest))
+				},
+			),
+		},
+		{
+			MethodName: "AddMember",
+			Handler: unaryHandler("AddMember", func() interface{} { return new(AddMemberRequest) },
+				func(ctx context.Context, srv Server, req interface{}) (interface{}, error) {
+					return srv.AddMember(ctx, req.(*AddMemberRequest))
+				},
+			),
+		},
+		{
+			MethodName: "RemoveMember",
+			Handler: unaryHandler("RemoveMember", func() interface{} { return new(RemoveMemberRequest) },
+				func(ctx context.Context, srv Server, req interface{}) (interface{}, error) {
+					return srv.RemoveMember(ctx, req.(*RemoveMemberRequest))
+				},
+			),
+		},
+		{
+			MethodName: "ListExits",
+			Handler: unaryHandler("ListExits", func() interface{} { return new(ListExitsRequest) },
+				func(ctx context.Context, srv Server, req interface{}) (interface{}, error) {
+					return srv.ListExits(ctx, req.(*ListExitsRequest))
+				},
+			),
+		},
+		{
+			MethodName: "ApproveExit",
+			Handler: unaryHandler("ApproveExit", func() interface{} { return new(ApproveExitRequest) },
+				func(ctx context.Context, srv Server, req interface{}) (interface{}, error) {
+					return srv.ApproveExit(ctx, req.(*ApproveExitRequest))
+				},
+			),
+		},
+		{
+			MethodName: "RejectExit",
+			Handler: unaryHandler("RejectExit", func() interface{} { return new(RejectExitRequest) },
+				func(ctx context.Context, srv Server, req interface{}) (interface{}, error) {
+					return srv.RejectExit(ctx, req.(*RejectExitRequest))
+				},
+			),
+		},
+		{
+			MethodName: "GetMaintenance",
+			Handler: unaryHandler("GetMaintenance", func() interface{} { return new(GetMaintenanceRequest) },
+				func(ctx context.Context, srv Server, req interface{}) (interface{}, error) {
+					return srv.GetMaintenance(ctx, req.(*GetMaintenanceRequest))
+				},
+			),
+		},
+		{
+			MethodName: "SetMaintenance",
+			Handler: unaryHandler("SetMaintenance", func() interface{} { return new(SetMaintenanceRequest) },
+				func(ctx context.Context, srv Server, req interface{}) (interface{}, error) {
+					return srv.SetMaintenance(ctx, req.(*SetMaintenanceRequest))
+				},
+			),
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "rpc/admin/admin.go",
+}
+
+type handlerFunc func(ctx context.Context, srv Server, req interface{}) (interface{}, error)
+
+// unaryHandler builds a gRPC method handler which decodes the request,
+// and runs the server interceptors before calling the server method.
+func unaryHandler(
+	method string, newReq func() interface{}, call handlerFunc,
+) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	fullMethod := fmt.Sprintf("/%s/%s", ServiceName, method)
+	return func(
+		srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor,
+	) (interface{}, error) {
+		req := newReq()
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return call(ctx, srv.(Server), req)
+		}
+		info := &grpc.UnaryServerInfo{
+			Server:     srv,
+			FullMethod: fullMethod,
+		}
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			return call(ctx, srv.(Server), req)
+		}
+		return interceptor(ctx, req, info, handler)
+	}
+}
+
+// Client is the client API of the admin service.
+type Client interface {
+	ListKeys(ctx context.Context, in *ListKeysRequest, opts ...grpc.CallOption) (*ListKeysResponse, error)
+	DisableKey(ctx context.Context, in *DisableKeyRequest, opts ...grpc.CallOption) (*DisableKeyResponse, error)
+	EnableKey(ctx context.Context, in *EnableKeyRequest, opts ...grpc.CallOption) (*EnableKeyResponse, error)
+	ListMembers(ctx context.Context, in *ListMembersRequest, opts ...grpc.CallOption) (*ListMembersResponse, error)
+	AddMember(ctx context.Context, in *AddMemberRequest, opts ...grpc.CallOption) (*AddMemberResponse, error)
+	RemoveMember(ctx context.Context, in *RemoveMemberRequest, opts ...grpc.CallOption) (*RemoveMemberResponse, error)
+	ListExits(ctx context.Context, in *ListExitsRequest, opts ...grpc.CallOption) (*ListExitsResponse, error)
+	ApproveExit(ctx context.Context, in *ApproveExitRequest, opts ...grpc.CallOption) (*ApproveExitResponse, error)
+	RejectExit(ctx context.Context, in *RejectExitRequest, opts ...grpc.CallOption) (*RejectExitResponse, error)
+	GetMaintenance(ctx context.Context, in *GetMaintenanceRequest, opts ...grpc.CallOption) (*GetMaintenanceResponse, error)
+	SetMaintenance(ctx context.Context, in *SetMaintenanceRequest, opts ...grpc.CallOption) (*SetMaintenanceResponse, error)
+}
+
+type client struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewClient instantiates an admin client on top of a gRPC connection.
+func NewClient(cc grpc.ClientConnInterface) Client {
+	return &client{cc: cc}
+}
+
+// ListKeys lists the validating keys of the remote signer along with their metadata.
+func (c *client) ListKeys(ctx context.Context, in *ListKeysRequest, opts ...grpc.CallOption) (*ListKeysResponse, error) {
+	out := new(ListKeysResponse)
+	if err := c.invoke(ctx, "ListKeys", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DisableKey stops a key from signing any request until it is enabled again.
+func (c *client) DisableKey(ctx context.Context, in *DisableKeyRequest, opts ...grpc.CallOption) (*DisableKeyResponse, error) {
+	out := new(DisableKeyResponse)
+	if err := c.invoke(ctx, "DisableKey", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// EnableKey re-enables signing with a previously disabled key.
+func (c *client) EnableKey(ctx context.Context, in *EnableKeyRequest, opts ...grpc.CallOption) (*EnableKeyResponse, error) {
+	out := new(EnableKeyResponse)
+	if err := c.invoke(ctx, "EnableKey", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListMembers lists the signers of the Raft cluster.
+func (c *client) ListMembers(ctx context.Context, in *ListMembersRequest, opts ...grpc.CallOption) (*ListMembersResponse, error) {
+	out := new(ListMembersResponse)
+	if err := c.invoke(ctx, "ListMembers", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AddMember adds a signer to the Raft cluster, and must be called on the leader.
+func (c *client) AddMember(ctx context.Context, in *AddMemberRequest, opts ...grpc.CallOption) (*AddMemberResponse, error) {
+	out := new(AddMemberResponse)
+	if err := c.invoke(ctx, "AddMember", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RemoveMember removes a signer from the Raft cluster, and must be called on the leader.
+func (c *client) RemoveMember(ctx context.Context, in *RemoveMemberRequest, opts ...grpc.CallOption) (*RemoveMemberResponse, error) {
+	out := new(RemoveMemberResponse)
+	if err := c.invoke(ctx, "RemoveMember", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListExits lists the voluntary exits awaiting approval.
+func (c *client) ListExits(ctx context.Context, in *ListExitsRequest, opts ...grpc.CallOption) (*ListExitsResponse, error) {
+	out := new(ListExitsResponse)
+	if err := c.invoke(ctx, "ListExits", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ApproveExit records the approval of a voluntary exit by an operator.
+func (c *client) ApproveExit(ctx context.Context, in *ApproveExitRequest, opts ...grpc.CallOption) (*ApproveExitResponse, error) {
+	out := new(ApproveExitResponse)
+	if err := c.invoke(ctx, "ApproveExit", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RejectExit rejects a voluntary exit on behalf of an operator.
+func (c *client) RejectExit(ctx context.Context, in *RejectExitRequest, opts ...grpc.CallOption) (*RejectExitResponse, error) {
+	out := new(RejectExitResponse)
+	if err := c.invoke(ctx, "RejectExit", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetMaintenance returns the maintenance mode of the remote signer.
+func (c *client) GetMaintenance(
+	ctx context.Context, in *GetMaintenanceRequest, opts ...grpc.CallOption,
+) (*GetMaintenanceResponse, error) {
+	out := new(GetMaintenanceResponse)
+	if err := c.invoke(ctx, "GetMaintenance", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SetMaintenance enables or disables the maintenance mode of the remote signer.
+func (c *client) SetMaintenance(
+	ctx context.Context, in *SetMaintenanceRequest, opts ...grpc.CallOption,
+) (*SetMaintenanceResponse, error) {
+	out := new(SetMaintenanceResponse)
+	if err := c.invoke(ctx, "SetMaintenance", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *client) invoke(ctx context.Context, method string, in, out interface{}, opts ...grpc.CallOption) error {
+	opts = append([]grpc.CallOption{grpc.CallContentSubtype(CodecName)}, opts...)
+	return c.cc.Invoke(ctx, fmt.Sprintf("/%s/%s", ServiceName, method), in, out, opts...)
+}
@@ -0,0 +1,10 @@
+package admin
+
+import (
+	"github.com/prysmaticlabs/remote-signer/rpc/jsoncodec"
+)
+
+// CodecName is the gRPC content-subtype used by the admin API. Admin
+// messages are plain Go structs encoded as JSON rather than protobufs,
+// which keeps the admin API easy to extend and to call from scripts.
+const CodecName = jsoncodec.Name
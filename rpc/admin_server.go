@@ -0,0 +1,340 @@
+package rpc
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/prysmaticlabs/prysm/crypto/bls"
+	"github.com/prysmaticlabs/remote-signer/cluster"
+	"github.com/prysmaticlabs/remote-signer/exits"
+	"github.com/prysmaticlabs/remote-signer/keyvault"
+	"github.com/prysmaticlabs/remote-signer/rpc/admin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Membership manages the signers of a Raft cluster, as implemented by cluster.Cluster.
+type Membership interface {
+	Status() *cluster.Status
+	AddMember(ctx context.Context, id, address string) error
+	RemoveMember(ctx context.Context, id string) error
+}
+
+// AdminServer implements the administrative API of the remote signer.
+type AdminServer struct {
+	keyVault    keyvault.Store
+	cluster     Membership
+	exitQueue   *exits.Queue
+	maintenance *Maintenance
+}
+
+// AdminOption configures an admin server.
+type AdminOption func(*AdminServer)
+
+// WithClusterMembership lets the admin API manage the members of the Raft
+// cluster the remote signer belongs to.
+func WithClusterMembership(m Membership) AdminOption {
+	return func(a *AdminServer) {
+		a.cluster = m
+	}
+}
+
+// WithExitQueue lets operators approve or reject the voluntary exits
+// held in the queue through the admin API.
+func WithExitQueue(q *exits.Queue) AdminOption {
+	return func(a *AdminServer) {
+		a.exitQueue = q
+	}
+}
+
+// WithMaintenanceMode lets operators toggle the maintenance mode of the
+// server through the admin API.
+func WithMaintenanceMode(m *Maintenance) AdminOption {
+	return func(a *AdminServer) {
+		a.maintenance = m
+	}
+}
+
+// NewAdminServer instantiates an admin server for the keys held in a keyvault.
+func NewAdminServer(keyVault keyvault.Store, opts ...AdminOption) *AdminServer {
+	a := &AdminServer{
+		keyVault: keyVault,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// ListKeys returns every validating key held by the keyvault along with its metadata.
+func (a *AdminServer) ListKeys(ctx context.Context, _ *admin.ListKeysRequest) (*admin.ListKeysResponse, error) {
+	metadata, err := keyvault.ListKeyMetadata(ctx, a.keyVault)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Could not retrieve key metadata: %v", err)
+	}
+	keys := make([]*admin.Key, len(metadata))
+	for i, m := range metadata {
+		keys[i] = admin.KeyFromMetadata(m)
+	}
+	return &admin.ListKeysResponse{
+		Keys: keys,
+	}, nil
+}
+
+// DisableKey stops a key from signing any request, without removing its key material.
+func (a *AdminServer) DisableKey(ctx context.Context, req *admin.DisableKeyRequest) (*admin.DisableKeyResponse, error) {
+	toggler, ok := a.keyVault.(keyvault.ToggleStore)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "Keyvault does not support disabling keys")
+	}
+	if req.Reason == "" {
+		return nil, status.Error(codes.InvalidArgument, "Expected a reason for disabling the key")
+	}
+	pubKey, err := parsePublicKey(req.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := toggler.DisableKey(ctx, pubKey, req.Reason); err != nil {
+		return nil, toggleError(err)
+	}
+	return &admin.DisableKeyResponse{}, nil
+}
+
+// EnableKey re-enables signing with a previously disabled key.
+func (a *AdminServer) EnableKey(ctx context.Context, req *admin.EnableKeyRequest) (*admin.EnableKeyResponse, error) {
+	toggler, ok := a.keyVault.(keyvault.ToggleStore)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "Keyvault does not support enabling keys")
+	}
+	pubKey, err := parsePublicKey(req.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := toggler.EnableKey(ctx, pubKey); err != nil {
+		return nil, toggleError(err)
+	}
+	return &admin.EnableKeyResponse{}, nil
+}
+
+// ListMembers returns the signers of the Raft cluster, as seen by this signer.
+func (a *AdminServer) ListMembers(_ context.Context, _ *admin.ListMembersRequest) (*admin.ListMembersResponse, error) {
+	if a.cluster == nil {
+		return nil, errNotClustered
+	}
+	st := a.cluster.Status()
+	res := &admin.ListMembersResponse{
+		Members:     make([]*admin.Member, 0, len(st.Members)),
+		State:       st.State,
+		Term:        st.Term,
+		CommitIndex: st.CommitIndex,
+	}
+	for id, address := range st.Members {
+		res.Members = append(res.Members, &admin.Member{ID: id, Address: address, Leader: id == st.Leader})
+	}
+	sort.Slice(res.Members, func(i, j int) bool {
+		return res.Members[i].ID < res.Members[j].ID
+	})
+	return res, nil
+}
+
+// AddMember adds a signer to the Raft cluster, or changes its address.
+func (a *AdminServer) AddMember(ctx context.Context, req *admin.AddMemberRequest) (*admin.AddMemberResponse, error) {
+	if a.cluster == nil {
+		return nil, errNotClustered
+	}
+	if req.ID == "" || req.Address == "" {
+		return nil, status.Error(codes.InvalidArgument, "Expected a member ID and address")
+	}
+	if err := a.cluster.AddMember(ctx, req.ID, req.Address); err != nil {
+		return nil, membershipError(err)
+	}
+	return &admin.AddMemberResponse{}, nil
+}
+
+// RemoveMember removes a signer from the Raft cluster.
+func (a *AdminServer) RemoveMember(ctx context.Context, req *admin.RemoveMemberRequest) (*admin.RemoveMemberResponse, error) {
+	if a.cluster == nil {
+		return nil, errNotClustered
+	}
+	if req.ID == "" {
+		return nil, status.Error(codes.InvalidArgument, "Expected a member ID")
+	}
+	if err := a.cluster.RemoveMember(ctx, req.ID); err != nil {
+		return nil, membershipError(err)
+	}
+	return &admin.RemoveMemberResponse{}, nil
+}
+
+// ListExits returns the voluntary exits held for approval, oldest first.
+func (a *AdminServer) ListExits(_ context.Context, _ *admin.ListExitsRequest) (*admin.ListExitsResponse, error) {
+	if a.exitQueue == nil {
+		return nil, errNoExitApproval
+	}
+	queued := a.exitQueue.List()
+	res := &admin.ListExitsResponse{
+		Exits: make([]*admin.Exit, len(queued)),
+	}
+	for i, e := range queued {
+		res.Exits[i] = admin.ExitFromQueue(e)
+	}
+	return res, nil
+}
+
+// ApproveExit records the approval of a voluntary exit by an operator.
+func (a *AdminServer) ApproveExit(ctx context.Context, req *admin.ApproveExitRequest) (*admin.ApproveExitResponse, error) {
+	if a.exitQueue == nil {
+		return nil, errNoExitApproval
+	}
+	sig, err := parseOperatorSignature(req.Signature)
+	if err != nil {
+		return nil, err
+	}
+	e, err := a.exitQueue.Approve(req.ID, a.exitOperator(ctx, req.Operator), sig)
+	if err != nil {
+		return nil, exitError(err)
+	}
+	return &admin.ApproveExitResponse{
+		Exit: admin.ExitFromQueue(e),
+	}, nil
+}
+
+// RejectExit rejects a voluntary exit on behalf of an operator.
+func (a *AdminServer) RejectExit(ctx context.Context, req *admin.RejectExitRequest) (*admin.RejectExitResponse, error) {
+	if a.exitQueue == nil {
+		return nil, errNoExitApproval
+	}
+	if req.Reason == "" {
+		return nil, status.Error(codes.InvalidArgument, "Expected a reason for rejecting the exit")
+	}
+	sig, err := parseOperatorSignature(req.Signature)
+	if err != nil {
+		return nil, err
+	}
+	e, err := a.exitQueue.Reject(req.ID, a.exitOperator(ctx, req.Operator), req.Reason, sig)
+	if err != nil {
+		return nil, exitError(err)
+	}
+	return &admin.RejectExitResponse{
+		Exit: admin.ExitFromQueue(e),
+	}, nil
+}
+
+// GetMaintenance returns the maintenance mode of the server.
+func (a *AdminServer) GetMaintenance(
+	_ context.Context, _ *admin.GetMaintenanceRequest,
+) (*admin.GetMaintenanceResponse, error) {
+	if a.maintenance == nil {
+		return nil, errNoMaintenance
+	}
+	return &admin.GetMaintenanceResponse{
+		Maintenance: a.maintenanceStatus(),
+	}, nil
+}
+
+// SetMaintenance enables or disables the maintenance mode of the server.
+func (a *AdminServer) SetMaintenance(
+	_ context.Context, req *admin.SetMaintenanceRequest,
+) (*admin.SetMaintenanceResponse, error) {
+	if a.maintenance == nil {
+		return nil, errNoMaintenance
+	}
+	if req.Enabled {
+		if req.Reason == "" {
+			return nil, status.Error(codes.InvalidArgument, "Expected a reason for entering maintenance mode")
+		}
+		a.maintenance.Enable(req.Reason)
+	} else {
+		a.maintenance.Disable()
+	}
+	return &admin.SetMaintenanceResponse{
+		Maintenance: a.maintenanceStatus(),
+	}, nil
+}
+
+func (a *AdminServer) maintenanceStatus() *admin.Maintenance {
+	enabled, reason, since := a.maintenance.Status()
+	m := &admin.Maintenance{Enabled: enabled, Reason: reason}
+	if enabled {
+		m.Since = &since
+	}
+	return m
+}
+
+var errNoMaintenance = status.Error(codes.Unimplemented, "Maintenance mode is not supported")
+
+var errNoExitApproval = status.Error(codes.Unimplemented, "Voluntary exit approval is not enabled")
+
+// exitOperator returns the operator approving or rejecting an exit: the
+// operator of the request if approvals are signed, or else the identity of
+// the authenticated caller, so that distinct callers must approve an exit.
+func (a *AdminServer) exitOperator(ctx context.Context, operator string) string {
+	if a.exitQueue.SignedApprovals() {
+		return operator
+	}
+	return clientIdentity(ctx)
+}
+
+// parseOperatorSignature decodes the hex encoded signature of an operator,
+// checked against its public key by the exit queue.
+func parseOperatorSignature(hexSig string) ([]byte, error) {
+	if hexSig == "" {
+		return nil, nil
+	}
+	sig, err := hex.DecodeString(strings.TrimPrefix(hexSig, "0x"))
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Could not decode signature: %v", err)
+	}
+	return sig, nil
+}
+
+func exitError(err error) error {
+	switch {
+	case errors.Is(err, exits.ErrUnauthorized):
+		return status.Errorf(codes.PermissionDenied, "Could not update exit: %v", err)
+	case errors.Is(err, exits.ErrUnknownExit):
+		return status.Errorf(codes.NotFound, "Could not update exit: %v", err)
+	default:
+		return status.Errorf(codes.FailedPrecondition, "Could not update exit: %v", err)
+	}
+}
+
+var errNotClustered = status.Error(codes.Unimplemented, "Remote signer is not part of a cluster")
+
+func membershipError(err error) error {
+	switch {
+	case errors.Is(err, cluster.ErrNotLeader):
+		return status.Errorf(codes.FailedPrecondition, "Could not change cluster membership: %v", err)
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, cluster.ErrLeadershipLost):
+		return status.Errorf(codes.Unavailable, "Could not change cluster membership: %v", err)
+	default:
+		return status.Errorf(codes.InvalidArgument, "Could not change cluster membership: %v", err)
+	}
+}
+
+// parsePublicKey parses a hex encoded BLS public key from an admin request.
+func parsePublicKey(hexKey string) (bls.PublicKey, error) {
+	raw, err := hex.DecodeString(strings.TrimPrefix(hexKey, "0x"))
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Could not decode public key: %v", err)
+	}
+	if len(raw) != blsPublicKeyLength {
+		return nil, status.Errorf(
+			codes.InvalidArgument, "Wrong public key byte size: %d, expected %d", len(raw), blsPublicKeyLength,
+		)
+	}
+	pubKey, err := bls.PublicKeyFromBytes(raw)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Could not parse public key: %v", err)
+	}
+	return pubKey, nil
+}
+
+func toggleError(err error) error {
+	if errors.Is(err, keyvault.ErrUnknownKey) {
+		return status.Errorf(codes.NotFound, "Could not find key: %v", err)
+	}
+	return status.Errorf(codes.Internal, "Could not update key state: %v", err)
+}
@@ -0,0 +1,144 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prysmaticlabs/prysm/crypto/bls"
+	ethpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1"
+	"github.com/prysmaticlabs/remote-signer/auth"
+	"github.com/prysmaticlabs/remote-signer/cluster"
+	"github.com/prysmaticlabs/remote-signer/exits"
+	"github.com/prysmaticlabs/remote-signer/keyvault"
+	"github.com/prysmaticlabs/remote-signer/rpc/admin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAdminServer_ListKeys(t *testing.T) {
+	ctx := context.Background()
+	a := NewAdminServer(&mockKeyVault{wantErr: true})
+	if _, err := a.ListKeys(ctx, &admin.ListKeysRequest{}); err == nil {
+		t.Fatal("Wanted error, received nil")
+	}
+	keys := []bls.PublicKey{randKey().PublicKey(), randKey().PublicKey()}
+	a = NewAdminServer(&mockKeyVault{pubKeys: keys})
+	res, err := a.ListKeys(ctx, &admin.ListKeysRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Keys) != len(keys) {
+		t.Fatalf("Wanted %d keys, received %d", len(keys), len(res.Keys))
+	}
+	for i, k := range res.Keys {
+		want := fmt.Sprintf("%#x", keys[i].Marshal())
+		if k.PublicKey != want {
+			t.Errorf("Wanted %s, received %s", want, k.PublicKey)
+		}
+		if k.Source != keyvault.UnknownSource || !k.Enabled {
+			t.Errorf("Unexpected key metadata %+v", k)
+		}
+	}
+}
+
+type mockMembership struct {
+	leader  string
+	members cluster.Members
+}
+
+func (m *mockMembership) Status() *cluster.Status {
+	return &cluster.Status{ID: "a", State: "leader", Leader: m.leader, Members: m.members}
+}
+
+func (m *mockMembership) AddMember(_ context.Context, id, address string) error {
+	if m.leader != "a" {
+		return cluster.ErrNotLeader
+	}
+	m.members[id] = address
+	return nil
+}
+
+func (m *mockMembership) RemoveMember(_ context.Context, id string) error {
+	delete(m.members, id)
+	return nil
+}
+
+func TestAdminServer_Membership(t *testing.T) {
+	ctx := context.Background()
+	a := NewAdminServer(&mockKeyVault{})
+	if _, err := a.ListMembers(ctx, &admin.ListMembersRequest{}); status.Code(err) != codes.Unimplemented {
+		t.Errorf("Wanted Unimplemented without a cluster, received %v", err)
+	}
+
+	m := &mockMembership{leader: "a", members: cluster.Members{"a": "a:4000"}}
+	a = NewAdminServer(&mockKeyVault{}, WithClusterMembership(m))
+	if _, err := a.AddMember(ctx, &admin.AddMemberRequest{ID: "b", Address: "b:4000"}); err != nil {
+		t.Fatal(err)
+	}
+	res, err := a.ListMembers(ctx, &admin.ListMembersRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*admin.Member{{ID: "a", Address: "a:4000", Leader: true}, {ID: "b", Address: "b:4000"}}
+	if len(res.Members) != len(want) {
+		t.Fatalf("Wanted %d members, received %d", len(want), len(res.Members))
+	}
+	for i, member := range res.Members {
+		if *member != *want[i] {
+			t.Errorf("Wanted %+v, received %+v", want[i], member)
+		}
+	}
+
+	m.leader = "b"
+	_, err = a.AddMember(ctx, &admin.AddMemberRequest{ID: "c", Address: "c:4000"})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Wanted FailedPrecondition on a follower, received %v", err)
+	}
+}
+
+func TestAdminServer_ApproveExit_CallerIdentity(t *testing.T) {
+	ctx := context.Background()
+	q, err := exits.NewQueue(&exits.Config{Approvals: 2, Expiry: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewAdminServer(&mockKeyVault{}, WithExitQueue(q))
+	exit := &ethpb.VoluntaryExit{Epoch: 10, ValidatorIndex: 1}
+	domain := append([]byte{0x04, 0x00, 0x00, 0x00}, make([]byte, 28)...)
+	signingRoot, err := exits.SigningRoot(exit, domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := q.Await(waitCtx, [48]byte{1}, exit, domain, signingRoot); !errors.Is(err, exits.ErrPending) {
+		t.Fatalf("Wanted %v, received %v", exits.ErrPending, err)
+	}
+	id := exits.ID([48]byte{1}, signingRoot)
+	alice := auth.NewContext(ctx, &auth.Token{ID: "alice"})
+
+	// Without signed approvals, the operator is the caller, whatever the request claims.
+	if _, err := a.ApproveExit(alice, &admin.ApproveExitRequest{ID: id, Operator: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = a.ApproveExit(alice, &admin.ApproveExitRequest{ID: id, Operator: "carol"})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Wanted FailedPrecondition for a second approval of the same caller, received %v", err)
+	}
+	if _, err := a.ApproveExit(ctx, &admin.ApproveExitRequest{ID: id}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Wanted PermissionDenied for an unidentified caller, received %v", err)
+	}
+	res, err := a.ApproveExit(auth.NewContext(ctx, &auth.Token{ID: "bob"}), &admin.ApproveExitRequest{ID: id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Exit.State != string(exits.Approved) {
+		t.Errorf("Wanted exit approved, received %s", res.Exit.State)
+	}
+	if want := []string{"token:alice", "token:bob"}; fmt.Sprint(res.Exit.Approvals) != fmt.Sprint(want) {
+		t.Errorf("Wanted approvals %v, received %v", want, res.Exit.Approvals)
+	}
+}
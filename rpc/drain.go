@@ -0,0 +1,60 @@
+package rpc
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultShutdownTimeout bounds how long stopping the server waits for
+// in-flight requests to complete before forcibly closing connections.
+const DefaultShutdownTimeout = 30 * time.Second
+
+// inflight tracks the requests being served, so that shutdown can wait for
+// them to complete before closing the keyvault and slashing protection database.
+type inflight struct {
+	lock     sync.Mutex
+	draining bool
+	wg       sync.WaitGroup
+}
+
+// unaryInterceptor refuses new requests once draining, and tracks the others.
+func (f *inflight) unaryInterceptor(
+	ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+) (interface{}, error) {
+	f.lock.Lock()
+	if f.draining {
+		f.lock.Unlock()
+		return nil, status.Error(codes.Unavailable, "Remote signer is shutting down")
+	}
+	f.wg.Add(1)
+	f.lock.Unlock()
+	defer f.wg.Done()
+	return handler(ctx, req)
+}
+
+// drain refuses new requests.
+func (f *inflight) drain() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.draining = true
+}
+
+// wait returns whether every in-flight request completed before ctx is done.
+func (f *inflight) wait(ctx context.Context) bool {
+	done := make(chan struct{})
+	go func() {
+		f.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,47 @@
+package rpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestInflight_Drain(t *testing.T) {
+	f := &inflight{}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		close(started)
+		<-release
+		return "signed", nil
+	}
+	res := make(chan interface{}, 1)
+	go func() {
+		out, _ := f.unaryInterceptor(context.Background(), nil, &grpc.UnaryServerInfo{}, handler)
+		res <- out
+	}()
+	<-started
+
+	f.drain()
+	_, err := f.unaryInterceptor(context.Background(), nil, &grpc.UnaryServerInfo{}, handler)
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("Wanted new requests refused while draining, received %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if f.wait(ctx) {
+		t.Error("Wanted wait to time out with a request in flight")
+	}
+
+	close(release)
+	if !f.wait(context.Background()) {
+		t.Error("Wanted in-flight request to complete")
+	}
+	if out := <-res; out != "signed" {
+		t.Errorf("Wanted in-flight request served, received %v", out)
+	}
+}
@@ -0,0 +1,116 @@
+//go:build go1.18
+// +build go1.18
+
+package rpc
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prysmaticlabs/prysm/crypto/bls"
+	ethpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1"
+	validatorpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1/validator-client"
+	"github.com/prysmaticlabs/remote-signer/keyvault/deterministic"
+	"github.com/prysmaticlabs/remote-signer/slashing"
+)
+
+// FuzzRemoteSigner_Sign decodes sign requests as received on the wire,
+// optionally for the key of the signer so that they reach the slashing
+// protection and the keyvault. Requests must never crash the signer, and
+// any signature returned must verify against the public key of the request.
+func FuzzRemoteSigner_Sign(f *testing.F) {
+	ctx := context.Background()
+	vault, err := deterministic.NewStore(1)
+	if err != nil {
+		f.Fatal(err)
+	}
+	pubKeys, err := vault.GetPublicKeys(ctx)
+	if err != nil {
+		f.Fatal(err)
+	}
+	pubKey := pubKeys[0].Marshal()
+	dir, err := ioutil.TempDir("", "rpc")
+	if err != nil {
+		f.Fatal(err)
+	}
+	db, err := slashing.Open(filepath.Join(dir, "slashing.db"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Cleanup(func() {
+		if err := db.Close(); err != nil {
+			f.Error(err)
+		}
+		if err := vault.Close(); err != nil {
+			f.Error(err)
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			f.Error(err)
+		}
+	})
+	r := NewRemoteSigner(ctx, vault, WithSlashingProtection(db))
+
+	seeds := []*validatorpb.SignRequest{
+		{Object: &validatorpb.SignRequest_Block{Block: &ethpb.BeaconBlock{Slot: 10}}},
+		{Object: &validatorpb.SignRequest_BlockV2{BlockV2: &ethpb.BeaconBlockAltair{Slot: 11}}},
+		{Object: &validatorpb.SignRequest_AttestationData{AttestationData: &ethpb.AttestationData{
+			Source: &ethpb.Checkpoint{Epoch: 1},
+			Target: &ethpb.Checkpoint{Epoch: 2},
+		}}},
+		{Object: &validatorpb.SignRequest_AttestationData{AttestationData: &ethpb.AttestationData{}}},
+		{Object: &validatorpb.SignRequest_Exit{Exit: &ethpb.VoluntaryExit{Epoch: 3}}},
+		{Object: &validatorpb.SignRequest_Slot{Slot: 4}},
+		{Object: &validatorpb.SignRequest_Epoch{Epoch: 5}},
+		{Object: &validatorpb.SignRequest_SyncMessageBlockRoot{SyncMessageBlockRoot: make([]byte, 32)}},
+		{},
+	}
+	for _, req := range seeds {
+		req.SigningRoot = make([]byte, 32)
+		// Blocks and attestations are only signed for the root of their object.
+		req.SignatureDomain = make([]byte, 32)
+		if _, ok := req.Object.(*validatorpb.SignRequest_AttestationData); ok {
+			req.SignatureDomain[0] = 0x01
+		}
+		if signingRoot, err := slashing.ComputeSigningRoot(req); err == nil && signingRoot != nil {
+			req.SigningRoot = signingRoot
+		}
+		enc, err := proto.Marshal(req)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(enc, true)
+		f.Add(enc, false)
+	}
+
+	f.Fuzz(func(t *testing.T, enc []byte, withKey bool) {
+		req := &validatorpb.SignRequest{}
+		if err := proto.Unmarshal(enc, req); err != nil {
+			return
+		}
+		if withKey {
+			req.PublicKey = pubKey
+		}
+		res, err := r.Sign(ctx, req)
+		if err != nil {
+			return
+		}
+		if res.Status != validatorpb.SignResponse_SUCCEEDED {
+			t.Fatalf("Wanted an error with status %s", res.Status)
+		}
+		sig, err := bls.SignatureFromBytes(res.Signature)
+		if err != nil {
+			t.Fatalf("Could not parse signature: %v", err)
+		}
+		pk, err := bls.PublicKeyFromBytes(req.PublicKey)
+		if err != nil {
+			t.Fatalf("Signed for an invalid public key: %v", err)
+		}
+		if !sig.Verify(pk, req.SigningRoot) {
+			t.Fatal("Signature does not verify against the public key")
+		}
+	})
+}
@@ -0,0 +1,34 @@
+/*
+Package jsoncodec registers a gRPC codec encoding messages as JSON. It is
+used by the hand written gRPC services of the remote signer, whose messages
+are plain Go structs rather than protobufs, which keeps them easy to extend
+and to call from scripts.
+*/
+package jsoncodec
+
+import (
+	"encoding/json"
+
+	"google.golang.org/grpc/encoding"
+)
+
+// Name is the gRPC content-subtype of the JSON codec.
+const Name = "json"
+
+func init() {
+	encoding.RegisterCodec(codec{})
+}
+
+type codec struct{}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (codec) Name() string {
+	return Name
+}
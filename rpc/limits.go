@@ -0,0 +1,139 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"time"
+
+	validatorpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1/validator-client"
+	"github.com/prysmaticlabs/remote-signer/ratelimit"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// retryAfterKey is the trailer telling rate limited callers how many
+// milliseconds to wait before retrying.
+const retryAfterKey = "retry-after-ms"
+
+// concurrencyRetryAfter is the retry hint of sign requests refused
+// because too many are being served at once.
+const concurrencyRetryAfter = 100 * time.Millisecond
+
+// Limits of the requests served to the callers of the remote signer and
+// admin APIs, so that a misbehaving client cannot starve the others.
+// Zero values disable a limit.
+type Limits struct {
+	// ClientRate is the number of requests per second of each client, by
+	// token, TLS client certificate, Unix socket user or else IP address,
+	// with bursts of up to ClientBurst requests.
+	ClientRate  float64
+	ClientBurst int
+	// KeyRate is the number of sign requests per second for each public
+	// key, with bursts of up to KeyBurst requests.
+	KeyRate  float64
+	KeyBurst int
+	// MaxConcurrentSigns caps the number of sign requests served at once.
+	MaxConcurrentSigns int
+}
+
+// limiter enforces limits, failing requests beyond them with the
+// ResourceExhausted code and a retry hint.
+type limiter struct {
+	perClient *ratelimit.Limiter
+	perKey    *ratelimit.Limiter
+	signSlots chan struct{}
+}
+
+func newLimiter(l *Limits) *limiter {
+	lim := &limiter{}
+	if l.ClientRate > 0 {
+		lim.perClient = ratelimit.New(l.ClientRate, l.ClientBurst)
+	}
+	if l.KeyRate > 0 {
+		lim.perKey = ratelimit.New(l.KeyRate, l.KeyBurst)
+	}
+	if l.MaxConcurrentSigns > 0 {
+		lim.signSlots = make(chan struct{}, l.MaxConcurrentSigns)
+	}
+	return lim
+}
+
+func (l *limiter) unaryInterceptor(
+	ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if _, ok := methodScope(info.FullMethod); !ok {
+		return handler(ctx, req)
+	}
+	if l.perClient != nil {
+		if ok, wait := l.perClient.Allow(limitKey(ctx)); !ok {
+			return nil, exhausted(ctx, "client", info.FullMethod, wait)
+		}
+	}
+	signReq, ok := req.(*validatorpb.SignRequest)
+	if !ok {
+		return handler(ctx, req)
+	}
+	if l.perKey != nil {
+		if ok, wait := l.perKey.Allow(string(signReq.PublicKey)); !ok {
+			return nil, exhausted(ctx, "key", info.FullMethod, wait)
+		}
+	}
+	if l.signSlots != nil {
+		select {
+		case l.signSlots <- struct{}{}:
+		default:
+			return nil, exhausted(ctx, "concurrency", info.FullMethod, concurrencyRetryAfter)
+		}
+		concurrentSignRequests.Inc()
+		defer func() {
+			concurrentSignRequests.Dec()
+			<-l.signSlots
+		}()
+	}
+	return handler(ctx, req)
+}
+
+// limitKey identifies the client of a request for rate limiting. Clients
+// without an identity of their own are told apart by IP address.
+func limitKey(ctx context.Context) string {
+	id := clientIdentity(ctx)
+	if id != "" && id != "tls" && id != "unix" {
+		return id
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return id
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// exhausted records a request refused by a limit, and returns its error
+// along with a trailer telling when to retry.
+func exhausted(ctx context.Context, limit, method string, wait time.Duration) error {
+	rateLimitedRequestsTotal.WithLabelValues(limit).Inc()
+	retryAfter := wait.Round(time.Millisecond)
+	if retryAfter < time.Millisecond {
+		retryAfter = time.Millisecond
+	}
+	if err := grpc.SetTrailer(ctx, metadata.Pairs(
+		retryAfterKey, strconv.FormatInt(retryAfter.Milliseconds(), 10),
+	)); err != nil {
+		log.WithError(err).Debug("Could not set retry hint")
+	}
+	requestLog(ctx).WithFields(logrus.Fields{
+		"client":     clientIdentity(ctx),
+		"method":     method,
+		"limit":      limit,
+		"retryAfter": retryAfter,
+	}).Debug("Rate limited request")
+	return status.Errorf(codes.ResourceExhausted, "Exceeded %s limit, retry after %v", limit, retryAfter)
+}
@@ -0,0 +1,84 @@
+package rpc
+
+import (
+	"context"
+	"testing"
+
+	validatorpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1/validator-client"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+var signInfo = &grpc.UnaryServerInfo{FullMethod: "/" + remoteSignerService + "/Sign"}
+
+func signed(context.Context, interface{}) (interface{}, error) {
+	return &validatorpb.SignResponse{Status: validatorpb.SignResponse_SUCCEEDED}, nil
+}
+
+func TestLimiter_PerClient(t *testing.T) {
+	l := newLimiter(&Limits{ClientRate: 1, ClientBurst: 2})
+	clientCtx := func(uid uint32) context.Context {
+		return peer.NewContext(context.Background(), &peer.Peer{
+			AuthInfo: &unixPeerInfo{known: true, UID: uid},
+		})
+	}
+	req := &validatorpb.SignRequest{PublicKey: make([]byte, 48)}
+	for i := 0; i < 2; i++ {
+		if _, err := l.unaryInterceptor(clientCtx(1000), req, signInfo, signed); err != nil {
+			t.Fatalf("Wanted request %d of the burst served, received %v", i, err)
+		}
+	}
+	_, err := l.unaryInterceptor(clientCtx(1000), req, signInfo, signed)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Wanted ResourceExhausted, received %v", err)
+	}
+	if _, err := l.unaryInterceptor(clientCtx(1001), req, signInfo, signed); err != nil {
+		t.Errorf("Wanted other client served, received %v", err)
+	}
+}
+
+func TestLimiter_PerKey(t *testing.T) {
+	l := newLimiter(&Limits{KeyRate: 1, KeyBurst: 1})
+	first, second := [48]byte{1}, [48]byte{2}
+	ctx := context.Background()
+	if _, err := l.unaryInterceptor(ctx, &validatorpb.SignRequest{PublicKey: first[:]}, signInfo, signed); err != nil {
+		t.Fatal(err)
+	}
+	_, err := l.unaryInterceptor(ctx, &validatorpb.SignRequest{PublicKey: first[:]}, signInfo, signed)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Wanted ResourceExhausted, received %v", err)
+	}
+	if _, err := l.unaryInterceptor(ctx, &validatorpb.SignRequest{PublicKey: second[:]}, signInfo, signed); err != nil {
+		t.Errorf("Wanted other key served, received %v", err)
+	}
+}
+
+func TestLimiter_MaxConcurrentSigns(t *testing.T) {
+	l := newLimiter(&Limits{MaxConcurrentSigns: 1})
+	req := &validatorpb.SignRequest{PublicKey: make([]byte, 48)}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		_, err := l.unaryInterceptor(context.Background(), req, signInfo, func(context.Context, interface{}) (interface{}, error) {
+			close(started)
+			<-release
+			return nil, nil
+		})
+		done <- err
+	}()
+	<-started
+	_, err := l.unaryInterceptor(context.Background(), req, signInfo, signed)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Wanted ResourceExhausted while at capacity, received %v", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.unaryInterceptor(context.Background(), req, signInfo, signed); err != nil {
+		t.Errorf("Wanted request served once a slot is free, received %v", err)
+	}
+}
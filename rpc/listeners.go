@@ -0,0 +1,85 @@
+package rpc
+
+import (
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultUnixSocketMode only lets the owner and group of the Unix socket
+// connect to it.
+const DefaultUnixSocketMode os.FileMode = 0660
+
+// listenTCP listens on every TCP address, closing the listeners
+// already opened if any address cannot be bound.
+func listenTCP(addresses []string) ([]net.Listener, error) {
+	listeners := make([]net.Listener, 0, len(addresses))
+	for _, address := range addresses {
+		lis, err := net.Listen("tcp", address)
+		if err != nil {
+			closeListeners(listeners)
+			return nil, errors.Wrapf(err, "could not listen on %s", address)
+		}
+		listeners = append(listeners, lis)
+	}
+	return listeners, nil
+}
+
+// listenUnix listens on a Unix domain socket, whose file permissions
+// restrict which local users may connect. A stale socket left by a
+// previous run is removed, but no other kind of file is.
+func listenUnix(path string, mode os.FileMode, group string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, errors.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, errors.Wrapf(err, "could not remove stale socket %s", path)
+		}
+	}
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not listen on %s", path)
+	}
+	if err := restrictSocket(path, mode, group); err != nil {
+		closeListeners([]net.Listener{lis})
+		return nil, err
+	}
+	return lis, nil
+}
+
+func restrictSocket(path string, mode os.FileMode, group string) error {
+	if mode == 0 {
+		mode = DefaultUnixSocketMode
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		return errors.Wrapf(err, "could not set permissions of %s", path)
+	}
+	if group == "" {
+		return nil
+	}
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		return errors.Wrapf(err, "could not find group %s", group)
+	}
+	gid, err := strconv.Atoi(g.Gid)
+	if err != nil {
+		return errors.Wrapf(err, "invalid ID of group %s", group)
+	}
+	if err := os.Chown(path, -1, gid); err != nil {
+		return errors.Wrapf(err, "could not set group of %s", path)
+	}
+	return nil
+}
+
+// closeListeners closes listeners, whose Unix socket files are removed.
+func closeListeners(listeners []net.Listener) {
+	for _, lis := range listeners {
+		if err := lis.Close(); err != nil {
+			log.WithError(err).WithField("address", lis.Addr()).Debug("Could not close listener")
+		}
+	}
+}
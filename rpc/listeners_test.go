@@ -0,0 +1,82 @@
+package rpc
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}()
+	path := filepath.Join(dir, "signer.sock")
+
+	lis, err := listenUnix(path, 0600, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Wanted socket mode 0600, received %v", info.Mode().Perm())
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Close(); err != nil {
+		t.Error(err)
+	}
+
+	// A socket left behind by a previous run is replaced.
+	if ul, ok := lis.(*net.UnixListener); ok {
+		ul.SetUnlinkOnClose(false)
+	}
+	if err := lis.Close(); err != nil {
+		t.Fatal(err)
+	}
+	lis, err = listenUnix(path, 0, "")
+	if err != nil {
+		t.Fatalf("Wanted stale socket replaced, received %v", err)
+	}
+	closeListeners([]net.Listener{lis})
+
+	// Other files are never removed.
+	if err := ioutil.WriteFile(path, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listenUnix(path, 0, ""); err == nil {
+		t.Error("Wanted error listening on a regular file, received nil")
+	}
+}
+
+func TestListenTCP_ClosesOnError(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeListeners([]net.Listener{busy})
+	if _, err := listenTCP([]string{"127.0.0.1:0", busy.Addr().String()}); err == nil {
+		t.Fatal("Wanted error listening on a bound address, received nil")
+	}
+
+	listeners, err := listenTCP([]string{"127.0.0.1:0", "127.0.0.1:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeListeners(listeners)
+	if len(listeners) != 2 {
+		t.Errorf("Wanted 2 listeners, received %d", len(listeners))
+	}
+}
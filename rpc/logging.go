@@ -0,0 +1,123 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	validatorpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1/validator-client"
+	"github.com/prysmaticlabs/remote-signer/logging"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// maxRequestIDLength bounds the correlation IDs accepted from callers, so
+// that they cannot bloat the logs.
+const maxRequestIDLength = 64
+
+// requestLogger tags every request with a correlation ID, taken from the
+// x-request-id metadata of the caller or else generated, and returned in
+// the response header. Sign requests are logged at debug level with their
+// public key, type and slot or epoch, never their signing root or any key
+// material.
+func requestLogger(
+	ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+) (interface{}, error) {
+	id := incomingRequestID(ctx)
+	if id == "" {
+		id = logging.NewRequestID()
+	}
+	ctx = logging.WithRequestID(ctx, id)
+	if err := grpc.SetHeader(ctx, metadata.Pairs(logging.RequestIDKey, id)); err != nil {
+		log.WithError(err).Debug("Could not set request ID header")
+	}
+	signReq, ok := req.(*validatorpb.SignRequest)
+	if !ok {
+		return handler(ctx, req)
+	}
+	start := time.Now()
+	res, err := handler(ctx, req)
+	requestLog(ctx).WithFields(signRequestFields(signReq)).WithFields(logrus.Fields{
+		"client":   clientIdentity(ctx),
+		"code":     status.Code(err).String(),
+		"duration": time.Since(start),
+	}).Debug("Served sign request")
+	return res, err
+}
+
+// incomingRequestID returns the correlation ID sent by the caller, if any.
+func incomingRequestID(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	ids := md.Get(logging.RequestIDKey)
+	if len(ids) == 0 || len(ids[0]) > maxRequestIDLength {
+		return ""
+	}
+	return ids[0]
+}
+
+// requestLog returns the logger of a request, tagged with its correlation ID.
+func requestLog(ctx context.Context) logrus.FieldLogger {
+	if id, ok := logging.RequestID(ctx); ok {
+		return log.WithField("requestID", id)
+	}
+	return log
+}
+
+// signRequestFields describes a sign request for the logs.
+func signRequestFields(req *validatorpb.SignRequest) logrus.Fields {
+	fields := logrus.Fields{"publicKey": fmt.Sprintf("%#x", req.PublicKey)}
+	switch o := req.Object.(type) {
+	case *validatorpb.SignRequest_Block:
+		fields["type"] = "block"
+		if o.Block != nil {
+			fields["slot"] = o.Block.Slot
+		}
+	case *validatorpb.SignRequest_BlockV2:
+		fields["type"] = "block"
+		if o.BlockV2 != nil {
+			fields["slot"] = o.BlockV2.Slot
+		}
+	case *validatorpb.SignRequest_AttestationData:
+		fields["type"] = "attestation"
+		if o.AttestationData != nil {
+			fields["slot"] = o.AttestationData.Slot
+		}
+	case *validatorpb.SignRequest_AggregateAttestationAndProof:
+		fields["type"] = "aggregate_and_proof"
+		agg := o.AggregateAttestationAndProof
+		if agg != nil && agg.Aggregate != nil && agg.Aggregate.Data != nil {
+			fields["slot"] = agg.Aggregate.Data.Slot
+		}
+	case *validatorpb.SignRequest_Exit:
+		fields["type"] = "exit"
+		if o.Exit != nil {
+			fields["epoch"] = o.Exit.Epoch
+		}
+	case *validatorpb.SignRequest_Slot:
+		fields["type"] = "selection_proof"
+		fields["slot"] = o.Slot
+	case *validatorpb.SignRequest_Epoch:
+		fields["type"] = "randao_reveal"
+		fields["epoch"] = o.Epoch
+	case *validatorpb.SignRequest_SyncAggregatorSelectionData:
+		fields["type"] = "sync_aggregator_selection"
+		if o.SyncAggregatorSelectionData != nil {
+			fields["slot"] = o.SyncAggregatorSelectionData.Slot
+		}
+	case *validatorpb.SignRequest_ContributionAndProof:
+		fields["type"] = "sync_contribution_and_proof"
+		if o.ContributionAndProof != nil && o.ContributionAndProof.Contribution != nil {
+			fields["slot"] = o.ContributionAndProof.Contribution.Slot
+		}
+	case *validatorpb.SignRequest_SyncMessageBlockRoot:
+		fields["type"] = "sync_committee_message"
+	default:
+		fields["type"] = "unknown"
+	}
+	return fields
+}
@@ -0,0 +1,49 @@
+package rpc
+
+import (
+	"context"
+	"testing"
+
+	validatorpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1/validator-client"
+	"github.com/prysmaticlabs/remote-signer/logging"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestRequestLogger_RequestID(t *testing.T) {
+	req := &validatorpb.SignRequest{PublicKey: make([]byte, 48)}
+	var received string
+	handler := func(ctx context.Context, _ interface{}) (interface{}, error) {
+		received, _ = logging.RequestID(ctx)
+		return nil, nil
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(logging.RequestIDKey, "abc123"))
+	if _, err := requestLogger(ctx, req, signInfo, handler); err != nil {
+		t.Fatal(err)
+	}
+	if received != "abc123" {
+		t.Errorf("Wanted request ID of the caller, received %q", received)
+	}
+
+	if _, err := requestLogger(context.Background(), req, signInfo, handler); err != nil {
+		t.Fatal(err)
+	}
+	if received == "" || received == "abc123" {
+		t.Errorf("Wanted generated request ID, received %q", received)
+	}
+}
+
+func TestSignRequestFields(t *testing.T) {
+	req := &validatorpb.SignRequest{
+		PublicKey:   []byte{0xab},
+		SigningRoot: []byte{0xcd},
+		Object:      &validatorpb.SignRequest_Slot{Slot: 42},
+	}
+	fields := signRequestFields(req)
+	if fields["type"] != "selection_proof" || fields["publicKey"] != "0xab" {
+		t.Errorf("Unexpected fields %v", fields)
+	}
+	if len(fields) != 3 {
+		t.Errorf("Wanted only public key, type and slot, received %v", fields)
+	}
+}
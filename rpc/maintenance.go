@@ -0,0 +1,79 @@
+package rpc
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	validatorpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1/validator-client"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Maintenance is the read-only mode of a server, in which public keys are
+// still listed but every sign request fails as unavailable, such as while
+// migrating keys, exporting the slashing protection history or decommissioning
+// a signer, without tearing down the connections of validator clients.
+type Maintenance struct {
+	lock    sync.RWMutex
+	enabled bool
+	reason  string
+	since   time.Time
+}
+
+// NewMaintenance instantiates a maintenance mode, initially disabled.
+func NewMaintenance() *Maintenance {
+	return &Maintenance{}
+}
+
+// Enable the maintenance mode for a reason, returned to the callers of Sign.
+func (m *Maintenance) Enable(reason string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if !m.enabled {
+		m.since = time.Now()
+	}
+	m.enabled = true
+	m.reason = reason
+	log.WithField("reason", reason).Warn("Entered maintenance mode, sign requests are refused")
+}
+
+// Disable the maintenance mode.
+func (m *Maintenance) Disable() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if !m.enabled {
+		return
+	}
+	m.enabled = false
+	m.reason = ""
+	m.since = time.Time{}
+	log.Info("Left maintenance mode, sign requests are served")
+}
+
+// Status returns whether the maintenance mode is enabled, why and since when.
+func (m *Maintenance) Status() (enabled bool, reason string, since time.Time) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.enabled, m.reason, m.since
+}
+
+// maintenanceSigner wraps a remote signer service, failing every
+// sign request while the server is in maintenance mode.
+type maintenanceSigner struct {
+	validatorpb.RemoteSignerServer
+	maintenance *Maintenance
+}
+
+// Sign fails with the Unavailable code in maintenance mode, so that clients
+// fail over to another signer or retry later, and signs otherwise.
+func (m *maintenanceSigner) Sign(ctx context.Context, req *validatorpb.SignRequest) (*validatorpb.SignResponse, error) {
+	if enabled, reason, _ := m.maintenance.Status(); enabled {
+		res := &validatorpb.SignResponse{
+			Status: validatorpb.SignResponse_FAILED,
+		}
+		recordSignRequest(res, nil)
+		return res, status.Errorf(codes.Unavailable, "Remote signer is in maintenance mode: %s", reason)
+	}
+	return m.RemoteSignerServer.Sign(ctx, req)
+}
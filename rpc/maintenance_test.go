@@ -0,0 +1,56 @@
+package rpc
+
+import (
+	"context"
+	"testing"
+
+	emptypb "github.com/golang/protobuf/ptypes/empty"
+	"github.com/prysmaticlabs/prysm/crypto/bls"
+	validatorpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1/validator-client"
+	"github.com/prysmaticlabs/remote-signer/rpc/admin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMaintenanceSigner(t *testing.T) {
+	ctx := context.Background()
+	pubKey := randKey().PublicKey()
+	vault := &mockKeyVault{pubKeys: []bls.PublicKey{pubKey}}
+	m := NewMaintenance()
+	s := &maintenanceSigner{RemoteSignerServer: NewRemoteSigner(ctx, vault), maintenance: m}
+	a := NewAdminServer(vault, WithMaintenanceMode(m))
+	req := &validatorpb.SignRequest{
+		PublicKey:   pubKey.Marshal(),
+		SigningRoot: make([]byte, 32),
+	}
+
+	if _, err := a.SetMaintenance(ctx, &admin.SetMaintenanceRequest{Enabled: true}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Wanted InvalidArgument without a reason, received %v", err)
+	}
+	res, err := a.SetMaintenance(ctx, &admin.SetMaintenanceRequest{Enabled: true, Reason: "key migration"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Maintenance.Enabled || res.Maintenance.Since == nil {
+		t.Errorf("Wanted maintenance mode enabled, received %+v", res.Maintenance)
+	}
+	signRes, err := s.Sign(ctx, req)
+	if status.Code(err) != codes.Unavailable || signRes.Status != validatorpb.SignResponse_FAILED {
+		t.Errorf("Wanted Unavailable in maintenance mode, received %v, %v", signRes.Status, err)
+	}
+	keys, err := s.ListValidatingPublicKeys(ctx, &emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys.ValidatingPublicKeys) != 1 {
+		t.Errorf("Wanted keys listed in maintenance mode, received %d", len(keys.ValidatingPublicKeys))
+	}
+
+	if _, err := a.SetMaintenance(ctx, &admin.SetMaintenanceRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	signRes, err = s.Sign(ctx, req)
+	if err != nil || signRes.Status != validatorpb.SignResponse_SUCCEEDED {
+		t.Errorf("Wanted request signed after maintenance, received %v, %v", signRes.Status, err)
+	}
+}
@@ -0,0 +1,58 @@
+package rpc
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	validatorpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1/validator-client"
+	"github.com/prysmaticlabs/remote-signer/keyvault"
+)
+
+var (
+	signRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "remote_signer_sign_requests_total",
+			Help: "Number of sign requests handled, by response status and key source and label.",
+		},
+		[]string{"status", "source", "label"},
+	)
+	validatingKeys = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "remote_signer_validating_keys",
+			Help: "Number of validating keys held by the keyvault, by key source.",
+		},
+		[]string{"source"},
+	)
+	rateLimitedRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "remote_signer_rate_limited_requests_total",
+			Help: "Number of requests refused by a rate or concurrency limit, by limit.",
+		},
+		[]string{"limit"},
+	)
+	concurrentSignRequests = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "remote_signer_concurrent_sign_requests",
+		Help: "Number of sign requests being served, when concurrent sign requests are capped.",
+	})
+)
+
+// recordSignRequest records the outcome of a sign request. The key
+// metadata is nil if the request failed before the key was resolved.
+func recordSignRequest(res *validatorpb.SignResponse, meta *keyvault.KeyMetadata) {
+	status := validatorpb.SignResponse_UNKNOWN
+	if res != nil {
+		status = res.Status
+	}
+	source, label := "", ""
+	if meta != nil {
+		source, label = meta.Source, meta.Label
+	}
+	signRequestsTotal.WithLabelValues(status.String(), source, label).Inc()
+}
+
+// recordValidatingKeys updates the gauge of validating keys per source.
+func recordValidatingKeys(metadata []*keyvault.KeyMetadata) {
+	validatingKeys.Reset()
+	for _, m := range metadata {
+		validatingKeys.WithLabelValues(m.Source).Inc()
+	}
+}
@@ -0,0 +1,34 @@
+//go:build linux
+// +build linux
+
+package rpc
+
+import (
+	"net"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// peerCredentials reads the user, group and process IDs of the peer of a
+// Unix socket connection, as recorded by the kernel when it connected.
+func peerCredentials(conn *net.UnixConn) (uid, gid uint32, pid int32, err error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return 0, 0, 0, errors.Wrap(err, "could not access socket")
+	}
+	var cred *syscall.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil {
+		return 0, 0, 0, errors.Wrap(err, "could not access socket")
+	}
+	if credErr != nil {
+		return 0, 0, 0, errors.Wrap(credErr, "could not read SO_PEERCRED")
+	}
+	return cred.Uid, cred.Gid, cred.Pid, nil
+}
+
+// peerCredentialsSupported tells whether Unix socket peers can be authorized.
+const peerCredentialsSupported = true
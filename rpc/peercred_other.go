@@ -0,0 +1,19 @@
+//go:build !linux
+// +build !linux
+
+package rpc
+
+import (
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// peerCredentials is not supported on this platform, where access to the
+// Unix socket is only controlled by the permissions of its file.
+func peerCredentials(*net.UnixConn) (uid, gid uint32, pid int32, err error) {
+	return 0, 0, 0, errors.New("peer credentials are not supported on this platform")
+}
+
+// peerCredentialsSupported tells whether Unix socket peers can be authorized.
+const peerCredentialsSupported = false
@@ -0,0 +1,165 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/pkg/errors"
+	"github.com/prysmaticlabs/remote-signer/auth"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// unixCredentials secures TCP connections with TLS, and trusts connections
+// over Unix domain sockets, which are only reachable by the local users
+// allowed by the permissions of the socket file, without a TLS handshake.
+// The user and group of Unix socket peers are read from the kernel.
+type unixCredentials struct {
+	credentials.TransportCredentials
+}
+
+func newUnixCredentials(tlsCreds credentials.TransportCredentials) credentials.TransportCredentials {
+	return &unixCredentials{TransportCredentials: tlsCreds}
+}
+
+// ServerHandshake performs the TLS handshake, except for Unix socket
+// connections whose peer credentials are read instead.
+func (c *unixCredentials) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	if conn.LocalAddr().Network() != "unix" {
+		return c.TransportCredentials.ServerHandshake(conn)
+	}
+	info := &unixPeerInfo{
+		CommonAuthInfo: credentials.CommonAuthInfo{SecurityLevel: credentials.PrivacyAndIntegrity},
+	}
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return conn, info, nil
+	}
+	uid, gid, pid, err := peerCredentials(unixConn)
+	if err != nil {
+		log.WithError(err).Debug("Could not read credentials of Unix socket peer")
+		return conn, info, nil
+	}
+	info.known, info.UID, info.GID, info.PID = true, uid, gid, pid
+	return conn, info, nil
+}
+
+// ClientHandshake is not supported, the credentials are only used by the server.
+func (c *unixCredentials) ClientHandshake(
+	_ context.Context, _ string, _ net.Conn,
+) (net.Conn, credentials.AuthInfo, error) {
+	return nil, nil, errors.New("unix credentials are only supported by the server")
+}
+
+// Clone returns a copy of the credentials.
+func (c *unixCredentials) Clone() credentials.TransportCredentials {
+	return &unixCredentials{TransportCredentials: c.TransportCredentials.Clone()}
+}
+
+// unixPeerInfo identifies the process connected to the Unix socket.
+type unixPeerInfo struct {
+	credentials.CommonAuthInfo
+	// known is false on platforms where peer credentials cannot be read.
+	known bool
+	UID   uint32
+	GID   uint32
+	PID   int32
+}
+
+// AuthType returns the type of the peer information.
+func (*unixPeerInfo) AuthType() string {
+	return "unix"
+}
+
+// clientIdentity describes the caller of a request: the ID of its bearer
+// token, the subject of its TLS client certificate, or its user and group
+// on the Unix socket.
+func clientIdentity(ctx context.Context) string {
+	if token, ok := auth.FromContext(ctx); ok {
+		return "token:" + token.ID
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	switch info := p.AuthInfo.(type) {
+	case *unixPeerInfo:
+		if !info.known {
+			return "unix"
+		}
+		return fmt.Sprintf("unix:uid=%d,gid=%d", info.UID, info.GID)
+	case credentials.TLSInfo:
+		if len(info.State.VerifiedChains) > 0 && len(info.State.VerifiedChains[0]) > 0 {
+			return "tls:" + info.State.VerifiedChains[0][0].Subject.CommonName
+		}
+		return "tls"
+	default:
+		return ""
+	}
+}
+
+// peerAuthorizer only lets the users and groups of an allowlist call the
+// server over the Unix socket. TCP peers are authenticated with TLS instead.
+type peerAuthorizer struct {
+	uids map[uint32]bool
+	gids map[uint32]bool
+}
+
+func newPeerAuthorizer(uids, gids []uint32) *peerAuthorizer {
+	a := &peerAuthorizer{
+		uids: make(map[uint32]bool, len(uids)),
+		gids: make(map[uint32]bool, len(gids)),
+	}
+	for _, uid := range uids {
+		a.uids[uid] = true
+	}
+	for _, gid := range gids {
+		a.gids[gid] = true
+	}
+	return a
+}
+
+// authorize fails with the PermissionDenied code for Unix socket peers
+// whose user and primary group are not allowed, or cannot be read.
+func (a *peerAuthorizer) authorize(ctx context.Context, method string) error {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	info, ok := p.AuthInfo.(*unixPeerInfo)
+	if !ok {
+		return nil
+	}
+	if info.known && (a.uids[info.UID] || a.gids[info.GID]) {
+		return nil
+	}
+	requestLog(ctx).WithFields(logrus.Fields{
+		"client": clientIdentity(ctx),
+		"pid":    info.PID,
+		"method": method,
+	}).Warn("Denied request from Unix socket peer")
+	return status.Error(codes.PermissionDenied, "Unix socket peer is not allowed")
+}
+
+func (a *peerAuthorizer) unaryInterceptor(
+	ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if err := a.authorize(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (a *peerAuthorizer) streamInterceptor(
+	srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler,
+) error {
+	if err := a.authorize(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
@@ -0,0 +1,50 @@
+package rpc
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestPeerAuthorizer_Authorize(t *testing.T) {
+	a := newPeerAuthorizer([]uint32{1000}, []uint32{2000})
+	tests := []struct {
+		name    string
+		info    credentials.AuthInfo
+		allowed bool
+	}{
+		{name: "allowed user", info: &unixPeerInfo{known: true, UID: 1000, GID: 1}, allowed: true},
+		{name: "allowed group", info: &unixPeerInfo{known: true, UID: 1, GID: 2000}, allowed: true},
+		{name: "other user", info: &unixPeerInfo{known: true, UID: 1, GID: 1}},
+		{name: "unknown credentials", info: &unixPeerInfo{}},
+		{name: "TLS peer", info: credentials.TLSInfo{}, allowed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := peer.NewContext(context.Background(), &peer.Peer{AuthInfo: tt.info})
+			err := a.authorize(ctx, "/ethereum.validator.accounts.v2.RemoteSigner/Sign")
+			if tt.allowed && err != nil {
+				t.Errorf("Wanted request allowed, received %v", err)
+			}
+			if !tt.allowed && status.Code(err) != codes.PermissionDenied {
+				t.Errorf("Wanted PermissionDenied, received %v", err)
+			}
+		})
+	}
+}
+
+func TestClientIdentity(t *testing.T) {
+	ctx := peer.NewContext(context.Background(), &peer.Peer{
+		AuthInfo: &unixPeerInfo{known: true, UID: 1000, GID: 2000},
+	})
+	if id := clientIdentity(ctx); id != "unix:uid=1000,gid=2000" {
+		t.Errorf("Wanted unix:uid=1000,gid=2000, received %s", id)
+	}
+	if id := clientIdentity(context.Background()); id != "" {
+		t.Errorf("Wanted no identity, received %s", id)
+	}
+}
@@ -2,11 +2,23 @@ package rpc
 
 import (
 	"context"
+	"fmt"
 
 	emptypb "github.com/golang/protobuf/ptypes/empty"
+	"github.com/pkg/errors"
+	types "github.com/prysmaticlabs/eth2-types"
 	"github.com/prysmaticlabs/prysm/crypto/bls"
+	"github.com/prysmaticlabs/prysm/encoding/bytesutil"
 	validatorpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1/validator-client"
+	"github.com/prysmaticlabs/remote-signer/clock"
+	"github.com/prysmaticlabs/remote-signer/doppelganger"
+	"github.com/prysmaticlabs/remote-signer/exits"
+	"github.com/prysmaticlabs/remote-signer/ha"
 	"github.com/prysmaticlabs/remote-signer/keyvault"
+	"github.com/prysmaticlabs/remote-signer/policy"
+	"github.com/prysmaticlabs/remote-signer/slashing"
+	"github.com/prysmaticlabs/remote-signer/tracing"
+	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -16,56 +28,285 @@ const blsPublicKeyLength = 48 // 48 byte public keys.
 // RemoteSigner capable of signing requests by using
 // BLS secret keys retrieved from a keyvault.
 type RemoteSigner struct {
-	keyVault keyvault.Store
+	keyVault         keyvault.Store
+	hideDisabledKeys bool
+	doppelganger     *doppelganger.Guard
+	elector          *ha.Elector
+	protector        slashing.Protector
+	exitQueue        *exits.Queue
+	policy           *policy.Engine
+	clock            *clock.Clock
+	maxFutureSlots   types.Slot
+}
+
+// SignerOption configures optional behavior of a RemoteSigner.
+type SignerOption func(*RemoteSigner)
+
+// WithHideDisabledKeys omits disabled keys from the
+// public keys listed by ListValidatingPublicKeys.
+func WithHideDisabledKeys() SignerOption {
+	return func(r *RemoteSigner) {
+		r.hideDisabledKeys = true
+	}
+}
+
+// WithDoppelgangerGuard denies block and attestation signing
+// requests for keys on probation in the doppelganger guard.
+func WithDoppelgangerGuard(g *doppelganger.Guard) SignerOption {
+	return func(r *RemoteSigner) {
+		r.doppelganger = g
+	}
+}
+
+// WithLeaderElection only signs requests while this instance is the
+// leader of its high availability cluster, so that a single instance
+// of the cluster ever signs with the same keys.
+func WithLeaderElection(e *ha.Elector) SignerOption {
+	return func(r *RemoteSigner) {
+		r.elector = e
+	}
+}
+
+// WithSlashingProtection checks every sign request against the
+// signing history of the protector, and denies slashable ones.
+func WithSlashingProtection(p slashing.Protector) SignerOption {
+	return func(r *RemoteSigner) {
+		r.protector = p
+	}
+}
+
+// WithExitApproval holds voluntary exit signing requests in
+// the queue until operators approve them.
+func WithExitApproval(q *exits.Queue) SignerOption {
+	return func(r *RemoteSigner) {
+		r.exitQueue = q
+	}
+}
+
+// WithSigningPolicy denies the sign requests breaking the rules of
+// the policy, before the keyvault is accessed.
+func WithSigningPolicy(p *policy.Engine) SignerOption {
+	return func(r *RemoteSigner) {
+		r.policy = p
+	}
+}
+
+// WithClockCheck denies block, attestation and sync committee sign requests
+// for slots more than maxFutureSlots ahead of the wall clock.
+func WithClockCheck(c *clock.Clock, maxFutureSlots types.Slot) SignerOption {
+	return func(r *RemoteSigner) {
+		r.clock = c
+		r.maxFutureSlots = maxFutureSlots
+	}
 }
 
 // NewRemoteSigner instantiates a new server instance using
 // a keyvault for retrieving.
-func NewRemoteSigner(ctx context.Context, keyVault keyvault.Store) *RemoteSigner {
-	return &RemoteSigner{
+func NewRemoteSigner(ctx context.Context, keyVault keyvault.Store, opts ...SignerOption) *RemoteSigner {
+	r := &RemoteSigner{
 		keyVault: keyVault,
 	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
 }
 
 // Sign a remote request by retrieving the corresponding secret key for
 // the public key in the request from a keyvault. If we have already signed
-// the data in the request, we return a DENIED signing response.
-func (r *RemoteSigner) Sign(ctx context.Context, req *validatorpb.SignRequest) (*validatorpb.SignResponse, error) {
-	if req.PublicKey == nil {
-		return &validatorpb.SignResponse{
-			Status: validatorpb.SignResponse_FAILED,
-		}, status.Error(codes.InvalidArgument, "Expected public key in request")
+// the data in the request, or the key has been disabled by an operator,
+// we return a DENIED signing response.
+func (r *RemoteSigner) Sign(ctx context.Context, req *validatorpb.SignRequest) (res *validatorpb.SignResponse, err error) {
+	var meta *keyvault.KeyMetadata
+	defer func() {
+		recordSignRequest(res, meta)
+	}()
+	_, span := tracing.Start(ctx, "validate")
+	pubKey, res, err := r.validate(ctx, req)
+	tracing.End(span, err)
+	if err != nil {
+		return res, err
 	}
-	if len(req.PublicKey) != blsPublicKeyLength {
-		return &validatorpb.SignResponse{
-				Status: validatorpb.SignResponse_FAILED,
-			}, status.Errorf(
-				codes.InvalidArgument,
-				"Wrong public key byte size: %d, expected %d",
-				len(req.PublicKey),
-				blsPublicKeyLength,
-			)
+	if r.policy != nil {
+		_, span := tracing.Start(ctx, "policy.Evaluate")
+		err := r.policy.Evaluate(bytesutil.ToBytes48(req.PublicKey), req)
+		tracing.End(span, err)
+		if err != nil {
+			requestLog(ctx).WithField("publicKey", fmt.Sprintf("%#x", req.PublicKey)).WithError(err).Warn("Denied signing request by signing policy")
+			return &validatorpb.SignResponse{
+				Status: validatorpb.SignResponse_DENIED,
+			}, status.Errorf(codes.PermissionDenied, "Signing policy: %v", err)
+		}
 	}
-	pubKey, err := bls.PublicKeyFromBytes(req.PublicKey)
+	meta, err = keyvault.GetKeyMetadata(ctx, r.keyVault, pubKey)
 	if err != nil {
 		return &validatorpb.SignResponse{
 			Status: validatorpb.SignResponse_FAILED,
-		}, status.Errorf(codes.InvalidArgument, "Could not parse public key: %v", err)
+		}, status.Errorf(codes.Internal, "Could not fetch key metadata from vault: %v", err)
+	}
+	if !meta.Enabled {
+		requestLog(ctx).WithFields(metadataFields(meta)).Warn("Denied signing request for disabled key")
+		return &validatorpb.SignResponse{
+			Status: validatorpb.SignResponse_DENIED,
+		}, status.Errorf(codes.PermissionDenied, "Key is disabled: %s", meta.DisabledReason)
+	}
+	if r.doppelganger != nil {
+		if err := r.doppelganger.CheckSign(bytesutil.ToBytes48(req.PublicKey), req); err != nil {
+			requestLog(ctx).WithFields(metadataFields(meta)).WithError(err).Warn("Denied signing request by doppelganger protection")
+			return &validatorpb.SignResponse{
+				Status: validatorpb.SignResponse_DENIED,
+			}, status.Errorf(codes.PermissionDenied, "Doppelganger protection: %v", err)
+		}
 	}
+	if exit, ok := req.Object.(*validatorpb.SignRequest_Exit); ok && r.exitQueue != nil && exit.Exit != nil {
+		if err := r.exitQueue.Await(
+			ctx,
+			bytesutil.ToBytes48(req.PublicKey),
+			exit.Exit,
+			req.SignatureDomain,
+			req.SigningRoot,
+		); err != nil {
+			if errors.Is(err, exits.ErrPending) {
+				return &validatorpb.SignResponse{
+					Status: validatorpb.SignResponse_FAILED,
+				}, status.Errorf(codes.Unavailable, "Voluntary exit approval: %v", err)
+			}
+			if errors.Is(err, exits.ErrTooManyPending) {
+				requestLog(ctx).WithFields(metadataFields(meta)).WithError(err).Warn("Refused voluntary exit signing request")
+				return &validatorpb.SignResponse{
+					Status: validatorpb.SignResponse_FAILED,
+				}, status.Errorf(codes.ResourceExhausted, "Voluntary exit approval: %v", err)
+			}
+			if errors.Is(err, exits.ErrSigningRoot) {
+				requestLog(ctx).WithFields(metadataFields(meta)).WithError(err).Warn("Denied voluntary exit signing request with a wrong signing root")
+				return &validatorpb.SignResponse{
+					Status: validatorpb.SignResponse_DENIED,
+				}, status.Errorf(codes.InvalidArgument, "Voluntary exit approval: %v", err)
+			}
+			requestLog(ctx).WithFields(metadataFields(meta)).WithError(err).Warn("Denied voluntary exit signing request")
+			return &validatorpb.SignResponse{
+				Status: validatorpb.SignResponse_DENIED,
+			}, status.Errorf(codes.PermissionDenied, "Voluntary exit approval: %v", err)
+		}
+	}
+	_, span = tracing.Start(ctx, "keyvault.GetSecretKey")
 	secretKey, err := r.keyVault.GetSecretKey(ctx, pubKey)
+	tracing.End(span, err)
 	if err != nil {
 		return &validatorpb.SignResponse{
 			Status: validatorpb.SignResponse_FAILED,
 		}, status.Errorf(codes.Internal, "Could not fetch secret key from vault: %v", err)
 	}
-	// TODO: Handle naive slashing protection.
+	// The leader may have been paused since it was validated, for longer
+	// than its lock lasts, so leadership is checked again before writing.
+	fence, res, err := r.fence(ctx)
+	if err != nil {
+		return res, err
+	}
+	if r.protector != nil {
+		if err := slashing.VerifySigningRoot(req); err != nil {
+			requestLog(ctx).WithFields(metadataFields(meta)).WithError(err).Warn("Denied signing request with a wrong signing root")
+			return &validatorpb.SignResponse{
+				Status: validatorpb.SignResponse_DENIED,
+			}, status.Errorf(codes.InvalidArgument, "Slashing protection: %v", err)
+		}
+		protectCtx, span := tracing.Start(slashing.WithFence(ctx, fence), "slashing.CheckAndRecord")
+		err := r.protector.CheckAndRecord(protectCtx, bytesutil.ToBytes48(req.PublicKey), req)
+		tracing.End(span, err)
+		if err != nil {
+			if errors.Is(err, slashing.ErrSlashable) {
+				requestLog(ctx).WithFields(metadataFields(meta)).WithError(err).Warn("Denied slashable signing request")
+				return &validatorpb.SignResponse{
+					Status: validatorpb.SignResponse_DENIED,
+				}, status.Errorf(codes.PermissionDenied, "Slashing protection: %v", err)
+			}
+			return &validatorpb.SignResponse{
+				Status: validatorpb.SignResponse_FAILED,
+			}, status.Errorf(codes.Unavailable, "Could not record signing history: %v", err)
+		}
+	}
+	if r.elector != nil {
+		current, res, err := r.fence(ctx)
+		if err != nil {
+			return res, err
+		}
+		if current != fence {
+			return &validatorpb.SignResponse{
+				Status: validatorpb.SignResponse_FAILED,
+			}, status.Error(codes.Unavailable, "Not the leader of the remote signer cluster")
+		}
+	}
+	requestLog(ctx).WithFields(metadataFields(meta)).WithField("client", clientIdentity(ctx)).Debug("Signing request")
+	_, span = tracing.Start(ctx, "bls.Sign")
 	sig := secretKey.Sign(req.SigningRoot)
+	tracing.End(span, nil)
 	return &validatorpb.SignResponse{
 		Signature: sig.Marshal(),
 		Status:    validatorpb.SignResponse_SUCCEEDED,
 	}, nil
 }
 
+// fence returns the fencing token of this signer as the leader of its high
+// availability cluster, once the leader lock is confirmed to still be held,
+// or 0 without high availability. It returns the response and error to fail
+// the request with if this signer is not the leader.
+func (r *RemoteSigner) fence(ctx context.Context) (uint64, *validatorpb.SignResponse, error) {
+	if r.elector == nil {
+		return 0, nil, nil
+	}
+	_, span := tracing.Start(ctx, "ha.Fence")
+	token, err := r.elector.Fence(ctx)
+	tracing.End(span, err)
+	if err != nil {
+		requestLog(ctx).WithError(err).Warn("Denied signing request while not the leader")
+		return 0, &validatorpb.SignResponse{
+			Status: validatorpb.SignResponse_FAILED,
+		}, status.Error(codes.Unavailable, "Not the leader of the remote signer cluster")
+	}
+	return token, nil, nil
+}
+
+// validate checks that a sign request can be served by this signer, and
+// parses its public key. It returns the response and error to fail the
+// request with, if any.
+func (r *RemoteSigner) validate(ctx context.Context, req *validatorpb.SignRequest) (bls.PublicKey, *validatorpb.SignResponse, error) {
+	if r.elector != nil && !r.elector.IsLeader() {
+		return nil, &validatorpb.SignResponse{
+			Status: validatorpb.SignResponse_FAILED,
+		}, status.Error(codes.Unavailable, "Not the leader of the remote signer cluster")
+	}
+	if req.PublicKey == nil {
+		return nil, &validatorpb.SignResponse{
+			Status: validatorpb.SignResponse_FAILED,
+		}, status.Error(codes.InvalidArgument, "Expected public key in request")
+	}
+	if len(req.PublicKey) != blsPublicKeyLength {
+		return nil, &validatorpb.SignResponse{
+			Status: validatorpb.SignResponse_FAILED,
+		}, status.Errorf(
+			codes.InvalidArgument,
+			"Wrong public key byte size: %d, expected %d",
+			len(req.PublicKey),
+			blsPublicKeyLength,
+		)
+	}
+	pubKey, err := bls.PublicKeyFromBytes(req.PublicKey)
+	if err != nil {
+		return nil, &validatorpb.SignResponse{
+			Status: validatorpb.SignResponse_FAILED,
+		}, status.Errorf(codes.InvalidArgument, "Could not parse public key: %v", err)
+	}
+	if r.clock != nil {
+		if err := r.clock.CheckSignRequest(req, r.maxFutureSlots); err != nil {
+			requestLog(ctx).WithField("publicKey", fmt.Sprintf("%#x", req.PublicKey)).WithError(err).Warn("Denied signing request ahead of the wall clock")
+			return nil, &validatorpb.SignResponse{
+				Status: validatorpb.SignResponse_DENIED,
+			}, status.Errorf(codes.PermissionDenied, "Wall clock check: %v", err)
+		}
+	}
+	return pubKey, nil, nil
+}
+
 // ListValidatingPublicKeys retrieves the BLS public keys
 // available for signing in the remote signer.
 func (r *RemoteSigner) ListValidatingPublicKeys(
@@ -75,11 +316,38 @@ func (r *RemoteSigner) ListValidatingPublicKeys(
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "Could not retrieve public keys: %v", err)
 	}
-	rawKeys := make([][]byte, len(pubKeys))
-	for i, k := range pubKeys {
-		rawKeys[i] = k.Marshal()
+	rawKeys := make([][]byte, 0, len(pubKeys))
+	for _, k := range pubKeys {
+		if r.hideDisabledKeys {
+			meta, err := keyvault.GetKeyMetadata(ctx, r.keyVault, k)
+			if err != nil {
+				return nil, status.Errorf(codes.Internal, "Could not retrieve key metadata: %v", err)
+			}
+			if !meta.Enabled {
+				continue
+			}
+		}
+		rawKeys = append(rawKeys, k.Marshal())
 	}
 	return &validatorpb.ListPublicKeysResponse{
 		ValidatingPublicKeys: rawKeys,
 	}, nil
 }
+
+// metadataFields returns the log fields describing a key.
+func metadataFields(m *keyvault.KeyMetadata) logrus.Fields {
+	fields := logrus.Fields{
+		"publicKey": fmt.Sprintf("%#x", m.PublicKey.Marshal()),
+		"source":    m.Source,
+	}
+	if m.Label != "" {
+		fields["label"] = m.Label
+	}
+	if m.ValidatorIndex != nil {
+		fields["validatorIndex"] = *m.ValidatorIndex
+	}
+	if m.DerivationPath != "" {
+		fields["derivationPath"] = m.DerivationPath
+	}
+	return fields
+}
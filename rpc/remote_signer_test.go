@@ -3,14 +3,34 @@ package rpc
 import (
 	"bytes"
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	emptypb "github.com/golang/protobuf/ptypes/empty"
+	types "github.com/prysmaticlabs/eth2-types"
 	"github.com/prysmaticlabs/prysm/crypto/bls"
+	ethpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1"
 	validatorpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1/validator-client"
+	"github.com/prysmaticlabs/remote-signer/clock"
+	"github.com/prysmaticlabs/remote-signer/doppelganger"
+	"github.com/prysmaticlabs/remote-signer/exits"
+	"github.com/prysmaticlabs/remote-signer/ha"
 	"github.com/prysmaticlabs/remote-signer/keyvault"
+	"github.com/prysmaticlabs/remote-signer/keyvault/deterministic"
+	"github.com/prysmaticlabs/remote-signer/policy"
+	"github.com/prysmaticlabs/remote-signer/rpc/admin"
+	"github.com/prysmaticlabs/remote-signer/slashing"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type mockKeyVault struct {
@@ -32,6 +52,23 @@ func (m *mockKeyVault) GetPublicKeys(context.Context) ([]bls.PublicKey, error) {
 	return m.pubKeys, nil
 }
 
+func (m *mockKeyVault) Close() error {
+	return nil
+}
+
+// disabledKeyVault reports every key as disabled.
+type disabledKeyVault struct {
+	mockKeyVault
+}
+
+func (d *disabledKeyVault) GetKeyMetadata(_ context.Context, pubKey bls.PublicKey) (*keyvault.KeyMetadata, error) {
+	return &keyvault.KeyMetadata{
+		PublicKey:      pubKey,
+		Enabled:        false,
+		DisabledReason: "incident",
+	}, nil
+}
+
 func TestRemoteSigner_Sign(t *testing.T) {
 	ctx := context.Background()
 	badPubKey := make([]byte, blsPublicKeyLength)
@@ -90,6 +127,16 @@ func TestRemoteSigner_Sign(t *testing.T) {
 			want:    validatorpb.SignResponse_FAILED,
 			wantErr: true,
 		},
+		{
+			name:     "Denies with disabled key",
+			keyVault: &disabledKeyVault{},
+			req: &validatorpb.SignRequest{
+				PublicKey:   randKey().PublicKey().Marshal(),
+				SigningRoot: make([]byte, 32),
+			},
+			want:    validatorpb.SignResponse_DENIED,
+			wantErr: true,
+		},
 		{
 			name:     "Succeeds with proper request",
 			keyVault: &mockKeyVault{},
@@ -155,6 +202,360 @@ func TestRemoteSigner_ListValidatingPublicKeys(t *testing.T) {
 	}
 }
 
+func TestRemoteSigner_ListValidatingPublicKeys_HideDisabledKeys(t *testing.T) {
+	ctx := context.Background()
+	keys := []bls.PublicKey{randKey().PublicKey()}
+	vault := &disabledKeyVault{mockKeyVault{pubKeys: keys}}
+	r := NewRemoteSigner(ctx, vault)
+	res, err := r.ListValidatingPublicKeys(ctx, &emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.ValidatingPublicKeys) != 1 {
+		t.Errorf("Wanted disabled key to be listed, received %d keys", len(res.ValidatingPublicKeys))
+	}
+	r = NewRemoteSigner(ctx, vault, WithHideDisabledKeys())
+	res, err = r.ListValidatingPublicKeys(ctx, &emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.ValidatingPublicKeys) != 0 {
+		t.Errorf("Wanted disabled key to be hidden, received %d keys", len(res.ValidatingPublicKeys))
+	}
+}
+
+func TestRemoteSigner_Sign_DoppelgangerGuard(t *testing.T) {
+	ctx := context.Background()
+	guard, err := doppelganger.NewGuard(&doppelganger.Config{
+		Checker: doppelganger.NewFakeLivenessChecker(),
+		Clock:   clock.New(time.Now(), clock.DefaultSecondsPerSlot, clock.DefaultSlotsPerEpoch),
+		Epochs:  2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey := randKey().PublicKey()
+	guard.Register([]bls.PublicKey{pubKey})
+	r := NewRemoteSigner(ctx, &mockKeyVault{}, WithDoppelgangerGuard(guard))
+
+	res, err := r.Sign(ctx, &validatorpb.SignRequest{
+		PublicKey:   pubKey.Marshal(),
+		SigningRoot: make([]byte, 32),
+		Object:      &validatorpb.SignRequest_AttestationData{},
+	})
+	if err == nil || res.Status != validatorpb.SignResponse_DENIED {
+		t.Errorf("Wanted attestation to be denied, received %v, %v", res.Status, err)
+	}
+	res, err = r.Sign(ctx, &validatorpb.SignRequest{
+		PublicKey:   pubKey.Marshal(),
+		SigningRoot: make([]byte, 32),
+		Object:      &validatorpb.SignRequest_Exit{},
+	})
+	if err != nil || res.Status != validatorpb.SignResponse_SUCCEEDED {
+		t.Errorf("Wanted exit to be signed, received %v, %v", res.Status, err)
+	}
+}
+
+func TestRemoteSigner_Sign_Follower(t *testing.T) {
+	ctx := context.Background()
+	// The elector is never run, so this instance never becomes the leader.
+	elector, err := ha.NewElector(&ha.Config{Provider: ha.NewFileLock("leader.lock")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewRemoteSigner(ctx, &mockKeyVault{}, WithLeaderElection(elector))
+	res, err := r.Sign(ctx, &validatorpb.SignRequest{
+		PublicKey:   randKey().PublicKey().Marshal(),
+		SigningRoot: make([]byte, 32),
+	})
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("Wanted Unavailable, received %v", err)
+	}
+	if res.Status != validatorpb.SignResponse_FAILED {
+		t.Errorf("Wanted %v, received %v", validatorpb.SignResponse_FAILED, res.Status)
+	}
+}
+
+// expiringLock is a lock provider whose lock can expire without the
+// elector noticing, as when the leader is paused for longer than it lasts.
+type expiringLock struct {
+	lock sync.Mutex
+	held bool
+}
+
+func (e *expiringLock) Acquire(context.Context) (uint64, <-chan struct{}, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.held = true
+	return 1, make(chan struct{}), nil
+}
+
+func (e *expiringLock) Check(context.Context, uint64) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if !e.held {
+		return errors.New("lock expired")
+	}
+	return nil
+}
+
+func (e *expiringLock) Release(context.Context) error {
+	e.expire()
+	return nil
+}
+
+func (e *expiringLock) expire() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.held = false
+}
+
+// expiringProtector records every request, while the lock of the leader expires.
+type expiringProtector struct {
+	lock *expiringLock
+}
+
+func (p expiringProtector) CheckAndRecord(context.Context, [48]byte, *validatorpb.SignRequest) error {
+	p.lock.expire()
+	return nil
+}
+
+func TestRemoteSigner_Sign_FencedLeader(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	lock := &expiringLock{}
+	elector, err := ha.NewElector(&ha.Config{Provider: lock})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		elector.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	for !elector.IsLeader() {
+		time.Sleep(time.Millisecond)
+	}
+
+	r := NewRemoteSigner(ctx, &mockKeyVault{}, WithLeaderElection(elector), WithSlashingProtection(expiringProtector{lock}))
+	res, err := r.Sign(ctx, &validatorpb.SignRequest{
+		PublicKey:   randKey().PublicKey().Marshal(),
+		SigningRoot: make([]byte, 32),
+	})
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("Wanted Unavailable, received %v", err)
+	}
+	if res.Status != validatorpb.SignResponse_FAILED || res.Signature != nil {
+		t.Errorf("Wanted no signature, received %v", res)
+	}
+}
+
+// mockProtector denies every request as slashable.
+type mockProtector struct{}
+
+func (mockProtector) CheckAndRecord(context.Context, [48]byte, *validatorpb.SignRequest) error {
+	return slashing.ErrSlashable
+}
+
+// attesterDomain returns a domain of the attester domain type.
+func attesterDomain() []byte {
+	return append([]byte{0x01, 0x00, 0x00, 0x00}, make([]byte, 28)...)
+}
+
+func TestRemoteSigner_Sign_WrongSigningRoot(t *testing.T) {
+	ctx := context.Background()
+	r := NewRemoteSigner(ctx, &mockKeyVault{}, WithSlashingProtection(allowingProtector{}))
+	req := &validatorpb.SignRequest{
+		PublicKey:       randKey().PublicKey().Marshal(),
+		SigningRoot:     make([]byte, 32),
+		SignatureDomain: attesterDomain(),
+		Object: &validatorpb.SignRequest_AttestationData{AttestationData: &ethpb.AttestationData{
+			BeaconBlockRoot: make([]byte, 32),
+			Source:          &ethpb.Checkpoint{Root: make([]byte, 32)},
+			Target:          &ethpb.Checkpoint{Epoch: 1, Root: make([]byte, 32)},
+		}},
+	}
+	res, err := r.Sign(ctx, req)
+	if status.Code(err) != codes.InvalidArgument || res.Status != validatorpb.SignResponse_DENIED {
+		t.Errorf("Wanted request with a wrong signing root denied, received %v, %v", res.Status, err)
+	}
+	signingRoot, err := slashing.ComputeSigningRoot(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SigningRoot = signingRoot
+	res, err = r.Sign(ctx, req)
+	if err != nil || res.Status != validatorpb.SignResponse_SUCCEEDED {
+		t.Errorf("Wanted request signed, received %v, %v", res.Status, err)
+	}
+}
+
+// allowingProtector allows every request.
+type allowingProtector struct{}
+
+func (allowingProtector) CheckAndRecord(context.Context, [48]byte, *validatorpb.SignRequest) error {
+	return nil
+}
+
+func TestRemoteSigner_Sign_SlashingProtection(t *testing.T) {
+	ctx := context.Background()
+	r := NewRemoteSigner(ctx, &mockKeyVault{}, WithSlashingProtection(mockProtector{}))
+	res, err := r.Sign(ctx, &validatorpb.SignRequest{
+		PublicKey:   randKey().PublicKey().Marshal(),
+		SigningRoot: make([]byte, 32),
+	})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Wanted PermissionDenied, received %v", err)
+	}
+	if res.Status != validatorpb.SignResponse_DENIED {
+		t.Errorf("Wanted %v, received %v", validatorpb.SignResponse_DENIED, res.Status)
+	}
+}
+
+func TestRemoteSigner_Sign_ExitApproval(t *testing.T) {
+	ctx := context.Background()
+	operatorKeys := make(map[string]ed25519.PrivateKey)
+	operators := make(map[string]ed25519.PublicKey)
+	for _, operator := range []string{"alice", "bob"} {
+		pubKey, privKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		operatorKeys[operator] = privKey
+		operators[operator] = pubKey
+	}
+	q, err := exits.NewQueue(&exits.Config{
+		Operators: operators,
+		Approvals: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewRemoteSigner(ctx, &mockKeyVault{}, WithExitApproval(q))
+	a := NewAdminServer(&mockKeyVault{}, WithExitQueue(q))
+	exit := &ethpb.VoluntaryExit{Epoch: 10, ValidatorIndex: 1}
+	domain := append([]byte{0x04, 0x00, 0x00, 0x00}, make([]byte, 28)...)
+	signingRoot, err := exits.SigningRoot(exit, domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &validatorpb.SignRequest{
+		PublicKey:       randKey().PublicKey().Marshal(),
+		SigningRoot:     signingRoot,
+		SignatureDomain: domain,
+		Object:          &validatorpb.SignRequest_Exit{Exit: exit},
+	}
+
+	// An exit whose signing root is not the one of the exit approvers see is denied.
+	res, err := r.Sign(ctx, &validatorpb.SignRequest{
+		PublicKey:       req.PublicKey,
+		SigningRoot:     make([]byte, 32),
+		SignatureDomain: domain,
+		Object:          req.Object,
+	})
+	if status.Code(err) != codes.InvalidArgument || res.Status != validatorpb.SignResponse_DENIED {
+		t.Fatalf("Wanted exit with a wrong signing root denied, received %v, %v", res.Status, err)
+	}
+
+	// The caller gives up waiting before the exit is approved.
+	waitCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	res, err = r.Sign(waitCtx, req)
+	if status.Code(err) != codes.Unavailable || res.Status != validatorpb.SignResponse_FAILED {
+		t.Fatalf("Wanted exit awaiting approval, received %v, %v", res.Status, err)
+	}
+	listed, err := a.ListExits(ctx, &admin.ListExitsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed.Exits) != 1 || listed.Exits[0].ValidatorIndex != 1 {
+		t.Fatalf("Wanted the pending exit listed, received %+v", listed.Exits)
+	}
+	id := listed.Exits[0].ID
+	approve := func(operator string) error {
+		_, err := a.ApproveExit(ctx, &admin.ApproveExitRequest{
+			ID:        id,
+			Operator:  operator,
+			Signature: fmt.Sprintf("%#x", ed25519.Sign(operatorKeys[operator], exits.ApprovalMessage(id))),
+		})
+		return err
+	}
+	if _, err := a.ApproveExit(ctx, &admin.ApproveExitRequest{ID: id, Operator: "alice"}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Wanted PermissionDenied for an unsigned approval, received %v", err)
+	}
+	for _, operator := range []string{"alice", "bob"} {
+		if err := approve(operator); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := approve("alice"); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Wanted FailedPrecondition, received %v", err)
+	}
+
+	// The retried request is signed once approved.
+	res, err = r.Sign(ctx, req)
+	if err != nil || res.Status != validatorpb.SignResponse_SUCCEEDED {
+		t.Errorf("Wanted approved exit to be signed, received %v, %v", res.Status, err)
+	}
+	// Other requests are not held.
+	res, err = r.Sign(ctx, &validatorpb.SignRequest{
+		PublicKey:   randKey().PublicKey().Marshal(),
+		SigningRoot: make([]byte, 32),
+		Object:      &validatorpb.SignRequest_AttestationData{},
+	})
+	if err != nil || res.Status != validatorpb.SignResponse_SUCCEEDED {
+		t.Errorf("Wanted attestation to be signed, received %v, %v", res.Status, err)
+	}
+}
+
+func TestRemoteSigner_Sign_SigningPolicy(t *testing.T) {
+	ctx := context.Background()
+	p, err := policy.New(&policy.Config{
+		Rules: []*policy.Rule{{Name: "no-exits", Types: []string{policy.TypeExit}, Deny: true}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The keyvault fails, so a denial shows it was never accessed.
+	r := NewRemoteSigner(ctx, &mockKeyVault{wantErr: true}, WithSigningPolicy(p))
+	res, err := r.Sign(ctx, &validatorpb.SignRequest{
+		PublicKey:   randKey().PublicKey().Marshal(),
+		SigningRoot: make([]byte, 32),
+		Object:      &validatorpb.SignRequest_Exit{Exit: &ethpb.VoluntaryExit{Epoch: 10}},
+	})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Wanted PermissionDenied, received %v", err)
+	}
+	if res.Status != validatorpb.SignResponse_DENIED {
+		t.Errorf("Wanted %v, received %v", validatorpb.SignResponse_DENIED, res.Status)
+	}
+}
+
+func TestRemoteSigner_Sign_ClockCheck(t *testing.T) {
+	ctx := context.Background()
+	c := clock.New(time.Now(), clock.DefaultSecondsPerSlot, clock.DefaultSlotsPerEpoch)
+	r := NewRemoteSigner(ctx, &mockKeyVault{}, WithClockCheck(c, clock.DefaultMaxFutureSlots))
+	res, err := r.Sign(ctx, &validatorpb.SignRequest{
+		PublicKey:   randKey().PublicKey().Marshal(),
+		SigningRoot: make([]byte, 32),
+		Object:      &validatorpb.SignRequest_Block{Block: &ethpb.BeaconBlock{Slot: 1000}},
+	})
+	if status.Code(err) != codes.PermissionDenied || res.Status != validatorpb.SignResponse_DENIED {
+		t.Errorf("Wanted far future block to be denied, received %v, %v", res.Status, err)
+	}
+	res, err = r.Sign(ctx, &validatorpb.SignRequest{
+		PublicKey:   randKey().PublicKey().Marshal(),
+		SigningRoot: make([]byte, 32),
+		Object:      &validatorpb.SignRequest_Block{Block: &ethpb.BeaconBlock{Slot: 1}},
+	})
+	if err != nil || res.Status != validatorpb.SignResponse_SUCCEEDED {
+		t.Errorf("Wanted block to be signed, received %v, %v", res.Status, err)
+	}
+}
+
 func randKey() bls.SecretKey {
 	k, err := bls.RandKey()
 	if err != nil {
@@ -162,3 +563,74 @@ func randKey() bls.SecretKey {
 	}
 	return k
 }
+
+func BenchmarkRemoteSigner_Sign(b *testing.B) {
+	ctx := context.Background()
+	vault, err := deterministic.NewStore(1)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer func() {
+		if err := vault.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}()
+	pubKeys, err := vault.GetPublicKeys(ctx)
+	if err != nil {
+		b.Fatal(err)
+	}
+	pubKey := pubKeys[0].Marshal()
+
+	b.Run("Unprotected", func(b *testing.B) {
+		benchmarkSign(b, NewRemoteSigner(ctx, vault), pubKey)
+	})
+	b.Run("SlashingProtection", func(b *testing.B) {
+		dir, err := ioutil.TempDir("", "rpc")
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer func() {
+			if err := os.RemoveAll(dir); err != nil {
+				b.Fatal(err)
+			}
+		}()
+		db, err := slashing.Open(filepath.Join(dir, "slashing.db"))
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer func() {
+			if err := db.Close(); err != nil {
+				b.Fatal(err)
+			}
+		}()
+		benchmarkSign(b, NewRemoteSigner(ctx, vault, WithSlashingProtection(db)), pubKey)
+	})
+}
+
+// benchmarkSign signs an attestation of a later epoch on each iteration,
+// so that slashing protection records each of them.
+func benchmarkSign(b *testing.B, r *RemoteSigner, pubKey []byte) {
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req := &validatorpb.SignRequest{
+			PublicKey:       pubKey,
+			SignatureDomain: attesterDomain(),
+			Object: &validatorpb.SignRequest_AttestationData{AttestationData: &ethpb.AttestationData{
+				BeaconBlockRoot: make([]byte, 32),
+				Source:          &ethpb.Checkpoint{Epoch: types.Epoch(i), Root: make([]byte, 32)},
+				Target:          &ethpb.Checkpoint{Epoch: types.Epoch(i + 1), Root: make([]byte, 32)},
+			}},
+		}
+		signingRoot, err := slashing.ComputeSigningRoot(req)
+		if err != nil {
+			b.Fatal(err)
+		}
+		req.SigningRoot = signingRoot
+		res, err := r.Sign(ctx, req)
+		if err != nil || res.Status != validatorpb.SignResponse_SUCCEEDED {
+			b.Fatalf("Could not sign: %v", err)
+		}
+	}
+}
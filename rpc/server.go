@@ -2,14 +2,30 @@ package rpc
 
 import (
 	"context"
-	"fmt"
 	"net"
+	"os"
+	"time"
 
+	"github.com/pkg/errors"
+	types "github.com/prysmaticlabs/eth2-types"
 	validatorpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1/validator-client"
+	"github.com/prysmaticlabs/remote-signer/auth"
+	"github.com/prysmaticlabs/remote-signer/certs"
+	"github.com/prysmaticlabs/remote-signer/clock"
+	"github.com/prysmaticlabs/remote-signer/cluster"
+	"github.com/prysmaticlabs/remote-signer/doppelganger"
+	"github.com/prysmaticlabs/remote-signer/exits"
+	"github.com/prysmaticlabs/remote-signer/ha"
 	"github.com/prysmaticlabs/remote-signer/keyvault"
+	"github.com/prysmaticlabs/remote-signer/policy"
+	"github.com/prysmaticlabs/remote-signer/rpc/admin"
+	"github.com/prysmaticlabs/remote-signer/slashing"
+	"github.com/prysmaticlabs/remote-signer/slashing/replication"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
 )
 
@@ -25,92 +41,423 @@ type Config struct {
 	Port     string
 	CertFlag string
 	KeyFlag  string
-	KeyVault keyvault.Store
+	// ClientCAFlag, if set, requires clients to present a certificate
+	// signed by the CA certificates of the file.
+	ClientCAFlag string
+	// Addresses are further host:port addresses the server listens on.
+	Addresses []string
+	// UnixSocket, if set, is the path of a Unix domain socket the server
+	// listens on without TLS, for validator clients on the same host. The
+	// socket file has UnixSocketMode, DefaultUnixSocketMode if unset, and
+	// belongs to UnixSocketGroup if set.
+	UnixSocket      string
+	UnixSocketMode  os.FileMode
+	UnixSocketGroup string
+	// UnixSocketUIDs and UnixSocketGIDs, if any, are the only users and
+	// primary groups of the processes allowed to call the server over the
+	// Unix socket, as read from the kernel with SO_PEERCRED on Linux.
+	UnixSocketUIDs []uint32
+	UnixSocketGIDs []uint32
+	// Tokens, if set, require a bearer token granted the scope of each
+	// call to the remote signer and admin APIs, whatever the transport.
+	Tokens *auth.Tokens
+	// EnableAdmin serves the admin API of the keyvault, which requires
+	// callers to be authenticated with ClientCAFlag or Tokens, and with
+	// Tokens or an allowlist of users or groups on the Unix socket.
+	EnableAdmin bool
+	// Limits, if set, rate limit the requests of each client and for each
+	// key, and cap the number of sign requests served at once.
+	Limits           *Limits
+	KeyVault         keyvault.Store
+	HideDisabledKeys bool
+	// RemoteSigner overrides the keyvault backed remote signer service,
+	// such as with a threshold signing coordinator which holds no keys.
+	RemoteSigner validatorpb.RemoteSignerServer
+	// Doppelganger, if set, puts every key of the keyvault on
+	// probation at startup before allowing it to sign.
+	Doppelganger *doppelganger.Guard
+	// Elector, if set, only lets this server sign while it is the
+	// leader of its high availability cluster.
+	Elector *ha.Elector
+	// SlashingProtection, if set, denies slashable sign requests.
+	SlashingProtection slashing.Protector
+	// Replication, if set, serves the slashing protection history to peer signers.
+	Replication replication.Server
+	// Cluster, if set, commits every signing decision to the replicated log
+	// of a Raft cluster, whose API and membership management it serves.
+	Cluster *cluster.Cluster
+	// ExitApproval, if set, holds voluntary exits until operators
+	// approve them through the admin API.
+	ExitApproval *exits.Queue
+	// Policy, if set, denies sign requests breaking its rules.
+	Policy *policy.Engine
+	// Clock, if set, denies block, attestation and sync committee
+	// sign requests more than MaxFutureSlots ahead of the wall clock.
+	Clock          *clock.Clock
+	MaxFutureSlots types.Slot
+	// Maintenance, if set, is the maintenance mode of the server, toggled
+	// through the admin API, in which sign requests are refused.
+	Maintenance *Maintenance
+	// ShutdownTimeout bounds how long Stop waits for in-flight
+	// requests, DefaultShutdownTimeout if unset.
+	ShutdownTimeout time.Duration
 }
 
 // Server defining a gRPC server for the remote signer API.
 type Server struct {
-	ctx             context.Context
-	cancel          context.CancelFunc
-	host            string
-	port            string
-	listener        net.Listener
-	withCert        string
-	withKey         string
-	credentialError error
-	grpcServer      *grpc.Server
-	keyVault        keyvault.Store
+	ctx              context.Context
+	cancel           context.CancelFunc
+	host             string
+	port             string
+	addresses        []string
+	unixSocket       string
+	unixSocketMode   os.FileMode
+	unixSocketGroup  string
+	unixSocketUIDs   []uint32
+	unixSocketGIDs   []uint32
+	tokens           *auth.Tokens
+	enableAdmin      bool
+	limits           *Limits
+	listeners        []net.Listener
+	withCert         string
+	withKey          string
+	withClientCA     string
+	certificates     *certs.Reloader
+	grpcServer       *grpc.Server
+	health           *health.Server
+	keyVault         keyvault.Store
+	hideDisabledKeys bool
+	remoteSigner     validatorpb.RemoteSignerServer
+	doppelganger     *doppelganger.Guard
+	elector          *ha.Elector
+	stopElector      context.CancelFunc
+	electorDone      chan struct{}
+	protector        slashing.Protector
+	replication      replication.Server
+	cluster          *cluster.Cluster
+	exitQueue        *exits.Queue
+	policy           *policy.Engine
+	clock            *clock.Clock
+	maxFutureSlots   types.Slot
+	maintenance      *Maintenance
+	shutdownTimeout  time.Duration
+	inflight         inflight
 }
 
 // NewServer instantiates a new gRPC server.
 func NewServer(ctx context.Context, cfg *Config) *Server {
 	ctx, cancel := context.WithCancel(ctx)
+	shutdownTimeout := cfg.ShutdownTimeout
+	if shutdownTimeout == 0 {
+		shutdownTimeout = DefaultShutdownTimeout
+	}
 	return &Server{
-		ctx:      ctx,
-		cancel:   cancel,
-		host:     cfg.Host,
-		port:     cfg.Port,
-		withCert: cfg.CertFlag,
-		withKey:  cfg.KeyFlag,
-		keyVault: cfg.KeyVault,
+		ctx:              ctx,
+		cancel:           cancel,
+		host:             cfg.Host,
+		port:             cfg.Port,
+		addresses:        cfg.Addresses,
+		unixSocket:       cfg.UnixSocket,
+		unixSocketMode:   cfg.UnixSocketMode,
+		unixSocketGroup:  cfg.UnixSocketGroup,
+		unixSocketUIDs:   cfg.UnixSocketUIDs,
+		unixSocketGIDs:   cfg.UnixSocketGIDs,
+		tokens:           cfg.Tokens,
+		enableAdmin:      cfg.EnableAdmin,
+		limits:           cfg.Limits,
+		withCert:         cfg.CertFlag,
+		withKey:          cfg.KeyFlag,
+		withClientCA:     cfg.ClientCAFlag,
+		keyVault:         cfg.KeyVault,
+		hideDisabledKeys: cfg.HideDisabledKeys,
+		remoteSigner:     cfg.RemoteSigner,
+		doppelganger:     cfg.Doppelganger,
+		elector:          cfg.Elector,
+		protector:        cfg.SlashingProtection,
+		replication:      cfg.Replication,
+		cluster:          cfg.Cluster,
+		exitQueue:        cfg.ExitApproval,
+		policy:           cfg.Policy,
+		clock:            cfg.Clock,
+		maxFutureSlots:   cfg.MaxFutureSlots,
+		maintenance:      cfg.Maintenance,
+		shutdownTimeout:  shutdownTimeout,
 	}
 }
 
-// Start the gRPC server.
-func (s *Server) Start() {
-	// Setup the gRPC server options and TLS configuration.
-	address := fmt.Sprintf("%s:%s", s.host, s.port)
-	lis, err := net.Listen("tcp", address)
+// Start the gRPC server, listening on every address and the Unix socket
+// if any. Nothing is served if any listener or the TLS certificates fail.
+func (s *Server) Start() error {
+	if s.withCert == "" || s.withKey == "" {
+		return errors.New("cannot use an insecure gRPC connection, provide a certificate and key to connect securely")
+	}
+	authorizePeers := len(s.unixSocketUIDs) > 0 || len(s.unixSocketGIDs) > 0
+	if authorizePeers && s.unixSocket == "" {
+		return errors.New("cannot authorize Unix socket peers without a Unix socket")
+	}
+	if authorizePeers && !peerCredentialsSupported {
+		return errors.New("cannot authorize Unix socket peers on this platform, rely on the socket permissions instead")
+	}
+	// The admin API enables keys and approves exits, so it is only
+	// served to callers authenticated by certificate or token.
+	if s.enableAdmin && s.withClientCA == "" && s.tokens == nil {
+		return errors.New("cannot serve the admin API without authenticating callers, provide a client CA or bearer tokens")
+	}
+	// Unix socket peers skip the TLS handshake, so client certificates
+	// do not authenticate them.
+	if s.enableAdmin && s.unixSocket != "" && s.tokens == nil && !authorizePeers {
+		return errors.New(
+			"cannot serve the admin API on an unauthenticated Unix socket, provide bearer tokens or allowed Unix socket users or groups",
+		)
+	}
+	if s.exitQueue != nil && !s.enableAdmin {
+		return errors.New("cannot approve voluntary exits without the admin API")
+	}
+	// Certificates are reloaded when their files change, so they
+	// are rotated without restarting the server.
+	certificates, err := certs.NewReloader(&certs.Config{
+		CertPath:     s.withCert,
+		KeyPath:      s.withKey,
+		ClientCAPath: s.withClientCA,
+	})
 	if err != nil {
-		log.Errorf("Could not listen to port in Start() %s: %v", address, err)
+		return errors.Wrap(err, "could not load TLS certificates")
 	}
-	s.listener = lis
 
-	opts := make([]grpc.ServerOption, 0)
-	if s.withCert != "" && s.withKey != "" {
-		creds, err := credentials.NewServerTLSFromFile(s.withCert, s.withKey)
+	listeners, err := listenTCP(append([]string{net.JoinHostPort(s.host, s.port)}, s.addresses...))
+	if err != nil {
+		return err
+	}
+	creds := credentials.NewTLS(certificates.TLSConfig())
+	if s.unixSocket != "" {
+		lis, err := listenUnix(s.unixSocket, s.unixSocketMode, s.unixSocketGroup)
 		if err != nil {
-			log.Errorf("Could not load TLS keys: %s", err)
-			s.credentialError = err
+			closeListeners(listeners)
+			return err
 		}
-		opts = append(opts, grpc.Creds(creds))
-	} else {
-		log.Fatal("Cannot use an insecure gRPC connection. Provide a certificate and key to connect securely")
-	}
-	log.WithFields(logrus.Fields{
-		"crt-path": s.withCert,
-		"key-path": s.withKey,
-	}).Info("Loaded TLS certificates")
+		listeners = append(listeners, lis)
+		creds = newUnixCredentials(creds)
+	}
+	s.certificates = certificates
+	go s.certificates.Run(s.ctx)
+
+	// Setup the gRPC server options and TLS configuration.
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(requestLogger, traceRequests, s.inflight.unaryInterceptor),
+		grpc.Creds(creds),
+	}
+	if authorizePeers {
+		authorizer := newPeerAuthorizer(s.unixSocketUIDs, s.unixSocketGIDs)
+		opts = append(
+			opts,
+			grpc.ChainUnaryInterceptor(authorizer.unaryInterceptor),
+			grpc.ChainStreamInterceptor(authorizer.streamInterceptor),
+		)
+	}
+	if s.tokens != nil {
+		go s.tokens.Run(s.ctx)
+		authorizer := &tokenAuthorizer{tokens: s.tokens}
+		opts = append(
+			opts,
+			grpc.ChainUnaryInterceptor(authorizer.unaryInterceptor),
+			grpc.ChainStreamInterceptor(authorizer.streamInterceptor),
+		)
+	}
+	// Limits apply once callers are authenticated, so that their
+	// token is the identity they are rate limited by.
+	if s.limits != nil {
+		opts = append(opts, grpc.ChainUnaryInterceptor(newLimiter(s.limits).unaryInterceptor))
+	}
 	s.grpcServer = grpc.NewServer(opts...)
 
-	// Instantiate a remote signer server.
-	remoteSigner := NewRemoteSigner(s.ctx, s.keyVault)
+	// Instantiate a remote signer server, unless one was provided.
+	remoteSigner := s.remoteSigner
+	if remoteSigner == nil {
+		var signerOpts []SignerOption
+		if s.hideDisabledKeys {
+			signerOpts = append(signerOpts, WithHideDisabledKeys())
+		}
+		if s.doppelganger != nil {
+			if err := s.startDoppelgangerGuard(); err != nil {
+				closeListeners(listeners)
+				return err
+			}
+			signerOpts = append(signerOpts, WithDoppelgangerGuard(s.doppelganger))
+		}
+		if s.elector != nil {
+			s.startElector()
+			signerOpts = append(signerOpts, WithLeaderElection(s.elector))
+		}
+		if s.cluster != nil {
+			signerOpts = append(signerOpts, WithSlashingProtection(s.cluster))
+		} else if s.protector != nil {
+			signerOpts = append(signerOpts, WithSlashingProtection(s.protector))
+		}
+		if s.exitQueue != nil {
+			signerOpts = append(signerOpts, WithExitApproval(s.exitQueue))
+		}
+		if s.policy != nil {
+			signerOpts = append(signerOpts, WithSigningPolicy(s.policy))
+		}
+		if s.clock != nil {
+			signerOpts = append(signerOpts, WithClockCheck(s.clock, s.maxFutureSlots))
+		}
+		remoteSigner = NewRemoteSigner(s.ctx, s.keyVault, signerOpts...)
+	}
+
+	if s.maintenance != nil {
+		remoteSigner = &maintenanceSigner{RemoteSignerServer: remoteSigner, maintenance: s.maintenance}
+	}
 
 	// Register services available for the gRPC server.
 	validatorpb.RegisterRemoteSignerServer(s.grpcServer, remoteSigner)
+	if s.keyVault != nil && s.enableAdmin {
+		var adminOpts []AdminOption
+		if s.cluster != nil {
+			adminOpts = append(adminOpts, WithClusterMembership(s.cluster))
+		}
+		if s.exitQueue != nil {
+			adminOpts = append(adminOpts, WithExitQueue(s.exitQueue))
+		}
+		if s.maintenance != nil {
+			adminOpts = append(adminOpts, WithMaintenanceMode(s.maintenance))
+		}
+		admin.RegisterServer(s.grpcServer, NewAdminServer(s.keyVault, adminOpts...))
+	}
+	if s.keyVault != nil {
+		s.logValidatingKeys()
+	}
+	if s.replication != nil {
+		replication.RegisterServer(s.grpcServer, s.replication)
+	}
+	if s.cluster != nil {
+		s.cluster.RegisterServer(s.grpcServer)
+	}
+	s.health = health.NewServer()
+	healthpb.RegisterHealthServer(s.grpcServer, s.health)
 	reflection.Register(s.grpcServer)
 
-	go func() {
-		if s.listener != nil {
-			if err := s.grpcServer.Serve(s.listener); err != nil {
-				log.Errorf("Could not serve: %v", err)
+	s.listeners = listeners
+	for _, lis := range listeners {
+		go func(lis net.Listener) {
+			if err := s.grpcServer.Serve(lis); err != nil {
+				log.WithError(err).WithField("address", lis.Addr()).Error("Could not serve")
 			}
-		}
+		}(lis)
+		log.WithField("address", lis.Addr()).Info("gRPC server listening on address")
+	}
+	return nil
+}
+
+// startDoppelgangerGuard puts every key of the keyvault on
+// probation and starts checking their liveness in the background.
+func (s *Server) startDoppelgangerGuard() error {
+	pubKeys, err := s.keyVault.GetPublicKeys(s.ctx)
+	if err != nil {
+		return errors.Wrap(err, "could not retrieve public keys for doppelganger protection")
+	}
+	s.doppelganger.Register(pubKeys)
+	go s.doppelganger.Run(s.ctx)
+	return nil
+}
+
+// startElector competes for leadership of the high availability cluster in
+// the background. Leadership is given up in Stop, once no more requests
+// are being served, so it outlives the server context.
+func (s *Server) startElector() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stopElector = cancel
+	s.electorDone = make(chan struct{})
+	go func() {
+		s.elector.Run(ctx)
+		close(s.electorDone)
 	}()
-	log.WithField("address", address).Info("gRPC server listening on address")
 }
 
-// Stop the gRPC server.
+// logValidatingKeys logs the metadata of every key held by the keyvault.
+func (s *Server) logValidatingKeys() {
+	metadata, err := keyvault.ListKeyMetadata(s.ctx, s.keyVault)
+	if err != nil {
+		log.WithError(err).Error("Could not retrieve validating key metadata")
+		return
+	}
+	recordValidatingKeys(metadata)
+	for _, m := range metadata {
+		log.WithFields(metadataFields(m)).Debug("Loaded validating key")
+	}
+	log.WithField("numKeys", len(metadata)).Info("Loaded validating keys")
+}
+
+// Stop the gRPC server, give up leadership of the high availability
+// cluster once no more requests are served, and close the keyvault,
+// zeroing any secret key material it holds in memory. New requests are
+// refused while in-flight ones complete, and connections are forcibly
+// closed once the shutdown timeout is exceeded.
 func (s *Server) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+	s.inflight.drain()
+	if s.listeners != nil {
+		s.health.Shutdown()
+		log.WithField("timeout", s.shutdownTimeout).Info("Draining in-flight requests")
+		stopped := make(chan struct{})
+		go func() {
+			s.grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+			log.Debug("Gracefully stopped server")
+		case <-ctx.Done():
+			log.Warn("Shutdown timeout exceeded, forcibly closing connections")
+			s.grpcServer.Stop()
+			<-stopped
+		}
+	}
 	s.cancel()
-	if s.listener != nil {
-		s.grpcServer.GracefulStop()
-		log.Debug("Initiated graceful stop of server")
+	// The keyvault is only closed once no request uses it. Requests still
+	// in flight after the timeout were cancelled, and are waited for without
+	// a deadline, the caller bounding the whole shutdown.
+	if !s.inflight.wait(ctx) {
+		log.Warn("Requests still in flight after the shutdown timeout, waiting for them to be cancelled")
+		s.inflight.wait(context.Background())
+	}
+	if s.stopElector != nil {
+		s.stopElector()
+		<-s.electorDone
+	}
+	if s.keyVault != nil {
+		if err := s.keyVault.Close(); err != nil {
+			return errors.Wrap(err, "could not close keyvault")
+		}
 	}
 	return nil
 }
 
-// Status returns nil or credentialError.
-func (s *Server) Status() error {
-	return s.credentialError
+// ReloadCertificates reads the TLS certificate, key and client CA of the
+// server from their files, such as on SIGHUP, keeping the previous ones on error.
+func (s *Server) ReloadCertificates() error {
+	if s.certificates == nil {
+		return errors.New("no TLS certificates to reload")
+	}
+	return s.certificates.Reload()
+}
+
+// ReloadTokens reads the bearer tokens of the server from their file, such
+// as on SIGHUP, keeping the previous ones on error. It is a no-op without tokens.
+func (s *Server) ReloadTokens() error {
+	if s.tokens == nil {
+		return nil
+	}
+	return s.tokens.Reload()
+}
+
+// Addrs returns the addresses the server listens on once started, such as
+// the port picked by the system when listening on port 0.
+func (s *Server) Addrs() []net.Addr {
+	addrs := make([]net.Addr, 0, len(s.listeners))
+	for _, lis := range s.listeners {
+		addrs = append(addrs, lis.Addr())
+	}
+	return addrs
 }
@@ -0,0 +1,47 @@
+package rpc
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/prysmaticlabs/remote-signer/exits"
+)
+
+func TestServer_Start_AdminAuthentication(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     *Config
+		wantErr string
+	}{
+		{
+			name:    "admin without authentication",
+			cfg:     &Config{CertFlag: "server.crt", KeyFlag: "server.key", EnableAdmin: true},
+			wantErr: "cannot serve the admin API without authenticating callers",
+		},
+		{
+			name: "admin on Unix socket with only a client CA",
+			cfg: &Config{
+				CertFlag:     "server.crt",
+				KeyFlag:      "server.key",
+				ClientCAFlag: "ca.crt",
+				UnixSocket:   "signer.sock",
+				EnableAdmin:  true,
+			},
+			wantErr: "cannot serve the admin API on an unauthenticated Unix socket",
+		},
+		{
+			name:    "exit approval without admin",
+			cfg:     &Config{CertFlag: "server.crt", KeyFlag: "server.key", ExitApproval: &exits.Queue{}},
+			wantErr: "cannot approve voluntary exits without the admin API",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewServer(context.Background(), tt.cfg).Start()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Wanted error %q, received %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	validatorpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1/validator-client"
+	"github.com/prysmaticlabs/remote-signer/auth"
+	"github.com/prysmaticlabs/remote-signer/cluster"
+	"github.com/prysmaticlabs/remote-signer/rpc/admin"
+	"github.com/prysmaticlabs/remote-signer/slashing/replication"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// remoteSignerService is the fully qualified gRPC service name of the remote signer API.
+const remoteSignerService = "ethereum.validator.accounts.v2.RemoteSigner"
+
+// tokenExemptServices are the services not authorized with client tokens:
+// health checks and reflection, and the replication and cluster services
+// which authenticate peers with their shared token.
+var tokenExemptServices = []string{
+	healthpb.Health_ServiceDesc.ServiceName,
+	"grpc.reflection.v1alpha.ServerReflection",
+	replication.ServiceName,
+	cluster.ServiceName,
+}
+
+// methodScope returns the token scope required by a method, or false if
+// the method is not authorized with client tokens.
+func methodScope(fullMethod string) (string, bool) {
+	switch {
+	case fullMethod == "/"+remoteSignerService+"/Sign":
+		return auth.ScopeSign, true
+	case strings.HasPrefix(fullMethod, "/"+remoteSignerService+"/"):
+		return auth.ScopeList, true
+	case strings.HasPrefix(fullMethod, "/"+admin.ServiceName+"/"):
+		return auth.ScopeAdmin, true
+	default:
+		return "", false
+	}
+}
+
+// isTokenExempt returns whether a method belongs to a service which is
+// not authorized with client tokens.
+func isTokenExempt(fullMethod string) bool {
+	for _, service := range tokenExemptServices {
+		if strings.HasPrefix(fullMethod, "/"+service+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenAuthorizer requires a bearer token granted the scope of the method
+// on the remote signer and admin APIs, and restricts the tokens with a key
+// allowlist to signing with and listing their keys. Methods of any other
+// service than the exempt ones are denied.
+type tokenAuthorizer struct {
+	tokens *auth.Tokens
+}
+
+// authorize returns a context carrying the token of the request.
+func (a *tokenAuthorizer) authorize(ctx context.Context, method, scope string) (context.Context, error) {
+	var authorization string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(auth.AuthorizationHeader); len(values) > 0 {
+			authorization = values[0]
+		}
+	}
+	token, err := a.tokens.Authorize(authorization, scope)
+	if err != nil {
+		fields := logrus.Fields{
+			"client": clientIdentity(ctx),
+			"method": method,
+		}
+		if token != nil {
+			fields["token"] = token.ID
+		}
+		requestLog(ctx).WithFields(fields).WithError(err).Warn("Denied request")
+		if errors.Is(err, auth.ErrForbidden) {
+			return nil, status.Errorf(codes.PermissionDenied, "Token is not allowed to call %s", method)
+		}
+		return nil, status.Error(codes.Unauthenticated, "Expected a valid bearer token")
+	}
+	return auth.NewContext(ctx, token), nil
+}
+
+// authorizeExempt fails with the PermissionDenied code for methods which
+// neither require a token scope nor belong to an exempt service.
+func (a *tokenAuthorizer) authorizeExempt(ctx context.Context, method string) error {
+	if isTokenExempt(method) {
+		return nil
+	}
+	requestLog(ctx).WithFields(logrus.Fields{
+		"client": clientIdentity(ctx),
+		"method": method,
+	}).Warn("Denied request for unknown method")
+	return status.Errorf(codes.PermissionDenied, "Method %s is not allowed", method)
+}
+
+func (a *tokenAuthorizer) unaryInterceptor(
+	ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+) (interface{}, error) {
+	scope, ok := methodScope(info.FullMethod)
+	if !ok {
+		if err := a.authorizeExempt(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+	ctx, err := a.authorize(ctx, info.FullMethod, scope)
+	if err != nil {
+		return nil, err
+	}
+	token, _ := auth.FromContext(ctx)
+	if signReq, ok := req.(*validatorpb.SignRequest); ok && !token.AllowsKey(signReq.PublicKey) {
+		requestLog(ctx).WithFields(logrus.Fields{
+			"token":     token.ID,
+			"publicKey": fmt.Sprintf("%#x", signReq.PublicKey),
+		}).Warn("Denied signing request for key outside of the token allowlist")
+		return nil, status.Error(codes.PermissionDenied, "Token is not allowed to sign with this key")
+	}
+	if scope == auth.ScopeAdmin {
+		requestLog(ctx).WithFields(logrus.Fields{
+			"token":  token.ID,
+			"method": info.FullMethod,
+		}).Info("Admin request")
+	}
+	res, err := handler(ctx, req)
+	if keys, ok := res.(*validatorpb.ListPublicKeysResponse); ok && err == nil {
+		allowed := make([][]byte, 0, len(keys.ValidatingPublicKeys))
+		for _, k := range keys.ValidatingPublicKeys {
+			if token.AllowsKey(k) {
+				allowed = append(allowed, k)
+			}
+		}
+		keys.ValidatingPublicKeys = allowed
+	}
+	return res, err
+}
+
+// streamInterceptor authorizes streams like unary calls. No stream of the
+// remote signer and admin APIs carries sign requests or key lists, so the
+// key allowlist of the token does not apply.
+func (a *tokenAuthorizer) streamInterceptor(
+	srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler,
+) error {
+	scope, ok := methodScope(info.FullMethod)
+	if !ok {
+		if err := a.authorizeExempt(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+	ctx, err := a.authorize(ss.Context(), info.FullMethod, scope)
+	if err != nil {
+		return err
+	}
+	if scope == auth.ScopeAdmin {
+		token, _ := auth.FromContext(ctx)
+		requestLog(ctx).WithFields(logrus.Fields{
+			"token":  token.ID,
+			"method": info.FullMethod,
+		}).Info("Admin request")
+	}
+	return handler(srv, &tokenServerStream{ServerStream: ss, ctx: ctx})
+}
+
+// tokenServerStream is a server stream whose context carries the token
+// of the caller.
+type tokenServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the context of the stream, with the token of the caller.
+func (s *tokenServerStream) Context() context.Context {
+	return s.ctx
+}
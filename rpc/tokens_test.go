@@ -0,0 +1,171 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	emptypb "github.com/golang/protobuf/ptypes/empty"
+	validatorpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1/validator-client"
+	"github.com/prysmaticlabs/remote-signer/auth"
+	"github.com/prysmaticlabs/remote-signer/rpc/admin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestTokenAuthorizer_UnaryInterceptor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}()
+	token, hash, err := auth.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	allowed, other := [48]byte{1}, [48]byte{2}
+	enc, err := json.Marshal(&auth.File{Tokens: []*auth.TokenEntry{{
+		ID:         "validator-a",
+		SHA256:     hash,
+		Scopes:     []string{auth.ScopeSign, auth.ScopeList},
+		PublicKeys: []string{fmt.Sprintf("%#x", allowed)},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "tokens.json")
+	if err := ioutil.WriteFile(path, enc, 0600); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := auth.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &tokenAuthorizer{tokens: tokens}
+
+	withToken := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+	call := func(ctx context.Context, method string, req interface{}, res interface{}) (interface{}, error) {
+		return a.unaryInterceptor(ctx, req, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, _ interface{}) (interface{}, error) {
+			if id := clientIdentity(ctx); id != "token:validator-a" {
+				t.Errorf("Wanted identity token:validator-a, received %s", id)
+			}
+			return res, nil
+		})
+	}
+	sign := "/" + remoteSignerService + "/Sign"
+	list := "/" + remoteSignerService + "/ListValidatingPublicKeys"
+
+	if _, err := call(withToken, sign, &validatorpb.SignRequest{PublicKey: allowed[:]}, &validatorpb.SignResponse{}); err != nil {
+		t.Errorf("Wanted allowed key signed, received %v", err)
+	}
+	_, err = call(withToken, sign, &validatorpb.SignRequest{PublicKey: other[:]}, &validatorpb.SignResponse{})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Wanted PermissionDenied for other key, received %v", err)
+	}
+	_, err = call(context.Background(), sign, &validatorpb.SignRequest{PublicKey: allowed[:]}, &validatorpb.SignResponse{})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Wanted Unauthenticated without token, received %v", err)
+	}
+	_, err = call(withToken, "/"+admin.ServiceName+"/ListKeys", &emptypb.Empty{}, nil)
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Wanted PermissionDenied without admin scope, received %v", err)
+	}
+	res, err := call(withToken, list, &emptypb.Empty{}, &validatorpb.ListPublicKeysResponse{
+		ValidatingPublicKeys: [][]byte{allowed[:], other[:]},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := res.(*validatorpb.ListPublicKeysResponse).ValidatingPublicKeys; len(keys) != 1 {
+		t.Errorf("Wanted only the allowed key listed, received %d keys", len(keys))
+	}
+	// Health checks and peer services are not authorized with client tokens.
+	if _, err := a.unaryInterceptor(
+		context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/grpc.health.v1.Health/Check"},
+		func(context.Context, interface{}) (interface{}, error) { return nil, nil },
+	); err != nil {
+		t.Errorf("Wanted health check allowed, received %v", err)
+	}
+	_, err = call(withToken, "/unknown.v1.Service/Method", &emptypb.Empty{}, nil)
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Wanted PermissionDenied for unknown service, received %v", err)
+	}
+}
+
+func TestTokenAuthorizer_StreamInterceptor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}()
+	token, hash, err := auth.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := json.Marshal(&auth.File{Tokens: []*auth.TokenEntry{{
+		ID:     "operator",
+		SHA256: hash,
+		Scopes: []string{auth.ScopeAdmin},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "tokens.json")
+	if err := ioutil.WriteFile(path, enc, 0600); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := auth.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &tokenAuthorizer{tokens: tokens}
+
+	withToken := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+	call := func(ctx context.Context, method string) error {
+		return a.streamInterceptor(nil, &testServerStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: method},
+			func(_ interface{}, ss grpc.ServerStream) error {
+				if id := clientIdentity(ss.Context()); ctx == withToken && id != "token:operator" {
+					t.Errorf("Wanted identity token:operator, received %s", id)
+				}
+				return nil
+			},
+		)
+	}
+	watch := "/" + admin.ServiceName + "/WatchKeys"
+
+	if err := call(context.Background(), watch); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Wanted Unauthenticated stream without token, received %v", err)
+	}
+	if err := call(withToken, watch); err != nil {
+		t.Errorf("Wanted stream with admin token allowed, received %v", err)
+	}
+	if err := call(withToken, "/unknown.v1.Service/Stream"); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Wanted PermissionDenied for unknown service, received %v", err)
+	}
+	if err := call(context.Background(), "/grpc.health.v1.Health/Watch"); err != nil {
+		t.Errorf("Wanted health watch allowed, received %v", err)
+	}
+}
+
+type testServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *testServerStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,43 @@
+package rpc
+
+import (
+	"context"
+
+	validatorpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1/validator-client"
+	"github.com/prysmaticlabs/remote-signer/logging"
+	"github.com/prysmaticlabs/remote-signer/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// traceRequests starts the server span of the requests to the remote
+// signer and admin APIs, in the trace of the caller if it sent a W3C
+// traceparent in its metadata. Replication and cluster traffic between
+// signers is not traced.
+func traceRequests(
+	ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if _, ok := methodScope(info.FullMethod); !ok {
+		return handler(ctx, req)
+	}
+	ctx, span := tracing.Start(tracing.Extract(ctx), info.FullMethod, trace.WithSpanKind(trace.SpanKindServer))
+	span.SetAttributes(
+		semconv.RPCSystemKey.String("grpc"),
+		semconv.RPCMethodKey.String(info.FullMethod),
+	)
+	if id, ok := logging.RequestID(ctx); ok {
+		span.SetAttributes(attribute.String("request.id", id))
+	}
+	if signReq, ok := req.(*validatorpb.SignRequest); ok {
+		for k, v := range signRequestFields(signReq) {
+			span.SetAttributes(tracing.Attribute("sign."+k, v))
+		}
+	}
+	res, err := handler(ctx, req)
+	span.SetAttributes(attribute.Int64("rpc.grpc.status_code", int64(status.Code(err))))
+	tracing.End(span, err)
+	return res, err
+}
@@ -0,0 +1,537 @@
+/*
+Package slashing protects validators from signing slashable messages. Every
+block and attestation signed is recorded in a local database, which denies
+double proposals, double votes and surround votes. The signing history is an
+append-only log of records, which can be replicated to other signer instances.
+*/
+package slashing
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	types "github.com/prysmaticlabs/eth2-types"
+	validatorpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1/validator-client"
+	"github.com/prysmaticlabs/remote-signer/tracing"
+	"github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var log = logrus.WithField("prefix", "slashing")
+
+var (
+	// ErrSlashable is returned when signing a request would be slashable.
+	ErrSlashable = errors.New("slashable signing request")
+	// ErrOutOfOrder is returned when applying a record which does not follow the last one.
+	ErrOutOfOrder = errors.New("record does not follow the last record")
+	// ErrDiverged is returned when applying a record conflicting with the local history.
+	ErrDiverged = errors.New("record conflicts with the local signing history")
+	// ErrFenced is returned when writing with a fencing token older than
+	// the token of a later leader.
+	ErrFenced = errors.New("fenced by a later leader")
+)
+
+var (
+	recordsBucket      = []byte("records")
+	blocksBucket       = []byte("blocks")
+	attestationsBucket = []byte("attestations")
+	metaBucket         = []byte("meta")
+)
+
+// fenceKey is the key of the greatest fencing token seen in the meta bucket.
+var fenceKey = []byte("fence")
+
+type fenceContextKey struct{}
+
+// WithFence returns a context whose records are written with the fencing
+// token of the leader of a high availability cluster, see RaiseFence.
+func WithFence(ctx context.Context, token uint64) context.Context {
+	return context.WithValue(ctx, fenceContextKey{}, token)
+}
+
+func fenceFromContext(ctx context.Context) uint64 {
+	token, _ := ctx.Value(fenceContextKey{}).(uint64)
+	return token
+}
+
+// writeBatchSize is the number of records read at once by WriteRecords.
+const writeBatchSize = 1000
+
+// genesisHash is the hash preceding the first record.
+var genesisHash = make([]byte, 32)
+
+// Protector checks sign requests against the signing history. Requests
+// which are not slashable are recorded, and the others are denied.
+type Protector interface {
+	CheckAndRecord(ctx context.Context, pubKey [48]byte, req *validatorpb.SignRequest) error
+}
+
+// DB is the slashing protection database, stored in a bolt file.
+type DB struct {
+	db *bolt.DB
+}
+
+// Open opens, or creates, the slashing protection database at path.
+func Open(path string) (*DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, errors.Wrap(err, "could not create slashing protection directory")
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not open slashing protection database %s", path)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{recordsBucket, blocksBucket, attestationsBucket, metaBucket} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if closeErr := db.Close(); closeErr != nil {
+			log.WithError(closeErr).Error("Could not close slashing protection database")
+		}
+		return nil, errors.Wrap(err, "could not initialize slashing protection database")
+	}
+	return &DB{db: db}, nil
+}
+
+// Close the database.
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// CheckAndRecord checks a sign request against the signing history, and records it.
+func (d *DB) CheckAndRecord(ctx context.Context, pubKey [48]byte, req *validatorpb.SignRequest) error {
+	_, err := d.CheckAndAppend(ctx, pubKey, req)
+	return err
+}
+
+// CheckAndAppend checks a sign request against the signing history and, unless
+// it is slashable, appends its record to the log. If the very same message was
+// already signed, signing it again is safe and the existing record is returned.
+// The returned record is nil if the request is not slashable by nature.
+func (d *DB) CheckAndAppend(ctx context.Context, pubKey [48]byte, req *validatorpb.SignRequest) (*Record, error) {
+	rec, err := RecordFromRequest(pubKey, req)
+	if err != nil {
+		return nil, errors.Wrap(ErrSlashable, err.Error())
+	}
+	if rec == nil {
+		return nil, nil
+	}
+	return d.appendRecord(ctx, rec)
+}
+
+// AppendRecord checks a new record, built by RecordFromRequest, against the
+// signing history and appends it to the log with the next sequence, or
+// returns the existing record of the very same message.
+func (d *DB) AppendRecord(rec *Record) (*Record, error) {
+	return d.appendRecord(context.Background(), rec)
+}
+
+// appendRecord traces the check of the record against the signing history
+// and its write, which lasts until the transaction is committed to disk.
+// The record is fenced with the token of the context, if any.
+func (d *DB) appendRecord(ctx context.Context, rec *Record) (*Record, error) {
+	if len(rec.PublicKey) != 48 {
+		return nil, errors.Errorf("wrong public key length %d in record", len(rec.PublicKey))
+	}
+	var writeSpan trace.Span
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		if err := raiseFence(tx, fenceFromContext(ctx)); err != nil {
+			return err
+		}
+		_, checkSpan := tracing.Start(ctx, "slashing.check")
+		existing, err := check(tx, rec)
+		tracing.End(checkSpan, err)
+		if err != nil {
+			return err
+		}
+		if existing > 0 {
+			rec, err = get(tx, existing)
+			return err
+		}
+		_, writeSpan = tracing.Start(ctx, "slashing.write")
+		seq, prevHash, err := last(tx)
+		if err != nil {
+			return err
+		}
+		rec.Sequence = seq + 1
+		rec.Fence = fenceFromContext(ctx)
+		rec.Hash = rec.computeHash(prevHash)
+		return put(tx, rec)
+	})
+	if writeSpan != nil {
+		tracing.End(writeSpan, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// ReplaceRecords replaces the whole signing history with the records read
+// from r, as written by WriteRecords, such as when restoring a snapshot of
+// another signer. The records are applied in a single transaction, so the
+// history is left untouched if any of them cannot be read or applied.
+func (d *DB) ReplaceRecords(r io.Reader) error {
+	dec := json.NewDecoder(r)
+	return d.db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{recordsBucket, blocksBucket, attestationsBucket} {
+			if err := tx.DeleteBucket(b); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket(b); err != nil {
+				return err
+			}
+		}
+		seq, prevHash := uint64(0), genesisHash
+		for {
+			rec := &Record{}
+			err := dec.Decode(rec)
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return errors.Wrapf(err, "could not decode record %d", seq+1)
+			}
+			if err := appendReplicated(tx, rec, seq, prevHash); err != nil {
+				return err
+			}
+			seq, prevHash = rec.Sequence, rec.Hash
+		}
+	})
+}
+
+// WriteRecords writes the records up to a sequence to w, as JSON objects
+// separated by newlines. The records are read in batches, without holding a
+// transaction open for the whole history, and must chain up to hash, the
+// hash of the record at seq when it was read: they are then the history at
+// that time, even if it was replaced meanwhile.
+func (d *DB) WriteRecords(w io.Writer, seq uint64, hash []byte) error {
+	enc := json.NewEncoder(w)
+	next, prevHash := uint64(1), genesisHash
+	for next <= seq {
+		records, err := d.Records(next, writeBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			return errors.Wrapf(ErrDiverged, "no record at sequence %d", next)
+		}
+		for _, rec := range records {
+			if rec.Sequence > seq {
+				break
+			}
+			if rec.Sequence != next || !rec.verifyHash(prevHash) {
+				return errors.Wrapf(ErrDiverged, "history changed at sequence %d", next)
+			}
+			if err := enc.Encode(rec); err != nil {
+				return errors.Wrap(err, "could not write record")
+			}
+			next, prevHash = rec.Sequence+1, rec.Hash
+		}
+	}
+	if !bytes.Equal(prevHash, hash) {
+		return errors.Wrapf(ErrDiverged, "history changed at sequence %d", seq)
+	}
+	return nil
+}
+
+// RaiseFence records the fencing token of the leader of a high availability
+// cluster, unless a greater token was already recorded, in which case it
+// returns ErrFenced. From then on, records written or applied with an older
+// token, by the instances which led the cluster before, are rejected.
+func (d *DB) RaiseFence(token uint64) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		return raiseFence(tx, token)
+	})
+}
+
+// Apply appends a record replicated from another signer to the log. Applying
+// a record already in the log is a no-op, as long as both are identical.
+func (d *DB) Apply(rec *Record) error {
+	return d.apply(rec, 0, false)
+}
+
+// ApplyFenced applies a record replicated by the leader holding a fencing
+// token, unless a later leader raised the fence above it. The history of the
+// leader holds every record which was signed, so local records conflicting
+// with it were never signed, and are replaced.
+func (d *DB) ApplyFenced(rec *Record, token uint64) error {
+	return d.apply(rec, token, true)
+}
+
+// TruncateAfter deletes the records following a sequence, which must never
+// have been signed, such as records conflicting with the history of a leader.
+func (d *DB) TruncateAfter(seq uint64) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		return truncate(tx, seq)
+	})
+}
+
+func (d *DB) apply(rec *Record, token uint64, fenced bool) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		if fenced {
+			if err := raiseFence(tx, token); err != nil {
+				return err
+			}
+		}
+		seq, prevHash, err := last(tx)
+		if err != nil {
+			return err
+		}
+		if rec.Sequence <= seq {
+			existing, err := get(tx, rec.Sequence)
+			if err != nil {
+				return err
+			}
+			if bytes.Equal(existing.Hash, rec.Hash) {
+				return nil
+			}
+			if !fenced {
+				return errors.Wrapf(ErrDiverged, "different hash at sequence %d", rec.Sequence)
+			}
+			log.WithField("sequence", rec.Sequence).Warn("Replacing records conflicting with the history of the leader")
+			if err := truncate(tx, rec.Sequence-1); err != nil {
+				return err
+			}
+			if seq, prevHash, err = last(tx); err != nil {
+				return err
+			}
+		}
+		return appendReplicated(tx, rec, seq, prevHash)
+	})
+}
+
+// appendReplicated appends a replicated record after the last record, at
+// seq with prevHash, once checked to follow it.
+func appendReplicated(tx *bolt.Tx, rec *Record, seq uint64, prevHash []byte) error {
+	if len(rec.PublicKey) != 48 {
+		return errors.Errorf("wrong public key length %d in record %d", len(rec.PublicKey), rec.Sequence)
+	}
+	if rec.Sequence != seq+1 {
+		return errors.Wrapf(ErrOutOfOrder, "received sequence %d after %d", rec.Sequence, seq)
+	}
+	if !rec.verifyHash(prevHash) {
+		return errors.Wrapf(ErrDiverged, "hash mismatch at sequence %d", rec.Sequence)
+	}
+	return put(tx, rec)
+}
+
+// Head returns the sequence and hash of the last record, or 0 and the genesis hash if there are none.
+func (d *DB) Head() (uint64, []byte, error) {
+	var seq uint64
+	var hash []byte
+	err := d.db.View(func(tx *bolt.Tx) error {
+		var err error
+		seq, hash, err = last(tx)
+		return err
+	})
+	return seq, hash, err
+}
+
+// Last returns the last record, or nil if there are none.
+func (d *DB) Last() (*Record, error) {
+	var rec *Record
+	err := d.db.View(func(tx *bolt.Tx) error {
+		seq, _, err := last(tx)
+		if err != nil || seq == 0 {
+			return err
+		}
+		rec, err = get(tx, seq)
+		return err
+	})
+	return rec, err
+}
+
+// HashAt returns the hash of the record at a sequence, or the genesis hash at sequence 0.
+func (d *DB) HashAt(seq uint64) ([]byte, error) {
+	if seq == 0 {
+		return genesisHash, nil
+	}
+	var hash []byte
+	err := d.db.View(func(tx *bolt.Tx) error {
+		rec, err := get(tx, seq)
+		if err != nil {
+			return err
+		}
+		hash = rec.Hash
+		return nil
+	})
+	return hash, err
+}
+
+// Records returns at most limit records, starting at sequence from.
+func (d *DB) Records(from uint64, limit int) ([]*Record, error) {
+	var records []*Record
+	err := d.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(recordsBucket).Cursor()
+		for k, v := c.Seek(uint64Key(from)); k != nil && len(records) < limit; k, v = c.Next() {
+			rec := &Record{}
+			if err := json.Unmarshal(v, rec); err != nil {
+				return errors.Wrapf(err, "could not decode record %d", binary.BigEndian.Uint64(k))
+			}
+			records = append(records, rec)
+		}
+		return nil
+	})
+	return records, err
+}
+
+// check returns an error if the record is slashable given the signing history,
+// or the sequence of the record of the very same message if already recorded.
+// Block index values are the sequence followed by the signing root, and
+// attestation index values the source epoch, the sequence and the signing root.
+func check(tx *bolt.Tx, rec *Record) (uint64, error) {
+	switch rec.Kind {
+	case KindBlock:
+		v := tx.Bucket(blocksBucket).Get(indexKey(rec.PublicKey, uint64(rec.Slot)))
+		if v == nil {
+			return 0, nil
+		}
+		if bytes.Equal(v[8:], rec.SigningRoot) {
+			return binary.BigEndian.Uint64(v[:8]), nil
+		}
+		return 0, errors.Wrapf(ErrSlashable, "double proposal at slot %d", rec.Slot)
+	case KindAttestation:
+		c := tx.Bucket(attestationsBucket).Cursor()
+		prefix := rec.PublicKey[:48:48]
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			target := types.Epoch(binary.BigEndian.Uint64(k[48:]))
+			source := types.Epoch(binary.BigEndian.Uint64(v[:8]))
+			switch {
+			case target == rec.TargetEpoch && bytes.Equal(v[16:], rec.SigningRoot):
+				return binary.BigEndian.Uint64(v[8:16]), nil
+			case target == rec.TargetEpoch:
+				return 0, errors.Wrapf(ErrSlashable, "double vote for target epoch %d", target)
+			case source < rec.SourceEpoch && target > rec.TargetEpoch:
+				return 0, errors.Wrapf(
+					ErrSlashable, "vote surrounded by source %d and target %d", source, target,
+				)
+			case source > rec.SourceEpoch && target < rec.TargetEpoch:
+				return 0, errors.Wrapf(
+					ErrSlashable, "vote surrounding source %d and target %d", source, target,
+				)
+			}
+		}
+		return 0, nil
+	default:
+		return 0, errors.Errorf("unknown record kind %q", rec.Kind)
+	}
+}
+
+// put indexes a record and appends it to the log.
+func put(tx *bolt.Tx, rec *Record) error {
+	switch rec.Kind {
+	case KindBlock:
+		value := append(uint64Key(rec.Sequence), rec.SigningRoot...)
+		if err := tx.Bucket(blocksBucket).Put(indexKey(rec.PublicKey, uint64(rec.Slot)), value); err != nil {
+			return err
+		}
+	case KindAttestation:
+		value := append(uint64Key(uint64(rec.SourceEpoch)), uint64Key(rec.Sequence)...)
+		value = append(value, rec.SigningRoot...)
+		if err := tx.Bucket(attestationsBucket).Put(indexKey(rec.PublicKey, uint64(rec.TargetEpoch)), value); err != nil {
+			return err
+		}
+	default:
+		return errors.Errorf("unknown record kind %q", rec.Kind)
+	}
+	enc, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(recordsBucket).Put(uint64Key(rec.Sequence), enc)
+}
+
+// truncate deletes the records following a sequence, and their indexes.
+func truncate(tx *bolt.Tx, after uint64) error {
+	var records []*Record
+	c := tx.Bucket(recordsBucket).Cursor()
+	for k, v := c.Seek(uint64Key(after + 1)); k != nil; k, v = c.Next() {
+		rec := &Record{}
+		if err := json.Unmarshal(v, rec); err != nil {
+			return errors.Wrapf(err, "could not decode record %d", binary.BigEndian.Uint64(k))
+		}
+		records = append(records, rec)
+	}
+	for _, rec := range records {
+		// The index values hold the sequence of the record, after the
+		// source epoch for attestations.
+		index, key, offset := blocksBucket, indexKey(rec.PublicKey, uint64(rec.Slot)), 0
+		if rec.Kind == KindAttestation {
+			index, key, offset = attestationsBucket, indexKey(rec.PublicKey, uint64(rec.TargetEpoch)), 8
+		}
+		if v := tx.Bucket(index).Get(key); v != nil && binary.BigEndian.Uint64(v[offset:offset+8]) == rec.Sequence {
+			if err := tx.Bucket(index).Delete(key); err != nil {
+				return err
+			}
+		}
+		if err := tx.Bucket(recordsBucket).Delete(uint64Key(rec.Sequence)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// raiseFence records a fencing token greater than the recorded one, or
+// returns ErrFenced if it is lower.
+func raiseFence(tx *bolt.Tx, token uint64) error {
+	var fence uint64
+	if v := tx.Bucket(metaBucket).Get(fenceKey); v != nil {
+		fence = binary.BigEndian.Uint64(v)
+	}
+	if token < fence {
+		return errors.Wrapf(ErrFenced, "fencing token %d is lower than %d", token, fence)
+	}
+	if token == fence {
+		return nil
+	}
+	return tx.Bucket(metaBucket).Put(fenceKey, uint64Key(token))
+}
+
+// last returns the sequence and hash of the last record.
+func last(tx *bolt.Tx) (uint64, []byte, error) {
+	k, v := tx.Bucket(recordsBucket).Cursor().Last()
+	if k == nil {
+		return 0, genesisHash, nil
+	}
+	rec := &Record{}
+	if err := json.Unmarshal(v, rec); err != nil {
+		return 0, nil, errors.Wrap(err, "could not decode last record")
+	}
+	return rec.Sequence, rec.Hash, nil
+}
+
+func get(tx *bolt.Tx, seq uint64) (*Record, error) {
+	v := tx.Bucket(recordsBucket).Get(uint64Key(seq))
+	if v == nil {
+		return nil, errors.Errorf("no record at sequence %d", seq)
+	}
+	rec := &Record{}
+	if err := json.Unmarshal(v, rec); err != nil {
+		return nil, errors.Wrapf(err, "could not decode record %d", seq)
+	}
+	return rec, nil
+}
+
+// indexKey returns the key of a slot or epoch of a public key in the indexes.
+func indexKey(pubKey []byte, v uint64) []byte {
+	return append(pubKey[:48:48], uint64Key(v)...)
+}
+
+func uint64Key(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
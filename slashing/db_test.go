@@ -0,0 +1,285 @@
+package slashing
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	types "github.com/prysmaticlabs/eth2-types"
+	ethpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1"
+	validatorpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1/validator-client"
+)
+
+func setupDB(t *testing.T) *DB {
+	dir, err := ioutil.TempDir("", "slashing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := Open(filepath.Join(dir, "slashing-protection.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := db.Close(); err != nil {
+			t.Error(err)
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	})
+	return db
+}
+
+func blockRequest(slot types.Slot, root byte) *validatorpb.SignRequest {
+	return &validatorpb.SignRequest{
+		SigningRoot: []byte{root},
+		Object: &validatorpb.SignRequest_Block{
+			Block: &ethpb.BeaconBlock{Slot: slot},
+		},
+	}
+}
+
+func attestationRequest(source, target types.Epoch, root byte) *validatorpb.SignRequest {
+	return &validatorpb.SignRequest{
+		SigningRoot: []byte{root},
+		Object: &validatorpb.SignRequest_AttestationData{
+			AttestationData: &ethpb.AttestationData{
+				Source: &ethpb.Checkpoint{Epoch: source},
+				Target: &ethpb.Checkpoint{Epoch: target},
+			},
+		},
+	}
+}
+
+func TestDB_CheckAndRecord(t *testing.T) {
+	ctx := context.Background()
+	db := setupDB(t)
+	pubKey := [48]byte{1}
+	otherPubKey := [48]byte{2}
+
+	tests := []struct {
+		name          string
+		pubKey        [48]byte
+		req           *validatorpb.SignRequest
+		wantSlashable bool
+	}{
+		{name: "first block", pubKey: pubKey, req: blockRequest(10, 1)},
+		{name: "same block again", pubKey: pubKey, req: blockRequest(10, 1)},
+		{name: "double proposal", pubKey: pubKey, req: blockRequest(10, 2), wantSlashable: true},
+		{name: "block of another key", pubKey: otherPubKey, req: blockRequest(10, 2)},
+		{name: "first attestation", pubKey: pubKey, req: attestationRequest(2, 5, 1)},
+		{name: "same attestation again", pubKey: pubKey, req: attestationRequest(2, 5, 1)},
+		{name: "double vote", pubKey: pubKey, req: attestationRequest(2, 5, 2), wantSlashable: true},
+		{name: "surrounding vote", pubKey: pubKey, req: attestationRequest(1, 6, 1), wantSlashable: true},
+		{name: "surrounded vote", pubKey: pubKey, req: attestationRequest(3, 4, 1), wantSlashable: true},
+		{name: "next attestation", pubKey: pubKey, req: attestationRequest(5, 6, 1)},
+		{name: "source after target", pubKey: pubKey, req: attestationRequest(8, 7, 1), wantSlashable: true},
+		{name: "exit", pubKey: pubKey, req: &validatorpb.SignRequest{Object: &validatorpb.SignRequest_Exit{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := db.CheckAndRecord(ctx, tt.pubKey, tt.req)
+			if tt.wantSlashable != errors.Is(err, ErrSlashable) {
+				t.Errorf("Wanted slashable %v, received %v", tt.wantSlashable, err)
+			}
+		})
+	}
+	seq, _, err := db.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seq != 4 {
+		t.Errorf("Wanted 4 records, received %d", seq)
+	}
+}
+
+func TestDB_Apply(t *testing.T) {
+	ctx := context.Background()
+	leader, follower := setupDB(t), setupDB(t)
+	pubKey := [48]byte{1}
+	for slot := types.Slot(1); slot <= 3; slot++ {
+		if err := leader.CheckAndRecord(ctx, pubKey, blockRequest(slot, 1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	records, err := leader.Records(1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Wanted 3 records, received %d", len(records))
+	}
+
+	if err := follower.Apply(records[1]); !errors.Is(err, ErrOutOfOrder) {
+		t.Errorf("Wanted %v, received %v", ErrOutOfOrder, err)
+	}
+	for _, rec := range records {
+		if err := follower.Apply(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Applying a record twice is a no-op.
+	if err := follower.Apply(records[2]); err != nil {
+		t.Error(err)
+	}
+	leaderSeq, leaderHash, err := leader.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	followerSeq, followerHash, err := follower.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaderSeq != followerSeq || string(leaderHash) != string(followerHash) {
+		t.Errorf("Wanted follower head %d %#x, received %d %#x", leaderSeq, leaderHash, followerSeq, followerHash)
+	}
+	// The replicated history protects the follower too.
+	if err := follower.CheckAndRecord(ctx, pubKey, blockRequest(2, 2)); !errors.Is(err, ErrSlashable) {
+		t.Errorf("Wanted %v, received %v", ErrSlashable, err)
+	}
+
+	tampered := *records[2]
+	tampered.SigningRoot = []byte{2}
+	other := setupDB(t)
+	for _, rec := range []*Record{records[0], records[1], &tampered} {
+		err = other.Apply(rec)
+	}
+	if !errors.Is(err, ErrDiverged) {
+		t.Errorf("Wanted %v, received %v", ErrDiverged, err)
+	}
+}
+
+func TestDB_Fence(t *testing.T) {
+	ctx := context.Background()
+	db := setupDB(t)
+	pubKey := [48]byte{1}
+	if err := db.CheckAndRecord(WithFence(ctx, 1), pubKey, blockRequest(1, 1)); err != nil {
+		t.Fatal(err)
+	}
+	// A later leader raises the fence, after which the previous leader
+	// can neither write nor replicate records.
+	if err := db.RaiseFence(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CheckAndRecord(WithFence(ctx, 1), pubKey, blockRequest(2, 1)); !errors.Is(err, ErrFenced) {
+		t.Errorf("Wanted %v, received %v", ErrFenced, err)
+	}
+	other := setupDB(t)
+	rec, err := other.CheckAndAppend(ctx, pubKey, blockRequest(1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.ApplyFenced(rec, 1); !errors.Is(err, ErrFenced) {
+		t.Errorf("Wanted %v, received %v", ErrFenced, err)
+	}
+	if err := db.RaiseFence(1); !errors.Is(err, ErrFenced) {
+		t.Errorf("Wanted %v, received %v", ErrFenced, err)
+	}
+	if err := db.CheckAndRecord(WithFence(ctx, 2), pubKey, blockRequest(2, 1)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDB_ApplyFenced_ReplacesConflicting(t *testing.T) {
+	ctx := context.Background()
+	leader, follower := setupDB(t), setupDB(t)
+	pubKey := [48]byte{1}
+	if err := leader.CheckAndRecord(WithFence(ctx, 2), pubKey, blockRequest(1, 1)); err != nil {
+		t.Fatal(err)
+	}
+	// A previous leader recorded, but could not replicate and never signed,
+	// a conflicting block.
+	if err := follower.CheckAndRecord(WithFence(ctx, 1), pubKey, blockRequest(1, 2)); err != nil {
+		t.Fatal(err)
+	}
+	records, err := leader.Records(1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := follower.Apply(records[0]); !errors.Is(err, ErrDiverged) {
+		t.Errorf("Wanted %v, received %v", ErrDiverged, err)
+	}
+	if err := follower.ApplyFenced(records[0], 2); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := follower.HashAt(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(hash) != string(records[0].Hash) {
+		t.Errorf("Wanted hash %#x, received %#x", records[0].Hash, hash)
+	}
+	// The history of the leader replaced the conflicting block.
+	if err := follower.CheckAndRecord(WithFence(ctx, 2), pubKey, blockRequest(1, 1)); err != nil {
+		t.Error(err)
+	}
+	if err := follower.CheckAndRecord(WithFence(ctx, 2), pubKey, blockRequest(1, 2)); !errors.Is(err, ErrSlashable) {
+		t.Errorf("Wanted %v, received %v", ErrSlashable, err)
+	}
+}
+
+func TestDB_TruncateAfter(t *testing.T) {
+	ctx := context.Background()
+	db := setupDB(t)
+	pubKey := [48]byte{1}
+	if err := db.CheckAndRecord(ctx, pubKey, blockRequest(1, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CheckAndRecord(ctx, pubKey, attestationRequest(1, 2, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CheckAndRecord(ctx, pubKey, blockRequest(2, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.TruncateAfter(1); err != nil {
+		t.Fatal(err)
+	}
+	rec, err := db.Last()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec == nil || rec.Sequence != 1 {
+		t.Fatalf("Wanted last record at sequence 1, received %v", rec)
+	}
+	// The truncated records no longer protect their slot and epochs.
+	if err := db.CheckAndRecord(ctx, pubKey, attestationRequest(1, 2, 2)); err != nil {
+		t.Error(err)
+	}
+	if err := db.CheckAndRecord(ctx, pubKey, blockRequest(2, 2)); err != nil {
+		t.Error(err)
+	}
+	if err := db.CheckAndRecord(ctx, pubKey, blockRequest(1, 2)); !errors.Is(err, ErrSlashable) {
+		t.Errorf("Wanted %v, received %v", ErrSlashable, err)
+	}
+}
+
+func TestVerifySigningRoot(t *testing.T) {
+	attesterDomain := append([]byte{0x01, 0x00, 0x00, 0x00}, make([]byte, 28)...)
+	req := attestationRequest(1, 2, 1)
+	req.SignatureDomain = attesterDomain
+	if err := VerifySigningRoot(req); err == nil {
+		t.Error("Wanted error for a signing root of another object")
+	}
+	signingRoot, err := ComputeSigningRoot(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SigningRoot = signingRoot
+	if err := VerifySigningRoot(req); err != nil {
+		t.Error(err)
+	}
+	// The attestation in the domain of blocks is another message.
+	req.SignatureDomain = make([]byte, 32)
+	if err := VerifySigningRoot(req); err == nil {
+		t.Error("Wanted error for a domain of another type")
+	}
+	if err := VerifySigningRoot(&validatorpb.SignRequest{
+		SigningRoot: []byte{1},
+		Object:      &validatorpb.SignRequest_Slot{Slot: 1},
+	}); err != nil {
+		t.Errorf("Wanted roots of other objects unchecked, received %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+//go:build go1.18
+// +build go1.18
+
+package slashing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	types "github.com/prysmaticlabs/eth2-types"
+	ethpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1"
+	validatorpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1/validator-client"
+)
+
+// signed is a message recorded by the reference implementation.
+type signed struct {
+	pubKey      byte
+	block       bool
+	slot        types.Slot
+	source      types.Epoch
+	target      types.Epoch
+	signingRoot byte
+}
+
+// reference decides whether a message is slashable by comparing it with
+// every message signed before, as the specification defines slashings.
+type reference struct {
+	history []signed
+}
+
+// check returns whether m is slashable, and records it unless it is or
+// it was already signed.
+func (r *reference) check(m signed) bool {
+	if !m.block && m.source > m.target {
+		return true
+	}
+	for _, h := range r.history {
+		if h == m {
+			return false
+		}
+	}
+	for _, h := range r.history {
+		if h.pubKey != m.pubKey || h.block != m.block {
+			continue
+		}
+		if m.block && h.slot == m.slot {
+			return true
+		}
+		if !m.block && (h.target == m.target ||
+			h.source < m.source && h.target > m.target ||
+			h.source > m.source && h.target < m.target) {
+			return true
+		}
+	}
+	r.history = append(r.history, m)
+	return false
+}
+
+// FuzzDB_CheckAndRecord checks the slashing protection database against
+// the brute-force reference, on histories of blocks, and of attestations
+// which surround each other. Each group of 4 bytes of ops is a message:
+// its key and kind, its slot or source epoch, its target epoch and its
+// signing root. Epochs and roots are small for messages to conflict, and
+// the signing root commits to the data as it does on a real network.
+func FuzzDB_CheckAndRecord(f *testing.F) {
+	f.Add([]byte{0, 2, 5, 1, 0, 2, 5, 2, 0, 1, 6, 1, 0, 3, 4, 1, 0, 5, 6, 1})
+	f.Add([]byte{1, 10, 0, 1, 1, 10, 0, 1, 1, 10, 0, 2, 3, 10, 0, 2})
+	f.Add([]byte{0, 8, 7, 1, 2, 0, 15, 0, 0, 0, 15, 0})
+
+	f.Fuzz(func(t *testing.T, ops []byte) {
+		ctx := context.Background()
+		db := setupDB(t)
+		ref := &reference{}
+		for i := 0; i+4 <= len(ops) && i < 256; i += 4 {
+			m := signed{
+				pubKey:      ops[i] >> 1 & 1,
+				block:       ops[i]&1 == 1,
+				signingRoot: ops[i+3] & 1,
+			}
+			pubKey := [48]byte{m.pubKey}
+			var req *validatorpb.SignRequest
+			if m.block {
+				m.slot = types.Slot(ops[i+1] % 16)
+				req = blockRequest(m.slot, m.signingRoot)
+			} else {
+				m.source, m.target = types.Epoch(ops[i+1]%16), types.Epoch(ops[i+2]%16)
+				req = attestationRequest(m.source, m.target, m.signingRoot)
+				req.SigningRoot = []byte{byte(m.source), byte(m.target), m.signingRoot}
+			}
+			err := db.CheckAndRecord(ctx, pubKey, req)
+			if err != nil && !errors.Is(err, ErrSlashable) {
+				t.Fatal(err)
+			}
+			if want := ref.check(m); want != (err != nil) {
+				t.Fatalf("Message %d %+v: wanted slashable %v, received %v", i/4, m, want, err)
+			}
+		}
+	})
+}
+
+// FuzzRecordFromRequest checks that sign requests with missing or
+// inconsistent objects are never recorded, nor crash the signer.
+func FuzzRecordFromRequest(f *testing.F) {
+	f.Add(uint8(0), uint64(10), uint64(0), false)
+	f.Add(uint8(1), uint64(10), uint64(0), false)
+	f.Add(uint8(2), uint64(2), uint64(5), false)
+	f.Add(uint8(2), uint64(8), uint64(7), true)
+
+	f.Fuzz(func(t *testing.T, kind uint8, a, b uint64, missing bool) {
+		req := &validatorpb.SignRequest{SigningRoot: []byte{1}}
+		switch kind % 4 {
+		case 0:
+			block := &ethpb.BeaconBlock{Slot: types.Slot(a)}
+			if missing {
+				block = nil
+			}
+			req.Object = &validatorpb.SignRequest_Block{Block: block}
+		case 1:
+			block := &ethpb.BeaconBlockAltair{Slot: types.Slot(a)}
+			if missing {
+				block = nil
+			}
+			req.Object = &validatorpb.SignRequest_BlockV2{BlockV2: block}
+		case 2:
+			data := &ethpb.AttestationData{
+				Source: &ethpb.Checkpoint{Epoch: types.Epoch(a)},
+				Target: &ethpb.Checkpoint{Epoch: types.Epoch(b)},
+			}
+			if missing {
+				data.Target = nil
+			}
+			req.Object = &validatorpb.SignRequest_AttestationData{AttestationData: data}
+		default:
+			req.Object = &validatorpb.SignRequest_Slot{Slot: types.Slot(a)}
+		}
+		rec, err := RecordFromRequest([48]byte{1}, req)
+		if err != nil {
+			if rec != nil {
+				t.Fatalf("Wanted no record on error, received %+v", rec)
+			}
+			return
+		}
+		if rec == nil {
+			return
+		}
+		if rec.Kind == KindAttestation && rec.SourceEpoch > rec.TargetEpoch {
+			t.Fatalf("Recorded source epoch %d after target epoch %d", rec.SourceEpoch, rec.TargetEpoch)
+		}
+		if kind%4 < 2 && rec.Slot != types.Slot(a) {
+			t.Fatalf("Wanted slot %d, received %d", a, rec.Slot)
+		}
+	})
+}
@@ -0,0 +1,72 @@
+package slashing
+
+import (
+	"github.com/pkg/errors"
+	"github.com/prysmaticlabs/remote-signer/slashing/interchange"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Import appends the signing history of an EIP-3076 interchange to the log,
+// such as when migrating keys from another validator client, and returns the
+// number of records appended. Records whose signing root is unknown deny
+// signing any other message at their slot or target epoch. Records already
+// in the history are skipped, so importing the same interchange twice is
+// safe. Nothing is imported if any record conflicts with the history, or
+// with another record of the interchange, since the history could not deny
+// every message slashable with both.
+func (d *DB) Import(i *interchange.Interchange) (int, error) {
+	var records []*Record
+	for _, v := range i.Validators {
+		pubKey := append([]byte(nil), v.PublicKey[:]...)
+		for _, b := range v.Blocks {
+			records = append(records, &Record{
+				PublicKey:   pubKey,
+				Kind:        KindBlock,
+				Slot:        b.Slot,
+				SigningRoot: b.SigningRoot,
+			})
+		}
+		for _, a := range v.Attestations {
+			if a.SourceEpoch > a.TargetEpoch {
+				return 0, errors.Errorf(
+					"attestation of %#x with source epoch %d greater than target epoch %d",
+					v.PublicKey, a.SourceEpoch, a.TargetEpoch,
+				)
+			}
+			records = append(records, &Record{
+				PublicKey:   pubKey,
+				Kind:        KindAttestation,
+				SourceEpoch: a.SourceEpoch,
+				TargetEpoch: a.TargetEpoch,
+				SigningRoot: a.SigningRoot,
+			})
+		}
+	}
+	imported := 0
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		for _, rec := range records {
+			existing, err := check(tx, rec)
+			if err != nil {
+				return errors.Wrapf(err, "could not import record of %#x", rec.PublicKey)
+			}
+			if existing > 0 {
+				continue
+			}
+			seq, prevHash, err := last(tx)
+			if err != nil {
+				return err
+			}
+			rec.Sequence = seq + 1
+			rec.Hash = rec.computeHash(prevHash)
+			if err := put(tx, rec); err != nil {
+				return err
+			}
+			imported++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return imported, nil
+}
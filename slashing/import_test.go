@@ -0,0 +1,63 @@
+package slashing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/prysmaticlabs/remote-signer/slashing/interchange"
+)
+
+func TestDB_Import(t *testing.T) {
+	ctx := context.Background()
+	db := setupDB(t)
+	pubKey := [48]byte{1}
+	i := &interchange.Interchange{Validators: []*interchange.Validator{{
+		PublicKey: pubKey,
+		Blocks:    []*interchange.SignedBlock{{Slot: 5}},
+		Attestations: []*interchange.SignedAttestation{
+			{SourceEpoch: 1, TargetEpoch: 2, SigningRoot: []byte{2}},
+		},
+	}}}
+	imported, err := db.Import(i)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported != 2 {
+		t.Errorf("Wanted 2 records imported, received %d", imported)
+	}
+	// Importing the same history again is a no-op.
+	if imported, err := db.Import(i); err != nil || imported != 0 {
+		t.Errorf("Wanted no record imported again, received %d, %v", imported, err)
+	}
+
+	// A block of unknown signing root denies any block at its slot.
+	if err := db.CheckAndRecord(ctx, pubKey, blockRequest(5, 1)); !errors.Is(err, ErrSlashable) {
+		t.Errorf("Wanted %v for a block at an imported slot, received %v", ErrSlashable, err)
+	}
+	if err := db.CheckAndRecord(ctx, pubKey, attestationRequest(0, 3, 1)); !errors.Is(err, ErrSlashable) {
+		t.Errorf("Wanted %v for a vote surrounding an imported one, received %v", ErrSlashable, err)
+	}
+	if err := db.CheckAndRecord(ctx, pubKey, attestationRequest(1, 2, 2)); err != nil {
+		t.Errorf("Wanted the imported attestation signed again, received %v", err)
+	}
+
+	// Nothing is imported from a history conflicting with the database.
+	seq, _, err := db.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Import(&interchange.Interchange{Validators: []*interchange.Validator{{
+		PublicKey: pubKey,
+		Blocks:    []*interchange.SignedBlock{{Slot: 6}},
+		Attestations: []*interchange.SignedAttestation{
+			{SourceEpoch: 2, TargetEpoch: 2, SigningRoot: []byte{3}},
+		},
+	}}})
+	if !errors.Is(err, ErrSlashable) {
+		t.Errorf("Wanted %v for a conflicting history, received %v", ErrSlashable, err)
+	}
+	if head, _, err := db.Head(); err != nil || head != seq {
+		t.Errorf("Wanted history left at sequence %d, received %d, %v", seq, head, err)
+	}
+}
@@ -0,0 +1,37 @@
+//go:build go1.18
+// +build go1.18
+
+package interchange
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// FuzzParse decodes interchange files, which are imported from other
+// validator clients. Malformed files must be rejected without crashing, and
+// an accepted file must encode to one parsed to the same history.
+func FuzzParse(f *testing.F) {
+	f.Add([]byte(example))
+	f.Add([]byte(`{"metadata":{"interchange_format_version":"5","genesis_validators_root":"0x00"},"data":[]}`))
+	f.Add([]byte(`{"data":[null]}`))
+
+	f.Fuzz(func(t *testing.T, enc []byte) {
+		i, err := Parse(bytes.NewReader(enc))
+		if err != nil {
+			return
+		}
+		var buf bytes.Buffer
+		if err := i.Encode(&buf); err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := Parse(&buf)
+		if err != nil {
+			t.Fatalf("Could not parse encoded interchange: %v", err)
+		}
+		if !reflect.DeepEqual(decoded, i) {
+			t.Fatalf("Wanted %+v, received %+v", i, decoded)
+		}
+	})
+}
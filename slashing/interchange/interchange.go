@@ -0,0 +1,215 @@
+/*
+Package interchange parses slashing protection histories in the
+interchange format of EIP-3076, in which validator clients export the
+blocks and attestations they signed.
+*/
+package interchange
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	types "github.com/prysmaticlabs/eth2-types"
+)
+
+// FormatVersion is the version of the interchange format supported.
+const FormatVersion = "5"
+
+// Interchange is the slashing protection history of validators.
+type Interchange struct {
+	GenesisValidatorsRoot [32]byte
+	Validators            []*Validator
+}
+
+// Validator is the signing history of a validator key.
+type Validator struct {
+	PublicKey    [48]byte
+	Blocks       []*SignedBlock
+	Attestations []*SignedAttestation
+}
+
+// SignedBlock is a block signed by a validator. The signing root is
+// optional, and nil if it is unknown.
+type SignedBlock struct {
+	Slot        types.Slot
+	SigningRoot []byte
+}
+
+// SignedAttestation is an attestation signed by a validator. The signing
+// root is optional, and nil if it is unknown.
+type SignedAttestation struct {
+	SourceEpoch types.Epoch
+	TargetEpoch types.Epoch
+	SigningRoot []byte
+}
+
+// jsonInterchange is the JSON encoding of an interchange, where integers
+// are decimal strings and byte strings are 0x prefixed hex.
+type jsonInterchange struct {
+	Metadata struct {
+		InterchangeFormatVersion string `json:"interchange_format_version"`
+		GenesisValidatorsRoot    string `json:"genesis_validators_root"`
+	} `json:"metadata"`
+	Data []*jsonValidator `json:"data"`
+}
+
+type jsonValidator struct {
+	PublicKey          string                   `json:"pubkey"`
+	SignedBlocks       []*jsonSignedBlock       `json:"signed_blocks"`
+	SignedAttestations []*jsonSignedAttestation `json:"signed_attestations"`
+}
+
+type jsonSignedBlock struct {
+	Slot        string `json:"slot"`
+	SigningRoot string `json:"signing_root,omitempty"`
+}
+
+type jsonSignedAttestation struct {
+	SourceEpoch string `json:"source_epoch"`
+	TargetEpoch string `json:"target_epoch"`
+	SigningRoot string `json:"signing_root,omitempty"`
+}
+
+// Parse reads an interchange, and fails if it is not of the supported
+// version or any of its fields is malformed.
+func Parse(r io.Reader) (*Interchange, error) {
+	enc := &jsonInterchange{}
+	if err := json.NewDecoder(r).Decode(enc); err != nil {
+		return nil, errors.Wrap(err, "could not decode interchange")
+	}
+	if v := enc.Metadata.InterchangeFormatVersion; v != FormatVersion {
+		return nil, errors.Errorf("unsupported interchange format version %q, expected %q", v, FormatVersion)
+	}
+	i := &Interchange{Validators: make([]*Validator, 0, len(enc.Data))}
+	root, err := decodeHex(enc.Metadata.GenesisValidatorsRoot, 32)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not decode genesis validators root")
+	}
+	copy(i.GenesisValidatorsRoot[:], root)
+	for _, data := range enc.Data {
+		if data == nil {
+			return nil, errors.New("expected validator data")
+		}
+		v, err := parseValidator(data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not parse history of validator %s", data.PublicKey)
+		}
+		i.Validators = append(i.Validators, v)
+	}
+	return i, nil
+}
+
+func parseValidator(data *jsonValidator) (*Validator, error) {
+	pubKey, err := decodeHex(data.PublicKey, 48)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not decode public key")
+	}
+	v := &Validator{
+		Blocks:       make([]*SignedBlock, 0, len(data.SignedBlocks)),
+		Attestations: make([]*SignedAttestation, 0, len(data.SignedAttestations)),
+	}
+	copy(v.PublicKey[:], pubKey)
+	for _, b := range data.SignedBlocks {
+		if b == nil {
+			return nil, errors.New("expected signed block")
+		}
+		slot, err := strconv.ParseUint(b.Slot, 10, 64)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not parse block slot")
+		}
+		signingRoot, err := decodeSigningRoot(b.SigningRoot)
+		if err != nil {
+			return nil, err
+		}
+		v.Blocks = append(v.Blocks, &SignedBlock{Slot: types.Slot(slot), SigningRoot: signingRoot})
+	}
+	for _, a := range data.SignedAttestations {
+		if a == nil {
+			return nil, errors.New("expected signed attestation")
+		}
+		source, err := strconv.ParseUint(a.SourceEpoch, 10, 64)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not parse attestation source epoch")
+		}
+		target, err := strconv.ParseUint(a.TargetEpoch, 10, 64)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not parse attestation target epoch")
+		}
+		signingRoot, err := decodeSigningRoot(a.SigningRoot)
+		if err != nil {
+			return nil, err
+		}
+		v.Attestations = append(v.Attestations, &SignedAttestation{
+			SourceEpoch: types.Epoch(source),
+			TargetEpoch: types.Epoch(target),
+			SigningRoot: signingRoot,
+		})
+	}
+	return v, nil
+}
+
+// Encode writes an interchange in the JSON format of EIP-3076.
+func (i *Interchange) Encode(w io.Writer) error {
+	enc := &jsonInterchange{Data: make([]*jsonValidator, 0, len(i.Validators))}
+	enc.Metadata.InterchangeFormatVersion = FormatVersion
+	enc.Metadata.GenesisValidatorsRoot = encodeHex(i.GenesisValidatorsRoot[:])
+	for _, v := range i.Validators {
+		data := &jsonValidator{
+			PublicKey:          encodeHex(v.PublicKey[:]),
+			SignedBlocks:       make([]*jsonSignedBlock, 0, len(v.Blocks)),
+			SignedAttestations: make([]*jsonSignedAttestation, 0, len(v.Attestations)),
+		}
+		for _, b := range v.Blocks {
+			data.SignedBlocks = append(data.SignedBlocks, &jsonSignedBlock{
+				Slot:        strconv.FormatUint(uint64(b.Slot), 10),
+				SigningRoot: encodeHex(b.SigningRoot),
+			})
+		}
+		for _, a := range v.Attestations {
+			data.SignedAttestations = append(data.SignedAttestations, &jsonSignedAttestation{
+				SourceEpoch: strconv.FormatUint(uint64(a.SourceEpoch), 10),
+				TargetEpoch: strconv.FormatUint(uint64(a.TargetEpoch), 10),
+				SigningRoot: encodeHex(a.SigningRoot),
+			})
+		}
+		enc.Data = append(enc.Data, data)
+	}
+	return json.NewEncoder(w).Encode(enc)
+}
+
+// decodeSigningRoot decodes an optional signing root.
+func decodeSigningRoot(s string) ([]byte, error) {
+	if s == "" {
+		return nil, nil
+	}
+	root, err := decodeHex(s, 32)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not decode signing root")
+	}
+	return root, nil
+}
+
+func decodeHex(s string, wantLen int) ([]byte, error) {
+	if !strings.HasPrefix(s, "0x") {
+		return nil, errors.New("expected 0x prefixed hex")
+	}
+	b, err := hex.DecodeString(s[2:])
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != wantLen {
+		return nil, errors.Errorf("wrong byte length %d, expected %d", len(b), wantLen)
+	}
+	return b, nil
+}
+
+func encodeHex(b []byte) string {
+	if b == nil {
+		return ""
+	}
+	return "0x" + hex.EncodeToString(b)
+}
@@ -0,0 +1,96 @@
+package interchange
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// example is the example interchange of EIP-3076.
+const example = `{
+  "metadata": {
+    "interchange_format_version": "5",
+    "genesis_validators_root": "0x04700007fabc8282644aed6d1c7c9e21d38a03a0c4ba193f3afe428824b3a673"
+  },
+  "data": [
+    {
+      "pubkey": "0xb845089a1457f811bfc000588fbb4e713669be8ce060ea6be3c6ece09afc3794106c91ca73acda5e5457122d58723bed",
+      "signed_blocks": [
+        {
+          "slot": "81952",
+          "signing_root": "0x4ff6f743a43f3b4f95350831aeaf0a122a1a392922c45d804280284a69eb850b"
+        },
+        {
+          "slot": "81951"
+        }
+      ],
+      "signed_attestations": [
+        {
+          "source_epoch": "2290",
+          "target_epoch": "3007",
+          "signing_root": "0x587d6a4f59a58fe24f406e0502413e77fe1babddee641fda30034ed37ecc884d"
+        },
+        {
+          "source_epoch": "2290",
+          "target_epoch": "3008"
+        }
+      ]
+    }
+  ]
+}`
+
+func TestParse(t *testing.T) {
+	i, err := Parse(strings.NewReader(example))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(i.GenesisValidatorsRoot[:]) != "04700007fabc8282644aed6d1c7c9e21d38a03a0c4ba193f3afe428824b3a673" {
+		t.Errorf("Wrong genesis validators root %x", i.GenesisValidatorsRoot)
+	}
+	if len(i.Validators) != 1 {
+		t.Fatalf("Wanted 1 validator, received %d", len(i.Validators))
+	}
+	v := i.Validators[0]
+	if len(v.Blocks) != 2 || v.Blocks[0].Slot != 81952 || len(v.Blocks[0].SigningRoot) != 32 || v.Blocks[1].SigningRoot != nil {
+		t.Errorf("Wrong signed blocks %+v %+v", v.Blocks[0], v.Blocks[1])
+	}
+	if len(v.Attestations) != 2 || v.Attestations[1].SourceEpoch != 2290 || v.Attestations[1].TargetEpoch != 3008 {
+		t.Errorf("Wrong signed attestations %+v %+v", v.Attestations[0], v.Attestations[1])
+	}
+
+	var buf bytes.Buffer
+	if err := i.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Parse(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, i) {
+		t.Error("Wanted interchange unchanged by encoding")
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		old  string
+		new  string
+	}{
+		{name: "version", old: `"interchange_format_version": "5"`, new: `"interchange_format_version": "4"`},
+		{name: "genesis validators root", old: `"0x04700007`, new: `"04700007`},
+		{name: "public key", old: `"0xb845089a`, new: `"0xb845089`},
+		{name: "slot", old: `"81952"`, new: `"-1"`},
+		{name: "epoch", old: `"3008"`, new: `"18446744073709551616"`},
+		{name: "signing root", old: `"0x587d6a4f`, new: `"0x587d`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(strings.NewReader(strings.Replace(example, tt.old, tt.new, 1))); err == nil {
+				t.Error("Wanted error for invalid interchange")
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package slashing
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+	types "github.com/prysmaticlabs/eth2-types"
+	ethpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1"
+	validatorpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1/validator-client"
+)
+
+// Kind is the kind of slashable message a record was signed for.
+type Kind string
+
+// Kinds of slashable messages.
+const (
+	KindBlock       Kind = "block"
+	KindAttestation Kind = "attestation"
+)
+
+// Domain types of the slashable messages, as defined by the consensus specification.
+var (
+	domainBeaconProposer = []byte{0x00, 0x00, 0x00, 0x00}
+	domainBeaconAttester = []byte{0x01, 0x00, 0x00, 0x00}
+)
+
+// Record is an entry of the signing history. Records form an append-only
+// log numbered by sequence, where the hash of each record commits to the
+// hash of the previous one, so two databases holding the same hash at a
+// sequence hold the same history up to it.
+type Record struct {
+	Sequence    uint64      `json:"sequence"`
+	PublicKey   []byte      `json:"public_key"`
+	Kind        Kind        `json:"kind"`
+	Slot        types.Slot  `json:"slot,omitempty"`
+	SourceEpoch types.Epoch `json:"source_epoch,omitempty"`
+	TargetEpoch types.Epoch `json:"target_epoch,omitempty"`
+	SigningRoot []byte      `json:"signing_root"`
+	// Fence is the fencing token of the leader which appended the record, if any.
+	Fence uint64 `json:"fence,omitempty"`
+	Hash  []byte `json:"hash"`
+}
+
+// RecordFromRequest returns the record of a slashable sign request,
+// or nil if signing the request can never be slashed.
+func RecordFromRequest(pubKey [48]byte, req *validatorpb.SignRequest) (*Record, error) {
+	rec := &Record{
+		PublicKey:   pubKey[:],
+		SigningRoot: req.SigningRoot,
+	}
+	switch o := req.Object.(type) {
+	case *validatorpb.SignRequest_Block:
+		if o.Block == nil {
+			return nil, errors.New("expected block in request")
+		}
+		rec.Kind, rec.Slot = KindBlock, o.Block.Slot
+	case *validatorpb.SignRequest_BlockV2:
+		if o.BlockV2 == nil {
+			return nil, errors.New("expected block in request")
+		}
+		rec.Kind, rec.Slot = KindBlock, o.BlockV2.Slot
+	case *validatorpb.SignRequest_AttestationData:
+		data := o.AttestationData
+		if data == nil || data.Source == nil || data.Target == nil {
+			return nil, errors.New("expected attestation data with source and target checkpoints in request")
+		}
+		if data.Source.Epoch > data.Target.Epoch {
+			return nil, errors.Errorf(
+				"source epoch %d is greater than target epoch %d", data.Source.Epoch, data.Target.Epoch,
+			)
+		}
+		rec.Kind, rec.SourceEpoch, rec.TargetEpoch = KindAttestation, data.Source.Epoch, data.Target.Epoch
+	default:
+		return nil, nil
+	}
+	return rec, nil
+}
+
+// ComputeSigningRoot returns the root signed for the block or attestation of
+// a sign request in its signature domain, which must be of the domain type
+// of the object. It returns nil for the requests of other objects.
+func ComputeSigningRoot(req *validatorpb.SignRequest) ([]byte, error) {
+	var objectRoot [32]byte
+	var domainType []byte
+	var err error
+	switch o := req.Object.(type) {
+	case *validatorpb.SignRequest_Block:
+		if o.Block == nil {
+			return nil, errors.New("expected block in request")
+		}
+		objectRoot, err = o.Block.HashTreeRoot()
+		domainType = domainBeaconProposer
+	case *validatorpb.SignRequest_BlockV2:
+		if o.BlockV2 == nil {
+			return nil, errors.New("expected block in request")
+		}
+		objectRoot, err = o.BlockV2.HashTreeRoot()
+		domainType = domainBeaconProposer
+	case *validatorpb.SignRequest_AttestationData:
+		if o.AttestationData == nil {
+			return nil, errors.New("expected attestation data in request")
+		}
+		objectRoot, err = o.AttestationData.HashTreeRoot()
+		domainType = domainBeaconAttester
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "could not compute object root")
+	}
+	if len(req.SignatureDomain) != 32 || !bytes.Equal(req.SignatureDomain[:4], domainType) {
+		return nil, errors.Errorf("signature domain %#x is not of domain type %#x", req.SignatureDomain, domainType)
+	}
+	signingRoot, err := (&ethpb.SigningData{
+		ObjectRoot: objectRoot[:],
+		Domain:     req.SignatureDomain,
+	}).HashTreeRoot()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not compute signing root")
+	}
+	return signingRoot[:], nil
+}
+
+// VerifySigningRoot checks that the signing root of a block or attestation
+// sign request is computed from its object. Records identify messages by
+// the slot or epochs of their object, so a request signing the root of
+// another object would otherwise be recorded as a different message than
+// the one signed.
+func VerifySigningRoot(req *validatorpb.SignRequest) error {
+	signingRoot, err := ComputeSigningRoot(req)
+	if err != nil {
+		return err
+	}
+	if signingRoot != nil && !bytes.Equal(signingRoot, req.SigningRoot) {
+		return errors.Errorf("signing root %#x is not the root %#x of the object in its domain", req.SigningRoot, signingRoot)
+	}
+	return nil
+}
+
+// computeHash returns the hash of a record chained to the hash of the previous record.
+func (r *Record) computeHash(prevHash []byte) []byte {
+	h := sha256.New()
+	var buf [8]byte
+	write := func(b []byte) {
+		// Writing to a hash never fails.
+		_, _ = h.Write(b)
+	}
+	writeUint64 := func(v uint64) {
+		binary.BigEndian.PutUint64(buf[:], v)
+		write(buf[:])
+	}
+	write(prevHash)
+	writeUint64(r.Sequence)
+	write(r.PublicKey)
+	write([]byte(r.Kind))
+	writeUint64(uint64(r.Slot))
+	writeUint64(uint64(r.SourceEpoch))
+	writeUint64(uint64(r.TargetEpoch))
+	write(r.SigningRoot)
+	// Records of signers without a leader have no fencing token, and keep
+	// the hash they had before fencing tokens were recorded.
+	if r.Fence != 0 {
+		writeUint64(r.Fence)
+	}
+	return h.Sum(nil)
+}
+
+// verifyHash checks the hash of a record against the hash of the previous record.
+func (r *Record) verifyHash(prevHash []byte) bool {
+	return bytes.Equal(r.Hash, r.computeHash(prevHash))
+}
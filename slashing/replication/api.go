@@ -0,0 +1,226 @@
+/*
+Package replication replicates the slashing protection history between signer
+instances. Each new record is streamed to the peer signers, and a signature is
+only returned once a quorum of them have durably stored the record, so the
+history survives the loss of the signer which produced it.
+*/
+package replication
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/prysmaticlabs/remote-signer/rpc/jsoncodec"
+	"github.com/prysmaticlabs/remote-signer/slashing"
+	"google.golang.org/grpc"
+)
+
+// ServiceName is the fully qualified gRPC service name of the replication API.
+const ServiceName = "remotesigner.replication.v1.Replication"
+
+// Ack is sent by a peer when a replication stream is opened, with the sequence
+// of its last record, and then in response to every record it received.
+type Ack struct {
+	Sequence uint64 `json:"sequence"`
+	Error    string `json:"error,omitempty"`
+}
+
+// StatusRequest is the request of the Status method.
+type StatusRequest struct {
+	// Sequence of the record whose hash is requested, if any.
+	Sequence uint64 `json:"sequence,omitempty"`
+	// Fence, if set, is the fencing token of a new leader syncing its
+	// history, which the peer then requires from replicated records.
+	Fence uint64 `json:"fence,omitempty"`
+}
+
+// StatusResponse is the response of the Status method.
+type StatusResponse struct {
+	LastSequence uint64 `json:"last_sequence"`
+	LastHash     []byte `json:"last_hash"`
+	// LastFence is the fencing token of the last record.
+	LastFence uint64 `json:"last_fence,omitempty"`
+	// Hash of the record at the requested sequence, unset if the peer does not have it yet.
+	Hash []byte `json:"hash,omitempty"`
+}
+
+// RecordsRequest is the request of the Records method.
+type RecordsRequest struct {
+	From  uint64 `json:"from"`
+	Limit int    `json:"limit"`
+}
+
+// RecordsResponse is the response of the Records method.
+type RecordsResponse struct {
+	Records []*slashing.Record `json:"records"`
+}
+
+// Server is the server API of the replication service.
+type Server interface {
+	Replicate(ReplicateServer) error
+	Status(context.Context, *StatusRequest) (*StatusResponse, error)
+	Records(context.Context, *RecordsRequest) (*RecordsResponse, error)
+}
+
+// ReplicateServer is the server side of a replication stream.
+type ReplicateServer interface {
+	Send(*Ack) error
+	Recv() (*slashing.Record, error)
+	grpc.ServerStream
+}
+
+type replicateServer struct {
+	grpc.ServerStream
+}
+
+func (s *replicateServer) Send(ack *Ack) error {
+	return s.ServerStream.SendMsg(ack)
+}
+
+func (s *replicateServer) Recv() (*slashing.Record, error) {
+	rec := new(slashing.Record)
+	if err := s.ServerStream.RecvMsg(rec); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// RegisterServer registers a replication server implementation on a gRPC server.
+func RegisterServer(s *grpc.Server, srv Server) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*Server)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Status",
+			Handler: unaryHandler("Status", func() interface{} { return new(StatusRequest) },
+				func(ctx context.Context, srv Server, req interface{}) (interface{}, error) {
+					return srv.Status(ctx, req.(*StatusRequest))
+				},
+			),
+		},
+		{
+			MethodName: "Records",
+			Handler: unaryHandler("Records", func() interface{} { return new(RecordsRequest) },
+				func(ctx context.Context, srv Server, req interface{}) (interface{}, error) {
+					return srv.Records(ctx, req.(*RecordsRequest))
+				},
+			),
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "Replicate",
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				return srv.(Server).Replicate(&replicateServer{stream})
+			},
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "slashing/replication/api.go",
+}
+
+type handlerFunc func(ctx context.Context, srv Server, req interface{}) (interface{}, error)
+
+// unaryHandler builds a gRPC method handler which decodes the request,
+// and runs the server interceptors before calling the server method.
+func unaryHandler(
+	method string, newReq func() interface{}, call handlerFunc,
+) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	fullMethod := fmt.Sprintf("/%s/%s", ServiceName, method)
+	return func(
+		srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor,
+	) (interface{}, error) {
+		req := newReq()
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return call(ctx, srv.(Server), req)
+		}
+		info := &grpc.UnaryServerInfo{
+			Server:     srv,
+			FullMethod: fullMethod,
+		}
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			return call(ctx, srv.(Server), req)
+		}
+		return interceptor(ctx, req, info, handler)
+	}
+}
+
+// Client is the client API of the replication service.
+type Client interface {
+	Replicate(ctx context.Context, opts ...grpc.CallOption) (ReplicateClient, error)
+	Status(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (*StatusResponse, error)
+	Records(ctx context.Context, in *RecordsRequest, opts ...grpc.CallOption) (*RecordsResponse, error)
+}
+
+// ReplicateClient is the client side of a replication stream.
+type ReplicateClient interface {
+	Send(*slashing.Record) error
+	Recv() (*Ack, error)
+	grpc.ClientStream
+}
+
+type replicateClient struct {
+	grpc.ClientStream
+}
+
+func (c *replicateClient) Send(rec *slashing.Record) error {
+	return c.ClientStream.SendMsg(rec)
+}
+
+func (c *replicateClient) Recv() (*Ack, error) {
+	ack := new(Ack)
+	if err := c.ClientStream.RecvMsg(ack); err != nil {
+		return nil, err
+	}
+	return ack, nil
+}
+
+type client struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewClient instantiates a replication client on top of a gRPC connection.
+func NewClient(cc grpc.ClientConnInterface) Client {
+	return &client{cc: cc}
+}
+
+// Replicate opens a stream sending records to the peer.
+func (c *client) Replicate(ctx context.Context, opts ...grpc.CallOption) (ReplicateClient, error) {
+	opts = append([]grpc.CallOption{grpc.CallContentSubtype(jsoncodec.Name)}, opts...)
+	stream, err := c.cc.NewStream(ctx, &serviceDesc.Streams[0], fmt.Sprintf("/%s/Replicate", ServiceName), opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &replicateClient{stream}, nil
+}
+
+// Status returns the head of the signing history of the peer, and the hash of a record.
+func (c *client) Status(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (*StatusResponse, error) {
+	out := new(StatusResponse)
+	if err := c.invoke(ctx, "Status", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Records returns records of the signing history of the peer.
+func (c *client) Records(ctx context.Context, in *RecordsRequest, opts ...grpc.CallOption) (*RecordsResponse, error) {
+	out := new(RecordsResponse)
+	if err := c.invoke(ctx, "Records", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *client) invoke(ctx context.Context, method string, in, out interface{}, opts ...grpc.CallOption) error {
+	opts = append([]grpc.CallOption{grpc.CallContentSubtype(jsoncodec.Name)}, opts...)
+	return c.cc.Invoke(ctx, fmt.Sprintf("/%s/%s", ServiceName, method), in, out, opts...)
+}
@@ -0,0 +1,73 @@
+package replication
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// Peer describes how to connect to another signer of the replication cluster.
+type Peer struct {
+	Address       string `json:"address"`
+	TLSCAPath     string `json:"tls_ca_path"`
+	TLSServerName string `json:"tls_server_name,omitempty"`
+}
+
+// LoadPeers reads the JSON list of peer signers of the replication cluster.
+func LoadPeers(path string) ([]*Peer, error) {
+	enc, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read peers file %s", path)
+	}
+	var peers []*Peer
+	if err := json.Unmarshal(enc, &peers); err != nil {
+		return nil, errors.Wrapf(err, "could not parse peers file %s", path)
+	}
+	return peers, nil
+}
+
+// DialPeers connects to every peer over TLS, authenticating with the shared
+// token. It returns the clients by peer address, and a function closing
+// every connection.
+func DialPeers(peers []*Peer, token string) (map[string]Client, func() error, error) {
+	clients := make(map[string]Client, len(peers))
+	conns := make([]*grpc.ClientConn, 0, len(peers))
+	closeAll := func() error {
+		var firstErr error
+		for _, conn := range conns {
+			if err := conn.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		return firstErr
+	}
+	for _, p := range peers {
+		if _, ok := clients[p.Address]; ok {
+			return nil, nil, errors.Errorf("duplicate peer %s", p.Address)
+		}
+		creds, err := credentials.NewClientTLSFromFile(p.TLSCAPath, p.TLSServerName)
+		if err != nil {
+			if closeErr := closeAll(); closeErr != nil {
+				log.WithError(closeErr).Error("Could not close peer connections")
+			}
+			return nil, nil, errors.Wrapf(err, "could not load TLS CA for peer %s", p.Address)
+		}
+		conn, err := grpc.Dial(
+			p.Address,
+			grpc.WithTransportCredentials(creds),
+			grpc.WithPerRPCCredentials(NewTokenCredentials(token)),
+		)
+		if err != nil {
+			if closeErr := closeAll(); closeErr != nil {
+				log.WithError(closeErr).Error("Could not close peer connections")
+			}
+			return nil, nil, errors.Wrapf(err, "could not dial peer %s", p.Address)
+		}
+		conns = append(conns, conn)
+		clients[p.Address] = NewClient(conn)
+	}
+	return clients, closeAll, nil
+}
@@ -0,0 +1,441 @@
+package replication
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	validatorpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1/validator-client"
+	"github.com/prysmaticlabs/remote-signer/slashing"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var log = logrus.WithField("prefix", "replication")
+
+// Defaults of the replicator configuration.
+const (
+	DefaultTimeout       = 2 * time.Second
+	DefaultRetryInterval = time.Second
+)
+
+// batchSize is the number of records sent or fetched at once when catching up.
+const batchSize = 100
+
+// ErrNoQuorum is returned when a record could not be stored by a quorum of peers.
+var ErrNoQuorum = errors.New("no quorum of peers")
+
+// errFenceChanged closes replication streams opened with a previous fencing token.
+var errFenceChanged = errors.New("fencing token changed")
+
+// Config options for the replicator.
+type Config struct {
+	// DB is the local slashing protection database.
+	DB *slashing.DB
+	// Peers are the clients of the other signers, by address.
+	Peers map[string]Client
+	// Quorum is the number of peers which must store a record before it is
+	// signed. It defaults to the number of peers which, with this signer,
+	// form a majority of the cluster.
+	Quorum int
+	// Timeout bounds how long signing waits for a quorum of peers.
+	Timeout time.Duration
+	// RetryInterval is the delay before reopening a failed replication stream.
+	RetryInterval time.Duration
+}
+
+// peer tracks the replication of the signing history to a peer.
+type peer struct {
+	address string
+	client  Client
+	// acked is the sequence up to which the peer stored the local history.
+	acked  uint64
+	notify chan struct{}
+}
+
+// Replicator is a slashing protector which replicates every new record to
+// a quorum of peers before allowing to sign it. Peers lagging behind, such
+// as after a restart, are caught up with the records they missed.
+type Replicator struct {
+	cfg     *Config
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	lock    sync.Mutex
+	peers   []*peer
+	changed chan struct{}
+	// fence is the fencing token of the last leadership of this signer,
+	// sent to peers with the records it replicates.
+	fence uint64
+}
+
+// NewReplicator instantiates a replicator of the local slashing protection database.
+func NewReplicator(cfg *Config) (*Replicator, error) {
+	if cfg.DB == nil || len(cfg.Peers) == 0 {
+		return nil, errors.New("expected a slashing protection database and peers")
+	}
+	if cfg.Quorum == 0 {
+		cfg.Quorum = (len(cfg.Peers) + 1) / 2
+	}
+	if cfg.Quorum < 0 || cfg.Quorum > len(cfg.Peers) {
+		return nil, errors.Errorf("quorum %d is out of range for %d peers", cfg.Quorum, len(cfg.Peers))
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.RetryInterval == 0 {
+		cfg.RetryInterval = DefaultRetryInterval
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Replicator{
+		cfg:     cfg,
+		ctx:     ctx,
+		cancel:  cancel,
+		changed: make(chan struct{}),
+	}
+	for address, client := range cfg.Peers {
+		r.peers = append(r.peers, &peer{
+			address: address,
+			client:  client,
+			notify:  make(chan struct{}, 1),
+		})
+	}
+	return r, nil
+}
+
+// Start streaming the signing history to every peer in the background.
+func (r *Replicator) Start() {
+	for _, p := range r.peers {
+		r.wg.Add(1)
+		go func(p *peer) {
+			defer r.wg.Done()
+			r.runPeer(p)
+		}(p)
+	}
+	log.WithFields(logrus.Fields{
+		"numPeers": len(r.peers),
+		"quorum":   r.cfg.Quorum,
+	}).Info("Replicating slashing protection history")
+}
+
+// Stop streaming to peers.
+func (r *Replicator) Stop() {
+	r.cancel()
+	r.wg.Wait()
+}
+
+// CheckAndRecord checks a sign request against the local signing history and
+// records it, then waits until a quorum of peers stored the record. If they do
+// not in time, the request must not be signed, but the record is kept so this
+// signer never signs a conflicting message. It is replicated once peers are
+// reachable again, or, as it was never signed, replaced by the history of a
+// later leader which does not hold it.
+func (r *Replicator) CheckAndRecord(ctx context.Context, pubKey [48]byte, req *validatorpb.SignRequest) error {
+	rec, err := r.cfg.DB.CheckAndAppend(ctx, pubKey, req)
+	if err != nil || rec == nil {
+		return err
+	}
+	for _, p := range r.peers {
+		select {
+		case p.notify <- struct{}{}:
+		default:
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.cfg.Timeout)
+	defer cancel()
+	return r.waitQuorum(ctx, rec.Sequence)
+}
+
+// waitQuorum blocks until a quorum of peers stored the record at a sequence.
+func (r *Replicator) waitQuorum(ctx context.Context, seq uint64) error {
+	for {
+		r.lock.Lock()
+		acked := 0
+		for _, p := range r.peers {
+			if p.acked >= seq {
+				acked++
+			}
+		}
+		changed := r.changed
+		r.lock.Unlock()
+		if acked >= r.cfg.Quorum {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return errors.Wrapf(ErrNoQuorum, "record %d stored by %d peers, expected %d", seq, acked, r.cfg.Quorum)
+		}
+	}
+}
+
+// setAcked records that a peer stored the local history up to a sequence.
+func (r *Replicator) setAcked(p *peer, seq uint64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if seq <= p.acked {
+		return
+	}
+	p.acked = seq
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+func (r *Replicator) getAcked(p *peer) uint64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return p.acked
+}
+
+// runPeer keeps a replication stream open to a peer until the replicator is stopped.
+func (r *Replicator) runPeer(p *peer) {
+	for {
+		err := r.replicate(p)
+		if r.ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, errFenceChanged) {
+			continue
+		}
+		if status.Code(errors.Cause(err)) == codes.FailedPrecondition {
+			// Peers reject the streams of signers which are not the leader.
+			log.WithError(err).WithField("peer", p.address).Debug("Replication stream to peer fenced")
+		} else {
+			log.WithError(err).WithField("peer", p.address).Warn("Replication stream to peer failed")
+		}
+		select {
+		case <-time.After(r.cfg.RetryInterval):
+		case <-r.ctx.Done():
+			return
+		}
+	}
+}
+
+func (r *Replicator) getFence() uint64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.fence
+}
+
+// replicate opens a replication stream to a peer, catches it up from its last
+// record, then streams every new record until the stream fails, or until the
+// signer becomes the leader with a new fencing token.
+func (r *Replicator) replicate(p *peer) error {
+	ctx, cancel := context.WithCancel(r.ctx)
+	defer cancel()
+	fence := r.getFence()
+	stream, err := p.client.Replicate(withFencingToken(ctx, fence))
+	if err != nil {
+		return errors.Wrap(err, "could not open replication stream")
+	}
+	hello, err := stream.Recv()
+	if err != nil {
+		return errors.Wrap(err, "could not receive peer head")
+	}
+	if err := r.checkConsistency(ctx, p, hello.Sequence); err != nil {
+		return err
+	}
+	for {
+		records, err := r.cfg.DB.Records(r.getAcked(p)+1, batchSize)
+		if err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			select {
+			case <-p.notify:
+				if r.getFence() != fence {
+					return errFenceChanged
+				}
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		for _, rec := range records {
+			if err := stream.Send(rec); err != nil {
+				return errors.Wrap(err, "could not send record")
+			}
+		}
+		for range records {
+			ack, err := stream.Recv()
+			if err != nil {
+				return errors.Wrap(err, "could not receive acknowledgement")
+			}
+			if ack.Error != "" {
+				return errors.Errorf("peer could not store record %d: %s", ack.Sequence, ack.Error)
+			}
+			r.setAcked(p, ack.Sequence)
+		}
+	}
+}
+
+// checkConsistency compares the history of a peer whose last record is at
+// peerSeq with the local one, and records their common prefix as acknowledged.
+// The records of the peer following it conflict with the history of this
+// signer, and are replaced by the peer once streamed, if this signer is the
+// leader.
+func (r *Replicator) checkConsistency(ctx context.Context, p *peer, peerSeq uint64) error {
+	seq, _, err := r.cfg.DB.Head()
+	if err != nil {
+		return err
+	}
+	common, err := r.commonPrefix(ctx, p, seq, peerSeq)
+	if err != nil {
+		return err
+	}
+	if common < seq && common < peerSeq {
+		log.WithFields(logrus.Fields{
+			"peer":     p.address,
+			"sequence": common + 1,
+		}).Warn("Peer holds records conflicting with the local history")
+	}
+	r.setAcked(p, common)
+	return nil
+}
+
+// commonPrefix returns the last sequence at which the history of a peer,
+// whose last record is at peerSeq, holds the same record as the local history
+// whose last record is at seq. Hashes are chained, so histories holding the
+// same record at a sequence hold the same records before it.
+func (r *Replicator) commonPrefix(ctx context.Context, p *peer, seq, peerSeq uint64) (uint64, error) {
+	if peerSeq < seq {
+		seq = peerSeq
+	}
+	same := func(seq uint64) (bool, error) {
+		hash, err := r.cfg.DB.HashAt(seq)
+		if err != nil {
+			return false, err
+		}
+		res, err := p.client.Status(ctx, &StatusRequest{Sequence: seq})
+		if err != nil {
+			return false, errors.Wrap(err, "could not fetch peer status")
+		}
+		return bytes.Equal(res.Hash, hash), nil
+	}
+	if seq == 0 {
+		return 0, nil
+	}
+	ok, err := same(seq)
+	if err != nil || ok {
+		return seq, err
+	}
+	// Histories always share the genesis, and differ at hi.
+	lo, hi := uint64(0), seq
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		ok, err := same(mid)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return lo, nil
+}
+
+// Sync brings the local signing history up to date with the peers before
+// signing as a new leader. Every record acknowledged by a quorum of peers is
+// stored by at least one of the peers needed to respond, and the most up to
+// date history among them, whose last record has the greatest fencing token,
+// then the greatest sequence, holds all of them: the local history is made
+// identical to it. The peers which respond also record the fencing token of
+// the new leader, so they reject the records of the previous leader from
+// then on.
+func (r *Replicator) Sync(ctx context.Context, token uint64) error {
+	if err := r.cfg.DB.RaiseFence(token); err != nil {
+		return err
+	}
+	r.lock.Lock()
+	r.fence = token
+	r.lock.Unlock()
+	for _, p := range r.peers {
+		select {
+		case p.notify <- struct{}{}:
+		default:
+		}
+	}
+	var bestSeq, bestFence uint64
+	lastRec, err := r.cfg.DB.Last()
+	if err != nil {
+		return err
+	}
+	if lastRec != nil {
+		bestSeq, bestFence = lastRec.Sequence, lastRec.Fence
+	}
+	var best *peer
+	needed := len(r.peers) - r.cfg.Quorum
+	responded := 0
+	for _, p := range r.peers {
+		res, err := p.client.Status(ctx, &StatusRequest{Fence: token})
+		if err != nil {
+			log.WithError(err).WithField("peer", p.address).Warn("Could not sync slashing protection history")
+			continue
+		}
+		responded++
+		if res.LastFence > bestFence || res.LastFence == bestFence && res.LastSequence > bestSeq {
+			best, bestSeq, bestFence = p, res.LastSequence, res.LastFence
+		}
+	}
+	if responded < needed {
+		return errors.Wrapf(ErrNoQuorum, "synced with %d peers, expected %d", responded, needed)
+	}
+	if best != nil {
+		if err := r.syncFrom(ctx, best, bestSeq); err != nil {
+			return errors.Wrapf(err, "could not sync with peer %s", best.address)
+		}
+	}
+	seq, _, err := r.cfg.DB.Head()
+	if err != nil {
+		return err
+	}
+	log.WithField("sequence", seq).Info("Synced slashing protection history")
+	return nil
+}
+
+// syncFrom makes the local history identical to the history of a peer whose
+// last record is at peerSeq: local records conflicting with it were never
+// signed and are deleted, then the records of the peer which are missing
+// locally are fetched.
+func (r *Replicator) syncFrom(ctx context.Context, p *peer, peerSeq uint64) error {
+	seq, _, err := r.cfg.DB.Head()
+	if err != nil {
+		return err
+	}
+	common, err := r.commonPrefix(ctx, p, seq, peerSeq)
+	if err != nil {
+		return err
+	}
+	if common < seq {
+		log.WithFields(logrus.Fields{
+			"peer":     p.address,
+			"sequence": common + 1,
+		}).Warn("Deleting local records conflicting with the history of the peer")
+		if err := r.cfg.DB.TruncateAfter(common); err != nil {
+			return err
+		}
+	}
+	for {
+		seq, _, err := r.cfg.DB.Head()
+		if err != nil {
+			return err
+		}
+		res, err := p.client.Records(ctx, &RecordsRequest{From: seq + 1, Limit: batchSize})
+		if err != nil {
+			return errors.Wrap(err, "could not fetch records")
+		}
+		if len(res.Records) == 0 {
+			return nil
+		}
+		for _, rec := range res.Records {
+			if err := r.cfg.DB.Apply(rec); err != nil {
+				return err
+			}
+		}
+	}
+}
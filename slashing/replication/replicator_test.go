@@ -0,0 +1,416 @@
+package replication
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	types "github.com/prysmaticlabs/eth2-types"
+	ethpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1"
+	validatorpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1/validator-client"
+	"github.com/prysmaticlabs/remote-signer/slashing"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const testToken = "secret"
+
+// testPeer is a signer of the replication cluster served in-process.
+type testPeer struct {
+	db *slashing.DB
+
+	lock   sync.Mutex
+	server *grpc.Server
+	lis    *bufconn.Listener
+}
+
+func (p *testPeer) stop() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.server.Stop()
+}
+
+func (p *testPeer) listener() *bufconn.Listener {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.lis
+}
+
+// testCluster holds the in-process peers of a replication cluster,
+// all sharing a self-signed TLS certificate.
+type testCluster struct {
+	t       *testing.T
+	dir     string
+	cert    tls.Certificate
+	certCAs *x509.CertPool
+}
+
+func newTestCluster(t *testing.T) *testCluster {
+	dir, err := ioutil.TempDir("", "replication")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	})
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "signer"},
+		DNSNames:     []string{"signer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(parsed)
+	return &testCluster{
+		t:       t,
+		dir:     dir,
+		cert:    tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key},
+		certCAs: pool,
+	}
+}
+
+// newDB opens a slashing protection database closed at the end of the test.
+func (c *testCluster) newDB(name string) *slashing.DB {
+	db, err := slashing.Open(filepath.Join(c.dir, name+".db"))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.t.Cleanup(func() {
+		if err := db.Close(); err != nil {
+			c.t.Error(err)
+		}
+	})
+	return db
+}
+
+// startPeer serves the replication API of a database in-process.
+func (c *testCluster) startPeer(db *slashing.DB) *testPeer {
+	p := &testPeer{db: db}
+	c.restartPeer(p)
+	return p
+}
+
+// restartPeer serves the replication API of a stopped peer again.
+func (c *testCluster) restartPeer(p *testPeer) {
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(grpc.Creds(credentials.NewServerTLSFromCert(&c.cert)))
+	RegisterServer(server, NewDBServer(p.db, testToken))
+	go func() {
+		if err := server.Serve(lis); err != nil {
+			c.t.Log(err)
+		}
+	}()
+	c.t.Cleanup(server.Stop)
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.server, p.lis = server, lis
+}
+
+// dial connects to an in-process peer, authenticating with token.
+func (c *testCluster) dial(p *testPeer, token string) Client {
+	conn, err := grpc.Dial(
+		"signer",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return p.listener().Dial()
+		}),
+		// Reconnect quickly to restarted peers.
+		grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff:           backoff.Config{BaseDelay: 10 * time.Millisecond, Multiplier: 1, MaxDelay: 10 * time.Millisecond},
+			MinConnectTimeout: time.Second,
+		}),
+		grpc.WithTransportCredentials(credentials.NewClientTLSFromCert(c.certCAs, "signer")),
+		grpc.WithPerRPCCredentials(NewTokenCredentials(token)),
+	)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.t.Cleanup(func() {
+		if err := conn.Close(); err != nil {
+			c.t.Error(err)
+		}
+	})
+	return NewClient(conn)
+}
+
+func blockRequest(slot types.Slot) *validatorpb.SignRequest {
+	return &validatorpb.SignRequest{
+		SigningRoot: []byte{1},
+		Object: &validatorpb.SignRequest_Block{
+			Block: &ethpb.BeaconBlock{Slot: slot},
+		},
+	}
+}
+
+func startReplicator(t *testing.T, cfg *Config) *Replicator {
+	cfg.RetryInterval = 10 * time.Millisecond
+	r, err := NewReplicator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Start()
+	t.Cleanup(r.Stop)
+	return r
+}
+
+func TestReplicator_QuorumBeforeSigning(t *testing.T) {
+	ctx := context.Background()
+	c := newTestCluster(t)
+	first, second := c.startPeer(c.newDB("first")), c.startPeer(c.newDB("second"))
+	r := startReplicator(t, &Config{
+		DB: c.newDB("leader"),
+		Peers: map[string]Client{
+			"first":  c.dial(first, testToken),
+			"second": c.dial(second, testToken),
+		},
+	})
+
+	pubKey := [48]byte{1}
+	for slot := types.Slot(1); slot <= 3; slot++ {
+		if err := r.CheckAndRecord(ctx, pubKey, blockRequest(slot)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A majority of the cluster stored the records, so at least one peer has them.
+	seq1, _, err := first.db.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	seq2, _, err := second.db.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seq1 != 3 && seq2 != 3 {
+		t.Errorf("Wanted a peer to store 3 records, received %d and %d", seq1, seq2)
+	}
+
+	// Slashable requests are denied without replication.
+	req := blockRequest(1)
+	req.SigningRoot = []byte{2}
+	if err := r.CheckAndRecord(ctx, pubKey, req); !errors.Is(err, slashing.ErrSlashable) {
+		t.Errorf("Wanted %v, received %v", slashing.ErrSlashable, err)
+	}
+}
+
+func TestReplicator_NoQuorum(t *testing.T) {
+	ctx := context.Background()
+	c := newTestCluster(t)
+	peer := c.startPeer(c.newDB("peer"))
+	client := c.dial(peer, testToken)
+	peer.stop()
+	r := startReplicator(t, &Config{
+		DB:      c.newDB("leader"),
+		Peers:   map[string]Client{"peer": client},
+		Timeout: 100 * time.Millisecond,
+	})
+	if err := r.CheckAndRecord(ctx, [48]byte{1}, blockRequest(1)); !errors.Is(err, ErrNoQuorum) {
+		t.Errorf("Wanted %v, received %v", ErrNoQuorum, err)
+	}
+	// Signing the same message again still requires a quorum.
+	if err := r.CheckAndRecord(ctx, [48]byte{1}, blockRequest(1)); !errors.Is(err, ErrNoQuorum) {
+		t.Errorf("Wanted %v, received %v", ErrNoQuorum, err)
+	}
+}
+
+func TestReplicator_CatchUpLaggingPeer(t *testing.T) {
+	ctx := context.Background()
+	c := newTestCluster(t)
+	leaderDB := c.newDB("leader")
+	pubKey := [48]byte{1}
+	// Records written while the peer was away.
+	for slot := types.Slot(1); slot <= 5; slot++ {
+		if _, err := leaderDB.CheckAndAppend(ctx, pubKey, blockRequest(slot)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	peer := c.startPeer(c.newDB("peer"))
+	r := startReplicator(t, &Config{
+		DB:    leaderDB,
+		Peers: map[string]Client{"peer": c.dial(peer, testToken)},
+	})
+	if err := r.CheckAndRecord(ctx, pubKey, blockRequest(6)); err != nil {
+		t.Fatal(err)
+	}
+	seq, _, err := peer.db.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seq != 6 {
+		t.Errorf("Wanted peer caught up to sequence 6, received %d", seq)
+	}
+}
+
+func TestReplicator_Sync(t *testing.T) {
+	ctx := context.Background()
+	c := newTestCluster(t)
+	oldLeaderDB := c.newDB("old-leader")
+	pubKey := [48]byte{1}
+	for slot := types.Slot(1); slot <= 3; slot++ {
+		if _, err := oldLeaderDB.CheckAndAppend(ctx, pubKey, blockRequest(slot)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	oldLeader := c.startPeer(oldLeaderDB)
+	newLeaderDB := c.newDB("new-leader")
+	r, err := NewReplicator(&Config{
+		DB:    newLeaderDB,
+		Peers: map[string]Client{"old-leader": c.dial(oldLeader, testToken)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Sync(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	// The new leader must not sign a conflicting block for a slot signed by the old leader.
+	req := blockRequest(2)
+	req.SigningRoot = []byte{2}
+	if err := newLeaderDB.CheckAndRecord(slashing.WithFence(ctx, 1), pubKey, req); !errors.Is(err, slashing.ErrSlashable) {
+		t.Errorf("Wanted %v, received %v", slashing.ErrSlashable, err)
+	}
+}
+
+func TestReplicator_FencedPreviousLeader(t *testing.T) {
+	ctx := context.Background()
+	c := newTestCluster(t)
+	peer := c.startPeer(c.newDB("peer"))
+	oldLeader := startReplicator(t, &Config{
+		DB:      c.newDB("old-leader"),
+		Peers:   map[string]Client{"peer": c.dial(peer, testToken)},
+		Timeout: 200 * time.Millisecond,
+	})
+	if err := oldLeader.Sync(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	pubKey := [48]byte{1}
+	if err := oldLeader.CheckAndRecord(slashing.WithFence(ctx, 1), pubKey, blockRequest(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The old leader is paused while a new leader syncs with the peer,
+	// after which the old leader cannot reach a quorum anymore.
+	newLeader := startReplicator(t, &Config{
+		DB:    c.newDB("new-leader"),
+		Peers: map[string]Client{"peer": c.dial(peer, testToken)},
+	})
+	if err := newLeader.Sync(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	err := oldLeader.CheckAndRecord(slashing.WithFence(ctx, 1), pubKey, blockRequest(2))
+	if !errors.Is(err, ErrNoQuorum) {
+		t.Errorf("Wanted %v, received %v", ErrNoQuorum, err)
+	}
+	if err := newLeader.CheckAndRecord(slashing.WithFence(ctx, 2), pubKey, blockRequest(2)); err != nil {
+		t.Fatal(err)
+	}
+	seq, _, err := peer.db.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seq != 2 {
+		t.Errorf("Wanted the peer to store 2 records, received %d", seq)
+	}
+}
+
+func TestReplicator_ReconcileUnsignedRecord(t *testing.T) {
+	ctx := context.Background()
+	c := newTestCluster(t)
+	pubKey := [48]byte{1}
+	// The old leader recorded a block, but lost its lock before a quorum
+	// of peers stored it, so never signed it.
+	oldLeader := c.startPeer(c.newDB("old-leader"))
+	unsigned := blockRequest(1)
+	unsigned.SigningRoot = []byte{2}
+	if _, err := oldLeader.db.CheckAndAppend(slashing.WithFence(ctx, 1), pubKey, unsigned); err != nil {
+		t.Fatal(err)
+	}
+	oldLeader.stop()
+
+	peer := c.startPeer(c.newDB("peer"))
+	leaderDB := c.newDB("leader")
+	r := startReplicator(t, &Config{
+		DB: leaderDB,
+		Peers: map[string]Client{
+			"old-leader": c.dial(oldLeader, testToken),
+			"peer":       c.dial(peer, testToken),
+		},
+	})
+	if err := r.Sync(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.CheckAndRecord(slashing.WithFence(ctx, 2), pubKey, blockRequest(1)); err != nil {
+		t.Fatal(err)
+	}
+	want, err := leaderDB.HashAt(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Once back, the old leader replaces its record with the history of
+	// the new leader.
+	c.restartPeer(oldLeader)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		hash, err := oldLeader.db.HashAt(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(hash) == string(want) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Wanted hash %#x at sequence 1, received %#x", want, hash)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := oldLeader.db.CheckAndRecord(slashing.WithFence(ctx, 2), pubKey, unsigned); !errors.Is(err, slashing.ErrSlashable) {
+		t.Errorf("Wanted %v, received %v", slashing.ErrSlashable, err)
+	}
+}
+
+func TestDBServer_Unauthenticated(t *testing.T) {
+	ctx := context.Background()
+	c := newTestCluster(t)
+	peer := c.startPeer(c.newDB("peer"))
+	client := c.dial(peer, "wrong")
+	_, err := client.Status(ctx, &StatusRequest{})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Wanted Unauthenticated, received %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package replication
+
+import (
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/prysmaticlabs/remote-signer/slashing"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxRecordsPerRequest bounds the number of records returned by the Records method.
+const maxRecordsPerRequest = 1000
+
+// DBServer serves the replication API of a local slashing protection
+// database, to peers authenticated with the shared token.
+type DBServer struct {
+	db    *slashing.DB
+	token string
+}
+
+// NewDBServer instantiates a replication server for a slashing protection database.
+func NewDBServer(db *slashing.DB, token string) *DBServer {
+	return &DBServer{
+		db:    db,
+		token: token,
+	}
+}
+
+// Replicate applies the records streamed by a peer to the local database,
+// acknowledging each one once durably stored. The stream starts with the
+// sequence of the last local record, so the peer knows where to resume.
+// Streams of a peer whose fencing token is older than the token of a later
+// leader are rejected, so a previous leader cannot reach a quorum.
+func (s *DBServer) Replicate(stream ReplicateServer) error {
+	if err := Authenticate(stream.Context(), s.token); err != nil {
+		return err
+	}
+	token, err := fencingToken(stream.Context())
+	if err != nil {
+		return err
+	}
+	if err := s.db.RaiseFence(token); err != nil {
+		return fenceError(err)
+	}
+	seq, _, err := s.db.Head()
+	if err != nil {
+		return status.Errorf(codes.Internal, "Could not read slashing protection head: %v", err)
+	}
+	if err := stream.Send(&Ack{Sequence: seq}); err != nil {
+		return err
+	}
+	for {
+		rec, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		ack := &Ack{Sequence: rec.Sequence}
+		if err := s.db.ApplyFenced(rec, token); err != nil {
+			if errors.Is(err, slashing.ErrFenced) {
+				return fenceError(err)
+			}
+			log.WithError(err).WithField("sequence", rec.Sequence).Error("Could not apply replicated record")
+			ack.Error = err.Error()
+		}
+		if err := stream.Send(ack); err != nil {
+			return err
+		}
+	}
+}
+
+// Status returns the head of the local signing history, and the hash of a record.
+// A new leader calls it with its fencing token before syncing.
+func (s *DBServer) Status(ctx context.Context, req *StatusRequest) (*StatusResponse, error) {
+	if err := Authenticate(ctx, s.token); err != nil {
+		return nil, err
+	}
+	if req.Fence > 0 {
+		if err := s.db.RaiseFence(req.Fence); err != nil {
+			return nil, fenceError(err)
+		}
+	}
+	lastRec, err := s.db.Last()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Could not read slashing protection head: %v", err)
+	}
+	res := &StatusResponse{}
+	if lastRec != nil {
+		res.LastSequence, res.LastHash, res.LastFence = lastRec.Sequence, lastRec.Hash, lastRec.Fence
+	} else if res.LastHash, err = s.db.HashAt(0); err != nil {
+		return nil, status.Errorf(codes.Internal, "Could not read record hash: %v", err)
+	}
+	if req.Sequence <= res.LastSequence {
+		res.Hash, err = s.db.HashAt(req.Sequence)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "Could not read record hash: %v", err)
+		}
+	}
+	return res, nil
+}
+
+// Records returns records of the local signing history.
+func (s *DBServer) Records(ctx context.Context, req *RecordsRequest) (*RecordsResponse, error) {
+	if err := Authenticate(ctx, s.token); err != nil {
+		return nil, err
+	}
+	limit := req.Limit
+	if limit <= 0 || limit > maxRecordsPerRequest {
+		limit = maxRecordsPerRequest
+	}
+	records, err := s.db.Records(req.From, limit)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Could not read records: %v", err)
+	}
+	return &RecordsResponse{Records: records}, nil
+}
+
+// fenceError returns the status of a request rejected by the fence of the
+// database, or failing to update it.
+func fenceError(err error) error {
+	if errors.Is(err, slashing.ErrFenced) {
+		return status.Errorf(codes.FailedPrecondition, "Fenced: %v", err)
+	}
+	return status.Errorf(codes.Internal, "Could not update fencing token: %v", err)
+}
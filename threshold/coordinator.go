@@ -0,0 +1,294 @@
+package threshold
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	emptypb "github.com/golang/protobuf/ptypes/empty"
+	"github.com/pkg/errors"
+	"github.com/prysmaticlabs/prysm/crypto/bls"
+	"github.com/prysmaticlabs/prysm/encoding/bytesutil"
+	validatorpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1/validator-client"
+	"github.com/prysmaticlabs/remote-signer/client"
+	"github.com/prysmaticlabs/remote-signer/logging"
+	"github.com/prysmaticlabs/remote-signer/tracing"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var log = logrus.WithField("prefix", "threshold")
+
+// sharedKey is a validator key split across the peer signers.
+type sharedKey struct {
+	groupPubKey      bls.PublicKey
+	threshold        int
+	verificationKeys map[uint64]bls.PublicKey
+}
+
+// partialResult is the outcome of a sign request sent to a single peer.
+type partialResult struct {
+	index  uint64
+	sig    bls.Signature
+	denied bool
+	err    error
+}
+
+// Coordinator implements the remote signer service by fanning each
+// sign request out to the peer signers holding shares of the key, and
+// combining t valid partial signatures into the final signature.
+type Coordinator struct {
+	peers   map[uint64]validatorpb.RemoteSignerClient
+	keys    map[[48]byte]*sharedKey
+	pubKeys [][]byte
+}
+
+// NewCoordinator instantiates a coordinator for the shared keys described
+// by the key sets, using clients to the peer signers keyed by share index.
+func NewCoordinator(peers map[uint64]validatorpb.RemoteSignerClient, keySets []*KeySet) (*Coordinator, error) {
+	c := &Coordinator{
+		peers: peers,
+		keys:  make(map[[48]byte]*sharedKey, len(keySets)),
+	}
+	for _, ks := range keySets {
+		key, err := parseKeySet(ks)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid key set for %s", ks.GroupPublicKey)
+		}
+		if len(peers) < key.threshold {
+			return nil, errors.Errorf(
+				"key %s requires %d signers, only %d peers configured", ks.GroupPublicKey, key.threshold, len(peers),
+			)
+		}
+		raw := key.groupPubKey.Marshal()
+		c.keys[bytesutil.ToBytes48(raw)] = key
+		c.pubKeys = append(c.pubKeys, raw)
+	}
+	log.WithFields(logrus.Fields{
+		"numKeys":  len(c.keys),
+		"numPeers": len(peers),
+	}).Info("Initialized threshold signing coordinator")
+	return c, nil
+}
+
+// DialPeers opens TLS connections to the peer signers, presenting the client
+// certificate and bearer token of each peer if any, and returns clients keyed
+// by share index along with a function closing every connection.
+func DialPeers(peers []*Peer) (map[uint64]validatorpb.RemoteSignerClient, func() error, error) {
+	clients := make(map[uint64]validatorpb.RemoteSignerClient, len(peers))
+	conns := make([]*grpc.ClientConn, 0, len(peers))
+	closeAll := func() error {
+		var firstErr error
+		for _, conn := range conns {
+			if err := conn.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		return firstErr
+	}
+	for _, p := range peers {
+		if _, ok := clients[p.Index]; ok {
+			return nil, nil, errors.Errorf("duplicate peer for share index %d", p.Index)
+		}
+		opts, err := peerDialOptions(p)
+		if err != nil {
+			if closeErr := closeAll(); closeErr != nil {
+				log.WithError(closeErr).Error("Could not close peer connections")
+			}
+			return nil, nil, errors.Wrapf(err, "could not load credentials for peer %s", p.Address)
+		}
+		conn, err := grpc.Dial(p.Address, opts...)
+		if err != nil {
+			if closeErr := closeAll(); closeErr != nil {
+				log.WithError(closeErr).Error("Could not close peer connections")
+			}
+			return nil, nil, errors.Wrapf(err, "could not dial peer %s", p.Address)
+		}
+		conns = append(conns, conn)
+		clients[p.Index] = validatorpb.NewRemoteSignerClient(conn)
+	}
+	return clients, closeAll, nil
+}
+
+// peerDialOptions returns the credentials of a peer: TLS, mutual TLS if the
+// peer has a client certificate, and a bearer token if it has a token file.
+func peerDialOptions(p *Peer) ([]grpc.DialOption, error) {
+	if (p.TLSCertPath == "") != (p.TLSKeyPath == "") {
+		return nil, errors.New("expected both a TLS client certificate and key")
+	}
+	var creds credentials.TransportCredentials
+	var err error
+	if p.TLSCertPath != "" {
+		creds, err = client.MutualTLSCredentials(p.TLSCAPath, p.TLSCertPath, p.TLSKeyPath, p.TLSServerName)
+	} else {
+		creds, err = client.TLSCredentials(p.TLSCAPath, p.TLSServerName)
+	}
+	if err != nil {
+		return nil, err
+	}
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+	if p.TokenFile != "" {
+		enc, err := ioutil.ReadFile(p.TokenFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not read token file %s", p.TokenFile)
+		}
+		token := strings.TrimSpace(string(enc))
+		if token == "" {
+			return nil, errors.Errorf("no token found in %s", p.TokenFile)
+		}
+		opts = append(opts, grpc.WithPerRPCCredentials(client.TokenCredentials(token)))
+	}
+	return opts, nil
+}
+
+// Sign a request by collecting partial signatures from the peer signers.
+// The request is DENIED if enough peers deny it that the threshold can no
+// longer be reached, as a peer denial usually means slashing protection.
+func (c *Coordinator) Sign(ctx context.Context, req *validatorpb.SignRequest) (*validatorpb.SignResponse, error) {
+	if len(req.PublicKey) != 48 {
+		return &validatorpb.SignResponse{
+			Status: validatorpb.SignResponse_FAILED,
+		}, status.Errorf(codes.InvalidArgument, "Wrong public key byte size: %d, expected %d", len(req.PublicKey), 48)
+	}
+	key, ok := c.keys[bytesutil.ToBytes48(req.PublicKey)]
+	if !ok {
+		return &validatorpb.SignResponse{
+			Status: validatorpb.SignResponse_FAILED,
+		}, status.Errorf(codes.NotFound, "Unknown shared public key %#x", req.PublicKey)
+	}
+
+	// Forward the correlation ID and trace context of the request, so that
+	// the logs and spans of the signers are tied to those of the coordinator.
+	if id, ok := logging.RequestID(ctx); ok {
+		ctx = metadata.AppendToOutgoingContext(ctx, logging.RequestIDKey, id)
+	}
+	ctx = tracing.Inject(ctx)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan *partialResult, len(c.peers))
+	for idx, peer := range c.peers {
+		go func(idx uint64, peer validatorpb.RemoteSignerClient) {
+			results <- c.signWithPeer(ctx, idx, peer, key, req)
+		}(idx, peer)
+	}
+
+	partials := make(map[uint64]bls.Signature, key.threshold)
+	denials, failures := 0, 0
+	for received := 0; received < len(c.peers); received++ {
+		res := <-results
+		switch {
+		case res.denied:
+			denials++
+			log.WithError(res.err).WithField("peer", res.index).Warn("Peer denied partial signature")
+		case res.err != nil:
+			failures++
+			log.WithError(res.err).WithField("peer", res.index).Error("Could not get partial signature")
+		default:
+			partials[res.index] = res.sig
+		}
+		if len(partials) == key.threshold {
+			break
+		}
+		if len(c.peers)-denials-failures < key.threshold {
+			break
+		}
+	}
+	if len(partials) < key.threshold {
+		if denials > 0 {
+			return &validatorpb.SignResponse{
+				Status: validatorpb.SignResponse_DENIED,
+			}, status.Errorf(codes.PermissionDenied, "%d peers denied signing, threshold %d not reached", denials, key.threshold)
+		}
+		return &validatorpb.SignResponse{
+			Status: validatorpb.SignResponse_FAILED,
+		}, status.Errorf(codes.Unavailable, "Received %d of %d required partial signatures", len(partials), key.threshold)
+	}
+	sig, err := Combine(partials)
+	if err != nil {
+		return &validatorpb.SignResponse{
+			Status: validatorpb.SignResponse_FAILED,
+		}, status.Errorf(codes.Internal, "Could not combine partial signatures: %v", err)
+	}
+	if !sig.Verify(key.groupPubKey, req.SigningRoot) {
+		return &validatorpb.SignResponse{
+			Status: validatorpb.SignResponse_FAILED,
+		}, status.Error(codes.Internal, "Combined signature does not verify against the group public key")
+	}
+	return &validatorpb.SignResponse{
+		Signature: sig.Marshal(),
+		Status:    validatorpb.SignResponse_SUCCEEDED,
+	}, nil
+}
+
+// ListValidatingPublicKeys returns the group public keys of every shared key.
+func (c *Coordinator) ListValidatingPublicKeys(context.Context, *emptypb.Empty) (*validatorpb.ListPublicKeysResponse, error) {
+	return &validatorpb.ListPublicKeysResponse{
+		ValidatingPublicKeys: c.pubKeys,
+	}, nil
+}
+
+// signWithPeer requests a partial signature from a peer, and verifies it
+// against the verification key of the share held by the peer.
+func (c *Coordinator) signWithPeer(
+	ctx context.Context, idx uint64, peer validatorpb.RemoteSignerClient, key *sharedKey, req *validatorpb.SignRequest,
+) *partialResult {
+	vk, ok := key.verificationKeys[idx]
+	if !ok {
+		return &partialResult{index: idx, err: fmt.Errorf("no verification key for share %d", idx)}
+	}
+	res, err := peer.Sign(ctx, req)
+	if err != nil {
+		return &partialResult{index: idx, err: err, denied: status.Code(err) == codes.PermissionDenied}
+	}
+	switch res.Status {
+	case validatorpb.SignResponse_SUCCEEDED:
+	case validatorpb.SignResponse_DENIED:
+		return &partialResult{index: idx, denied: true, err: errors.New("signing denied")}
+	default:
+		return &partialResult{index: idx, err: fmt.Errorf("unexpected response status %s", res.Status)}
+	}
+	sig, err := bls.SignatureFromBytes(res.Signature)
+	if err != nil {
+		return &partialResult{index: idx, err: errors.Wrap(err, "could not parse partial signature")}
+	}
+	if !sig.Verify(vk, req.SigningRoot) {
+		return &partialResult{index: idx, err: errors.New("partial signature does not verify against share verification key")}
+	}
+	return &partialResult{index: idx, sig: sig}
+}
+
+func parseKeySet(ks *KeySet) (*sharedKey, error) {
+	raw, err := DecodeHex(ks.GroupPublicKey, 48)
+	if err != nil {
+		return nil, err
+	}
+	groupPubKey, err := bls.PublicKeyFromBytes(raw)
+	if err != nil {
+		return nil, err
+	}
+	if ks.Threshold < 1 || len(ks.VerificationKeys) < ks.Threshold {
+		return nil, errors.Errorf("invalid threshold %d of %d shares", ks.Threshold, len(ks.VerificationKeys))
+	}
+	key := &sharedKey{
+		groupPubKey:      groupPubKey,
+		threshold:        ks.Threshold,
+		verificationKeys: make(map[uint64]bls.PublicKey, len(ks.VerificationKeys)),
+	}
+	for idx, hexKey := range ks.VerificationKeys {
+		raw, err := DecodeHex(hexKey, 48)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid verification key for share %d", idx)
+		}
+		vk, err := bls.PublicKeyFromBytes(raw)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid verification key for share %d", idx)
+		}
+		key.verificationKeys[idx] = vk
+	}
+	return key, nil
+}
@@ -0,0 +1,167 @@
+package threshold_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	emptypb "github.com/golang/protobuf/ptypes/empty"
+	"github.com/prysmaticlabs/prysm/crypto/bls"
+	validatorpb "github.com/prysmaticlabs/prysm/proto/prysm/v1alpha1/validator-client"
+	"github.com/prysmaticlabs/remote-signer/keyvault/shares"
+	"github.com/prysmaticlabs/remote-signer/rpc"
+	"github.com/prysmaticlabs/remote-signer/threshold"
+	"google.golang.org/grpc"
+)
+
+// localPeer calls an in-process remote signer as if it was a gRPC client.
+type localPeer struct {
+	signer validatorpb.RemoteSignerServer
+}
+
+func (l *localPeer) ListValidatingPublicKeys(
+	ctx context.Context, in *emptypb.Empty, _ ...grpc.CallOption,
+) (*validatorpb.ListPublicKeysResponse, error) {
+	return l.signer.ListValidatingPublicKeys(ctx, in)
+}
+
+func (l *localPeer) Sign(ctx context.Context, in *validatorpb.SignRequest, _ ...grpc.CallOption) (*validatorpb.SignResponse, error) {
+	return l.signer.Sign(ctx, in)
+}
+
+func TestCoordinator_Sign(t *testing.T) {
+	ctx := context.Background()
+	secretKey, err := bls.RandKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	groupPubKey := secretKey.PublicKey()
+	keyShares, err := threshold.Split(secretKey, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "threshold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	// Start one in-process signer per share, the last one is unreachable.
+	peers := make(map[uint64]validatorpb.RemoteSignerClient)
+	for _, share := range keyShares {
+		shareDir := filepath.Join(dir, strconv.Itoa(int(share.Index)))
+		if err := os.MkdirAll(shareDir, 0700); err != nil {
+			t.Fatal(err)
+		}
+		enc, err := json.Marshal(threshold.NewShareFile(groupPubKey, 2, share))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(shareDir, "share.json"), enc, 0600); err != nil {
+			t.Fatal(err)
+		}
+		store, err := shares.NewStore(shareDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if share.Index == 3 {
+			if err := store.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		peers[share.Index] = &localPeer{signer: rpc.NewRemoteSigner(ctx, store)}
+	}
+
+	c, err := threshold.NewCoordinator(peers, []*threshold.KeySet{threshold.NewKeySet(groupPubKey, 2, keyShares)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := c.ListValidatingPublicKeys(ctx, &emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys.ValidatingPublicKeys) != 1 || string(keys.ValidatingPublicKeys[0]) != string(groupPubKey.Marshal()) {
+		t.Fatal("Expected coordinator to list the group public key")
+	}
+
+	root := make([]byte, 32)
+	copy(root, "signing root")
+	res, err := c.Sign(ctx, &validatorpb.SignRequest{
+		PublicKey:   groupPubKey.Marshal(),
+		SigningRoot: root,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != validatorpb.SignResponse_SUCCEEDED {
+		t.Fatalf("Wanted %v, received %v", validatorpb.SignResponse_SUCCEEDED, res.Status)
+	}
+	if string(res.Signature) != string(secretKey.Sign(root).Marshal()) {
+		t.Error("Combined signature does not match the signature of the secret key")
+	}
+
+	_, err = c.Sign(ctx, &validatorpb.SignRequest{
+		PublicKey:   secretKey.PublicKey().Marshal()[:47],
+		SigningRoot: root,
+	})
+	if err == nil {
+		t.Error("Expected error with malformed public key")
+	}
+}
+
+func TestDialPeers_Credentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "threshold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}()
+	tokenFile := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ca, cert, key := "../ca.crt", "../example-server.crt", "../example-server.key"
+	tests := []struct {
+		name    string
+		peer    *threshold.Peer
+		wantErr bool
+	}{
+		{name: "tls", peer: &threshold.Peer{TLSCAPath: ca}},
+		{name: "mutual tls and token", peer: &threshold.Peer{
+			TLSCAPath: ca, TLSCertPath: cert, TLSKeyPath: key, TokenFile: tokenFile,
+		}},
+		{name: "certificate without key", peer: &threshold.Peer{TLSCAPath: ca, TLSCertPath: cert}, wantErr: true},
+		{name: "missing token file", peer: &threshold.Peer{
+			TLSCAPath: ca, TokenFile: filepath.Join(dir, "missing"),
+		}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.peer.Index, tt.peer.Address = 1, "localhost:4000"
+			_, closePeers, err := threshold.DialPeers([]*threshold.Peer{tt.peer})
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Wanted error, received nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := closePeers(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package threshold
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/prysmaticlabs/prysm/crypto/bls"
+)
+
+// ShareFile is the JSON file holding the secret key share of one
+// validator key, as loaded by a signer running in threshold mode.
+//
+// WARN: secret shares are stored unencrypted, NOT MEANT FOR PRODUCTION.
+type ShareFile struct {
+	GroupPublicKey string `json:"group_public_key"`
+	Threshold      int    `json:"threshold"`
+	Index          uint64 `json:"index"`
+	SecretShare    string `json:"secret_share"`
+}
+
+// KeySet is the JSON file describing a shared validator key to a
+// coordinator: the group public key the combined signatures verify
+// against, and the verification key of each share by share index.
+type KeySet struct {
+	GroupPublicKey   string            `json:"group_public_key"`
+	Threshold        int               `json:"threshold"`
+	VerificationKeys map[uint64]string `json:"verification_keys"`
+}
+
+// Peer describes how a coordinator connects to the signer holding the share at Index.
+type Peer struct {
+	Index         uint64 `json:"index"`
+	Address       string `json:"address"`
+	TLSCAPath     string `json:"tls_ca_path"`
+	TLSServerName string `json:"tls_server_name,omitempty"`
+	// TLSCertPath and TLSKeyPath, if set, are the client certificate the
+	// coordinator presents to a peer requiring mutual TLS.
+	TLSCertPath string `json:"tls_cert_path,omitempty"`
+	TLSKeyPath  string `json:"tls_key_path,omitempty"`
+	// TokenFile, if set, holds the bearer token the coordinator
+	// authenticates with to a peer requiring tokens.
+	TokenFile string `json:"token_file,omitempty"`
+}
+
+// NewShareFile encodes the share of a validator key held by a single signer.
+func NewShareFile(groupPubKey bls.PublicKey, threshold int, share *Share) *ShareFile {
+	return &ShareFile{
+		GroupPublicKey: fmt.Sprintf("%#x", groupPubKey.Marshal()),
+		Threshold:      threshold,
+		Index:          share.Index,
+		SecretShare:    fmt.Sprintf("%#x", share.SecretKey.Marshal()),
+	}
+}
+
+// NewKeySet encodes the verification keys of all shares of a validator key.
+func NewKeySet(groupPubKey bls.PublicKey, threshold int, shares []*Share) *KeySet {
+	vks := make(map[uint64]string, len(shares))
+	for _, share := range shares {
+		vks[share.Index] = fmt.Sprintf("%#x", share.VerificationKey().Marshal())
+	}
+	return &KeySet{
+		GroupPublicKey:   fmt.Sprintf("%#x", groupPubKey.Marshal()),
+		Threshold:        threshold,
+		VerificationKeys: vks,
+	}
+}
+
+// LoadShareFiles reads every share file with a .json extension in a directory.
+func LoadShareFiles(dir string) ([]*ShareFile, error) {
+	var files []*ShareFile
+	err := loadJSONFiles(dir, func() interface{} {
+		f := &ShareFile{}
+		files = append(files, f)
+		return f
+	})
+	return files, err
+}
+
+// LoadKeySets reads every key set file with a .json extension in a directory.
+func LoadKeySets(dir string) ([]*KeySet, error) {
+	var keySets []*KeySet
+	err := loadJSONFiles(dir, func() interface{} {
+		k := &KeySet{}
+		keySets = append(keySets, k)
+		return k
+	})
+	return keySets, err
+}
+
+// LoadPeers reads the JSON list of peer signers used by a coordinator.
+func LoadPeers(path string) ([]*Peer, error) {
+	enc, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read peers file %s", path)
+	}
+	var peers []*Peer
+	if err := json.Unmarshal(enc, &peers); err != nil {
+		return nil, errors.Wrapf(err, "could not parse peers file %s", path)
+	}
+	return peers, nil
+}
+
+func loadJSONFiles(dir string, next func() interface{}) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		enc, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "could not read %s", path)
+		}
+		if err := json.Unmarshal(enc, next()); err != nil {
+			return errors.Wrapf(err, "could not parse %s", path)
+		}
+	}
+	return nil
+}
+
+// DecodeHex decodes a 0x prefixed hex string of an expected byte length.
+func DecodeHex(s string, wantLen int) ([]byte, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != wantLen {
+		return nil, errors.Errorf("wrong byte length %d, expected %d", len(b), wantLen)
+	}
+	return b, nil
+}
@@ -0,0 +1,172 @@
+/*
+Package threshold implements t-of-n threshold BLS signing for distributed
+validators. A validator secret key is split into Shamir shares, each held by
+a different signer instance which returns partial signatures. A coordinator
+collects t valid partial signatures and combines them into the signature
+of the original key using Lagrange interpolation in the exponent.
+
+Note: this implementation is meant to be a reference, the dealer splitting a
+key briefly holds the whole secret key in memory.
+*/
+package threshold
+
+import (
+	"crypto/rand"
+	"math/big"
+
+	"github.com/pkg/errors"
+	"github.com/prysmaticlabs/prysm/crypto/bls"
+)
+
+// curveOrder is the order r of the BLS12-381 scalar field.
+var curveOrder, _ = new(big.Int).SetString(
+	"73eda753299d7d483339d80809a1d80553bda402fffe5bfeffffffff00000001", 16,
+)
+
+const secretKeyLength = 32
+
+// Share is the secret key share held by a single signer, along
+// with its index which is the x coordinate of the share.
+type Share struct {
+	Index     uint64
+	SecretKey bls.SecretKey
+}
+
+// VerificationKey returns the public key of the share, against
+// which partial signatures produced with the share are verified.
+func (s *Share) VerificationKey() bls.PublicKey {
+	return s.SecretKey.PublicKey()
+}
+
+// Split a secret key into n shares, such that any t of them can be
+// combined to produce signatures for the public key of the secret key.
+// Shares are assigned indices 1 to n.
+func Split(secretKey bls.SecretKey, t, n int) ([]*Share, error) {
+	if t < 1 || n < t {
+		return nil, errors.Errorf("invalid threshold %d of %d shares", t, n)
+	}
+	// The polynomial f(x) = a_0 + a_1*x + ... + a_{t-1}*x^{t-1}
+	// has the secret key as its constant term.
+	coefficients := make([]*big.Int, t)
+	coefficients[0] = new(big.Int).SetBytes(secretKey.Marshal())
+	for i := 1; i < t; i++ {
+		c, err := rand.Int(rand.Reader, curveOrder)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not generate polynomial coefficient")
+		}
+		coefficients[i] = c
+	}
+	defer func() {
+		for _, c := range coefficients {
+			c.SetInt64(0)
+		}
+	}()
+	shares := make([]*Share, n)
+	for i := 1; i <= n; i++ {
+		y := evaluate(coefficients, big.NewInt(int64(i)))
+		if y.Sign() == 0 {
+			// A zero share is not a valid secret key, this happens with negligible
+			// probability and simply requires drawing a new polynomial.
+			return Split(secretKey, t, n)
+		}
+		sk, err := bls.SecretKeyFromBytes(scalarBytes(y))
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not create secret key share %d", i)
+		}
+		shares[i-1] = &Share{
+			Index:     uint64(i),
+			SecretKey: sk,
+		}
+	}
+	return shares, nil
+}
+
+// Combine partial signatures, keyed by share index, into the signature of
+// the shared secret key. Exactly the threshold number of partial signatures
+// should be provided, and each must have been verified against the
+// verification key of its share beforehand.
+func Combine(partials map[uint64]bls.Signature) (bls.Signature, error) {
+	if len(partials) == 0 {
+		return nil, errors.New("no partial signatures to combine")
+	}
+	indices := make([]uint64, 0, len(partials))
+	for idx := range partials {
+		if idx == 0 {
+			return nil, errors.New("share index 0 is not valid")
+		}
+		indices = append(indices, idx)
+	}
+	terms := make([]bls.Signature, 0, len(partials))
+	for _, idx := range indices {
+		lambda := lagrangeCoefficient(idx, indices)
+		term, err := multiply(partials[idx], lambda)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not weigh partial signature %d", idx)
+		}
+		terms = append(terms, term)
+	}
+	return bls.AggregateSignatures(terms), nil
+}
+
+// lagrangeCoefficient returns the Lagrange basis polynomial of index i
+// evaluated at zero, prod_{j != i} j / (j - i) mod r.
+func lagrangeCoefficient(i uint64, indices []uint64) *big.Int {
+	num := big.NewInt(1)
+	den := big.NewInt(1)
+	xi := new(big.Int).SetUint64(i)
+	for _, j := range indices {
+		if j == i {
+			continue
+		}
+		xj := new(big.Int).SetUint64(j)
+		num.Mul(num, xj)
+		num.Mod(num, curveOrder)
+		diff := new(big.Int).Sub(xj, xi)
+		den.Mul(den, diff)
+		den.Mod(den, curveOrder)
+	}
+	den.ModInverse(den, curveOrder)
+	return num.Mul(num, den).Mod(num, curveOrder)
+}
+
+// multiply computes the scalar multiplication of a signature point using
+// double-and-add, relying on point addition through signature aggregation.
+func multiply(sig bls.Signature, scalar *big.Int) (bls.Signature, error) {
+	if scalar.Sign() == 0 {
+		return nil, errors.New("cannot multiply by zero")
+	}
+	var acc bls.Signature
+	for i := scalar.BitLen() - 1; i >= 0; i-- {
+		if acc != nil {
+			acc = bls.AggregateSignatures([]bls.Signature{acc, acc})
+		}
+		if scalar.Bit(i) == 1 {
+			if acc == nil {
+				acc = sig
+			} else {
+				acc = bls.AggregateSignatures([]bls.Signature{acc, sig})
+			}
+		}
+	}
+	return acc, nil
+}
+
+// evaluate the polynomial with the given coefficients at x, modulo r.
+func evaluate(coefficients []*big.Int, x *big.Int) *big.Int {
+	// Horner's method.
+	y := new(big.Int)
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		y.Mul(y, x)
+		y.Add(y, coefficients[i])
+		y.Mod(y, curveOrder)
+	}
+	return y
+}
+
+// scalarBytes returns the 32 byte big-endian encoding of a scalar.
+func scalarBytes(s *big.Int) []byte {
+	b := make([]byte, secretKeyLength)
+	raw := s.Bytes()
+	copy(b[secretKeyLength-len(raw):], raw)
+	return b
+}
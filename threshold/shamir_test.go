@@ -0,0 +1,97 @@
+package threshold
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/prysmaticlabs/prysm/crypto/bls"
+)
+
+func TestSplitCombine(t *testing.T) {
+	secretKey, err := bls.RandKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	shares, err := Split(secretKey, 3, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shares) != 5 {
+		t.Fatalf("Wanted 5 shares, received %d", len(shares))
+	}
+	msg := []byte("signing root")
+	want := secretKey.Sign(msg).Marshal()
+
+	subsets := [][]int{{0, 1, 2}, {1, 3, 4}, {4, 0, 2}}
+	for _, subset := range subsets {
+		partials := make(map[uint64]bls.Signature)
+		for _, i := range subset {
+			sig := shares[i].SecretKey.Sign(msg)
+			if !sig.Verify(shares[i].VerificationKey(), msg) {
+				t.Fatalf("Partial signature %d does not verify against its verification key", shares[i].Index)
+			}
+			partials[shares[i].Index] = sig
+		}
+		sig, err := Combine(partials)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(sig.Marshal()) != string(want) {
+			t.Errorf("Combined signature of shares %v does not match the signature of the secret key", subset)
+		}
+		if !sig.Verify(secretKey.PublicKey(), msg) {
+			t.Errorf("Combined signature of shares %v does not verify", subset)
+		}
+	}
+}
+
+func TestCombine_BelowThreshold(t *testing.T) {
+	secretKey, err := bls.RandKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	shares, err := Split(secretKey, 3, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := []byte("signing root")
+	partials := map[uint64]bls.Signature{
+		shares[0].Index: shares[0].SecretKey.Sign(msg),
+		shares[1].Index: shares[1].SecretKey.Sign(msg),
+	}
+	sig, err := Combine(partials)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig.Verify(secretKey.PublicKey(), msg) {
+		t.Error("Expected signature combined below threshold to not verify")
+	}
+}
+
+func TestSplit_InvalidThreshold(t *testing.T) {
+	secretKey, err := bls.RandKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Split(secretKey, 0, 3); err == nil {
+		t.Error("Expected error with zero threshold")
+	}
+	if _, err := Split(secretKey, 4, 3); err == nil {
+		t.Error("Expected error with threshold above number of shares")
+	}
+}
+
+func TestLagrangeCoefficient(t *testing.T) {
+	// Interpolating f(x) = 5 + 3x through points 1 and 2 yields f(0) = 5.
+	indices := []uint64{1, 2}
+	f := func(x int64) *big.Int { return big.NewInt(5 + 3*x) }
+	got := new(big.Int)
+	for _, i := range indices {
+		term := new(big.Int).Mul(f(int64(i)), lagrangeCoefficient(i, indices))
+		got.Add(got, term)
+	}
+	got.Mod(got, curveOrder)
+	if got.Cmp(big.NewInt(5)) != 0 {
+		t.Errorf("Wanted 5, received %s", got)
+	}
+}
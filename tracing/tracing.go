@@ -0,0 +1,163 @@
+/*
+Package tracing records OpenTelemetry traces of the requests served, so that
+the latency of a signature can be broken down into its steps, such as the
+signing policy, the slashing protection database or the keyvault. Spans are
+exported in batches to an OpenTelemetry collector with the OTLP/HTTP
+protocol, and the trace context of callers is honoured in the W3C
+traceparent format, so that the spans of a validator client and of the
+remote signer belong to the same trace.
+
+Spans are started with the global OpenTelemetry tracer provider, which
+records nothing until a provider is installed with NewProvider.
+*/
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var log = logrus.WithField("prefix", "tracing")
+
+// DefaultServiceName identifies the remote signer in the traces.
+const DefaultServiceName = "remote-signer"
+
+// instrumentationName is the name of the tracer of the remote signer.
+const instrumentationName = "github.com/prysmaticlabs/remote-signer"
+
+// tracesPath is the path of the OTLP/HTTP traces receiver of a collector.
+const tracesPath = "/v1/traces"
+
+// Config of a tracer provider.
+type Config struct {
+	// Endpoint is the base URL of the OTLP/HTTP receiver of a collector,
+	// such as http://localhost:4318, spans being posted to /v1/traces.
+	Endpoint string
+	// ServiceName identifies the remote signer in the traces.
+	ServiceName string
+	// SampleRatio is the share of the traces started by the remote signer
+	// which are recorded, from 0 to 1. Traces started by callers are
+	// recorded if the caller sampled them.
+	SampleRatio float64
+}
+
+// Provider records spans and exports them to a collector.
+type Provider struct {
+	tp *sdktrace.TracerProvider
+}
+
+// NewProvider instantiates a tracer provider exporting to the collector of
+// the configuration, and installs it as the global tracer provider. Spans
+// which could not be exported are logged and dropped.
+func NewProvider(ctx context.Context, cfg *Config) (*Provider, error) {
+	if cfg.SampleRatio < 0 || cfg.SampleRatio > 1 {
+		return nil, errors.Errorf("sample ratio %v is not between 0 and 1", cfg.SampleRatio)
+	}
+	opts, err := exporterOptions(cfg.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create OTLP exporter")
+	}
+	serviceName := cfg.ServiceName
+	if serviceName == "" {
+		serviceName = DefaultServiceName
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(serviceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		log.WithError(err).Warn("Could not export spans")
+	}))
+	otel.SetTracerProvider(tp)
+	return &Provider{tp: tp}, nil
+}
+
+// exporterOptions returns the options of the OTLP/HTTP exporter posting to
+// the traces receiver of a collector at a base URL.
+func exporterOptions(endpoint string) ([]otlptracehttp.Option, error) {
+	if endpoint == "" {
+		return nil, errors.New("expected an OTLP endpoint")
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not parse OTLP endpoint %s", endpoint)
+	}
+	if u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, errors.Errorf("OTLP endpoint %s is not an http or https URL", endpoint)
+	}
+	path := strings.TrimSuffix(u.Path, "/")
+	if !strings.HasSuffix(path, tracesPath) {
+		path += tracesPath
+	}
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(u.Host),
+		otlptracehttp.WithURLPath(path),
+	}
+	if u.Scheme == "http" {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	return opts, nil
+}
+
+// Shutdown exports the remaining spans, and stops the provider.
+func (p *Provider) Shutdown(ctx context.Context) error {
+	return p.tp.Shutdown(ctx)
+}
+
+// Start starts a span, the child of the current span of the context or
+// else of the span context received from the caller. It returns a context
+// carrying the new span, and the span to end with End.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+}
+
+// End ends a span, recording it as failed if err is not nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Attribute returns the attribute of a key and value. Values are recorded as
+// strings, booleans, integers or floats according to their kind, anything
+// else as a string.
+func Attribute(key string, value interface{}) attribute.KeyValue {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.String:
+		return attribute.String(key, v.String())
+	case reflect.Bool:
+		return attribute.Bool(key, v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return attribute.Int64(key, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v.Uint() <= math.MaxInt64 {
+			return attribute.Int64(key, int64(v.Uint()))
+		}
+	case reflect.Float32, reflect.Float64:
+		return attribute.Float64(key, v.Float())
+	}
+	return attribute.String(key, fmt.Sprint(value))
+}
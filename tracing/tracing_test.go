@@ -0,0 +1,114 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+)
+
+const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// recordSpans installs a tracer provider sampling none of the traces it
+// starts, and recording the spans of the others.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(recorder),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.NeverSample())),
+	)
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(trace.NewNoopTracerProvider())
+	})
+	return recorder
+}
+
+func TestStart_TraceOfCaller(t *testing.T) {
+	recorder := recordSpans(t)
+
+	// The trace of the caller is sampled, although the provider samples
+	// none of the traces it starts.
+	incoming := metadata.NewIncomingContext(context.Background(), metadata.Pairs("traceparent", traceparent))
+	ctx, server := Start(Extract(incoming), "Sign", trace.WithSpanKind(trace.SpanKindServer))
+	_, child := Start(ctx, "keyvault.GetSecretKey")
+	child.SetAttributes(Attribute("slot", uint64(42)))
+	End(child, errors.New("unavailable"))
+	End(server, nil)
+
+	_, unsampled := Start(context.Background(), "unsampled")
+	End(unsampled, nil)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Wanted 2 spans recorded, received %d", len(spans))
+	}
+	got, parent := spans[0], spans[1]
+	if got.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" ||
+		parent.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Error("Wanted spans in the trace of the caller")
+	}
+	if got.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Error("Wanted child span of the server span")
+	}
+	if got.Status().Code != codes.Error || got.Status().Description != "unavailable" {
+		t.Errorf("Wanted failed span, received %+v", got.Status())
+	}
+	if attrs := got.Attributes(); len(attrs) != 1 || attrs[0].Value.AsInt64() != 42 {
+		t.Errorf("Unexpected attributes %+v", attrs)
+	}
+
+	// The trace context is forwarded to the processes called.
+	md, _ := metadata.FromOutgoingContext(Inject(ctx))
+	if values := md.Get("traceparent"); len(values) != 1 || values[0][:36] != traceparent[:36] {
+		t.Errorf("Wanted traceparent of the trace of the caller, received %v", values)
+	}
+}
+
+func TestNewProvider_Export(t *testing.T) {
+	var posts int32
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		atomic.AddInt32(&posts, 1)
+	}))
+	defer collector.Close()
+
+	ctx := context.Background()
+	p, err := NewProvider(ctx, &Config{Endpoint: collector.URL, SampleRatio: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+	_, span := Start(ctx, "Sign")
+	End(span, nil)
+	// Shutting down exports the remaining spans.
+	if err := p.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&posts) == 0 {
+		t.Error("Wanted spans exported to the collector")
+	}
+}
+
+func TestNewProvider_InvalidConfig(t *testing.T) {
+	for _, cfg := range []*Config{
+		{},
+		{Endpoint: "localhost:4318"},
+		{Endpoint: "http://localhost:4318", SampleRatio: 2},
+	} {
+		if _, err := NewProvider(context.Background(), cfg); err == nil {
+			t.Errorf("Wanted error for %+v", cfg)
+		}
+	}
+}